@@ -9,6 +9,12 @@ const (
     InvTypeError = 0
     InvTypeTx = 1
     InvTypeBlock = 2
+    // Asks for a block as "cmpctblock" (BIP152)
+    InvTypeCmpctBlock = 4
+    // Set on InvTypeTx and InvTypeBlock to ask for witness data (BIP144)
+    InvTypeWitnessFlag = 1 << 30
+    InvTypeWitnessTx = InvTypeTx | InvTypeWitnessFlag
+    InvTypeWitnessBlock = InvTypeBlock | InvTypeWitnessFlag
 )
 
 type InvElement struct {
@@ -29,5 +35,5 @@ func Destroy() error {
 func GetInvElem(h int) *InvElement {
     headers := storage.Get().Headers()
     header := headers.Get(h)
-    return &InvElement{InvTypeBlock, *(header.Hash())}
+    return &InvElement{InvTypeWitnessBlock, *(header.Hash())}
 }
\ No newline at end of file
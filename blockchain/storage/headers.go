@@ -5,71 +5,227 @@ import (
     "os"
     "fmt"
     "sync"
+    "time"
     "errors"
+    "math/big"
     "encoding/binary"
     "github.com/oxfeeefeee/kaiju/log"
     "github.com/oxfeeefeee/kaiju/catma"
     "github.com/oxfeeefeee/kaiju/klib"
 )
 
+// Size of a header in the headers file
+var headerSize = binary.Size(catma.Header{})
+
+// Validates a header before it's added, replaced by tests to skip proof of work
+var checkHeader = catma.CheckHeader
+
+// Returned by Append for a header of a block marked invalid, or after one
+var ErrInvalidChain = errors.New("headers.Append: header of an invalid chain")
+
+var errInvalidateGenesis = errors.New("headers.Invalidate: genesis can't be invalid")
+
+var errInvalidateUnknown = errors.New("headers.Invalidate: unknown header")
+
+// A change of the best header chain that is not a simple extension.
+type Reorg struct {
+    // Height of the last header both chains share
+    Fork            int
+    // Headers removed from the best chain, from low to high
+    Disconnected    []*catma.Header
+    // Headers added to the best chain, from low to high
+    Connected       []*catma.Header
+}
+
+// Called when the best chain is reorganized, after Append has released the lock.
+type ReorgHandler func(r *Reorg)
+
+// Called when the best header changes, after Append has released the lock.
+type TipHandler func(tip *catma.Header, height int)
+
+// Position of a node in the KTree
+type treePos struct {
+    depth       int
+    index       int
+}
+
+// Value of KTree nodes
+type headerNode struct {
+    header      *catma.Header
+    hash        klib.Hash256
+    // Total work of the chain up to and including this header
+    work        *big.Int
+    pos         treePos
+    // The block or one before it failed to verify
+    invalid     bool
+}
+
+// All known headers are kept in a KTree, with the depth of a node being its height.
+// The chain with most work is the best chain, which is also what's saved in file.
+// Side chains live only in memory.
 type headers struct {
-    data    []*catma.Header
-    mutex   sync.RWMutex
-    file    *os.File
+    tree        *klib.KTree
+    index       map[klib.Hash256]*headerNode
+    // The best chain
+    data        []*headerNode
+    // Roots of side branches, i.e. nodes off the best chain with parents on it
+    forks       map[*headerNode]bool
+    handlers    []ReorgHandler
+    tipHandlers []TipHandler
+    mutex       sync.RWMutex
+    file        *os.File
 }
 
 func newHeaders(f *os.File) *headers {
+    g := genesisHeader()
+    root := &headerNode{g, *g.Hash(), catma.BlockWork(g.Bits), treePos{0, 0}, false}
     return &headers{
-        data :[]*catma.Header{genesisHeader()},
+        tree: klib.NewKTree(root),
+        index: map[klib.Hash256]*headerNode{root.hash: root},
+        data: []*headerNode{root},
+        forks: make(map[*headerNode]bool),
         file : f,
     }
 }
 
 func (h *headers) Len() int {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
     return len(h.data)
 }
 
-// Get the hash of block with height "height"
+// Get the header of block with height "height" on the best chain
 func (h *headers) Get(height int) *catma.Header {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+    return h.get(height)
+}
+
+// Total work of the best chain up to "height", nil if out of range
+func (h *headers) Work(height int) *big.Int {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
     if height < 0 || height >= len(h.data) {
         return nil
     }
-    return h.data[height]
+    return new(big.Int).Set(h.data[height].work)
+}
+
+// Returns the height of header with "hash" if it's on the best chain
+func (h *headers) Height(hash *klib.Hash256) (int, bool) {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+    n := h.index[*hash]
+    if n == nil || !h.onBest(n) {
+        return 0, false
+    }
+    return n.pos.depth, true
 }
 
-// Append downloaded headers.
-// TODO: more robust way of getting old blocks
+// Registers a handler to be called when the best chain gets reorganized
+func (h *headers) OnReorg(f ReorgHandler) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+    h.handlers = append(h.handlers, f)
+}
+
+// Registers a handler to be called when the best header changes
+func (h *headers) OnTip(f TipHandler) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+    h.tipHandlers = append(h.tipHandlers, f)
+}
+
+// Append downloaded headers, they don't have to extend the best chain.
 func (h *headers) Append(hs []*catma.Header) error {
     if len(hs) == 0 {
         return nil
     }
-    oldL := len(h.data) - 1 // excluding genesis
+    h.mutex.Lock()
+    oldTip := h.data[len(h.data)-1]
+    // Lowest height of the best chain that has changed
+    dirty := len(h.data)
+    reorgs := make([]*Reorg, 0)
+    var lastError error
     for _, header := range hs {
-        err := h.appendHeader(header)
+        from, r, err := h.appendHeader(header)
         if err != nil {
-            return err
+            lastError = err
+            break
+        }
+        if from < dirty {
+            dirty = from
+        }
+        if r != nil {
+            reorgs = append(reorgs, r)
         }
-    } 
-    // Write to file as well
-    f := h.file
-    // Caclulate the offset
-    offset := int64(binary.Size(hs[0]) * oldL)
-    _, err := f.Seek(offset, 0)
-    if err != nil {
-        return err
     }
-    for _, header := range hs {
-        err := binary.Write(f, binary.LittleEndian, header)
-        if err != nil {
-            return err
+    h.prune()
+    err := h.save(dirty)
+    l := len(h.data)
+    handlers := h.handlers
+    tip := h.data[l-1]
+    tipHandlers := h.tipHandlers
+    h.mutex.Unlock()
+
+    log.Infof("Headers total: %v", l)
+    for _, r := range reorgs {
+        log.Infof("Reorg at height %d, %d headers disconnected, %d connected",
+            r.Fork, len(r.Disconnected), len(r.Connected))
+        for _, f := range handlers {
+            f(r)
         }
     }
-    log.Infof("Headers total: %v", len(h.data))
-    return f.Sync()
+    if tip != oldTip {
+        for _, f := range tipHandlers {
+            f(tip.header, tip.pos.depth)
+        }
+    }
+    if lastError != nil {
+        return lastError
+    }
+    return err
+}
+
+// Marks the block with "hash" invalid, along with the blocks after it. If it's
+// on the best chain, the valid chain with most work becomes the best instead.
+func (h *headers) Invalidate(hash *klib.Hash256) error {
+    h.mutex.Lock()
+    n := h.index[*hash]
+    if n == nil {
+        h.mutex.Unlock()
+        return errInvalidateUnknown
+    } else if n.pos.depth == 0 {
+        h.mutex.Unlock()
+        return errInvalidateGenesis
+    }
+    for _, s := range h.subtree(n) {
+        s.invalid = true
+    }
+    if !h.onBest(n) {
+        h.mutex.Unlock()
+        return nil
+    }
+    r := h.switchTo(h.bestValid(h.parent(n)))
+    err := h.save(r.Fork + 1)
+    handlers := h.handlers
+    tip := h.data[len(h.data)-1]
+    tipHandlers := h.tipHandlers
+    h.mutex.Unlock()
+
+    log.Infof("Block %s invalid, reorg at height %d, %d headers disconnected, %d connected",
+        hash, r.Fork, len(r.Disconnected), len(r.Connected))
+    for _, f := range handlers {
+        f(r)
+    }
+    for _, f := range tipHandlers {
+        f(tip.header, tip.pos.depth)
+    }
+    return err
 }
 
 // Locator is a list of hashes of currently downloaded headers,
-// Used to show other peers what we have and what are missing. 
+// Used to show other peers what we have and what are missing.
 func (h *headers) GetLocator() []*klib.Hash256 {
     h.mutex.RLock()
     defer h.mutex.RUnlock()
@@ -77,8 +233,9 @@ func (h *headers) GetLocator() []*klib.Hash256 {
     ind := locatorIndices(len(d) - 1)
     ltor := make([]*klib.Hash256, 0, len(ind))
     for _, v := range ind {
-        ltor = append(ltor, d[v].Hash())
-    }    
+        hash := d[v].hash
+        ltor = append(ltor, &hash)
+    }
     return ltor
 }
 
@@ -86,10 +243,12 @@ func (h *headers) GetLocator() []*klib.Hash256 {
 // Errors are not returned to caller, simply print a log
 func (h *headers) loadHeaders() {
     r := h.file
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
     for {
         ch := new(catma.Header)
         if err := binary.Read(r, binary.LittleEndian, ch); err == nil {
-            if err = h.appendHeader(ch); err != nil {
+            if _, _, err = h.appendHeader(ch); err != nil {
                 log.Infof("Error loading block header: %s", err)
                 break;
             }
@@ -103,20 +262,251 @@ func (h *headers) loadHeaders() {
     log.Infof("Loaded header count: %v", len(h.data))
 }
 
-// Append new block header, the chain always at least has genesis in it.
-func (h *headers) appendHeader(ch *catma.Header) error {
-    h.mutex.Lock()
-    defer h.mutex.Unlock()
-    d := h.data
-    // Search back if the latest one doesn't match
-    for i := len(d) - 1; i >=0; i-- {
-        if *(d[len(d)-1].Hash()) == ch.PrevBlock {
-            h.data = append(d[:i+1], ch)
-            return nil
+// Writes the best chain from "height" to the end into file,
+// genesis is not saved.
+func (h *headers) save(height int) error {
+    if height < 1 {
+        height = 1
+    }
+    f := h.file
+    if _, err := f.Seek(int64(headerSize * (height - 1)), 0); err != nil {
+        return err
+    }
+    for _, n := range h.data[height:] {
+        if err := binary.Write(f, binary.LittleEndian, n.header); err != nil {
+            return err
         }
     }
-    return errors.New(fmt.Sprintf(
+    // The new best chain could be shorter than the old one
+    if err := f.Truncate(int64(headerSize * (len(h.data) - 1))); err != nil {
+        return err
+    }
+    return f.Sync()
+}
+
+// Adds a new block header to the tree, and switches the best chain if the
+// chain ending with the new header has more work.
+// Returns the lowest height of the best chain that has changed, which is
+// len(h.data) if the best chain stays the same, and the reorg if there is one.
+func (h *headers) appendHeader(ch *catma.Header) (int, *Reorg, error) {
+    hash := *ch.Hash()
+    if n, ok := h.index[hash]; ok {
+        // Already known
+        if n.invalid {
+            return 0, nil, ErrInvalidChain
+        }
+        return len(h.data), nil, nil
+    }
+    parent := h.index[ch.PrevBlock]
+    if parent == nil {
+        return 0, nil, errors.New(fmt.Sprintf(
             "appendHeader: PrevBlock value doesn't match any exsiting header: %s", &(ch.PrevBlock)))
+    } else if parent.invalid {
+        return 0, nil, ErrInvalidChain
+    }
+    height := parent.pos.depth + 1
+    if err := checkHeader(ch, height, &branch{h, parent}, time.Now()); err != nil {
+        return 0, nil, fmt.Errorf("appendHeader: invalid header %s: %s", &hash, err)
+    }
+    if err := catma.CheckCheckpoint(&hash, height); err != nil {
+        return 0, nil, fmt.Errorf("appendHeader: invalid header %s: %s", &hash, err)
+    }
+    if err := h.tree.AddChild(parent.pos.depth, parent.pos.index, nil); err != nil {
+        return 0, nil, err
+    }
+    nodes, _ := h.tree.NodesByDepth(height)
+    work := new(big.Int).Add(parent.work, catma.BlockWork(ch.Bits))
+    n := &headerNode{ch, hash, work, treePos{height, len(nodes) - 1}, false}
+    nodes[n.pos.index].Value = n
+    h.index[hash] = n
+
+    if work.Cmp(h.data[len(h.data)-1].work) <= 0 {
+        // Not the best chain, at least not yet
+        if h.onBest(parent) {
+            h.forks[n] = true
+        }
+        return len(h.data), nil, nil
+    }
+    if parent == h.data[len(h.data)-1] {
+        h.data = append(h.data, n)
+        return height, nil, nil
+    }
+    r := h.switchTo(n)
+    return r.Fork + 1, r, nil
+}
+
+// Makes the chain ending with "n" the best chain, "n" can be on the best
+// chain already, which cuts the blocks after it off.
+func (h *headers) switchTo(n *headerNode) *Reorg {
+    path := make([]*headerNode, 0)
+    for p := n; !h.onBest(p); p = h.parent(p) {
+        path = append(path, p)
+    }
+    fork := n.pos.depth - len(path)
+    r := &Reorg{Fork: fork}
+    for _, old := range h.data[fork+1:] {
+        r.Disconnected = append(r.Disconnected, old.header)
+    }
+    if fork + 1 < len(h.data) {
+        h.forks[h.data[fork+1]] = true
+    }
+    h.data = h.data[:fork+1]
+    for i := len(path) - 1; i >= 0; i-- {
+        h.data = append(h.data, path[i])
+        r.Connected = append(r.Connected, path[i].header)
+    }
+    // Branches off the old side chain fork from the new best chain now
+    for _, p := range path {
+        for _, c := range h.children(p) {
+            if !h.onBest(c) {
+                h.forks[c] = true
+            }
+        }
+    }
+    return r
+}
+
+// Returns the valid node with most work, "n" if none has more. The best chain
+// is valid up to "n", the ones after it are not.
+func (h *headers) bestValid(n *headerNode) *headerNode {
+    best := n
+    for root, _ := range h.forks {
+        if root.invalid {
+            continue
+        }
+        for _, s := range h.subtree(root) {
+            if !s.invalid && s.work.Cmp(best.work) > 0 {
+                best = s
+            }
+        }
+    }
+    return best
+}
+
+func (h *headers) get(height int) *catma.Header {
+    if height < 0 || height >= len(h.data) {
+        return nil
+    }
+    return h.data[height].header
+}
+
+func (h *headers) parent(n *headerNode) *headerNode {
+    node, err := h.tree.Node(n.pos.depth, n.pos.index)
+    if err != nil || n.pos.depth == 0 {
+        return nil
+    }
+    pnode, err := h.tree.Node(n.pos.depth - 1, node.ParentIndex())
+    if err != nil {
+        return nil
+    }
+    return pnode.Value.(*headerNode)
+}
+
+// Side branches forking more than this many blocks below the tip are pruned
+var pruneDepth = 288
+
+// Removes side branches forking more than pruneDepth below the tip, whose
+// blocks couldn't be disconnected to reorg to them anyway, and the ones behind
+// the tip by more work than pruneDepth blocks at its difficulty.
+func (h *headers) prune() {
+    tip := h.data[len(h.data)-1]
+    minWork := new(big.Int).Mul(catma.BlockWork(tip.header.Bits), big.NewInt(int64(pruneDepth)))
+    minWork.Sub(tip.work, minWork)
+    for n, _ := range h.forks {
+        if h.onBest(n) || !h.onBest(h.parent(n)) {
+            // Not the root of a side branch any more
+            delete(h.forks, n)
+            continue
+        }
+        sub := h.subtree(n)
+        work := n.work
+        for _, s := range sub {
+            if s.work.Cmp(work) > 0 {
+                work = s.work
+            }
+        }
+        if n.pos.depth + pruneDepth > tip.pos.depth && work.Cmp(minWork) >= 0 {
+            continue
+        }
+        for _, s := range sub {
+            delete(h.index, s.hash)
+            delete(h.forks, s)
+        }
+        h.tree.Remove(n.pos.depth, n.pos.index)
+        h.updatePos(n.pos.depth, sub[len(sub)-1].pos.depth)
+        log.Infof("Pruned side branch of %d headers at height %d", len(sub), n.pos.depth)
+    }
+}
+
+// Returns the nodes whose parent is "n"
+func (h *headers) children(n *headerNode) []*headerNode {
+    nodes, _ := h.tree.NodesByDepth(n.pos.depth + 1)
+    c := make([]*headerNode, 0)
+    for _, node := range nodes {
+        if node.ParentIndex() == n.pos.index {
+            c = append(c, node.Value.(*headerNode))
+        }
+    }
+    return c
+}
+
+// Returns "n" and all the nodes after it, from low to high
+func (h *headers) subtree(n *headerNode) []*headerNode {
+    sub := []*headerNode{n}
+    indices := map[int]bool{n.pos.index: true}
+    for depth := n.pos.depth + 1; len(indices) > 0; depth++ {
+        nodes, err := h.tree.NodesByDepth(depth)
+        if err != nil {
+            break
+        }
+        next := make(map[int]bool)
+        for i, node := range nodes {
+            if indices[node.ParentIndex()] {
+                next[i] = true
+                sub = append(sub, node.Value.(*headerNode))
+            }
+        }
+        indices = next
+    }
+    return sub
+}
+
+// Updates positions of nodes from height "from" to "to", after some are removed
+func (h *headers) updatePos(from int, to int) {
+    for depth := from; depth <= to; depth++ {
+        nodes, err := h.tree.NodesByDepth(depth)
+        if err != nil {
+            return
+        }
+        for i, node := range nodes {
+            node.Value.(*headerNode).pos.index = i
+        }
+    }
+}
+
+func (h *headers) onBest(n *headerNode) bool {
+    return n.pos.depth < len(h.data) && h.data[n.pos.depth] == n
+}
+
+// A chain in the tree ending with "tip", it's used to validate headers on side chains.
+type branch struct {
+    h       *headers
+    tip     *headerNode
+}
+
+// Member of catma.HeaderChain interface
+func (b *branch) Get(height int) *catma.Header {
+    n := b.tip
+    if height < 0 || height > n.pos.depth {
+        return nil
+    }
+    for n.pos.depth > height {
+        if b.h.onBest(n) {
+            return b.h.get(height)
+        }
+        n = b.h.parent(n)
+    }
+    return n.header
 }
 
 func locatorIndices(h int) []int {
@@ -141,4 +531,4 @@ func genesisHeader() *catma.Header {
     h.Bits = 0x1d00ffff
     h.Nonce = 2083236893
     return h
-}
\ No newline at end of file
+}
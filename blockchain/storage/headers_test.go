@@ -1,39 +1,373 @@
 package storage
 
 import (
+    "os"
     "testing"
-    "fmt"
-    "github.com/oxfeeefeee/kaiju"
+    "io/ioutil"
+    "time"
+    "path/filepath"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
 )
 
-func TestFiles(t *testing.T) {
-    err := kaiju.Init()
+// A file in a directory removed along with it by the returned func
+func tempFile(t *testing.T, name string) (*os.File, func()) {
+    dir, err := ioutil.TempDir("", "storage")
     if err != nil {
-        t.Errorf(fmt.Sprintf("Failed to call kaiju.Init: %s", err))
+        t.Fatalf("TempDir error: %s", err)
     }
-
-    fs, err := newFiles(headersFileName, kdbFileName)
+    f, _, err := openFile(dir, name)
     if err != nil {
-        t.Errorf(fmt.Sprintf("newFiles error: %s", err))
+        t.Fatalf("openFile error: %s", err)
+    }
+    return f, func() {
+        f.Close()
+        os.RemoveAll(dir)
     }
-    //fs.headerFile().Write([]byte{0,1,2,3,4,5,6,78})
-    fs.close()
 }
 
-func TestGenesisHeader(t *testing.T) {
-    fs, err := newFiles(headersFileName, kdbFileName)
-    if err != nil {
-        t.Errorf(fmt.Sprintf("newFiles error: %s", err))
+func TestFiles(t *testing.T) {
+    f, done := tempFile(t, "headers.dat")
+    defer done()
+    if fi, err := f.Stat(); err != nil || fi.Size() != 0 || filepath.Base(fi.Name()) != "headers.dat" {
+        t.Errorf("Bad file opened %v %s", fi, err)
     }
-    headers := newHeaders(fs.headerFile())
+}
+
+func TestGenesisHeader(t *testing.T) {
+    f, done := tempFile(t, "headers.dat")
+    defer done()
+    headers := newHeaders(f)
+    headers.loadHeaders()
     h := headers.data[0]
-    s := h.Hash().String()
+    s := h.hash.String()
     log.Debugf("genesis hash %s", s)
     if s != "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f" {
         t.Errorf("Invalid genesis hash")
     }
 
     log.Debugf("Locator %s", headers.GetLocator()[0]) 
+}
+
+// Headers with made-up proof of work, checkHeader is replaced while they are used
+func testHeaders(t *testing.T) (*headers, func()) {
+    f, done := tempFile(t, "headers.dat")
+    check := checkHeader
+    checkHeader = func(*catma.Header, int, catma.HeaderChain, time.Time) error { return nil }
+    h := newHeaders(f)
+    h.loadHeaders()
+    return h, func() {
+        checkHeader = check
+        done()
+    }
+}
+
+// "n" headers following "parent", "seed" tells branches of the same bits apart
+func chainAfter(parent *catma.Header, n int, bits uint32, seed uint32) []*catma.Header {
+    hs := make([]*catma.Header, n)
+    for i := 0; i < n; i++ {
+        hs[i] = &catma.Header{
+            Version: 4,
+            PrevBlock: *parent.Hash(),
+            Timestamp: parent.Timestamp + 600,
+            Bits: bits,
+            Nonce: seed,
+        }
+        parent = hs[i]
+    }
+    return hs
+}
+
+// Checks the best chain is "hs" after genesis, in memory and in file
+func checkBest(t *testing.T, h *headers, hs []*catma.Header) {
+    if h.Len() != len(hs) + 1 {
+        t.Fatalf("%d headers instead of %d", h.Len(), len(hs) + 1)
+    }
+    for i, header := range hs {
+        if *h.Get(i + 1).Hash() != *header.Hash() {
+            t.Errorf("Wrong header at %d", i + 1)
+        }
+        if height, ok := h.Height(header.Hash()); !ok || height != i + 1 {
+            t.Errorf("Wrong height of header %d: %d %v", i + 1, height, ok)
+        }
+    }
+    h2 := newHeaders(h.file)
+    h.file.Seek(0, 0)
+    h2.loadHeaders()
+    if h2.Len() != h.Len() || *h2.Get(h2.Len() - 1).Hash() != *h.Get(h.Len() - 1).Hash() {
+        t.Errorf("Different tip loaded from file")
+    }
+}
+
+func TestReorg(t *testing.T) {
+    h, done := testHeaders(t)
+    defer done()
+    var reorgs []*Reorg
+    var tips []int
+    h.OnReorg(func(r *Reorg) { reorgs = append(reorgs, r) })
+    h.OnTip(func(tip *catma.Header, height int) { tips = append(tips, height) })
+
+    g := h.Get(0)
+    a := chainAfter(g, 5, numbers.PowLimitBits, 1)
+    if err := h.Append(a); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, a)
+    if len(reorgs) != 0 || len(tips) != 1 || tips[0] != 5 {
+        t.Errorf("Handlers called with %v %v", reorgs, tips)
+    }
+
+    // Shorter, but with more work
+    b := chainAfter(a[1], 2, 0x1c00ffff, 2)
+    if err := h.Append(b); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, append(a[:2:2], b...))
+    if len(reorgs) != 1 || len(tips) != 2 || tips[1] != 4 {
+        t.Fatalf("Handlers called with %v %v", reorgs, tips)
+    }
+    // b[1] only extends the new best chain
+    r := reorgs[0]
+    if r.Fork != 2 || len(r.Disconnected) != 3 || len(r.Connected) != 1 ||
+        r.Disconnected[0] != a[2] || r.Connected[0] != b[0] {
+        t.Errorf("Bad reorg %+v", r)
+    }
+
+    // Back to the first chain, which has the same bits as before
+    c := chainAfter(a[4], 600, numbers.PowLimitBits, 1)
+    if err := h.Append(c); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, append(a[:5:5], c...))
+    if len(reorgs) != 2 {
+        t.Fatalf("%d reorgs", len(reorgs))
+    }
+    r = reorgs[1]
+    if r.Fork != 2 || len(r.Disconnected) != 2 || r.Disconnected[1] != b[1] || r.Connected[0] != a[2] {
+        t.Errorf("Bad reorg back %+v", r)
+    }
+}
+
+// Invalid blocks and the ones after them are left out of the best chain
+func TestInvalidate(t *testing.T) {
+    h, done := testHeaders(t)
+    defer done()
+    var reorgs []*Reorg
+    h.OnReorg(func(r *Reorg) { reorgs = append(reorgs, r) })
+
+    g := h.Get(0)
+    a := chainAfter(g, 4, numbers.PowLimitBits, 1)
+    b := chainAfter(a[0], 2, numbers.PowLimitBits, 2)
+    for _, hs := range [][]*catma.Header{a, b} {
+        if err := h.Append(hs); err != nil {
+            t.Fatal(err)
+        }
+    }
+    checkBest(t, h, a)
+
+    // Side branch b has more work than what's left of a
+    if err := h.Invalidate(a[2].Hash()); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, append(a[:1:1], b...))
+    if len(reorgs) != 1 {
+        t.Fatalf("%d reorgs", len(reorgs))
+    }
+    r := reorgs[0]
+    if r.Fork != 1 || len(r.Disconnected) != 3 || len(r.Connected) != 2 || r.Disconnected[1] != a[2] {
+        t.Errorf("Bad reorg %+v", r)
+    }
+    // Nothing after an invalid block gets in
+    if err := h.Append(chainAfter(a[3], 2, 0x1c00ffff, 1)); err != ErrInvalidChain {
+        t.Errorf("Header after invalid block: %v", err)
+    }
+    if err := h.Append(a[2:3]); err != ErrInvalidChain {
+        t.Errorf("Invalid header appended again: %v", err)
+    }
+    checkBest(t, h, append(a[:1:1], b...))
 
-    fs.close()
-}
\ No newline at end of file
+    // Back to the valid part of a, cut off at the block before
+    if err := h.Invalidate(b[0].Hash()); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, a[:2])
+    r = reorgs[1]
+    if r.Fork != 1 || len(r.Disconnected) != 2 || len(r.Connected) != 1 || r.Connected[0] != a[1] {
+        t.Errorf("Bad reorg back %+v", r)
+    }
+    if err := h.Invalidate(a[1].Hash()); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, a[:1])
+    if r = reorgs[2]; r.Fork != 1 || len(r.Disconnected) != 1 || len(r.Connected) != 0 {
+        t.Errorf("Bad reorg to the same chain %+v", r)
+    }
+
+    if err := h.Invalidate(g.Hash()); err == nil {
+        t.Errorf("Genesis invalidated")
+    }
+    if err := h.Invalidate(chainAfter(g, 1, numbers.PowLimitBits, 3)[0].Hash()); err == nil {
+        t.Errorf("Unknown header invalidated")
+    }
+    checkPos(t, h)
+}
+
+func TestEqualWork(t *testing.T) {
+    h, done := testHeaders(t)
+    defer done()
+    g := h.Get(0)
+    a := chainAfter(g, 3, numbers.PowLimitBits, 1)
+    b := chainAfter(g, 3, numbers.PowLimitBits, 2)
+    if err := h.Append(a); err != nil {
+        t.Fatal(err)
+    }
+    if err := h.Append(b); err != nil {
+        t.Fatal(err)
+    }
+    // The first seen stays
+    checkBest(t, h, a)
+    if h.index[*b[2].Hash()] == nil {
+        t.Errorf("Side branch not kept")
+    }
+    // Until the other gets ahead
+    b2 := chainAfter(b[2], 1, numbers.PowLimitBits, 2)
+    if err := h.Append(b2); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, append(b, b2...))
+}
+
+func TestOrphan(t *testing.T) {
+    h, done := testHeaders(t)
+    defer done()
+    a := chainAfter(h.Get(0), 3, numbers.PowLimitBits, 1)
+    if err := h.Append(a[:1]); err != nil {
+        t.Fatal(err)
+    }
+    // a[1] missing
+    if err := h.Append(a[2:]); err == nil {
+        t.Errorf("Orphan header appended")
+    }
+    checkBest(t, h, a[:1])
+    if h.index[*a[2].Hash()] != nil {
+        t.Errorf("Orphan header indexed")
+    }
+    // Headers before an orphan in the same batch are kept
+    if err := h.Append([]*catma.Header{a[1], a[2], a[2]}); err != nil {
+        t.Errorf("Known header not ignored: %s", err)
+    }
+    b := chainAfter(a[2], 2, numbers.PowLimitBits, 1)
+    if err := h.Append([]*catma.Header{b[0], b[1], a[0], chainAfter(b[0], 2, numbers.PowLimitBits, 2)[1]}); err == nil {
+        t.Errorf("Orphan header appended")
+    }
+    checkBest(t, h, append(a, b...))
+}
+
+func TestPrune(t *testing.T) {
+    depth := pruneDepth
+    pruneDepth = 3
+    defer func() { pruneDepth = depth }()
+    h, done := testHeaders(t)
+    defer done()
+
+    g := h.Get(0)
+    a := chainAfter(g, 4, numbers.PowLimitBits, 1)
+    // Forks at 1, 2 and 3, the one at 2 with two headers on its first
+    b := chainAfter(a[0], 2, numbers.PowLimitBits, 2)
+    d := chainAfter(a[1], 2, numbers.PowLimitBits, 3)
+    d = append(d, chainAfter(d[0], 1, numbers.PowLimitBits, 4)...)
+    c := chainAfter(a[2], 1, numbers.PowLimitBits, 5)
+    for _, hs := range [][]*catma.Header{a, b, c, d} {
+        if err := h.Append(hs); err != nil {
+            t.Fatal(err)
+        }
+    }
+    checkBest(t, h, a)
+    if len(h.index) != 11 {
+        t.Fatalf("%d headers known", len(h.index))
+    }
+
+    // The fork at 1 gets deeper than 3 blocks below the tip
+    a2 := chainAfter(a[3], 1, 0x1c00ffff, 1)
+    if err := h.Append(a2); err != nil {
+        t.Fatal(err)
+    }
+    a = append(a, a2...)
+    checkBest(t, h, a)
+    for _, header := range append(append(b, c...), d...) {
+        if pruned := h.index[*header.Hash()] == nil; pruned != (header == b[0] || header == b[1]) {
+            t.Errorf("Header pruned: %v", pruned)
+        }
+    }
+    checkPos(t, h)
+
+    // The fork at 2 gets too deep, and the one at 3 falls behind by more than
+    // 3 blocks of work at the difficulty of the tip, which drops
+    a3 := chainAfter(a[4], 1, 0x1c7fff80, 1)
+    if err := h.Append(a3); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, append(a, a3...))
+    if len(h.index) != len(h.data) {
+        t.Errorf("Side branches not pruned, %d headers known", len(h.index))
+    }
+    checkPos(t, h)
+}
+
+// Branches left behind by a reorg get pruned as well
+func TestPruneAfterReorg(t *testing.T) {
+    depth := pruneDepth
+    pruneDepth = 3
+    defer func() { pruneDepth = depth }()
+    h, done := testHeaders(t)
+    defer done()
+
+    g := h.Get(0)
+    a := chainAfter(g, 3, numbers.PowLimitBits, 1)
+    b := chainAfter(a[0], 3, numbers.PowLimitBits, 2)
+    // Off the side branch until the reorg
+    c := chainAfter(b[0], 1, numbers.PowLimitBits, 3)
+    for _, hs := range [][]*catma.Header{a, b[:2], c, b[2:]} {
+        if err := h.Append(hs); err != nil {
+            t.Fatal(err)
+        }
+    }
+    checkBest(t, h, append(a[:1], b...))
+    if len(h.index) != 8 {
+        t.Fatalf("%d headers known", len(h.index))
+    }
+    b2 := chainAfter(b[2], 2, numbers.PowLimitBits, 2)
+    if err := h.Append(b2); err != nil {
+        t.Fatal(err)
+    }
+    checkBest(t, h, append(append(a[:1], b...), b2...))
+    if len(h.index) != len(h.data) {
+        t.Errorf("Side branches not pruned, %d headers known", len(h.index))
+    }
+    checkPos(t, h)
+}
+
+// Checks the positions nodes have are where they are in the tree
+func checkPos(t *testing.T, h *headers) {
+    count := 0
+    for depth := 0; ; depth++ {
+        nodes, err := h.tree.NodesByDepth(depth)
+        if err != nil {
+            break
+        }
+        for i, node := range nodes {
+            n := node.Value.(*headerNode)
+            if n.pos.depth != depth || n.pos.index != i || h.index[n.hash] != n {
+                t.Errorf("Node at %d:%d has position %v", depth, i, n.pos)
+            }
+            if depth > 0 && h.parent(n).hash != n.header.PrevBlock {
+                t.Errorf("Node at %d:%d has a wrong parent", depth, i)
+            }
+            count++
+        }
+    }
+    if count != len(h.index) {
+        t.Errorf("%d nodes in tree, %d indexed", count, len(h.index))
+    }
+}
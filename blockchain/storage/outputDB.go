@@ -2,7 +2,9 @@ package storage
 
 import (
     "fmt"
+    "sync"
     "bytes"
+    "errors"
     "encoding/binary"
     "github.com/oxfeeefeee/kaiju"
     "github.com/oxfeeefeee/kaiju/log"
@@ -14,25 +16,44 @@ import (
 
 // All unspent tx output stored in KDB
 type outputDB struct {
-    db  *kdb.KDB
+    db          *kdb.KDB
+    // Undo data of recent blocks
+    undoFiles   *undoFiles
+    // Changes made since the last block was committed
+    undo        *blockUndo
+    // Height of the last block connected
+    height      uint32
+    // Used to decide if a block is recent enough to keep undo data
+    headers     HeaderArray
+    mutex       sync.Mutex
 }
 
-func newOutputDB(db *kdb.KDB) *outputDB {
-    return &outputDB{db,}
+func newOutputDB(db *kdb.KDB, undoDir string, headers HeaderArray) (*outputDB, error) {
+    height, err := db.Tag()
+    if err != nil {
+        return nil, err
+    }
+    return &outputDB{
+        db: db,
+        undoFiles: &undoFiles{undoDir},
+        undo: newBlockUndo(),
+        height: height,
+        headers: headers,
+    }, nil
 }
 
-func (u *outputDB) Get(h *klib.Hash256, i uint32) (*catma.TxOut, error) {
+func (u *outputDB) Get(h *klib.Hash256, i uint32) (*catma.UtxoEntry, error) {
     key := getKdbKey(h, i)
     if val, err := u.db.Get(key); err != nil {
         return nil, err
     } else if val == nil {
-        return nil, fmt.Errorf("outputDB.Get Cannot find tx input %s %d", h, i)
+        return nil, catma.ErrUtxoNotFound
     } else {
         return DecodeTxo(val)
     }
 }
 
-func (u *outputDB) Use(h *klib.Hash256, i uint32, txo *catma.TxOut) error {
+func (u *outputDB) Use(h *klib.Hash256, i uint32, txo *catma.UtxoEntry) error {
     key := getKdbKey(h, i)
     v, err := u.db.Get(key)
     if err != nil {
@@ -52,21 +73,35 @@ func (u *outputDB) Use(h *klib.Hash256, i uint32, txo *catma.TxOut) error {
         return err
     } else if !found {
         return fmt.Errorf("outputDB.Use Cannot find tx input %s %d", h, i)
-    } else {
-        return nil
     }
+    u.mutex.Lock()
+    defer u.mutex.Unlock()
+    u.undo.use(key, v)
+    return nil
 }
 
-func (u *outputDB) Add(h *klib.Hash256, i uint32, txo *catma.TxOut) error {
+func (u *outputDB) Add(h *klib.Hash256, i uint32, txo *catma.UtxoEntry) error {
     key := getKdbKey(h, i)
-    if val, err := EncodeTxo(txo); err != nil {
+    val, err := EncodeTxo(txo)
+    if err != nil {
         return err
-    } else {
-        return u.db.Add(key, val)
     }
+    if err = u.db.Add(key, val); err != nil {
+        return err
+    }
+    u.mutex.Lock()
+    defer u.mutex.Unlock()
+    u.undo.add(key)
+    return nil
 }
 
+// Marks the end of block "tag", all the changes since the last call are
+// considered made by this block.
+// KDB gets committed with "tag" if "force" or the write-ahead data is big enough.
 func (u *outputDB) Commit(tag uint32, force bool) error {
+    if err := u.endBlock(tag); err != nil {
+        return err
+    }
     if force || u.db.WAValueLen() > kaiju.GetConfig().MaxKdbWAValueLen {
         log.Infof("Committing blocks up to number %d ...", tag)
         err := u.db.Commit(tag)
@@ -80,54 +115,134 @@ func (u *outputDB) Tag() (uint32, error) {
     return u.db.Tag()
 }
 
-func EncodeTxo(txo *catma.TxOut) ([]byte, error) {
+func (u *outputDB) Height() int {
+    u.mutex.Lock()
+    defer u.mutex.Unlock()
+    return int(u.height)
+}
+
+// Reverts the changes block "height" made, the block has to be the last one
+// connected. KDB is committed with tag rolled back to "height-1".
+func (u *outputDB) DisconnectBlock(height uint32) error {
+    u.mutex.Lock()
+    defer u.mutex.Unlock()
+    if height != u.height || height == 0 {
+        return fmt.Errorf("outputDB.DisconnectBlock %d is not the last block %d", height, u.height)
+    }
+    if !u.undo.empty() {
+        return errors.New("outputDB.DisconnectBlock changes of unfinished block pending")
+    }
+    b, err := u.undoFiles.load(height)
+    if err != nil {
+        return fmt.Errorf("outputDB.DisconnectBlock no undo data for block %d: %s", height, err)
+    }
+    for k, _ := range b.created {
+        if found, err := u.db.Remove([]byte(k)); err != nil {
+            return err
+        } else if !found {
+            return fmt.Errorf("outputDB.DisconnectBlock created output not found in block %d", height)
+        }
+    }
+    for _, r := range b.spent {
+        if err := u.db.Add(r.key, r.value); err != nil {
+            return err
+        }
+    }
+    u.height = height - 1
+    if err := u.db.Commit(u.height); err != nil {
+        return err
+    }
+    u.undoFiles.remove(height)
+    log.Infof("Disconnected block %d", height)
+    return nil
+}
+
+// Saves undo data of block "height" if it's recent enough to be reorganized
+func (u *outputDB) endBlock(height uint32) error {
+    u.mutex.Lock()
+    defer u.mutex.Unlock()
+    if height <= u.height {
+        return nil
+    }
+    keep := uint32(kaiju.GetConfig().MaxUndoBlocks)
+    if int(height + keep) >= u.headers.Len() {
+        if err := u.undoFiles.save(height, u.undo); err != nil {
+            return err
+        }
+    }
+    if height > keep {
+        u.undoFiles.remove(height - keep)
+    }
+    u.undo = newBlockUndo()
+    u.height = height
+    return nil
+}
+
+// Size of the header of an encoded output: type, value, height and coin base flag
+const txoHeaderSize = 1 + 8 + 4
+
+// Encoded output is [type 1][value 8][height<<1 | coinbase 4][payload],
+// payload being the hash for P2PKH and P2SH, and the full script for others.
+func EncodeTxo(txo *catma.UtxoEntry) ([]byte, error) {
+    if txo.Height >= 1 << 31 {
+        return nil, errors.New("EncodeTxo height out of range")
+    }
     s := script.Script(txo.PKScript)
+    var ret []byte
     if s.IsTypePubKeyHash() {
-        ret := make([]byte, 20+1+8)
+        ret = make([]byte, txoHeaderSize+20)
         ret[0] = byte(script.PKS_PubKeyHash)
-        binary.LittleEndian.PutUint64(ret[1:], uint64(txo.Value))
-        copy(ret[9:], s[3:23])
-        return ret, nil
+        copy(ret[txoHeaderSize:], s[3:23])
     } else if s.IsTypeScriptHash() {
-        ret := make([]byte, 20+1+8)
+        ret = make([]byte, txoHeaderSize+20)
         ret[0] = byte(script.PKS_ScriptHash)
-        binary.LittleEndian.PutUint64(ret[1:], uint64(txo.Value))
-        copy(ret[9:], s[2:22])
-        return ret, nil
+        copy(ret[txoHeaderSize:], s[2:22])
     } else {
-        ret := make([]byte, len(s)+1+8)
+        ret = make([]byte, txoHeaderSize+len(s))
         ret[0] = 0
-        binary.LittleEndian.PutUint64(ret[len(s)+1:], uint64(txo.Value))
-        copy(ret[9:], s)
-        return ret, nil
+        copy(ret[txoHeaderSize:], s)
     }
+    binary.LittleEndian.PutUint64(ret[1:], uint64(txo.Value))
+    hc := txo.Height << 1
+    if txo.CoinBase {
+        hc |= 1
+    }
+    binary.LittleEndian.PutUint32(ret[9:], hc)
+    return ret, nil
 }
 
-func DecodeTxo(val []byte) (*catma.TxOut, error) {
+func DecodeTxo(val []byte) (*catma.UtxoEntry, error) {
+    if len(val) < txoHeaderSize {
+        return nil, errors.New("DecodeTxo value too short")
+    }
     fb := val[0]
+    v := int64(binary.LittleEndian.Uint64(val[1:]))
+    hc := binary.LittleEndian.Uint32(val[9:])
+    payload := val[txoHeaderSize:]
+    var s []byte
     if fb == byte(script.PKS_PubKeyHash) {
-        v := binary.LittleEndian.Uint64(val[1:])
-        s := make([]byte, 25)
+        s = make([]byte, 25)
         s[0] = byte(script.OP_DUP)
         s[1] = byte(script.OP_HASH160)
         s[2] = byte(script.OP_PUSHDATA14)
         s[23] = byte(script.OP_EQUALVERIFY)
         s[24] = byte(script.OP_CHECKSIG)
-        copy(s[3:23], val[9:])
-        return &catma.TxOut{int64(v), s}, nil
+        copy(s[3:23], payload)
     } else if fb == byte(script.PKS_ScriptHash) {
-        v := binary.LittleEndian.Uint64(val[1:])
-        s := make([]byte, 23)
+        s = make([]byte, 23)
         s[0] = byte(script.OP_HASH160)
         s[1] = byte(script.OP_PUSHDATA14)
         s[22] = byte(script.OP_EQUAL)
-        copy(s[2:22], val[9:])
-        return &catma.TxOut{int64(v), s}, nil
+        copy(s[2:22], payload)
     } else {
-        v := binary.LittleEndian.Uint64(val[1:])
         // NOTE: reusing memory of val
-        return &catma.TxOut{int64(v), val[9:]}, nil
+        s = payload
     }
+    return &catma.UtxoEntry{
+        TxOut: catma.TxOut{Value: v, PKScript: s},
+        Height: hc >> 1,
+        CoinBase: hc & 1 == 1,
+    }, nil
 }
 
 func getKdbKey(h *klib.Hash256, i uint32) []byte {
@@ -1,26 +1,40 @@
 package storage
 
 import (
+    "os"
     "testing"
-    "fmt"
-    "github.com/oxfeeefeee/kaiju"
+    "path/filepath"
+    "github.com/oxfeeefeee/kaiju/klib/kdb"
 )
 
-func TestOutputDB(t *testing.T) {
-    err := kaiju.Init()
+// An empty outputDB, with undo files in a temporary directory
+func newTestOutputDB(t *testing.T) (*outputDB, func()) {
+    hf, hdone := tempFile(t, "headers.dat")
+    dbf, dbdone := tempFile(t, "utxo.kdb")
+    waf, wadone := tempFile(t, "utxo.wa")
+    db, err := kdb.New(1024, dbf, waf)
     if err != nil {
-        t.Errorf(fmt.Sprintf("Failed to call kaiju.Init: %s", err))
+        t.Fatalf("kdb.New error: %s", err)
     }
-
-    fs, err := newFiles(headersFileName, kdbFileName)
-    if err != nil {
-        t.Errorf(fmt.Sprintf("newFiles error: %s", err))
+    undoDir := filepath.Join(filepath.Dir(dbf.Name()), "undo")
+    if err := os.MkdirAll(undoDir, os.ModePerm); err != nil {
+        t.Fatalf("MkdirAll error: %s", err)
     }
-
-    _, err = newOutputDB(fs.kdbFile())
+    udb, err := newOutputDB(db, undoDir, newHeaders(hf))
     if err != nil {
-        t.Errorf(fmt.Sprintf("newUtxoDB error: %s", err))
+        t.Fatalf("newOutputDB error: %s", err)
     }
+    return udb, func() {
+        hdone()
+        dbdone()
+        wadone()
+    }
+}
 
-    fs.close()
-}
\ No newline at end of file
+func TestOutputDB(t *testing.T) {
+    udb, done := newTestOutputDB(t)
+    defer done()
+    if tag, err := udb.Tag(); err != nil || tag != 0 || udb.Height() != 0 {
+        t.Errorf("New outputDB at tag %d height %d: %v", tag, udb.Height(), err)
+    }
+}
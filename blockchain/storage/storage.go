@@ -3,6 +3,8 @@ package storage
 
 import (
     "os"
+    "errors"
+    "math/big"
     "path/filepath"
     "github.com/oxfeeefeee/kaiju"
     "github.com/oxfeeefeee/kaiju/klib"
@@ -12,17 +14,35 @@ import (
 
 var storage Storage
 
+var errOldKDB = errors.New("Storage.Init: UTXO database of an older version, delete the data directory and resync")
+
+// The best header chain, backed by a tree of all known headers
 type HeaderArray interface {
     Len() int
     Get(height int) *catma.Header
+    // Total work of the best chain up to "height"
+    Work(height int) *big.Int
+    // Returns the height of a header if it's on the best chain
+    Height(hash *klib.Hash256) (int, bool)
     Append(hs []*catma.Header) error 
     GetLocator() []*klib.Hash256
+    // Marks a block invalid along with the blocks after it, the best chain
+    // switches to the valid one with most work
+    Invalidate(hash *klib.Hash256) error
+    // Registers a handler to be notified when the best chain gets reorganized
+    OnReorg(f ReorgHandler)
+    // Registers a handler to be notified when the best header changes
+    OnTip(f TipHandler)
 }
 
 type UtxoDB interface {
     catma.UtxoSet
     Commit(tag uint32, force bool) error
     Tag() (uint32, error)
+    // Height of the last block connected
+    Height() int
+    // Reverts the last block connected
+    DisconnectBlock(height uint32) error
 }
 
 type Storage struct {
@@ -48,6 +68,7 @@ func (c *Storage) Init() error {
         return err
     }
     c.hfile = f
+    pruneDepth = kaiju.GetConfig().MaxUndoBlocks
     c.h = newHeaders(f)
     c.h.loadHeaders()
 
@@ -67,14 +88,20 @@ func (c *Storage) Init() error {
         }
     } else {
         db, err = kdb.Load(dbf, waf)
-        if err != nil {
+        if err == kdb.ErrVersion {
+            return errOldKDB
+        } else if err != nil {
             return err
         }
     }
+    undoDir := filepath.Join(path, kaiju.GetConfig().UndoDirName)
+    if err := os.MkdirAll(undoDir, os.ModePerm); err != nil {
+        return err
+    }
     c.dbFile = dbf
     c.waFile = waf
-    c.db = newOutputDB(db)
-    return nil
+    c.db, err = newOutputDB(db, undoDir, c.h)
+    return err
 }
 
 func (c *Storage) Destroy() error {
@@ -0,0 +1,148 @@
+// Undo data of blocks, used to disconnect blocks from the UTXO set during a reorg
+package storage
+
+import (
+    "os"
+    "fmt"
+    "bytes"
+    "errors"
+    "io/ioutil"
+    "path/filepath"
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+// A KDB record removed by spending an output
+type spentRecord struct {
+    key     []byte
+    value   []byte
+}
+
+// Changes a block made to the UTXO set
+type blockUndo struct {
+    // Outputs spent by the block, with their encoded values
+    spent       []spentRecord
+    // Keys of outputs created by the block
+    created     map[string]bool
+}
+
+func newBlockUndo() *blockUndo {
+    return &blockUndo{
+        spent: make([]spentRecord, 0),
+        created: make(map[string]bool),
+    }
+}
+
+func (b *blockUndo) empty() bool {
+    return len(b.spent) == 0 && len(b.created) == 0
+}
+
+func (b *blockUndo) add(key []byte) {
+    b.created[string(key)] = true
+}
+
+func (b *blockUndo) use(key []byte, value []byte) {
+    if b.created[string(key)] {
+        // Created and spent in the same block, nothing to undo
+        delete(b.created, string(key))
+        return
+    }
+    v := make([]byte, len(value))
+    copy(v, value)
+    b.spent = append(b.spent, spentRecord{key, v})
+}
+
+func (b *blockUndo) Bytes() []byte {
+    p := new(bytes.Buffer)
+    p.Write(klib.VarUint(len(b.spent)).Bytes())
+    for _, r := range b.spent {
+        p.Write(klib.VarString(r.key).Bytes())
+        p.Write(klib.VarString(r.value).Bytes())
+    }
+    p.Write(klib.VarUint(len(b.created)).Bytes())
+    for k, _ := range b.created {
+        p.Write(klib.VarString(k).Bytes())
+    }
+    return p.Bytes()
+}
+
+func (b *blockUndo) FromBytes(data []byte) error {
+    r := bytes.NewReader(data)
+    var count klib.VarUint
+    if err := count.Deserialize(r); err != nil {
+        return err
+    }
+    for i := uint64(0); i < uint64(count); i++ {
+        var k, v klib.VarString
+        if err := k.Deserialize(r); err != nil {
+            return err
+        }
+        if err := v.Deserialize(r); err != nil {
+            return err
+        }
+        b.spent = append(b.spent, spentRecord{k, v})
+    }
+    if err := count.Deserialize(r); err != nil {
+        return err
+    }
+    for i := uint64(0); i < uint64(count); i++ {
+        var k klib.VarString
+        if err := k.Deserialize(r); err != nil {
+            return err
+        }
+        b.created[string(k)] = true
+    }
+    if r.Len() != 0 {
+        return errors.New("blockUndo.FromBytes: trailing data")
+    }
+    return nil
+}
+
+// Undo files, one for each block, named by block height
+type undoFiles struct {
+    dir     string
+}
+
+func (f *undoFiles) path(height uint32) string {
+    return filepath.Join(f.dir, fmt.Sprintf("%d.undo", height))
+}
+
+// Undo data has to be on disk before KDB is committed with the block, or
+// a crash could leave a block connected that can't be disconnected
+func (f *undoFiles) save(height uint32, b *blockUndo) error {
+    file, err := os.OpenFile(f.path(height), os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0644)
+    if err != nil {
+        return err
+    }
+    if _, err = file.Write(b.Bytes()); err == nil {
+        err = file.Sync()
+    }
+    if cerr := file.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return err
+    }
+    // So is the directory entry of the new file
+    dir, err := os.Open(f.dir)
+    if err != nil {
+        return err
+    }
+    defer dir.Close()
+    return dir.Sync()
+}
+
+func (f *undoFiles) load(height uint32) (*blockUndo, error) {
+    data, err := ioutil.ReadFile(f.path(height))
+    if err != nil {
+        return nil, err
+    }
+    b := newBlockUndo()
+    if err := b.FromBytes(data); err != nil {
+        return nil, err
+    }
+    return b, nil
+}
+
+func (f *undoFiles) remove(height uint32) {
+    os.Remove(f.path(height))
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+    "os"
+    "bytes"
+    "testing"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+)
+
+func TestUndoBytes(t *testing.T) {
+    b := newBlockUndo()
+    if err := newBlockUndo().FromBytes(b.Bytes()); err != nil {
+        t.Errorf("Empty undo data doesn't round trip: %s", err)
+    }
+    b.add([]byte("created1"))
+    b.add([]byte("created2"))
+    b.use([]byte("spent1"), []byte("value1"))
+    b.use([]byte("spent2"), []byte{})
+    b2 := newBlockUndo()
+    if err := b2.FromBytes(b.Bytes()); err != nil {
+        t.Fatalf("FromBytes error: %s", err)
+    }
+    if len(b2.created) != 2 || !b2.created["created1"] || !b2.created["created2"] {
+        t.Errorf("Created outputs don't round trip: %v", b2.created)
+    }
+    if len(b2.spent) != 2 {
+        t.Fatalf("Spent outputs don't round trip: %v", b2.spent)
+    }
+    for i, r := range b.spent {
+        if !bytes.Equal(r.key, b2.spent[i].key) || !bytes.Equal(r.value, b2.spent[i].value) {
+            t.Errorf("Spent output %d is %v, expect %v", i, b2.spent[i], r)
+        }
+    }
+    data := b.Bytes()
+    if err := newBlockUndo().FromBytes(data[:len(data) - 1]); err == nil {
+        t.Errorf("Truncated undo data loaded")
+    }
+    if err := newBlockUndo().FromBytes(append(data, 0)); err == nil {
+        t.Errorf("Undo data with trailing bytes loaded")
+    }
+}
+
+func testTxo(value int64) *catma.UtxoEntry {
+    return &catma.UtxoEntry{TxOut: catma.TxOut{Value: value, PKScript: []byte{0x51}}, Height: 1}
+}
+
+// Connecting a block then disconnecting it leaves the UTXO set as it was
+func TestDisconnectBlock(t *testing.T) {
+    udb, done := newTestOutputDB(t)
+    defer done()
+    var a, b klib.Hash256
+    a.SetUint64(1)
+    b.SetUint64(2)
+    // Block 1 creates a:0 and a:1
+    udb.Add(&a, 0, testTxo(100))
+    udb.Add(&a, 1, testTxo(200))
+    if err := udb.Commit(1, true); err != nil {
+        t.Fatalf("Commit error: %s", err)
+    }
+    if fi, err := os.Stat(udb.undoFiles.path(1)); err != nil || fi.Mode().Perm() & 0133 != 0 {
+        t.Errorf("Bad undo file of block 1: %v %v", fi, err)
+    }
+    // Block 2 spends a:0, creates b:0, and b:1 which it also spends
+    if err := udb.Use(&a, 0, testTxo(100)); err != nil {
+        t.Fatalf("Use error: %s", err)
+    }
+    udb.Add(&b, 0, testTxo(50))
+    udb.Add(&b, 1, testTxo(40))
+    if err := udb.Use(&b, 1, nil); err != nil {
+        t.Fatalf("Use error: %s", err)
+    }
+    if err := udb.Commit(2, false); err != nil {
+        t.Fatalf("Commit error: %s", err)
+    }
+    if _, err := udb.Get(&a, 0); err != catma.ErrUtxoNotFound {
+        t.Fatalf("Output spent by block 2 still there: %v", err)
+    }
+
+    if err := udb.DisconnectBlock(1); err == nil {
+        t.Errorf("Disconnected a block other than the last one")
+    }
+    if err := udb.DisconnectBlock(2); err != nil {
+        t.Fatalf("DisconnectBlock error: %s", err)
+    }
+    for i, v := range []int64{100, 200} {
+        txo, err := udb.Get(&a, uint32(i))
+        if err != nil || txo.Value != v || !bytes.Equal(txo.PKScript, []byte{0x51}) || txo.Height != 1 {
+            t.Errorf("Output a:%d not restored: %v %v", i, txo, err)
+        }
+    }
+    for i := 0; i < 2; i++ {
+        if _, err := udb.Get(&b, uint32(i)); err != catma.ErrUtxoNotFound {
+            t.Errorf("Output b:%d created by block 2 still there: %v", i, err)
+        }
+    }
+    if tag, err := udb.Tag(); err != nil || tag != 1 || udb.Height() != 1 {
+        t.Errorf("After disconnecting at tag %d height %d: %v", tag, udb.Height(), err)
+    }
+    // Then back to an empty set
+    if err := udb.DisconnectBlock(1); err != nil {
+        t.Fatalf("DisconnectBlock error: %s", err)
+    }
+    for i := 0; i < 2; i++ {
+        if _, err := udb.Get(&a, uint32(i)); err != catma.ErrUtxoNotFound {
+            t.Errorf("Output a:%d created by block 1 still there: %v", i, err)
+        }
+    }
+    if err := udb.DisconnectBlock(0); err == nil {
+        t.Errorf("Disconnected genesis")
+    }
+}
@@ -0,0 +1,323 @@
+package catma
+
+import (
+    "bytes"
+    "errors"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+)
+
+var (
+    // CheckBlock --------------------------------------------------------------------
+    errBlockNoTx = errors.New("CheckBlock: block has no tx")
+
+    errBlockSizeLimit = errors.New("CheckBlock: size limit exceeded")
+
+    errBlockFirstNotCoinBase = errors.New("CheckBlock: first tx is not coin base")
+
+    errBlockMultipleCoinBase = errors.New("CheckBlock: more than one coin base")
+
+    errBlockDuplicateTx = errors.New("CheckBlock: duplicate tx")
+
+    errBlockBadMerkleRoot = errors.New("CheckBlock: merkle root mismatch")
+
+    errBlockSigOpsLimit = errors.New("CheckBlock: sigop count exceeded limit")
+
+    errBlockWeightLimit = errors.New("CheckBlock: weight limit exceeded")
+
+    // VerifyBlock -------------------------------------------------------------------
+    errBlockP2SHSigOpsLimit = errors.New("VerifyBlock: sigop count exceeded limit")
+
+    errBlockFeeRange = errors.New("VerifyBlock: total fees larger than SatoshiInTotal")
+
+    errBlockCoinBaseValue = errors.New("VerifyBlock: coin base pays more than subsidy plus fees")
+
+    errBlockOverwriteTx = errors.New("VerifyBlock: tx overwrites an unspent tx (BIP30)")
+
+    errBlockCoinBaseHeight = errors.New("VerifyBlock: coin base doesn't start with block height (BIP34)")
+
+    errBlockWitnessNonce = errors.New("VerifyBlock: coin base witness is not a 32 byte nonce")
+
+    errBlockWitnessCommitment = errors.New("VerifyBlock: witness commitment mismatch")
+
+    errBlockUnexpectedWitness = errors.New("VerifyBlock: unexpected witness")
+
+    errBlockNonFinalTx = errors.New("VerifyBlock: non-final tx")
+)
+
+// Prefix of the coin base output committing to the witness merkle root (BIP141)
+var witnessCommitmentHeader = []byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+// The only two blocks violating BIP30, each has a coin base duplicating an earlier one
+var bip30Exceptions = map[int]string{
+    91842: "00000000000a4d0a398161ffc163c503763b1f4360639393e0e4c8e300e0caec",
+    91880: "00000000000743f190a18c5577a3c2d2a1f610ae9601ac046a38084ccb7cd721",
+}
+
+// Returns the newly generated coins a block at "height" is allowed to claim
+func BlockSubsidy(height int) int64 {
+    halvings := uint(height / numbers.SubsidyHalvingInterval)
+    // Shifting int64 by 64 or more is undefined in the Satoshi client
+    if halvings >= 64 {
+        return 0
+    }
+    return numbers.InitialSubsidy >> halvings
+}
+
+// Returns the serialized size of a block
+func BlockByteSize(txs []*Tx) int {
+    size := 80 /*Header*/ + klib.VarUint(len(txs)).ByteSize()
+    for _, tx := range txs {
+        size += tx.ByteSize()
+    }
+    return size
+}
+
+// Returns the weight of a block (BIP141)
+func BlockWeight(txs []*Tx) int {
+    weight := (80 /*Header*/ + klib.VarUint(len(txs)).ByteSize()) * numbers.WitnessScaleFactor
+    for _, tx := range txs {
+        weight += tx.Weight()
+    }
+    return weight
+}
+
+// CheckBlock in Satoshi client, the checks that don't depend on the UTXO set.
+// Proof of work is checked along with the header chain, not here.
+func CheckBlock(h *Header, txs []*Tx) error {
+    if len(txs) == 0 {
+        return errBlockNoTx
+    }
+    if len(txs) > numbers.MaxBlockSize || BlockByteSize(txs) > numbers.MaxBlockSize {
+        return errBlockSizeLimit
+    }
+    if !txs[0].IsCoinBase() {
+        return errBlockFirstNotCoinBase
+    }
+    hashes := make([]*klib.Hash256, len(txs))
+    set := make(map[klib.Hash256]bool)
+    sigOps := 0
+    for i, tx := range txs {
+        if i > 0 && tx.IsCoinBase() {
+            return errBlockMultipleCoinBase
+        }
+        if err := tx.FormatCheck(); err != nil {
+            return err
+        }
+        hashes[i] = tx.Hash()
+        if set[*hashes[i]] {
+            return errBlockDuplicateTx
+        }
+        set[*hashes[i]] = true
+        sigOps += tx.legacySigOpCount()
+    }
+    if sigOps > numbers.MaxBlockSigOps {
+        return errBlockSigOpsLimit
+    }
+    if BlockWeight(txs) > numbers.MaxBlockWeight {
+        return errBlockWeightLimit
+    }
+    // A mutated tx list is already rejected as duplicate txs above,
+    // so the second return value is not needed here.
+    root, _ := MerkleRoot(hashes)
+    if *root != h.MerkleRoot {
+        return errBlockBadMerkleRoot
+    }
+    return nil
+}
+
+// Returns if "txs" are not what header "h" of the block at "height" commits to,
+// e.g. duplicate txs, or witnesses stripped or changed. Such a block could have
+// been corrupted in transfer, which doesn't make the header invalid.
+func IsBlockMutated(h *Header, txs []*Tx, height int) bool {
+    hashes := make([]*klib.Hash256, len(txs))
+    for i, tx := range txs {
+        hashes[i] = tx.Hash()
+    }
+    root, mutated := MerkleRoot(hashes)
+    if mutated || *root != h.MerkleRoot {
+        return true
+    }
+    if len(txs) == 0 || !txs[0].IsCoinBase() {
+        // Invalid whatever the witnesses are
+        return false
+    }
+    return checkWitnessCommitment(txs, BlockEvalFlags(h, height)) != nil
+}
+
+// Verifies the block at "height" and connects its txs to the UTXO set.
+// "chain" has to have all the headers before "height".
+// With "pseudo" being true, scripts are not run, which is for blocks we already
+// trust, e.g. those buried under checkpoints.
+//
+// Note that the UTXO set is left half-updated if an error is returned.
+func VerifyBlock(h *Header, txs []*Tx, height int, chain HeaderChain, utxo UtxoSet, pseudo bool) error {
+    if err := CheckBlock(h, txs); err != nil {
+        return err
+    }
+    if height >= numbers.BIP34Height {
+        if !coinBaseHasHeight(txs[0], height) {
+            return errBlockCoinBaseHeight
+        }
+    }
+    if height < numbers.BIP34Height || height >= numbers.BIP30ReenableHeight {
+        if err := checkNoOverwrite(h, txs, height, utxo); err != nil {
+            return err
+        }
+    }
+    // BIP113: lock time is compared against the median time past
+    lockTimeCutoff := h.Timestamp
+    if height >= numbers.CSVHeight {
+        lockTimeCutoff = MedianTimePast(chain, height)
+    }
+    for _, tx := range txs {
+        if !tx.IsFinal(uint32(height), lockTimeCutoff) {
+            return errBlockNonFinalTx
+        }
+    }
+    flags := BlockEvalFlags(h, height)
+    if err := checkWitnessCommitment(txs, flags); err != nil {
+        return err
+    }
+    sigOpCost := 0
+    fees := int64(0)
+    // Scripts are verified in parallel after all the txs are connected
+    jobs := make([]*scriptJob, 0)
+    for _, tx := range txs {
+        r, err := checkTxInputs(tx, utxo, height, flags, pseudo, &jobs)
+        if err != nil {
+            return err
+        }
+        if (flags & script.EvalFlagCheckSequence) != 0 {
+            if err := CheckSequenceLocks(tx, height, chain, utxo); err != nil {
+                return err
+            }
+        }
+        if err := connectTx(tx, utxo, height); err != nil {
+            return err
+        }
+        sigOpCost += r.SigOpCost
+        if sigOpCost > numbers.MaxBlockSigOpsCost {
+            return errBlockP2SHSigOpsLimit
+        }
+        fees += r.Fee
+        if fees > numbers.SatoshiInTotal {
+            return errBlockFeeRange
+        }
+    }
+    if txs[0].valueOut() > BlockSubsidy(height) + fees {
+        return errBlockCoinBaseValue
+    }
+    if err := runScriptJobs(jobs); err != nil {
+        return err
+    }
+    return nil
+}
+
+// BIP34: the coin base SigScript has to start with a push of the block height
+func coinBaseHasHeight(cb *Tx, height int) bool {
+    expected := script.NewScript()
+    expected.AppendPushInt(int64(height))
+    return bytes.HasPrefix(cb.TxIns[0].SigScript, *expected)
+}
+
+// Returns the witness commitment in the coin base, nil if there is none.
+// If more than one output matches, the last one is used.
+func witnessCommitment(cb *Tx) []byte {
+    for i := len(cb.TxOuts) - 1; i >= 0; i-- {
+        pks := cb.TxOuts[i].PKScript
+        if len(pks) >= 38 && bytes.HasPrefix(pks, witnessCommitmentHeader) {
+            return pks[len(witnessCommitmentHeader):38]
+        }
+    }
+    return nil
+}
+
+// BIP141: witness data is only allowed after activation, and has to be
+// committed to by the coin base.
+func checkWitnessCommitment(txs []*Tx, flags script.EvalFlag) error {
+    var commitment []byte
+    if (flags & script.EvalFlagWitness) != 0 {
+        commitment = witnessCommitment(txs[0])
+    }
+    if commitment == nil {
+        for _, tx := range txs {
+            if tx.HasWitness() {
+                return errBlockUnexpectedWitness
+            }
+        }
+        return nil
+    }
+    // The coin base witness is the reserved value
+    witness := txs[0].TxIns[0].Witness
+    if len(witness) != 1 || len(witness[0]) != 32 {
+        return errBlockWitnessNonce
+    }
+    expected := WitnessCommitment(txs, witness[0])
+    if !bytes.Equal(expected[:], commitment) {
+        return errBlockWitnessCommitment
+    }
+    return nil
+}
+
+// Returns the commitment to the witness merkle root of txs and the reserved
+// value in the coin base witness (BIP141)
+func WitnessCommitment(txs []*Tx, reserved []byte) *klib.Hash256 {
+    // The wtxid of the coin base is taken as 0
+    hashes := make([]*klib.Hash256, len(txs))
+    hashes[0] = new(klib.Hash256)
+    for i := 1; i < len(txs); i++ {
+        hashes[i] = txs[i].WitnessHash()
+    }
+    root, _ := MerkleRoot(hashes)
+    return klib.Sha256Sha256(append(root[:], reserved...))
+}
+
+// Returns the coin base output script holding a witness commitment
+func WitnessCommitmentScript(commitment *klib.Hash256) []byte {
+    pks := make([]byte, 0, len(witnessCommitmentHeader) + len(commitment))
+    pks = append(pks, witnessCommitmentHeader...)
+    return append(pks, commitment[:]...)
+}
+
+// BIP30: a tx is not allowed to have the same hash as a tx with unspent outputs.
+// Only the outputs of each tx are checked, same as the Satoshi client.
+func checkNoOverwrite(h *Header, txs []*Tx, height int, utxo UtxoSet) error {
+    if hash, ok := bip30Exceptions[height]; ok && h.Hash().String() == hash {
+        return nil
+    }
+    for _, tx := range txs {
+        txHash := tx.Hash()
+        for i, _ := range tx.TxOuts {
+            _, err := utxo.Get(txHash, uint32(i))
+            if err == nil {
+                return errBlockOverwriteTx
+            } else if err != ErrUtxoNotFound {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Signature operations counted without looking at previous outputs
+func (t *Tx) legacySigOpCount() int {
+    count := 0
+    for _, txin := range t.TxIns {
+        count += script.Script(txin.SigScript).SigOpCount(false)
+    }
+    for _, txout := range t.TxOuts {
+        count += script.Script(txout.PKScript).SigOpCount(false)
+    }
+    return count
+}
+
+// Returns the sum of all output values
+func (t *Tx) valueOut() int64 {
+    v := int64(0)
+    for _, txout := range t.TxOuts {
+        v += txout.Value
+    }
+    return v
+}
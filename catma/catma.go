@@ -2,39 +2,136 @@
 package catma
 
 import (
+    "fmt"
     "errors"
     //"github.com/oxfeeefeee/kaiju/log"
     "github.com/oxfeeefeee/kaiju/klib"
     "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
 )
 
+// Returned by UtxoSet.Get when the output doesn't exist or is spent
+var ErrUtxoNotFound = errors.New("UtxoSet: output not found")
+
+var (
+    errImmatureCoinBase = errors.New("VerifyTx: spending immature coin base")
+
+    errNegativeVIn = errors.New("VerifyTx: negative value in")
+
+    errTooLargeVin = errors.New("VerifyTx: value in larger than SatoshiInTotal")
+
+    errNegativeFee = errors.New("VerifyTx: value out larger than value in")
+)
+
+// An unspent tx output and where it comes from
+type UtxoEntry struct {
+    TxOut
+    // Height of the block that created the output
+    Height          uint32
+    // If the output is created by a coin base
+    CoinBase        bool
+}
+
 type UtxoSet interface {
-    Get(h *klib.Hash256, i uint32) (*TxOut, error)
-    Use(h *klib.Hash256, i uint32, txo *TxOut) error
-    Add(h *klib.Hash256, i uint32, txo *TxOut) error
+    Get(h *klib.Hash256, i uint32) (*UtxoEntry, error)
+    Use(h *klib.Hash256, i uint32, txo *UtxoEntry) error
+    Add(h *klib.Hash256, i uint32, txo *UtxoEntry) error
+}
+
+// What VerifyTx learned about a valid tx
+type TxVerifyResult struct {
+    // Value in minus value out, always 0 for coin base
+    Fee             int64
+    // Legacy and P2SH sigops scaled by WitnessScaleFactor, plus witness
+    // sigops if EvalFlagWitness is set. P2SH sigops need EvalFlagP2SH.
+    SigOpCost       int
+    // Serialized size in bytes, including witness
+    Size            int
+    // See BIP141
+    Weight          int
 }
 
-func VerifyTx(tx *Tx, utxo UtxoSet, preBip16 bool, standard bool, pseudo bool) error {
+// Verifies tx to be included in block "height" and updates the UTXO set.
+// The UTXO set is only updated if tx is valid.
+// Use BlockEvalFlags for consensus rules, or add policy flags for relaying.
+func VerifyTx(tx *Tx, utxo UtxoSet, height int, flags script.EvalFlag, pseudo bool) (*TxVerifyResult, error) {
+    var jobs []*scriptJob
+    r, err := checkTxInputs(tx, utxo, height, flags, pseudo, &jobs)
+    if err != nil {
+        return nil, err
+    }
+    if err := runScriptJobs(jobs); err != nil {
+        return nil, err
+    }
+    if err := connectTx(tx, utxo, height); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// Does all the checks of VerifyTx except running scripts, which are appended
+// to "jobs" unless "pseudo". The UTXO set is not changed.
+func checkTxInputs(tx *Tx, utxo UtxoSet, height int, flags script.EvalFlag,
+    pseudo bool, jobs *[]*scriptJob) (*TxVerifyResult, error) {
     err := tx.FormatCheck()
     if err != nil {
-        return err
+        return nil, err
     }
     // TODO more checks...
 
-    if !tx.IsCoinBase() {
-        for i, txi := range tx.TxIns {
-            op := &(txi.PreviousOutput)
-            txo, err := utxo.Get(&op.Hash, op.Index)
-            if err != nil {
-                return err
-            }
-            if !pseudo {
-                err = VerifyInput(txo.PKScript, tx, i, preBip16, standard)
-                if err != nil {
-                    return err
-                }
-            }
+    result := &TxVerifyResult{
+        SigOpCost: tx.legacySigOpCount() * numbers.WitnessScaleFactor,
+        Size: tx.WitnessByteSize(),
+        Weight: tx.Weight(),
+    }
+    if tx.IsCoinBase() {
+        return result, nil
+    }
+    valueIn := int64(0)
+    prevOuts := make([]*TxOut, len(tx.TxIns))
+    for i, txi := range tx.TxIns {
+        op := &(txi.PreviousOutput)
+        txo, err := utxo.Get(&op.Hash, op.Index)
+        if err != nil {
+            return nil, fmt.Errorf("VerifyTx: input %s %d: %s", &op.Hash, op.Index, err)
         }
+        if txo.CoinBase && height - int(txo.Height) < numbers.CoinbaseMaturity {
+            return nil, errImmatureCoinBase
+        }
+        // Values in the UTXO set passed FormatCheck, but check anyway in case
+        // the set is corrupted, like the Satoshi client does.
+        if txo.Value < 0 {
+            return nil, errNegativeVIn
+        }
+        valueIn += txo.Value
+        if txo.Value > numbers.SatoshiInTotal || valueIn > numbers.SatoshiInTotal {
+            return nil, errTooLargeVin
+        }
+        pks := script.Script(txo.PKScript)
+        if (flags & script.EvalFlagP2SH) != 0 {
+            result.SigOpCost += pks.P2SHSigOpCount(txi.SigScript) * numbers.WitnessScaleFactor
+        }
+        if (flags & script.EvalFlagWitness) != 0 {
+            result.SigOpCost += pks.WitnessSigOpCount(txi.SigScript, txi.Witness)
+        }
+        prevOuts[i] = &txo.TxOut
+    }
+    if !pseudo {
+        for i, _ := range tx.TxIns {
+            *jobs = append(*jobs, &scriptJob{prevOuts, tx, i, flags})
+        }
+    }
+    // FormatCheck makes sure value out is in range
+    result.Fee = valueIn - tx.valueOut()
+    if result.Fee < 0 {
+        return nil, errNegativeFee
+    }
+    return result, nil
+}
+
+// Spends the inputs of tx and adds its outputs to the UTXO set
+func connectTx(tx *Tx, utxo UtxoSet, height int) error {
+    if !tx.IsCoinBase() {
         for _, txi := range tx.TxIns {
             op := &(txi.PreviousOutput)
             err := utxo.Use(&op.Hash, op.Index, nil)
@@ -44,8 +141,9 @@ func VerifyTx(tx *Tx, utxo UtxoSet, preBip16 bool, standard bool, pseudo bool) e
         }
     }
     hash := tx.Hash()
+    coinBase := tx.IsCoinBase()
     for i, txo := range tx.TxOuts {
-        err := utxo.Add(hash, uint32(i), txo)
+        err := utxo.Add(hash, uint32(i), &UtxoEntry{*txo, uint32(height), coinBase})
         if err != nil {
             return err
         }
@@ -53,6 +151,16 @@ func VerifyTx(tx *Tx, utxo UtxoSet, preBip16 bool, standard bool, pseudo bool) e
     return nil
 }
 
+// Verifies the scripts of all the inputs of tx in parallel, "prevOuts" are
+// the outputs spent by the inputs.
+func VerifyTxScripts(prevOuts []*TxOut, tx *Tx, flags script.EvalFlag) error {
+    jobs := make([]*scriptJob, len(tx.TxIns))
+    for i, _ := range tx.TxIns {
+        jobs[i] = &scriptJob{prevOuts, tx, i, flags}
+    }
+    return runScriptJobs(jobs)
+}
+
 func VerifyInput(pkScript []byte, tx *Tx, idx int, preBip16 bool, standard bool) error {
     var evalFlags script.EvalFlag
     if preBip16 {
@@ -69,10 +177,33 @@ func VerifyInput(pkScript []byte, tx *Tx, idx int, preBip16 bool, standard bool)
 }
 
 func VerifyInputWithFlags(pkScript []byte, tx *Tx, idx int, flags script.EvalFlag) error {
+    return VerifyInputWithAmount(pkScript, 0, tx, idx, flags)
+}
+
+// Same as VerifyInputWithFlags, but also takes the value of the output being
+// spent, which is needed to verify segwit inputs.
+func VerifyInputWithAmount(pkScript []byte, amount int64, tx *Tx, idx int, flags script.EvalFlag) error {
     if idx >= len(tx.TxIns) {
         return errors.New("VerifyInput: Input index out of range")
     }
     sig := tx.TxIns[idx].SigScript
-    ie := &InputEntry{tx, idx}
+    ie := &InputEntry{tx, idx, amount, nil}
     return script.VerifyScript(pkScript, sig, ie, flags)
 }
+
+// Verifies input "idx" of tx, "prevOuts" are the outputs spent by all the
+// inputs of tx, which are needed to verify taproot inputs.
+func VerifyInputWithPrevOuts(prevOuts []*TxOut, tx *Tx, idx int, flags script.EvalFlag) error {
+    return TraceInput(prevOuts, tx, idx, flags, nil)
+}
+
+// Same as VerifyInputWithPrevOuts, but reports every step of script evaluation
+// to "t". Only prevOuts[idx] is required unless it's a taproot input.
+func TraceInput(prevOuts []*TxOut, tx *Tx, idx int, flags script.EvalFlag, t script.Tracer) error {
+    if idx >= len(tx.TxIns) || len(prevOuts) != len(tx.TxIns) || prevOuts[idx] == nil {
+        return errors.New("VerifyInput: Input index out of range")
+    }
+    sig := tx.TxIns[idx].SigScript
+    ie := &InputEntry{tx, idx, prevOuts[idx].Value, prevOuts}
+    return script.TraceScript(prevOuts[idx].PKScript, sig, ie, flags, t)
+}
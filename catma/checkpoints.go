@@ -0,0 +1,76 @@
+// Checkpoints: blocks known to be on the main chain
+package catma
+
+import (
+    "sort"
+    "errors"
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+var errCheckpoint = errors.New("CheckCheckpoint: header doesn't match checkpoint")
+
+// Hashes of main chain blocks by height. Besides those of the Satoshi client,
+// the blocks soft forks took effect at are included to make them less sparse.
+var checkpointHashes = map[int]string{
+    11111: "0000000069e244f73d78e8fd29ba2fd2ed618bd6fa2ee92559f542fdb26e7c1d",
+    33333: "000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d0a6",
+    74000: "0000000000573993a3c9e41ce34471c079dcf5f52a0e824a81e7f953b8661a20",
+    105000: "00000000000291ce28027faea320c8d2b054b2e0fe44a773f3eefb151d6bdc97",
+    134444: "00000000000005b12ffd4cd315cd34ffd4a594f430ac814c91184a0d42d2b0fe",
+    168000: "000000000000099e61ea72015e79632f216fe6cb33d7899acb35b75c8303b763",
+    193000: "000000000000059f452a5f7340de6682a977387c17010ff6e6c3bd83ca8b1317",
+    210000: "000000000000048b95347e83192f69cf0366076336c639f9b7228e9ba171342e",
+    216116: "00000000000001b4f4b433e81ee46494af945cf96014816a4e2370f11b23df4e",
+    225430: "00000000000001c108384350f74090433e7fcf79a606b8e797f065b130575932",
+    // BIP34
+    227931: "000000000000024b89b42a942fe0d9fea3bb44ab7bd1b19115dd6a759c0808b8",
+    250000: "000000000000003887df1f29024b06fc2200b55f8af8f35453d7be294df2d214",
+    279000: "0000000000000001ae8c72a0b0c301f67e3afca10e819efa9041e458e9bd7e40",
+    295000: "00000000000000004d9b4ef50f0f9d686fd69db2e03af35a100370c64632a983",
+    // BIP66
+    363725: "00000000000000000379eaa19dce8c9b722d46ae6a57c2f1a988119488b50931",
+    // BIP65
+    388381: "000000000000000004c2b624ed5d7756c508d90fd0da2c7c679febfa6c4735f0",
+    // CSV
+    419328: "000000000000000004a1b34462cb8aeebd5799177f7a29cf28f2d1961716b5b5",
+    // Segwit
+    481824: "0000000000000000001c8018d9cb3b742ef25114f27563e3fc4a1902167f9893",
+    // Taproot
+    709632: "0000000000000000000687bca986194dc2c1f949318629b44bb54ec0a94d8244",
+}
+
+// A block known to be on the main chain
+type Checkpoint struct {
+    Height      int
+    Hash        klib.Hash256
+}
+
+var checkpoints []Checkpoint
+
+func init() {
+    for height, s := range checkpointHashes {
+        cp := Checkpoint{Height: height}
+        if _, err := cp.Hash.SetString(s); err != nil {
+            panic(err)
+        }
+        checkpoints = append(checkpoints, cp)
+    }
+    sort.Slice(checkpoints, func(i, j int) bool {
+        return checkpoints[i].Height < checkpoints[j].Height
+    })
+}
+
+// Returns the checkpoints from low to high
+func Checkpoints() []Checkpoint {
+    return checkpoints
+}
+
+// Checks that the header with "hash" at "height" matches the checkpoint there
+// if there is one, so that chains forking off below it are rejected once they
+// reach its height
+func CheckCheckpoint(hash *klib.Hash256, height int) error {
+    if s, ok := checkpointHashes[height]; ok && hash.String() != s {
+        return errCheckpoint
+    }
+    return nil
+}
@@ -0,0 +1,81 @@
+// Soft fork activation and relative lock time (BIP68)
+package catma
+
+import (
+    "errors"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+)
+
+var errSequenceLock = errors.New("CheckSequenceLocks: relative lock time not satisfied")
+
+// Returns the script flags enforced by consensus for block "h" at "height"
+func BlockEvalFlags(h *Header, height int) script.EvalFlag {
+    flags := script.EvalFlagNone
+    if int64(h.Timestamp) >= numbers.BIP16SwitchTime {
+        flags |= script.EvalFlagP2SH
+    }
+    if height >= numbers.BIP66Height {
+        flags |= script.EvalFlagDERSig
+    }
+    if height >= numbers.BIP65Height {
+        flags |= script.EvalFlagCheckLockTime
+    }
+    if height >= numbers.CSVHeight {
+        flags |= script.EvalFlagCheckSequence
+    }
+    if height >= numbers.SegwitHeight {
+        // BIP147 is deployed along with segwit
+        flags |= script.EvalFlagWitness | script.EvalFlagNullDummy
+    }
+    if height >= numbers.TaprootHeight {
+        flags |= script.EvalFlagTaproot
+    }
+    return flags
+}
+
+// Checks the relative lock times (BIP68) of tx to be included in block "height".
+// "chain" has to have all the headers before "height", and the inputs of tx
+// have to be in "utxo".
+func CheckSequenceLocks(tx *Tx, height int, chain HeaderChain, utxo UtxoSet) error {
+    if tx.IsCoinBase() || tx.Version < 2 {
+        return nil
+    }
+    // The last height and time at which tx is still invalid
+    minHeight, minTime := int64(-1), int64(-1)
+    for _, txi := range tx.TxIns {
+        seq := txi.Sequence
+        if (seq & numbers.SequenceLockTimeDisableFlag) != 0 {
+            continue
+        }
+        op := &(txi.PreviousOutput)
+        txo, err := utxo.Get(&op.Hash, op.Index)
+        if err != nil {
+            return err
+        }
+        coinHeight := int(txo.Height)
+        value := int64(seq & numbers.SequenceLockTimeMask)
+        if (seq & numbers.SequenceLockTimeTypeFlag) != 0 {
+            // Measured from the median time past of the block before the one
+            // creating the output
+            mtpHeight := coinHeight
+            if mtpHeight < 1 {
+                mtpHeight = 1
+            }
+            coinTime := int64(MedianTimePast(chain, mtpHeight))
+            t := coinTime + (value << numbers.SequenceLockTimeGranularity) - 1
+            if t > minTime {
+                minTime = t
+            }
+        } else {
+            h := int64(coinHeight) + value - 1
+            if h > minHeight {
+                minHeight = h
+            }
+        }
+    }
+    if minHeight >= int64(height) || minTime >= int64(MedianTimePast(chain, height)) {
+        return errSequenceLock
+    }
+    return nil
+}
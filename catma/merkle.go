@@ -0,0 +1,47 @@
+package catma
+
+import (
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+// Returns the merkle root of the tx hashes, as it is recorded in Header.MerkleRoot.
+// A level with odd number of hashes duplicates its last hash, this is how the
+// Satoshi client does it.
+//
+// The second return value reports if two identical hashes were ever paired, which
+// means a different tx list (CVE-2012-2459) would produce the very same root.
+func MerkleRoot(hashes []*klib.Hash256) (*klib.Hash256, bool) {
+    if len(hashes) == 0 {
+        return new(klib.Hash256), false
+    }
+    level := make([]*klib.Hash256, len(hashes))
+    copy(level, hashes)
+    mutated := false
+    buf := make([]byte, 64)
+    for len(level) > 1 {
+        next := make([]*klib.Hash256, 0, (len(level) + 1) / 2)
+        for i := 0; i < len(level); i += 2 {
+            left, right := level[i], level[i]
+            if i + 1 < len(level) {
+                right = level[i+1]
+                if *left == *right {
+                    mutated = true
+                }
+            }
+            copy(buf[:32], left[:])
+            copy(buf[32:], right[:])
+            next = append(next, klib.Sha256Sha256(buf))
+        }
+        level = next
+    }
+    return level[0], mutated
+}
+
+// Returns the merkle root of txs
+func TxsMerkleRoot(txs []*Tx) (*klib.Hash256, bool) {
+    hashes := make([]*klib.Hash256, len(txs))
+    for i, tx := range txs {
+        hashes[i] = tx.Hash()
+    }
+    return MerkleRoot(hashes)
+}
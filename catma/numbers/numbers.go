@@ -14,7 +14,8 @@ const MaxScriptElementSize = 520
 
 const MaxScriptSize = 10000
 
-const MaxOpReturnRelay = 40
+// Max size of a standard OP_RETURN script: OP_RETURN, a push opcode and 80 bytes
+const MaxOpReturnRelay = 83
 
 const PubKeyHashLen = 20
 
@@ -24,6 +25,15 @@ const MinPubKeyLen = 33
 
 const MaxBlockSize = 1000000
 
+const MaxBlockSigOps = MaxBlockSize / 50
+
+// Segwit counts block size in weight, where witness data weighs 1 and others 4
+const WitnessScaleFactor = 4
+
+const MaxBlockWeight = MaxBlockSize * WitnessScaleFactor
+
+const MaxBlockSigOpsCost = MaxBlockSigOps * WitnessScaleFactor
+
 const SatoshiInCoin = 100000000
 
 const SatoshiInTotal = SatoshiInCoin * 21000000
@@ -32,14 +42,123 @@ const MinCoinBaseSigScriptSize = 2
 
 const MaxCoinBaseSigScriptSize = 100 
 
+// Block reward of the first era, halved every SubsidyHalvingInterval blocks
+const InitialSubsidy = 50 * SatoshiInCoin
+
+const SubsidyHalvingInterval = 210000
+
+// Coin base outputs can only be spent after this many blocks
+const CoinbaseMaturity = 100
+
+// Soft forks -------------------------------------
+// BIP34: coin base starts with block height, block version >= 2
+const BIP34Height = 227931
+
+// BIP30 is implied by BIP34 until BIP34 heights start to repeat old coin bases
+const BIP30ReenableHeight = 1983702
+
+// BIP66: strict DER signatures, block version >= 3
+const BIP66Height = 363725
+
+// BIP65: OP_CHECKLOCKTIMEVERIFY, block version >= 4
+const BIP65Height = 388381
+
+// BIP68, BIP112 and BIP113: relative lock time, OP_CHECKSEQUENCEVERIFY
+// and median time past as lock time threshold
+const CSVHeight = 419328
+
+// BIP141, BIP143 and BIP147: segregated witness
+const SegwitHeight = 481824
+
+// BIP340, BIP341 and BIP342: schnorr signatures and taproot
+const TaprootHeight = 709632
+
+// Tapscript signature checks are limited by witness size (BIP342) ---
+// Validation weight each signature check costs
+const ValidationWeightPerSigOp = 50
+
+// Validation weight given on top of the witness size
+const ValidationWeightOffset = 50
+
+// Leaf version of tapscript
+const TapscriptLeafVersion = 0xc0
+
+// Max depth of the script tree in a taproot control block
+const TaprootControlMaxNodeCount = 128
+
+// Sequence numbers as relative lock time (BIP68) ---
+// Set if the sequence number is not a relative lock time
+const SequenceLockTimeDisableFlag = 1 << 31
+
+// Set if the relative lock time is in units of 512 seconds, otherwise blocks
+const SequenceLockTimeTypeFlag = 1 << 22
+
+const SequenceLockTimeMask = 0x0000ffff
+
+const SequenceLockTimeGranularity = 9
+
+// Sequence number of inputs opting out of lock time
+const SequenceFinal = 0xffffffff
+
 // Threshold for nLockTime: below this value it is interpreted as block number, 
 // otherwise as UNIX timestamp.
 const LockTimeThreshold = 500000000; // Tue Nov  5 00:53:20 1985 UTC
 
-const MaxStandardTxSize = 100000
+// Relay policy defaults, see catma.Policy -------
+const MaxStandardTxWeight = 400000
+
+// Satoshis per 1000 virtual bytes
+const MinRelayTxFee = 1000
+
+// Outputs worth less than the fee of spending them at this rate are dust
+const DustRelayTxFee = 3000
+
+const MaxStandardTxSigOpsCost = MaxBlockSigOpsCost / 5
+
+const MaxP2SHSigOps = 15
+
+// Bare multisig with more keys is not standard
+const MaxStandardMultiSigKeys = 3
+
+// Limits of unconfirmed ancestors and descendants of a tx in mempool,
+// counts include the tx itself, sizes are in virtual bytes
+const MaxMempoolAncestors = 25
+
+const MaxMempoolAncestorSize = 101000
+
+const MaxMempoolDescendants = 25
+
+const MaxMempoolDescendantSize = 101000
+
+// Replace-by-fee (BIP125) ---
+// Inputs with sequence numbers up to this signal the tx can be replaced
+const MaxBIP125RBFSequence = 0xfffffffd
+
+// Satoshis per 1000 virtual bytes a replacement has to pay on top of
+// the fees of the txs it replaces
+const IncrementalRelayTxFee = 1000
+
+// Max number of txs a replacement can evict from mempool
+const MaxBIP125Replacements = 100
+
+// Proof of work -------------------------------------
+// Difficulty 1 target in compact form, the easiest target allowed
+const PowLimitBits = 0x1d00ffff
+
+// Difficulty is adjusted every RetargetInterval blocks
+const RetargetInterval = 2016
+
+// Expected time in seconds for RetargetInterval blocks: two weeks
+const TargetTimespan = 14 * 24 * 60 * 60
+
+// Number of previous blocks used to compute median time past
+const MedianTimeSpan = 11
+
+// How far in seconds a block timestamp can be ahead of our clock
+const MaxFutureBlockTime = 2 * 60 * 60
 
 // Versions -----------------------------------------
-const TxCurrentVersion = 1
+const TxCurrentVersion = 2
 
 // Rough numbers ------------------------------------
 const MaxSigScriptSize = 1650
\ No newline at end of file
@@ -0,0 +1,98 @@
+package catma
+
+import (
+    "errors"
+    "encoding/json"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+)
+
+// Relay policy: rules on top of consensus a tx has to follow to be accepted
+// into mempool and relayed. Unlike consensus rules each node can tune them.
+// Fee rates are in satoshi per 1000 virtual bytes.
+type Policy struct {
+    // Highest tx version considered standard
+    MaxTxVersion        uint32
+    MaxTxWeight         int
+    MaxSigScriptSize    int
+    // Outputs worth less than spending them at this fee rate are dust
+    DustRelayFee        int64
+    // Max size of an OP_RETURN output script, 0 disables OP_RETURN outputs
+    MaxDataCarrierSize  int
+    // Allows bare multisig outputs of up to MaxStandardMultiSigKeys keys
+    PermitBareMultiSig  bool
+    // Limit of sigops of a tx, counted as in blocks (TxVerifyResult.SigOpCost)
+    MaxTxSigOpsCost     int
+    // Limit of sigops of a P2SH redeem script
+    MaxP2SHSigOps       int
+    MinRelayFee         int64
+    // Limits of unconfirmed ancestors and descendants, including the tx itself
+    MaxAncestors        int
+    MaxAncestorSize     int
+    MaxDescendants      int
+    MaxDescendantSize   int
+    // Allows replacing txs not signaling replaceability (BIP125)
+    FullRBF             bool
+    // Fee rate a replacement pays for its own relay, on top of replaced fees
+    IncrementalRelayFee int64
+    MaxReplacements     int
+}
+
+// Script flags enforced on relayed txs on top of consensus, so that scripts
+// soft forks might make invalid are not relayed
+const StandardEvalFlags = script.EvalFlagP2SH | script.EvalFlagStrictEnc |
+    script.EvalFlagLowS | script.EvalFlagNullDummy | script.EvalFlagDERSig |
+    script.EvalFlagCheckLockTime | script.EvalFlagCheckSequence |
+    script.EvalFlagWitness | script.EvalFlagTaproot
+
+var (
+    errFeeTooLow = errors.New("Policy.CheckFee: fee lower than min relay fee")
+)
+
+// Returns the policy of the Satoshi client
+func DefaultPolicy() *Policy {
+    return &Policy{
+        MaxTxVersion: numbers.TxCurrentVersion,
+        MaxTxWeight: numbers.MaxStandardTxWeight,
+        MaxSigScriptSize: numbers.MaxSigScriptSize,
+        DustRelayFee: numbers.DustRelayTxFee,
+        MaxDataCarrierSize: numbers.MaxOpReturnRelay,
+        PermitBareMultiSig: true,
+        MaxTxSigOpsCost: numbers.MaxStandardTxSigOpsCost,
+        MaxP2SHSigOps: numbers.MaxP2SHSigOps,
+        MinRelayFee: numbers.MinRelayTxFee,
+        MaxAncestors: numbers.MaxMempoolAncestors,
+        MaxAncestorSize: numbers.MaxMempoolAncestorSize,
+        MaxDescendants: numbers.MaxMempoolDescendants,
+        MaxDescendantSize: numbers.MaxMempoolDescendantSize,
+        FullRBF: false,
+        IncrementalRelayFee: numbers.IncrementalRelayTxFee,
+        MaxReplacements: numbers.MaxBIP125Replacements,
+    }
+}
+
+// Returns DefaultPolicy with fields set by JSON object "p",
+// e.g. {"MinRelayFee": 5000}, an empty "p" returns the defaults.
+func ParsePolicy(p []byte) (*Policy, error) {
+    policy := DefaultPolicy()
+    if len(p) == 0 {
+        return policy, nil
+    }
+    if err := json.Unmarshal(p, policy); err != nil {
+        return nil, err
+    }
+    return policy, nil
+}
+
+// Returns the min fee to relay a tx of "vsize" virtual bytes
+func (p *Policy) MinFee(vsize int) int64 {
+    return int64(vsize) * p.MinRelayFee / 1000
+}
+
+// Checks if "fee" is enough to relay tx of "vsize" virtual bytes
+func (p *Policy) CheckFee(fee int64, vsize int) error {
+    if fee < p.MinFee(vsize) {
+        return errFeeTooLow
+    }
+    return nil
+}
@@ -0,0 +1,204 @@
+// Proof of work and difficulty adjustment
+package catma
+
+import (
+    "time"
+    "sort"
+    "errors"
+    "math/big"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+)
+
+// Read-only view of a header chain, used to validate the header at the end of it
+type HeaderChain interface {
+    // Returns the header at "height", nil if out of range
+    Get(height int) *Header
+}
+
+var (
+    errBadBits = errors.New("CheckHeader: invalid difficulty target")
+
+    errHighHash = errors.New("CheckHeader: hash doesn't meet target")
+
+    errWrongBits = errors.New("CheckHeader: difficulty target doesn't match retargeting")
+
+    errTimeTooOld = errors.New("CheckHeader: timestamp not after median time past")
+
+    errTimeTooNew = errors.New("CheckHeader: timestamp too far in the future")
+
+    errMissingAncestor = errors.New("CheckHeader: ancestor header missing")
+
+    errOldVersion = errors.New("CheckHeader: obsolete block version")
+)
+
+// The easiest target allowed, which is NOT the same as PowLimitBits decoded.
+var powLimit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 224), big.NewInt(1))
+
+// Decodes the compact form "Bits" into a big number.
+// Compact is a floating point like format: the highest byte is the size of
+// the number in bytes, and the rest 3 bytes are the most significant digits.
+// The 0x00800000 bit is the sign bit.
+func CompactToBig(bits uint32) *big.Int {
+    size := uint(bits >> 24)
+    word := bits & 0x007fffff
+    var n *big.Int
+    if size <= 3 {
+        n = big.NewInt(int64(word >> (8 * (3 - size))))
+    } else {
+        n = new(big.Int).Lsh(big.NewInt(int64(word)), 8 * (size - 3))
+    }
+    if word != 0 && (bits & 0x00800000) != 0 {
+        n.Neg(n)
+    }
+    return n
+}
+
+// Encodes a big number into compact form
+func BigToCompact(n *big.Int) uint32 {
+    if n.Sign() == 0 {
+        return 0
+    }
+    abs := new(big.Int).Abs(n)
+    size := uint32(len(abs.Bytes()))
+    var compact uint32
+    if size <= 3 {
+        compact = uint32(abs.Uint64()) << (8 * (3 - size))
+    } else {
+        compact = uint32(new(big.Int).Rsh(abs, uint(8 * (size - 3))).Uint64())
+    }
+    // The 0x00800000 bit is the sign bit, so if it's already set,
+    // divide the mantissa by 256 and increase the exponent.
+    if (compact & 0x00800000) != 0 {
+        compact >>= 8
+        size++
+    }
+    compact |= size << 24
+    if n.Sign() < 0 {
+        compact |= 0x00800000
+    }
+    return compact
+}
+
+// Interprets the hash as a 256 bit little endian number
+func HashToBig(h *klib.Hash256) *big.Int {
+    p := make([]byte, 32)
+    for i := 0; i < 32; i++ {
+        p[i] = h[31-i]
+    }
+    return new(big.Int).SetBytes(p)
+}
+
+// Checks that the header hash meets the target claimed by itself
+func CheckProofOfWork(h *Header) error {
+    target := CompactToBig(h.Bits)
+    if target.Sign() <= 0 || target.Cmp(powLimit) > 0 {
+        return errBadBits
+    }
+    if HashToBig(h.Hash()).Cmp(target) > 0 {
+        return errHighHash
+    }
+    return nil
+}
+
+// Returns the new target after a retarget period that started at "firstTime" and
+// ended with a block with "lastBits" at "lastTime".
+func CalcNextBits(lastBits uint32, firstTime uint32, lastTime uint32) uint32 {
+    actual := int64(lastTime) - int64(firstTime)
+    // Limit adjustment step to 4x either way
+    if actual < numbers.TargetTimespan / 4 {
+        actual = numbers.TargetTimespan / 4
+    }
+    if actual > numbers.TargetTimespan * 4 {
+        actual = numbers.TargetTimespan * 4
+    }
+    n := CompactToBig(lastBits)
+    n.Mul(n, big.NewInt(actual))
+    n.Div(n, big.NewInt(numbers.TargetTimespan))
+    if n.Cmp(powLimit) > 0 {
+        n.Set(powLimit)
+    }
+    return BigToCompact(n)
+}
+
+// Returns the Bits the header at "height" is required to have
+func NextBits(chain HeaderChain, height int) (uint32, error) {
+    if height == 0 {
+        return numbers.PowLimitBits, nil
+    }
+    last := chain.Get(height - 1)
+    if last == nil {
+        return 0, errMissingAncestor
+    }
+    if height % numbers.RetargetInterval != 0 {
+        return last.Bits, nil
+    }
+    // Another Satoshi Bug: the period is measured from the first block of the
+    // period, so it's actually 2015 blocks long instead of 2016.
+    first := chain.Get(height - numbers.RetargetInterval)
+    if first == nil {
+        return 0, errMissingAncestor
+    }
+    return CalcNextBits(last.Bits, first.Timestamp, last.Timestamp), nil
+}
+
+// Returns the median timestamp of the MedianTimeSpan blocks before "height"
+func MedianTimePast(chain HeaderChain, height int) uint32 {
+    times := make([]int, 0, numbers.MedianTimeSpan)
+    for i := height - 1; i >= 0 && i >= height - numbers.MedianTimeSpan; i-- {
+        if h := chain.Get(i); h != nil {
+            times = append(times, int(h.Timestamp))
+        }
+    }
+    if len(times) == 0 {
+        return 0
+    }
+    sort.Ints(times)
+    return uint32(times[len(times) / 2])
+}
+
+// Validates header "h" to be appended to "chain" at "height",
+// "chain" is expected to have all the headers before "height".
+func CheckHeader(h *Header, height int, chain HeaderChain, now time.Time) error {
+    if err := CheckProofOfWork(h); err != nil {
+        return err
+    }
+    return CheckHeaderContext(h, height, chain, now)
+}
+
+// CheckHeader without proof of work, for headers not mined yet, e.g. block templates
+func CheckHeaderContext(h *Header, height int, chain HeaderChain, now time.Time) error {
+    bits, err := NextBits(chain, height)
+    if err != nil {
+        return err
+    }
+    if h.Bits != bits {
+        return errWrongBits
+    }
+    if h.Timestamp <= MedianTimePast(chain, height) {
+        return errTimeTooOld
+    }
+    if int64(h.Timestamp) > now.Unix() + numbers.MaxFutureBlockTime {
+        return errTimeTooNew
+    }
+    // Version is signed in the Satoshi client, the ones with the top bit set
+    // are lower than any of these
+    version := int32(h.Version)
+    if (version < 2 && height >= numbers.BIP34Height) ||
+        (version < 3 && height >= numbers.BIP66Height) ||
+        (version < 4 && height >= numbers.BIP65Height) {
+        return errOldVersion
+    }
+    return nil
+}
+
+// Returns the expected number of hashes to find a header with "bits",
+// which is 2^256 / (target+1)
+func BlockWork(bits uint32) *big.Int {
+    target := CompactToBig(bits)
+    if target.Sign() <= 0 {
+        return big.NewInt(0)
+    }
+    denominator := new(big.Int).Add(target, big.NewInt(1))
+    return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
@@ -0,0 +1,52 @@
+// Conversion between pkScripts and addresses
+package script
+
+import (
+    "errors"
+    "github.com/oxfeeefeee/kaiju/klib/address"
+    )
+
+// Returns the pkScript paying to address "addr" of network "net"
+func FromAddress(addr string, net *address.Network) (Script, error) {
+    a, err := address.Decode(addr, net)
+    if err != nil {
+        return nil, err
+    }
+    s := NewScript()
+    switch a.Type {
+    case address.AddrPubKeyHash:
+        s.AppendOp(OP_DUP)
+        s.AppendOp(OP_HASH160)
+        s.AppendPushData(a.Hash)
+        s.AppendOp(OP_EQUALVERIFY)
+        s.AppendOp(OP_CHECKSIG)
+    case address.AddrScriptHash:
+        s.AppendOp(OP_HASH160)
+        s.AppendPushData(a.Hash)
+        s.AppendOp(OP_EQUAL)
+    case address.AddrWitness:
+        if a.Version == 0 {
+            s.AppendOp(OP_PUSHDATA00)
+        } else {
+            s.AppendOp(Opcode(int(OP_1) + a.Version - 1))
+        }
+        s.AppendPushData(a.Hash)
+    }
+    return *s, nil
+}
+
+// Returns the address of pkScript on network "net", only P2PKH, P2SH
+// and witness programs have addresses.
+func (s Script) Address(net *address.Network) (string, error) {
+    var a *address.Address
+    if s.IsTypePubKeyHash() {
+        a = &address.Address{Type: address.AddrPubKeyHash, Hash: s[3:23]}
+    } else if s.IsTypeScriptHash() {
+        a = &address.Address{Type: address.AddrScriptHash, Hash: s[2:22]}
+    } else if v, p, ok := s.WitnessProgram(); ok {
+        a = &address.Address{Type: address.AddrWitness, Version: v, Hash: p}
+    } else {
+        return "", errors.New("Script.Address: no address for " + s.PKScriptType().String())
+    }
+    return a.Encode(net)
+}
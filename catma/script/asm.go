@@ -0,0 +1,148 @@
+// Conversion between scripts and their text form
+package script
+
+import (
+    "fmt"
+    "bytes"
+    "errors"
+    "strconv"
+    "strings"
+    "encoding/hex"
+    )
+
+// Opcode names accepted by Assemble, with and without the "OP_" prefix
+var asmNames map[string]Opcode
+
+func init() {
+    asmNames = map[string]Opcode{
+        "0": OP_PUSHDATA00,
+        "OP_0": OP_PUSHDATA00,
+        "OP_FALSE": OP_PUSHDATA00,
+        "OP_TRUE": OP_1,
+        "OP_1NEGATE": OP_1NEGATE,
+        "OP_CHECKLOCKTIMEVERIFY": OP_CHECKLOCKTIMEVERIFY,
+        "OP_CHECKSEQUENCEVERIFY": OP_CHECKSEQUENCEVERIFY,
+    }
+    for i := 1; i <= 16; i++ {
+        asmNames[fmt.Sprintf("OP_%d", i)] = Opcode(int(OP_1) + i - 1)
+    }
+    for i := 0; i < 256; i++ {
+        op := Opcode(i)
+        if name := op.String(); name != "OP_UNKNOWN" {
+            asmNames[name] = op
+        }
+    }
+    for name, op := range asmNames {
+        if strings.HasPrefix(name, "OP_") {
+            asmNames[name[3:]] = op
+        }
+    }
+}
+
+// Returns the text form of script, e.g.
+//   OP_DUP OP_HASH160 <4c9c3dfac4207d5d8cb89df5722cb3d712385e3f> OP_EQUALVERIFY OP_CHECKSIG
+// Data pushed by opcode 0x01-0x4b is shown as <hex>, OP_PUSHDATA1/2/4 as
+// "OP_PUSHDATA1 <hex>", and OP_0, OP_1NEGATE, OP_1-OP_16 as numbers.
+// Unknown opcodes and a malformed tail are shown as raw bytes "0x<hex>".
+// Assemble turns the text back into the same script.
+func Disassemble(s Script) string {
+    words := make([]string, 0)
+    for pc := 0; pc < len(s); {
+        op, operand, next, err := s.getOpcode(pc)
+        if err != nil {
+            words = append(words, "0x" + hex.EncodeToString(s[pc:]))
+            break
+        }
+        switch {
+        case op == OP_PUSHDATA00:
+            words = append(words, "0")
+        case op < OP_PUSHDATA1:
+            words = append(words, "<" + hex.EncodeToString(operand) + ">")
+        case op <= OP_PUSHDATA4:
+            words = append(words, op.String() + " <" + hex.EncodeToString(operand) + ">")
+        case op.String() == "OP_UNKNOWN":
+            words = append(words, fmt.Sprintf("0x%02x", byte(op)))
+        default:
+            words = append(words, op.String())
+        }
+        pc = next
+    }
+    return strings.Join(words, " ")
+}
+
+// Parses the text form of a script, as returned by Disassemble.
+// Also accepted are the forms used by the Satoshi client test data: opcode names
+// without "OP_", decimal numbers pushed as script integers, 'text' pushed
+// as data, and raw bytes as "0x<hex>".
+func Assemble(text string) (Script, error) {
+    s := NewScript()
+    words := strings.Fields(text)
+    for i := 0; i < len(words); i++ {
+        w := words[i]
+        if op, ok := asmNames[w]; ok {
+            if op >= OP_PUSHDATA1 && op <= OP_PUSHDATA4 &&
+                i + 1 < len(words) && isAsmData(words[i+1]) {
+                data, err := hex.DecodeString(words[i+1][1:len(words[i+1])-1])
+                if err != nil {
+                    return nil, fmt.Errorf("Assemble: bad data %s", words[i+1])
+                }
+                if err := appendPushDataWith(s, op, data); err != nil {
+                    return nil, err
+                }
+                i++
+            } else {
+                s.AppendOp(op)
+            }
+            continue
+        }
+        switch {
+        case isAsmData(w):
+            data, err := hex.DecodeString(w[1:len(w)-1])
+            if err != nil {
+                return nil, fmt.Errorf("Assemble: bad data %s", w)
+            }
+            s.AppendPushData(data)
+        case len(w) > 2 && w[:2] == "0x":
+            data, err := hex.DecodeString(w[2:])
+            if err != nil {
+                return nil, fmt.Errorf("Assemble: bad hex %s", w)
+            }
+            s.AppendData(data)
+        case len(w) >= 2 && w[0] == '\'' && w[len(w)-1] == '\'':
+            s.AppendPushData([]byte(w[1:len(w)-1]))
+        default:
+            n, err := strconv.ParseInt(w, 10, 64)
+            if err != nil {
+                return nil, fmt.Errorf("Assemble: unknown word %s", w)
+            }
+            s.AppendPushInt(n)
+        }
+    }
+    return *s, nil
+}
+
+func isAsmData(w string) bool {
+    return len(w) >= 2 && w[0] == '<' && w[len(w)-1] == '>'
+}
+
+// Pushes data with OP_PUSHDATA1/2/4, even if a shorter opcode would do
+func appendPushDataWith(s *Script, op Opcode, data []byte) error {
+    size := new(bytes.Buffer)
+    switch {
+    case op == OP_PUSHDATA1 && len(data) <= 0xff:
+        size.WriteByte(byte(len(data)))
+    case op == OP_PUSHDATA2 && len(data) <= 0xffff:
+        size.WriteByte(byte(len(data)))
+        size.WriteByte(byte(len(data) >> 8))
+    case op == OP_PUSHDATA4:
+        for i := uint(0); i < 32; i += 8 {
+            size.WriteByte(byte(len(data) >> i))
+        }
+    default:
+        return errors.New("Assemble: data too long for " + op.String())
+    }
+    s.AppendOp(op)
+    s.AppendData(size.Bytes())
+    s.AppendData(data)
+    return nil
+}
@@ -53,4 +53,42 @@ var (
     errScriptSizeLimit = errors.New("eval: size of script exceeded limit")
 
     errDisabledOp = errors.New("eval: Disabled opcode in script")
+
+    errSigDER = errors.New("Signature not strict DER")
+
+    errSigHighS = errors.New("Signature S value is unnecessarily high")
+
+    errNoTxContext = errors.New("eval: lock time check without tx")
+
+    errNegativeLockTime = errors.New("eval: negative lock time")
+
+    errUnsatisfiedLockTime = errors.New("eval: lock time requirement not satisfied")
+
+    errWitnessMalleated = errors.New("Witness program with non-empty sigScript")
+
+    errWitnessUnexpected = errors.New("Witness provided for non-witness script")
+
+    errWitnessEmpty = errors.New("Witness program with empty witness")
+
+    errWitnessMismatch = errors.New("Witness program hash mismatch")
+
+    errWitnessWrongLength = errors.New("Witness program has wrong length")
+
+    errTaprootControlSize = errors.New("Taproot control block has wrong size")
+
+    errTaprootCommitment = errors.New("Taproot output key doesn't commit to the script")
+
+    errTapscriptMultiSig = errors.New("OP_CHECKMULTISIG is disabled in tapscript")
+
+    errTapscriptMinimalIf = errors.New("OP_IF/OP_NOTIF argument must be minimal in tapscript")
+
+    errTapscriptEmptyPubKey = errors.New("Empty public key in tapscript")
+
+    errTapscriptValidationWeight = errors.New("Tapscript validation weight exceeded")
+
+    errSchnorrSig = errors.New("Schnorr signature verification failed")
+
+    errSchnorrSigSize = errors.New("Schnorr signature has wrong size")
+
+    errSchnorrSigHashType = errors.New("Schnorr signature has invalid hash type")
     )
\ No newline at end of file
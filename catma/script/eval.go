@@ -8,10 +8,40 @@ import (
 
 type scriptContext interface {
     HashToSign(subScript []byte, hashType byte) (*klib.Hash256, error)
+    // Hash to sign of segwit version 0 scripts, as defined in BIP143
+    WitnessHashToSign(subScript []byte, hashType byte) (*klib.Hash256, error)
+    // Witness stack of the input being verified
+    Witness() [][]byte
+    // Hash to sign of taproot, as defined in BIP341. "leafHash" is nil for
+    // key path spending, otherwise it's tapscript and "codeSepPos" is the
+    // opcode position of the last executed OP_CODESEPARATOR.
+    TaprootHashToSign(hashType byte, annex []byte, leafHash []byte, codeSepPos uint32) (*klib.Hash256, error)
+    // Fields of the tx and the input being verified, used by lock time opcodes
+    TxVersion() uint32
+    LockTime() uint32
+    Sequence() uint32
 }
 
 var fnTable []execFunc
 
+// Which kind of script is running, they have different signature checking rules
+type sigVersion int
+
+const (
+    sigVersionBase sigVersion = iota
+    sigVersionWitnessV0
+    sigVersionTaproot   // Key path spending, no script is run
+    sigVersionTapscript
+)
+
+// Extra state of tapscript execution (BIP342)
+type tapState struct {
+    leafHash    []byte
+    annex       []byte
+    codeSepPos  uint32  // Opcode position of the last executed OP_CODESEPARATOR
+    budget      int     // Validation weight left for signature checks
+}
+
 // Context used by execXXXX functions
 type execContext struct {
     stack       *stack          // Script running main stack
@@ -19,78 +49,111 @@ type execContext struct {
     bStack      boolStack       // Branching stack
     separator   int             // Hash starts after the code separator
     pc          int             // Next pc
+    opPos       int             // Position of the current opcode
     opCount     int             // Opcode count
     script      Script
     sctx        scriptContext
     flags       EvalFlag
+    sigVersion  sigVersion
+    tap         *tapState       // Only for tapscript
+    tracer      Tracer          // Optional, receives each step
 }
 
 type execFunc func(ctx *execContext, op Opcode, operand []byte) error
 
-func (s *stack) eval(script Script, c scriptContext, flags EvalFlag) error {
+func (s *stack) eval(script Script, c scriptContext, flags EvalFlag, sv sigVersion, t Tracer) error {
+    if t != nil {
+        t.Start(script)
+    }
     if len(script) > numbers.MaxScriptSize {
         return errScriptSizeLimit
     }
-    pc := 0
     ctx := &execContext{s, &stack{}, make([]bool, 0),
-        0, 0, 0, script, c, flags}
+        0, 0, -1, 0, script, c, flags, sv, nil, t}
+    return ctx.run()
+}
+
+// Tapscript has no limit on script size and opcode count
+func (s *stack) evalTapscript(script Script, c scriptContext, flags EvalFlag, tap *tapState, t Tracer) error {
+    if t != nil {
+        t.Start(script)
+    }
+    ctx := &execContext{s, &stack{}, make([]bool, 0),
+        0, 0, -1, 0, script, c, flags, sigVersionTapscript, tap, t}
+    return ctx.run()
+}
+
+func (ctx *execContext) run() error {
+    script := ctx.script
+    pc := 0
     for pc < len(script) {
         op, operand, next, err := script.getOpcode(pc)
         //log.Debugf("op: %s %v\n", op, operand)
-        pc = next
         ctx.pc = next
+        ctx.opPos++
+        skipped := false
+        if err == nil {
+            skipped, err = ctx.step(op, operand)
+        }
+        if ctx.tracer != nil {
+            ctx.tracer.Step(ctx.traceStep(pc, op, operand, skipped, err))
+        }
         if err != nil {
             return err
         }
+        pc = next
+    }
+    if !ctx.bStack.empty() {
+        return errIfElseMismatch
+    }
+    return nil
+}
 
-        if len(operand) > numbers.MaxScriptElementSize {
-            return errOperandSizeLimit
-        }
-
-        if op >= OP_NOP {
-            ctx.opCount++
-            if ctx.opCount > numbers.MaxOpcodeCount {
-                return errOpcodeCount
-            }
-        }
+// Executes one opcode, returns true if it's skipped in a non-executed branch
+func (ctx *execContext) step(op Opcode, operand []byte) (bool, error) {
+    if len(operand) > numbers.MaxScriptElementSize {
+        return false, errOperandSizeLimit
+    }
 
-        // Another Satoshi Bug: any other junk data can be included in script as long as not
-        // getting executed, but Disabled Opcodes make the script invalid no matter what.
-        if int(op) >= 0 && int(op) < len(fnTable) && fnTable[op] == nil {
-            return errDisabledOp
+    if op >= OP_NOP && ctx.sigVersion != sigVersionTapscript {
+        ctx.opCount++
+        if ctx.opCount > numbers.MaxOpcodeCount {
+            return false, errOpcodeCount
         }
+    }
 
-        alive := ctx.bStack.alive()  
-        if !alive && !(op >= OP_IF && op <= OP_ENDIF) {
-            // Skip the code if we are in non-execute branch and the op is not
-            // OP_IF / OP_NOTIF / OP_ELSE / OP_ENDIF
-            continue
-        }
+    // Another Satoshi Bug: any other junk data can be included in script as long as not
+    // getting executed, but Disabled Opcodes make the script invalid no matter what.
+    if int(op) >= 0 && int(op) < len(fnTable) && fnTable[op] == nil {
+        return false, errDisabledOp
+    }
 
-        if op < 0 || int(op) >= len(fnTable) {
-            return errInvalidOp
-        }
+    alive := ctx.bStack.alive()  
+    if !alive && !(op >= OP_IF && op <= OP_ENDIF) {
+        // Skip the code if we are in non-execute branch and the op is not
+        // OP_IF / OP_NOTIF / OP_ELSE / OP_ENDIF
+        return true, nil
+    }
 
-        fn := fnTable[op]
-        err = fn(ctx, op, operand)
-        if err != nil {
-            return err
-        }
+    if op < 0 || int(op) >= len(fnTable) {
+        return false, errInvalidOp
+    }
 
-        if ctx.stack.height() + ctx.altStack.height() > numbers.MaxScriptEvalStackSize {
-            return errStackSizeLimit
-        }
+    fn := fnTable[op]
+    if err := fn(ctx, op, operand); err != nil {
+        return false, err
     }
-    if !ctx.bStack.empty() {
-        return errIfElseMismatch
+
+    if ctx.stack.height() + ctx.altStack.height() > numbers.MaxScriptEvalStackSize {
+        return false, errStackSizeLimit
     }
-    return nil
+    return false, nil
 }
 
 // Init function table
 func init() {
-    fnTable = make([]execFunc, 0, byte(OP_NOP10) + 1)
-    for op := OP_PUSHDATA00; op <= OP_NOP10; op++ {
+    fnTable = make([]execFunc, 0, byte(OP_CHECKSIGADD) + 1)
+    for op := OP_PUSHDATA00; op <= OP_CHECKSIGADD; op++ {
         _, fn := op.attr()
         fnTable = append(fnTable, fn)
     }
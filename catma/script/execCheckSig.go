@@ -3,6 +3,7 @@ package script
 import (
     "bytes"
     "errors"
+    "math/big"
     "crypto/ecdsa"
     "github.com/oxfeeefeee/kaiju/klib"
     "github.com/oxfeeefeee/kaiju/catma/numbers"
@@ -16,13 +17,34 @@ func execCheckSig(ctx *execContext, op Opcode, _ []byte) error {
     }
     pk := ctx.stack.pop()
     sig := ctx.stack.pop()
+    if ctx.sigVersion == sigVersionTapscript {
+        ok, err := checkTapSig(ctx, pk, sig)
+        if err != nil {
+            return err
+        }
+        if op == OP_CHECKSIGVERIFY {
+            if !ok {
+                return errSigVerify
+            }
+        } else {
+            ctx.stack.push(boolToStackItem(ok))
+        }
+        return nil
+    }
+    if err := checkSigEncoding(sig, ctx.flags); err != nil {
+        return err
+    }
     subScript := make([]byte, len(ctx.script) - ctx.separator)
     copy(subScript, ctx.script[ctx.separator:])
-    subScript, err := removeSig(subScript, sig)
-    if err != nil {
-        return err
+    // Signatures can't sign themselves, but it's not an issue with BIP143
+    if ctx.sigVersion == sigVersionBase {
+        var err error
+        subScript, err = removeSig(subScript, sig)
+        if err != nil {
+            return err
+        }
     }
-    err = checkKeySig(ctx.sctx, pk, sig, subScript, ctx.flags)
+    err := checkKeySig(ctx.sctx, pk, sig, subScript, ctx.flags, ctx.sigVersion)
     if op == OP_CHECKSIGVERIFY {
         if err != nil {
             return errSigVerify
@@ -40,6 +62,10 @@ func execCheckSig(ctx *execContext, op Opcode, _ []byte) error {
 // OP_CHECKMULTISIG
 // OP_CHECKMULTISIGVERIFY
 func execCheckMultiSig(ctx *execContext, op Opcode, _ []byte) error {
+    // Replaced by OP_CHECKSIGADD in tapscript
+    if ctx.sigVersion == sigVersionTapscript {
+        return errTapscriptMultiSig
+    }
     i := 1
     if ctx.stack.height() < i {
         return errStackItemMissing
@@ -71,7 +97,7 @@ func execCheckMultiSig(ctx *execContext, op Opcode, _ []byte) error {
 
     subScript := make([]byte, len(ctx.script) - ctx.separator)
     copy(subScript, ctx.script[ctx.separator:])
-    for k := 0; k < sCount; k++ {
+    for k := 0; k < sCount && ctx.sigVersion == sigVersionBase; k++ {
         var err error
         subScript, err = removeSig(subScript, ctx.stack.top(-(iSig + k)))
         if err != nil {
@@ -82,7 +108,10 @@ func execCheckMultiSig(ctx *execContext, op Opcode, _ []byte) error {
     for success && (sCount > 0) {
         pk := ctx.stack.top(-iKey)
         sig := ctx.stack.top(-iSig)
-        err := checkKeySig(ctx.sctx, pk, sig, subScript, ctx.flags)
+        if err := checkSigEncoding(sig, ctx.flags); err != nil {
+            return err
+        }
+        err := checkKeySig(ctx.sctx, pk, sig, subScript, ctx.flags, ctx.sigVersion)
         if err == nil {
             iSig++
             sCount--
@@ -165,11 +194,9 @@ func removeSig(subScript Script, sig []byte) (Script, error) {
     return subScript, nil
 }
 
-func checkKeySig(c scriptContext, pk []byte, sig []byte, subScript Script, flags EvalFlag) error {
+func checkKeySig(c scriptContext, pk []byte, sig []byte, subScript Script, flags EvalFlag,
+    sv sigVersion) error {
     if (flags & EvalFlagStrictEnc) != 0 {
-        if (flags & EvalFlagLowS) != 0 {
-            panic("EvalFlag_LOW_S not implemented")
-        }
         err := canonicalPK(pk)
         if err != nil {
             return err
@@ -179,13 +206,14 @@ func checkKeySig(c scriptContext, pk []byte, sig []byte, subScript Script, flags
             return err
         }
     }
-    return verifySig(c, pk, sig, subScript)
+    return verifySig(c, pk, sig, subScript, sv)
 }
 
 // See https://en.bitcoin.it/wiki/OP_CHECKSIG
-func verifySig(c scriptContext, pk []byte, sig []byte, subScript Script) error {
-    // STEP1: Remove OP_CODESEPARATOR's from subScript
-    for current := 0; current < len(subScript); {
+// and BIP143 for segwit version 0 scripts
+func verifySig(c scriptContext, pk []byte, sig []byte, subScript Script, sv sigVersion) error {
+    // STEP1: Remove OP_CODESEPARATOR's from subScript, BIP143 keeps them
+    for current := 0; current < len(subScript) && sv == sigVersionBase; {
         op, _, next, err := subScript.getOpcode(current)
         if err != nil {
             return err
@@ -202,12 +230,19 @@ func verifySig(c scriptContext, pk []byte, sig []byte, subScript Script) error {
     if len(sig) == 0 {
         return errEmptySig
     }
-    hash, err := c.HashToSign(subScript, sig[len(sig)-1])
+    var hash *klib.Hash256
+    var err error
+    if sv == sigVersionWitnessV0 {
+        hash, err = c.WitnessHashToSign(subScript, sig[len(sig)-1])
+    } else {
+        hash, err = c.HashToSign(subScript, sig[len(sig)-1])
+    }
     if err != nil {
         return err
     }
 
-    // STEP3: Verify the sig
+    // STEP3: Verify the sig, unless it's known to be valid. Both are parsed
+    // first, so only a pubkey and a sig that are well formed hit the cache
     pubKey, err := klib.PubKey(pk).GoPubKey()
     if err != nil {
         return err
@@ -217,9 +252,14 @@ func verifySig(c scriptContext, pk []byte, sig []byte, subScript Script) error {
     if err != nil {
         return err
     }
+    key := sigCacheKey(hash, pk, sig)
+    if validSigs.contains(&key) {
+        return nil
+    }
     if !ecdsa.Verify(pubKey, hash[:], r, s) {
         return errors.New("verifySig: ecdsa verification failed")
     }
+    validSigs.add(&key)
     return nil
 }
 
@@ -244,6 +284,35 @@ func canonicalPK(pk []byte) error {
     return nil
 }
 
+// Unlike other encoding checks which only make CHECKSIG fail, a non-DER
+// signature fails the whole script under BIP66, so does a high S.
+// Empty signatures are allowed as a compact way to provide an invalid signature.
+func checkSigEncoding(sig []byte, flags EvalFlag) error {
+    if len(sig) == 0 || (flags & (EvalFlagDERSig | EvalFlagLowS)) == 0 {
+        return nil
+    }
+    if !isDERSig(sig) {
+        return errSigDER
+    }
+    if (flags & EvalFlagLowS) != 0 && !isLowS(sig) {
+        return errSigHighS
+    }
+    return nil
+}
+
+// Half the order of secp256k1, for every S above it N - S makes a valid
+// signature too, which is how sigs are malleated
+var halfOrder, _ = new(big.Int).SetString(
+    "7fffffffffffffffffffffffffffffff5d576e7357a4501ddfe92f46681b20a0", 16)
+
+// Checks S of a strict DER signature is no more than halfOrder
+func isLowS(sig []byte) bool {
+    lenR := int(sig[3])
+    lenS := int(sig[5+lenR])
+    s := new(big.Int).SetBytes(sig[6+lenR:6+lenR+lenS])
+    return s.Cmp(halfOrder) <= 0
+}
+
 func canonicalSig(sig []byte) error {
     l := len(sig)
     if l < 9 || l > 73 {
@@ -253,49 +322,145 @@ func canonicalSig(sig []byte) error {
     if hashType < 1 || hashType > 3 { 
         return errSigNonCanonical   // Unknown hashtype byte
     }
+    if !isDERSig(sig) {
+        return errSigNonCanonical
+    }
+    return nil
+}
+
+// Checks the signature (with hash type byte) is strict DER, as defined in BIP66
+func isDERSig(sig []byte) bool {
+    l := len(sig)
+    if l < 9 || l > 73 {
+        return false
+    }
     if sig[0] != 0x30 { 
-        return errSigNonCanonical   // Wrong type
+        return false    // Wrong type
     }
     if int(sig[1]) != (l - 3) {
-        return errSigNonCanonical   // Wrong length marker
+        return false    // Wrong length marker
     }
-    lenR := sig[3]
-    if (5 + int(lenR)) >= l {
-        return errSigNonCanonical   // S length misplaced
+    lenR := int(sig[3])
+    if (5 + lenR) >= l {
+        return false    // S length misplaced
     }
-    lenS := sig[5+lenR]
-    if int(lenR + lenS + 7) != l {
-        return errSigNonCanonical   // R+S length mismatch
+    lenS := int(sig[5+lenR])
+    if (lenR + lenS + 7) != l {
+        return false    // R+S length mismatch
     }
 
     rBegin := 4
     r := sig[rBegin:]
     if sig[rBegin-2] != 0x02 {
-        return errSigNonCanonical   //R value type mismatch
+        return false    //R value type mismatch
     }
     if lenR == 0 {
-        return errSigNonCanonical   //R length is zero
+        return false    //R length is zero
     }
     if (r[0] & 0x80) != 0 {
-        return errSigNonCanonical   //R length is negative
+        return false    //R length is negative
     }
     if (lenR > 1) && (r[0] == 0x00) && ((r[1] & 0x80) == 0) {
-        return errSigNonCanonical   // R value excessively padded
+        return false    // R value excessively padded
     }
 
     sBegin := 6 + lenR
     s := sig[sBegin:]
     if sig[sBegin-2] != 0x02 {
-        return errSigNonCanonical   //S value type mismatch
+        return false    //S value type mismatch
     }
     if lenS == 0 {
-        return errSigNonCanonical   //S length is zero
+        return false    //S length is zero
     }
     if (s[0] & 0x80) != 0 {
-        return errSigNonCanonical   //S length is negative
+        return false    //S length is negative
     }
     if (lenS > 1) && (s[0] == 0x00) && ((s[1] & 0x80) == 0) {
-        return errSigNonCanonical   //S value excessively padded
+        return false    //S value excessively padded
+    }
+    return true
+}
+
+// OP_CHECKSIGADD, only valid in tapscript.
+// Pops pubkey, n and sig, pushes n+1 if sig is valid, or n if sig is empty.
+func execCheckSigAdd(ctx *execContext, _ Opcode, _ []byte) error {
+    if ctx.sigVersion != sigVersionTapscript {
+        return errInvalidOp
+    }
+    if ctx.stack.height() < 3 {
+        return errStackItemMissing
+    }
+    pk := ctx.stack.pop()
+    nItem := ctx.stack.pop()
+    if klib.ScriptIntOverflow(nItem) {
+        return errScriptIntOverflow
+    }
+    n := klib.ToScriptInt(nItem)
+    sig := ctx.stack.pop()
+    ok, err := checkTapSig(ctx, pk, sig)
+    if err != nil {
+        return err
+    }
+    if ok {
+        n++
+    }
+    ctx.stack.push(n.Bytes())
+    return nil
+}
+
+// Signature check of tapscript (BIP342), returns false if sig is empty.
+// Unlike legacy scripts, a non-empty sig has to be valid.
+func checkTapSig(ctx *execContext, pk []byte, sig []byte) (bool, error) {
+    if len(sig) > 0 {
+        ctx.tap.budget -= numbers.ValidationWeightPerSigOp
+        if ctx.tap.budget < 0 {
+            return false, errTapscriptValidationWeight
+        }
+    }
+    if len(pk) == 0 {
+        return false, errTapscriptEmptyPubKey
+    }
+    if len(sig) == 0 {
+        return false, nil
+    }
+    // Unknown public key types are reserved for future soft forks
+    if len(pk) == 32 {
+        err := verifySchnorrSig(ctx.sctx, pk, sig, ctx.tap)
+        if err != nil {
+            return false, err
+        }
+    }
+    return true, nil
+}
+
+// Verifies a BIP340 signature of taproot, "tap.leafHash" is nil for key path spending.
+// A 64 bytes sig has the default hash type, which signs the same as SIGHASH_ALL.
+func verifySchnorrSig(c scriptContext, pk []byte, sig []byte, tap *tapState) error {
+    if c == nil {
+        return errNoTxContext
+    }
+    hashType := byte(0)
+    if len(sig) == 65 {
+        hashType = sig[64]
+        // The default hash type has to be implicit
+        if hashType == 0 {
+            return errSchnorrSigHashType
+        }
+        sig = sig[:64]
+    } else if len(sig) != 64 {
+        return errSchnorrSigSize
+    }
+    hash, err := c.TaprootHashToSign(hashType, tap.annex, tap.leafHash, tap.codeSepPos)
+    if err != nil {
+        return err
+    }
+    key := sigCacheKey(hash, pk, sig)
+    if validSigs.contains(&key) {
+        return nil
+    }
+    if !klib.XOnlyPubKey(pk).VerifySchnorr(hash[:], klib.SchnorrSig(sig)) {
+        return errSchnorrSig
     }
+    validSigs.add(&key)
     return nil
 }
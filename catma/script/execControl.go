@@ -27,7 +27,13 @@ func execBranching(ctx *execContext, op Opcode, _ []byte) error {
             if ctx.stack.empty() {
                 return errStackItemMissing
             }
-            val = ctx.stack.pop().toBool()
+            item := ctx.stack.pop()
+            // MINIMALIF is a consensus rule in tapscript
+            if ctx.sigVersion == sigVersionTapscript &&
+                !(len(item) == 0 || (len(item) == 1 && item[0] == 1)) {
+                return errTapscriptMinimalIf
+            }
+            val = item.toBool()
             if op == OP_NOTIF {
                 val = !val
             }
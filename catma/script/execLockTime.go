@@ -0,0 +1,85 @@
+package script
+
+import (
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    )
+
+// Lock time operands are allowed to be 5 bytes long, as 4 bytes are not
+// enough for timestamps after 2038.
+const lockTimeMaxSize = 5
+
+// OP_CHECKLOCKTIMEVERIFY, OP_NOP2 without EvalFlagCheckLockTime
+func execCheckLockTimeVerify(ctx *execContext, _ Opcode, _ []byte) error {
+    if (ctx.flags & EvalFlagCheckLockTime) == 0 {
+        return nil
+    }
+    lockTime, err := lockTimeOperand(ctx)
+    if err != nil {
+        return err
+    }
+    txLockTime := int64(ctx.sctx.LockTime())
+    // Both have to be block numbers or both timestamps
+    if (lockTime < numbers.LockTimeThreshold) != (txLockTime < numbers.LockTimeThreshold) {
+        return errUnsatisfiedLockTime
+    }
+    if lockTime > txLockTime {
+        return errUnsatisfiedLockTime
+    }
+    // A final input would make the tx final regardless of its lock time
+    if ctx.sctx.Sequence() == numbers.SequenceFinal {
+        return errUnsatisfiedLockTime
+    }
+    return nil
+}
+
+// OP_CHECKSEQUENCEVERIFY, OP_NOP3 without EvalFlagCheckSequence
+func execCheckSequenceVerify(ctx *execContext, _ Opcode, _ []byte) error {
+    if (ctx.flags & EvalFlagCheckSequence) == 0 {
+        return nil
+    }
+    sequence, err := lockTimeOperand(ctx)
+    if err != nil {
+        return err
+    }
+    // Behaves as a NOP if the operand has the disable flag set
+    if (sequence & numbers.SequenceLockTimeDisableFlag) != 0 {
+        return nil
+    }
+    txSequence := int64(ctx.sctx.Sequence())
+    if ctx.sctx.TxVersion() < 2 {
+        return errUnsatisfiedLockTime
+    }
+    if (txSequence & numbers.SequenceLockTimeDisableFlag) != 0 {
+        return errUnsatisfiedLockTime
+    }
+    mask := int64(numbers.SequenceLockTimeTypeFlag | numbers.SequenceLockTimeMask)
+    sequence, txSequence = sequence & mask, txSequence & mask
+    // Both have to be in blocks or both in time
+    if (sequence < numbers.SequenceLockTimeTypeFlag) != (txSequence < numbers.SequenceLockTimeTypeFlag) {
+        return errUnsatisfiedLockTime
+    }
+    if sequence > txSequence {
+        return errUnsatisfiedLockTime
+    }
+    return nil
+}
+
+// Reads the lock time on stack top without popping it
+func lockTimeOperand(ctx *execContext) (int64, error) {
+    if ctx.sctx == nil {
+        return 0, errNoTxContext
+    }
+    if ctx.stack.empty() {
+        return 0, errStackItemMissing
+    }
+    p := ctx.stack.top(-1)
+    if len(p) > lockTimeMaxSize {
+        return 0, errScriptIntOverflow
+    }
+    v := int64(klib.ToLongScriptInt(p, lockTimeMaxSize))
+    if v < 0 {
+        return 0, errNegativeLockTime
+    }
+    return v, nil
+}
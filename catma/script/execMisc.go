@@ -42,5 +42,8 @@ func execEqual(ctx *execContext, op Opcode, _ []byte) error {
 
 func execSeparator(ctx *execContext, _ Opcode, _ []byte) error {
     ctx.separator = ctx.pc
+    if ctx.tap != nil {
+        ctx.tap.codeSepPos = uint32(ctx.opPos)
+    }
     return nil
 }
\ No newline at end of file
@@ -220,9 +220,18 @@ const (
     OP_NOP9             //0xb8
     OP_NOP10            //0xb9
 
+    // tapscript only (BIP342)
+    OP_CHECKSIGADD      //0xba
+
     OP_INVALIDOPCODE Opcode = 0xff
 )
 
+// Soft forks redefining OP_NOPx
+const (
+    OP_CHECKLOCKTIMEVERIFY = OP_NOP2    // BIP65
+    OP_CHECKSEQUENCEVERIFY = OP_NOP3    // BIP112
+)
+
 type Opcode byte
 
 // The same as Satoshi client
@@ -353,8 +362,8 @@ func (c Opcode) attr() (string, execFunc) {
 
     // expanson
     case OP_NOP1                : return "OP_NOP1",                 execNop
-    case OP_NOP2                : return "OP_NOP2",                 execNop
-    case OP_NOP3                : return "OP_NOP3",                 execNop
+    case OP_NOP2                : return "OP_NOP2",                 execCheckLockTimeVerify
+    case OP_NOP3                : return "OP_NOP3",                 execCheckSequenceVerify
     case OP_NOP4                : return "OP_NOP4",                 execNop
     case OP_NOP5                : return "OP_NOP5",                 execNop
     case OP_NOP6                : return "OP_NOP6",                 execNop
@@ -363,11 +372,22 @@ func (c Opcode) attr() (string, execFunc) {
     case OP_NOP9                : return "OP_NOP9",                 execNop
     case OP_NOP10               : return "OP_NOP10",                execNop
 
+    case OP_CHECKSIGADD         : return "OP_CHECKSIGADD",          execCheckSigAdd
+
     case OP_INVALIDOPCODE       : return "OP_INVALIDOPCODE",        nil
     }
     return "OP_UNKNOWN", nil
 }
 
+// Opcodes that make a tapscript succeed right away, no matter where they are.
+// They are reserved for future soft forks, see BIP342.
+func (c Opcode) isSuccess() bool {
+    return c == 80 || c == 98 || (c >= 126 && c <= 129) ||
+        (c >= 131 && c <= 134) || (c >= 137 && c <= 138) ||
+        (c >= 141 && c <= 142) || (c >= 149 && c <= 153) ||
+        (c >= 187 && c <= 254)
+}
+
 // Returns the number to be pushed for OP_PUSHDATA00, OP_1, OP_2 ...
 // returns -1 othewise
 func (c Opcode) number() int {
@@ -13,6 +13,11 @@ const (
     PKS_ScriptHash
     PKS_MultiSig
     PKS_NullData
+    PKS_WitnessPubKeyHash
+    PKS_WitnessScriptHash
+    PKS_WitnessTaproot
+    // Witness programs of other versions and sizes, reserved for soft forks
+    PKS_WitnessUnknown
 )
 
 func (t PKScriptType) String() string {
@@ -23,6 +28,10 @@ func (t PKScriptType) String() string {
     case PKS_ScriptHash:    return "PKS_ScriptHash"
     case PKS_MultiSig:      return "PKS_MultiSig"
     case PKS_NullData:      return "PKS_NullData"
+    case PKS_WitnessPubKeyHash: return "PKS_WitnessPubKeyHash"
+    case PKS_WitnessScriptHash: return "PKS_WitnessScriptHash"
+    case PKS_WitnessTaproot:    return "PKS_WitnessTaproot"
+    case PKS_WitnessUnknown:    return "PKS_WitnessUnknown"
     default:                return "PKS_Invalid"
     }
 }
@@ -34,6 +43,10 @@ func (s Script) PKScriptType() PKScriptType {
     case s.IsTypeScriptHash():  return PKS_ScriptHash
     case s.IsTypeNullData():    return PKS_NullData
     case s.IsTypeMultiSig():    return PKS_MultiSig
+    case s.IsTypeWitnessPubKeyHash(): return PKS_WitnessPubKeyHash
+    case s.IsTypeWitnessScriptHash(): return PKS_WitnessScriptHash
+    case s.IsTypeWitnessTaproot():    return PKS_WitnessTaproot
+    case s.IsTypeWitnessUnknown():    return PKS_WitnessUnknown
     default:                    return PKS_NonStandard
     }
 }
@@ -85,6 +98,50 @@ func (s Script) IsTypeScriptHash() bool {
         Opcode(s[22]) == OP_EQUAL
 }
 
+// Returns the version and program if PKScript is a witness program (BIP141),
+// which is a version byte push followed by a 2 to 40 bytes direct push.
+func (s Script) WitnessProgram() (int, []byte, bool) {
+    if len(s) < 4 || len(s) > 42 {
+        return 0, nil, false
+    }
+    op := Opcode(s[0])
+    if op != OP_PUSHDATA00 && (op < OP_1 || op > OP_16) {
+        return 0, nil, false
+    }
+    if int(s[1]) + 2 != len(s) {
+        return 0, nil, false
+    }
+    version := 0
+    if op != OP_PUSHDATA00 {
+        version = int(op - OP_1) + 1
+    }
+    return version, s[2:], true
+}
+
+// Returns if PKScipt is of type PKS_WitnessPubKeyHash
+func (s Script) IsTypeWitnessPubKeyHash() bool {
+    v, p, ok := s.WitnessProgram()
+    return ok && v == 0 && len(p) == numbers.PubKeyHashLen
+}
+
+// Returns if PKScipt is of type PKS_WitnessScriptHash
+func (s Script) IsTypeWitnessScriptHash() bool {
+    v, p, ok := s.WitnessProgram()
+    return ok && v == 0 && len(p) == 32
+}
+
+// Returns if PKScipt is of type PKS_WitnessTaproot
+func (s Script) IsTypeWitnessTaproot() bool {
+    v, p, ok := s.WitnessProgram()
+    return ok && v == 1 && len(p) == 32
+}
+
+// Returns if PKScipt is of type PKS_WitnessUnknown
+func (s Script) IsTypeWitnessUnknown() bool {
+    v, _, ok := s.WitnessProgram()
+    return ok && v != 0 && !s.IsTypeWitnessTaproot()
+}
+
 // Returns if PKScipt is of type PKS_MultiSig
 func (s Script) IsTypeMultiSig() bool {
     if len(s) < 1 {
@@ -128,18 +185,20 @@ func (s Script) IsTypeMultiSig() bool {
     return m >=1 && n >= 1 && m <= n && count == n && next == len(s)
 }
 
-// Returns if PKScipt is of type PKS_NullData
+// Returns the number of public keys of a PKS_MultiSig script, 0 if not multisig
+func (s Script) MultiSigKeyCount() int {
+    if !s.IsTypeMultiSig() {
+        return 0
+    }
+    return Opcode(s[len(s)-2]).number()
+}
+
+// Returns if PKScipt is of type PKS_NullData, i.e. OP_RETURN followed by pushes.
+// The size limit is a relay policy, see catma.Policy.
 func (s Script) IsTypeNullData() bool {
     if len(s) < 1 || Opcode(s[0]) != OP_RETURN {
         return false
     }
-    if len(s) == 1 {
-        return true
-    } else {
-        _, operand, next, err := s.getOpcode(1)
-        return err != nil && 
-            len(operand) <= numbers.MaxOpReturnRelay &&  
-            next == len(s)
-    }
+    return s[1:].IsPushOnly()
 }
 
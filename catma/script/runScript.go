@@ -1,5 +1,11 @@
 package script
 
+import (
+    "bytes"
+    "errors"
+    "strings"
+    )
+
 type EvalFlag uint32
 
 // The value here is different from SCRIPT_VERIFY_XXXX in Satoshi client
@@ -10,20 +16,64 @@ const (
     EvalFlagNone, EvalFlagP2SH EvalFlag = 0, 1 << iota
     // enforce strict conformance to DER and SEC2 for signatures and pubkeys
     EvalFlagStrictEnc = 1 << iota        
-    // enforce low S values (<n/2) in signatures (depends on STRICTENC)
-    // TODO: not implemented yet
+    // enforce low S values (<n/2) in signatures (BIP146)
     EvalFlagLowS             
     // verify dummy stack item consumed by CHECKMULTISIG is of zero-length
     EvalFlagNullDummy       
+    // enforce strict DER encoding of signatures (BIP66)
+    EvalFlagDERSig
+    // OP_NOP2 becomes OP_CHECKLOCKTIMEVERIFY (BIP65)
+    EvalFlagCheckLockTime
+    // OP_NOP3 becomes OP_CHECKSEQUENCEVERIFY (BIP112)
+    EvalFlagCheckSequence
+    // verify witness programs (BIP141)
+    EvalFlagWitness
+    // verify taproot outputs and tapscript (BIP341, BIP342)
+    EvalFlagTaproot
 )
 
+// Names used by the Satoshi client, e.g. in test data
+var evalFlagNames = map[string]EvalFlag{
+    "NONE": EvalFlagNone,
+    "P2SH": EvalFlagP2SH,
+    "STRICTENC": EvalFlagStrictEnc,
+    "LOW_S": EvalFlagLowS,
+    "NULLDUMMY": EvalFlagNullDummy,
+    "DERSIG": EvalFlagDERSig,
+    "CHECKLOCKTIMEVERIFY": EvalFlagCheckLockTime,
+    "CHECKSEQUENCEVERIFY": EvalFlagCheckSequence,
+    "WITNESS": EvalFlagWitness,
+    "TAPROOT": EvalFlagTaproot,
+}
+
+// Parses comma separated flag names like "P2SH,WITNESS"
+func ParseEvalFlags(s string) (EvalFlag, error) {
+    flags := EvalFlagNone
+    for _, name := range strings.Split(s, ",") {
+        name = strings.TrimSpace(name)
+        if name == "" {
+            continue
+        }
+        f, ok := evalFlagNames[name]
+        if !ok {
+            return 0, errors.New("ParseEvalFlags: unknown flag " + name)
+        }
+        flags |= f
+    }
+    return flags, nil
+}
+
 func RunSigScript(sigScript Script) (error, [][]byte) {
     sstack := stack{}
-    err := sstack.eval(sigScript, nil, EvalFlagNone)
+    err := sstack.eval(sigScript, nil, EvalFlagNone, sigVersionBase, nil)
     if err != nil {
         return err, nil
     } else {
-        return nil, (interface{}(sstack)).([][]byte)
+        result := make([][]byte, len(sstack))
+        for i, item := range sstack {
+            result[i] = item
+        }
+        return nil, result
     }
 }
 
@@ -33,10 +83,19 @@ func RunScript(pkScript Script, sigScript Script) error {
 }
 
 func VerifyScript(pkScript Script, sigScript Script, sctx scriptContext, flags EvalFlag) error {
+    return verifyScript(pkScript, sigScript, sctx, flags, nil)
+}
+
+// Same as VerifyScript, but reports every step of evaluation to "t"
+func TraceScript(pkScript Script, sigScript Script, sctx scriptContext, flags EvalFlag, t Tracer) error {
+    return verifyScript(pkScript, sigScript, sctx, flags, t)
+}
+
+func verifyScript(pkScript Script, sigScript Script, sctx scriptContext, flags EvalFlag, t Tracer) error {
     sstack := stack{}
     var stackCopy stack 
     // First eval sigScript
-    err := sstack.eval(sigScript, sctx, flags)
+    err := sstack.eval(sigScript, sctx, flags, sigVersionBase, t)
     if err != nil {
         return err
     }
@@ -47,7 +106,7 @@ func VerifyScript(pkScript Script, sigScript Script, sctx scriptContext, flags E
         copy(stackCopy, sstack)
     }
     // Eval pkScript
-    err = sstack.eval(pkScript, sctx, flags)
+    err = sstack.eval(pkScript, sctx, flags, sigVersionBase, t)
     if err != nil {
         return err
     }
@@ -56,19 +115,52 @@ func VerifyScript(pkScript Script, sigScript Script, sctx scriptContext, flags E
         return errEvalNotTrue
     }
 
+    witness := (flags & EvalFlagWitness) != 0
+    hadWitness := false
+    if witness {
+        if version, program, ok := pkScript.WitnessProgram(); ok {
+            hadWitness = true
+            // The sigScript has to be empty, otherwise it's malleable
+            if len(sigScript) != 0 {
+                return errWitnessMalleated
+            }
+            if err := verifyWitnessProgram(sctx, version, program, flags, false, t); err != nil {
+                return err
+            }
+        }
+    }
+
     // Extra verification for P2SH
     if p2sh && pkScript.IsTypeScriptHash() {
         if !sigScript.IsPushOnly() {
             return errP2SHSigNotPushOnly
         }
         pkScript2 := Script(stackCopy.pop())
-        err := stackCopy.eval(pkScript2, sctx, flags)
+        err := stackCopy.eval(pkScript2, sctx, flags, sigVersionBase, t)
         if err != nil {
             return err
         }
         if stackCopy.empty() || !stackCopy.top(-1).toBool() {
             return errEvalNotTrue
         }
+        // P2SH wrapped witness program
+        if witness {
+            if version, program, ok := pkScript2.WitnessProgram(); ok {
+                hadWitness = true
+                // The sigScript has to be exactly a push of the redeem script
+                expected := Script{}
+                expected.AppendPushData(pkScript2)
+                if !bytes.Equal(sigScript, expected) {
+                    return errWitnessMalleated
+                }
+                if err := verifyWitnessProgram(sctx, version, program, flags, true, t); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+    if witness && !hadWitness && len(witnessOf(sctx)) > 0 {
+        return errWitnessUnexpected
     }
     return nil
 }
\ No newline at end of file
@@ -3,6 +3,7 @@ package script
 import (
     "encoding/binary"
     "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
     )
 
 type Script []byte
@@ -39,7 +40,7 @@ func (s *Script) AppendPushData(p []byte) {
 }
 
 func (s *Script) AppendPushInt(v int64) {
-    if v == int64(OP_1NEGATE) || (v >= 1 && v <= 16) {
+    if v == -1 || (v >= 1 && v <= 16) {
         s.AppendOp(Opcode(v + int64(OP_1) - 1))
     } else {
         i := klib.ScriptInt(v)
@@ -102,6 +103,8 @@ func (s Script) SigArgsExpected(t PKScriptType) (bool, int) {
     case PKS_MultiSig:
         m := Opcode(s[0]).number()
         return true, m + 1    // Expect: m * <sig> + Satoshi_Bug
+    case PKS_WitnessPubKeyHash, PKS_WitnessScriptHash, PKS_WitnessTaproot:
+        return true, 0  // Arguments are in the witness
     }
     return false, 0
 }
@@ -151,3 +154,49 @@ func (s Script) getOpcode(p int) (op Opcode, operand []byte, next int, err error
     return
 }
 
+
+// Returns the number of signature operations in the script.
+// With "accurate" being false, CHECKMULTISIG counts as MaxMultiSigKeyCount
+// sigops no matter how many keys are actually used, like the Satoshi client does
+// for SigScripts and PKScripts.
+func (s Script) SigOpCount(accurate bool) int {
+    count := 0
+    lastOp := OP_INVALIDOPCODE
+    for next := 0; next < len(s); {
+        op, _, np, err := s.getOpcode(next)
+        if err != nil {
+            break
+        }
+        next = np
+        switch op {
+        case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+            count++
+        case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+            if accurate && lastOp >= OP_1 && lastOp <= OP_16 {
+                count += lastOp.number()
+            } else {
+                count += numbers.MaxMultiSigKeyCount
+            }
+        }
+        lastOp = op
+    }
+    return count
+}
+
+// Returns the number of signature operations in the serialized script carried by
+// a P2SH SigScript, it's 0 if the PKScript is not P2SH.
+func (s Script) P2SHSigOpCount(sigScript Script) int {
+    if !s.IsTypeScriptHash() {
+        return 0
+    }
+    var data []byte
+    for next := 0; next < len(sigScript); {
+        op, operand, np, err := sigScript.getOpcode(next)
+        if err != nil || op > OP_16 {
+            return 0
+        }
+        next = np
+        data = operand
+    }
+    return Script(data).SigOpCount(true)
+}
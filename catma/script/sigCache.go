@@ -0,0 +1,99 @@
+package script
+
+import (
+    "sync"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/binary"
+    "github.com/oxfeeefeee/kaiju/klib"
+    )
+
+// Default number of entries kept by the signature cache
+const DefaultSigCacheSize = 100000
+
+// Signatures known to be valid, so that a tx verified when it's relayed
+// doesn't get verified again when it's included in a block.
+// Only the salted hash of (sighash, pubkey, sig) is kept, and a random entry
+// is evicted when the cache is full, same as the Satoshi client.
+type sigCache struct {
+    entries     map[klib.Hash256]struct{}
+    maxSize     int
+    mutex       sync.RWMutex
+}
+
+var validSigs = newSigCache(DefaultSigCacheSize)
+
+func newSigCache(size int) *sigCache {
+    return &sigCache{
+        entries: make(map[klib.Hash256]struct{}),
+        maxSize: size,
+    }
+}
+
+// Sets the max number of entries of the signature cache, 0 disables it.
+func SetSigCacheSize(size int) {
+    validSigs.mutex.Lock()
+    defer validSigs.mutex.Unlock()
+    if size < 0 {
+        size = 0
+    }
+    validSigs.maxSize = size
+    for k, _ := range validSigs.entries {
+        if len(validSigs.entries) <= size {
+            break
+        }
+        delete(validSigs.entries, k)
+    }
+}
+
+// Random for each process, so that others can't work out the keys
+var sigCacheSalt = newSigCacheSalt()
+
+func newSigCacheSalt() []byte {
+    salt := make([]byte, 32)
+    if _, err := rand.Read(salt); err != nil {
+        panic(err)
+    }
+    return salt
+}
+
+// The lengths of pubkey and sig are hashed too, or the same bytes split
+// differently between them would make the same key
+func sigCacheKey(hash *klib.Hash256, pk []byte, sig []byte) klib.Hash256 {
+    var l [4]byte
+    d := sha256.New()
+    d.Write(sigCacheSalt)
+    d.Write(hash[:])
+    binary.LittleEndian.PutUint32(l[:], uint32(len(pk)))
+    d.Write(l[:])
+    d.Write(pk)
+    binary.LittleEndian.PutUint32(l[:], uint32(len(sig)))
+    d.Write(l[:])
+    d.Write(sig)
+    var key klib.Hash256
+    copy(key[:], d.Sum(nil))
+    return key
+}
+
+func (c *sigCache) contains(key *klib.Hash256) bool {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+    _, ok := c.entries[*key]
+    return ok
+}
+
+func (c *sigCache) add(key *klib.Hash256) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    if c.maxSize == 0 {
+        return
+    }
+    if len(c.entries) >= c.maxSize {
+        // Go randomizes map iteration order
+        for k, _ := range c.entries {
+            delete(c.entries, k)
+            break
+        }
+    }
+    c.entries[*key] = struct{}{}
+}
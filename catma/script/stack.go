@@ -21,11 +21,8 @@ func boolToStackItem(b bool) stackItem {
 func (si stackItem) toBool() bool {
     for i, v := range si {
         if v != 0 {
-            if v != 0x80 {
-                return true
-            } else {
-                return i == (len(si) - 1) // negative zero
-            }
+            // Negative zero is false
+            return !(v == 0x80 && i == (len(si) - 1))
         }
     }
     return false
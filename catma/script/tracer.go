@@ -0,0 +1,124 @@
+// Tracing of script evaluation, for debugging scripts
+package script
+
+import (
+    "fmt"
+    "bytes"
+    "encoding/hex"
+    )
+
+// Receives the state of script evaluation, see TraceScript
+type Tracer interface {
+    // Called before a script starts running, a tx input runs up to 3 scripts:
+    // sigScript, pkScript and the P2SH or witness script
+    Start(s Script)
+    // Called after each opcode
+    Step(s *TraceStep)
+}
+
+// State after running an opcode, the stacks are copies
+type TraceStep struct {
+    Pc          int         // Position of the opcode in script
+    Op          Opcode
+    Operand     []byte
+    Skipped     bool        // In a non-executed branch
+    Stack       [][]byte    // Main stack, top is the last one
+    AltStack    [][]byte
+    Branches    []bool      // Branching stack of OP_IF/OP_NOTIF, false is not executed
+    Err         error       // The error that stops the script, if any
+}
+
+func (ctx *execContext) traceStep(pc int, op Opcode, operand []byte, skipped bool, err error) *TraceStep {
+    bs := make([]bool, len(ctx.bStack))
+    copy(bs, ctx.bStack)
+    return &TraceStep{pc, op, operand, skipped,
+        copyStack(*ctx.stack), copyStack(*ctx.altStack), bs, err}
+}
+
+func copyStack(s stack) [][]byte {
+    c := make([][]byte, len(s))
+    for i, item := range s {
+        c[i] = append([]byte{}, item...)
+    }
+    return c
+}
+
+func (s *TraceStep) String() string {
+    b := new(bytes.Buffer)
+    fmt.Fprintf(b, "%5d  %s", s.Pc, s.Op)
+    if len(s.Operand) > 0 {
+        fmt.Fprintf(b, " %s", hex.EncodeToString(s.Operand))
+    }
+    if s.Skipped {
+        fmt.Fprintf(b, " (skipped)")
+    }
+    fmt.Fprintf(b, "\n       stack: %s", stackString(s.Stack))
+    if len(s.AltStack) > 0 {
+        fmt.Fprintf(b, "\n       alt: %s", stackString(s.AltStack))
+    }
+    if len(s.Branches) > 0 {
+        fmt.Fprintf(b, "\n       branches: %v", s.Branches)
+    }
+    if s.Err != nil {
+        fmt.Fprintf(b, "\n       error: %s", s.Err)
+    }
+    return b.String()
+}
+
+func stackString(s [][]byte) string {
+    b := new(bytes.Buffer)
+    b.WriteString("[")
+    for i, item := range s {
+        if i > 0 {
+            b.WriteString(" ")
+        }
+        if len(item) == 0 {
+            b.WriteString("''")
+        } else {
+            b.WriteString(hex.EncodeToString(item))
+        }
+    }
+    b.WriteString("]")
+    return b.String()
+}
+
+// Steps of one script
+type ScriptTrace struct {
+    Script      Script
+    Steps       []*TraceStep
+}
+
+// A Tracer keeping all the steps in memory
+type TraceRecorder struct {
+    Scripts     []*ScriptTrace
+}
+
+func (r *TraceRecorder) Start(s Script) {
+    r.Scripts = append(r.Scripts, &ScriptTrace{Script: s})
+}
+
+func (r *TraceRecorder) Step(s *TraceStep) {
+    st := r.Scripts[len(r.Scripts)-1]
+    st.Steps = append(st.Steps, s)
+}
+
+// Returns the last step, nil if nothing was run
+func (r *TraceRecorder) LastStep() *TraceStep {
+    for i := len(r.Scripts) - 1; i >= 0; i-- {
+        if steps := r.Scripts[i].Steps; len(steps) > 0 {
+            return steps[len(steps)-1]
+        }
+    }
+    return nil
+}
+
+func (r *TraceRecorder) String() string {
+    b := new(bytes.Buffer)
+    for i, st := range r.Scripts {
+        fmt.Fprintf(b, "script %d: %s\n", i, Disassemble(st.Script))
+        for _, s := range st.Steps {
+            fmt.Fprintf(b, "%s\n", s)
+        }
+    }
+    return b.String()
+}
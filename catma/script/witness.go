@@ -0,0 +1,214 @@
+// Witness program evaluation (BIP141, BIP341 and BIP342)
+package script
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    )
+
+// First byte of the annex, an optional last witness item reserved for future use
+const annexTag = 0x50
+
+func witnessOf(sctx scriptContext) [][]byte {
+    if sctx == nil {
+        return nil
+    }
+    return sctx.Witness()
+}
+
+// Runs the witness program with the witness stack of the input,
+// "p2sh" tells if the program is wrapped in P2SH.
+func verifyWitnessProgram(sctx scriptContext, version int, program []byte, flags EvalFlag,
+    p2sh bool, t Tracer) error {
+    if version == 1 && len(program) == 32 && !p2sh && (flags & EvalFlagTaproot) != 0 {
+        return verifyTaproot(sctx, program, flags, t)
+    }
+    if version != 0 {
+        // Reserved for future soft forks, anyone can spend for now
+        return nil
+    }
+    witness := witnessOf(sctx)
+    var s Script
+    var wstack stack
+    switch len(program) {
+    case 32: // P2WSH, the last item is the script, whose sha256 is the program
+        if len(witness) == 0 {
+            return errWitnessEmpty
+        }
+        s = Script(witness[len(witness)-1])
+        hash := sha256.Sum256(s)
+        if !bytes.Equal(hash[:], program) {
+            return errWitnessMismatch
+        }
+        wstack = newWitnessStack(witness[:len(witness)-1])
+    case numbers.PubKeyHashLen: // P2WPKH, witness is signature and public key
+        if len(witness) != 2 {
+            return errWitnessMismatch
+        }
+        s = Script{}
+        s.AppendOp(OP_DUP)
+        s.AppendOp(OP_HASH160)
+        s.AppendPushData(program)
+        s.AppendOp(OP_EQUALVERIFY)
+        s.AppendOp(OP_CHECKSIG)
+        wstack = newWitnessStack(witness)
+    default:
+        return errWitnessWrongLength
+    }
+    if err := checkWitnessStack(wstack); err != nil {
+        return err
+    }
+    if err := wstack.eval(s, sctx, flags, sigVersionWitnessV0, t); err != nil {
+        return err
+    }
+    return checkCleanStack(wstack)
+}
+
+// BIP341: spends with either a signature of the output key (key path),
+// or a script committed to by the output key (script path)
+func verifyTaproot(sctx scriptContext, program []byte, flags EvalFlag, t Tracer) error {
+    witness := witnessOf(sctx)
+    if len(witness) == 0 {
+        return errWitnessEmpty
+    }
+    tap := &tapState{codeSepPos: 0xffffffff}
+    tap.budget = numbers.ValidationWeightOffset + witnessByteSize(witness)
+    if last := witness[len(witness)-1]; len(witness) >= 2 && len(last) > 0 && last[0] == annexTag {
+        tap.annex = last
+        witness = witness[:len(witness)-1]
+    }
+    if len(witness) == 1 {
+        return verifySchnorrSig(sctx, program, witness[0], tap)
+    }
+    control := witness[len(witness)-1]
+    s := Script(witness[len(witness)-2])
+    if len(control) < 33 || (len(control) - 33) % 32 != 0 ||
+        (len(control) - 33) / 32 > numbers.TaprootControlMaxNodeCount {
+        return errTaprootControlSize
+    }
+    leafVersion := control[0] & 0xfe
+    tap.leafHash = TapLeafHash(leafVersion, s)
+    k := tap.leafHash
+    for i := 33; i < len(control); i += 32 {
+        k = TapBranchHash(k, control[i:i+32])
+    }
+    internalKey := klib.XOnlyPubKey(control[1:33])
+    tweak := klib.TaggedHash("TapTweak", internalKey, k)
+    q, odd, err := internalKey.Tweak(tweak[:])
+    if err != nil || !bytes.Equal(q, program) || odd != ((control[0] & 1) == 1) {
+        return errTaprootCommitment
+    }
+    if leafVersion != numbers.TapscriptLeafVersion {
+        // Unknown leaf versions are reserved for future soft forks
+        return nil
+    }
+    // Any OP_SUCCESSx makes the script succeed, as long as it can be parsed
+    for pc := 0; pc < len(s); {
+        op, _, next, err := s.getOpcode(pc)
+        if err != nil {
+            return err
+        }
+        if op.isSuccess() {
+            return nil
+        }
+        pc = next
+    }
+    wstack := newWitnessStack(witness[:len(witness)-2])
+    if err := checkWitnessStack(wstack); err != nil {
+        return err
+    }
+    if wstack.height() > numbers.MaxScriptEvalStackSize {
+        return errStackSizeLimit
+    }
+    if err := wstack.evalTapscript(s, sctx, flags, tap, t); err != nil {
+        return err
+    }
+    return checkCleanStack(wstack)
+}
+
+// Returns the hash of a leaf of the taproot script tree
+func TapLeafHash(leafVersion byte, s Script) []byte {
+    return klib.TaggedHash("TapLeaf", []byte{leafVersion}, klib.VarString(s).Bytes())[:]
+}
+
+// Returns the hash of a branch of the taproot script tree, children are sorted
+func TapBranchHash(a []byte, b []byte) []byte {
+    if bytes.Compare(a, b) > 0 {
+        a, b = b, a
+    }
+    return klib.TaggedHash("TapBranch", a, b)[:]
+}
+
+// Returns the serialized size of a witness stack
+func witnessByteSize(witness [][]byte) int {
+    size := klib.VarUint(len(witness)).ByteSize()
+    for _, item := range witness {
+        size += klib.VarString(item).ByteSize()
+    }
+    return size
+}
+
+// Initial witness stack items are limited in size like pushed data
+func checkWitnessStack(wstack stack) error {
+    for _, item := range wstack {
+        if len(item) > numbers.MaxScriptElementSize {
+            return errOperandSizeLimit
+        }
+    }
+    return nil
+}
+
+// Witness scripts have to leave exactly one true on stack
+func checkCleanStack(wstack stack) error {
+    if wstack.height() != 1 || !wstack.top(-1).toBool() {
+        return errEvalNotTrue
+    }
+    return nil
+}
+
+func newWitnessStack(items [][]byte) stack {
+    s := make(stack, len(items))
+    for i, item := range items {
+        s[i] = stackItem(item)
+    }
+    return s
+}
+
+// Returns the number of signature operations in the witness of an input
+// spending s, including P2SH wrapped witness programs.
+func (s Script) WitnessSigOpCount(sigScript Script, witness [][]byte) int {
+    if version, program, ok := s.WitnessProgram(); ok {
+        return witnessSigOpCount(version, program, witness)
+    }
+    if !s.IsTypeScriptHash() {
+        return 0
+    }
+    var data []byte
+    for next := 0; next < len(sigScript); {
+        op, operand, np, err := sigScript.getOpcode(next)
+        if err != nil || op > OP_16 {
+            return 0
+        }
+        next = np
+        data = operand
+    }
+    if version, program, ok := Script(data).WitnessProgram(); ok {
+        return witnessSigOpCount(version, program, witness)
+    }
+    return 0
+}
+
+func witnessSigOpCount(version int, program []byte, witness [][]byte) int {
+    if version != 0 {
+        return 0
+    }
+    switch {
+    case len(program) == numbers.PubKeyHashLen:
+        return 1
+    case len(program) == 32 && len(witness) > 0:
+        return Script(witness[len(witness)-1]).SigOpCount(true)
+    }
+    return 0
+}
@@ -0,0 +1,75 @@
+// Script verification of many inputs in parallel
+package catma
+
+import (
+    "sync"
+    "runtime"
+    "sync/atomic"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+)
+
+// Number of goroutines verifying scripts
+var scriptWorkers = runtime.NumCPU()
+
+// Sets how many goroutines VerifyBlock and VerifyTx use to verify scripts,
+// n <= 0 means one for each CPU.
+func SetScriptWorkers(n int) {
+    if n <= 0 {
+        n = runtime.NumCPU()
+    }
+    scriptWorkers = n
+}
+
+// Script verification of one input, deferred until all the UTXO lookups are done
+type scriptJob struct {
+    prevOuts    []*TxOut
+    tx          *Tx
+    index       int
+    flags       script.EvalFlag
+}
+
+func (j *scriptJob) run() error {
+    return VerifyInputWithPrevOuts(j.prevOuts, j.tx, j.index, j.flags)
+}
+
+// Runs all the jobs with up to scriptWorkers goroutines.
+// Workers stop picking up jobs as soon as one job fails, and the error
+// of the first failed job is returned.
+func runScriptJobs(jobs []*scriptJob) error {
+    n := scriptWorkers
+    if n > len(jobs) {
+        n = len(jobs)
+    }
+    if n <= 1 {
+        for _, j := range jobs {
+            if err := j.run(); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    next := int64(-1)
+    failed := int32(0)
+    var firstErr error
+    var wg sync.WaitGroup
+    wg.Add(n)
+    for w := 0; w < n; w++ {
+        go func() {
+            defer wg.Done()
+            for atomic.LoadInt32(&failed) == 0 {
+                i := int(atomic.AddInt64(&next, 1))
+                if i >= len(jobs) {
+                    return
+                }
+                if err := jobs[i].run(); err != nil {
+                    if atomic.CompareAndSwapInt32(&failed, 0, 1) {
+                        firstErr = err
+                    }
+                    return
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    return firstErr
+}
@@ -0,0 +1,266 @@
+package test
+
+import (
+    "bytes"
+    "testing"
+    "encoding/hex"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+)
+
+const genesisTxHex = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+
+// UtxoSet in memory
+type memUtxo map[catma.OutPoint]*catma.UtxoEntry
+
+func (m memUtxo) Get(h *klib.Hash256, i uint32) (*catma.UtxoEntry, error) {
+    if txo, ok := m[catma.OutPoint{Hash: *h, Index: i}]; ok {
+        return txo, nil
+    }
+    return nil, catma.ErrUtxoNotFound
+}
+
+func (m memUtxo) Use(h *klib.Hash256, i uint32, _ *catma.UtxoEntry) error {
+    if _, ok := m[catma.OutPoint{Hash: *h, Index: i}]; !ok {
+        return catma.ErrUtxoNotFound
+    }
+    delete(m, catma.OutPoint{Hash: *h, Index: i})
+    return nil
+}
+
+func (m memUtxo) Add(h *klib.Hash256, i uint32, txo *catma.UtxoEntry) error {
+    m[catma.OutPoint{Hash: *h, Index: i}] = txo
+    return nil
+}
+
+func decodeTx(t *testing.T, s string) *catma.Tx {
+    data, err := hex.DecodeString(s)
+    if err != nil {
+        t.Fatalf("hex.DecodeString error %s", err)
+    }
+    var btx btcmsg.Tx
+    if err = btx.Deserialize(bytes.NewReader(data)); err != nil {
+        t.Fatalf("tx deserialize error %s", err)
+    }
+    return (*catma.Tx)(&btx)
+}
+
+func genesisHeader() *catma.Header {
+    h := new(catma.Header)
+    h.Version = 1
+    h.MerkleRoot.SetString("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b")
+    h.Timestamp = 1231006505
+    h.Bits = 0x1d00ffff
+    h.Nonce = 2083236893
+    return h
+}
+
+func TestMerkleRoot(t *testing.T) {
+    var a, b, c klib.Hash256
+    a.SetUint64(1)
+    b.SetUint64(2)
+    c.SetUint64(3)
+    r1, m1 := catma.MerkleRoot([]*klib.Hash256{&a, &b, &c})
+    r2, m2 := catma.MerkleRoot([]*klib.Hash256{&a, &b, &c, &c})
+    if *r1 != *r2 {
+        t.Errorf("Odd level should duplicate the last hash")
+    }
+    if m1 || !m2 {
+        t.Errorf("Bad mutation detection %v %v", m1, m2)
+    }
+}
+
+func TestGenesisBlock(t *testing.T) {
+    h := genesisHeader()
+    tx := decodeTx(t, genesisTxHex)
+    if err := catma.CheckBlock(h, []*catma.Tx{tx}); err != nil {
+        t.Errorf("CheckBlock failed on genesis: %s", err)
+    }
+    if err := catma.VerifyBlock(h, []*catma.Tx{tx}, 0, headerSlice{}, memUtxo{}, false); err != nil {
+        t.Errorf("VerifyBlock failed on genesis: %s", err)
+    }
+    if err := catma.CheckBlock(h, []*catma.Tx{tx, tx}); err == nil {
+        t.Errorf("Duplicate txs deemed to be valid")
+    }
+    h.MerkleRoot.SetZero()
+    if err := catma.CheckBlock(h, []*catma.Tx{tx}); err == nil {
+        t.Errorf("Bad merkle root deemed to be valid")
+    }
+}
+
+func TestBlockSubsidy(t *testing.T) {
+    cases := map[int]int64{
+        0: 5000000000,
+        209999: 5000000000,
+        210000: 2500000000,
+        420000: 1250000000,
+        64 * 210000: 0,
+    }
+    for height, v := range cases {
+        if s := catma.BlockSubsidy(height); s != v {
+            t.Errorf("Bad subsidy at %d: %d", height, s)
+        }
+    }
+}
+
+func TestVerifyTx(t *testing.T) {
+    cb := decodeTx(t, genesisTxHex)
+    utxo := memUtxo{}
+    if _, err := catma.VerifyTx(cb, utxo, 1, script.EvalFlagP2SH, true); err != nil {
+        t.Fatalf("VerifyTx failed on coin base: %s", err)
+    }
+    spend := new(catma.Tx)
+    spend.Version = 1
+    spend.TxIns = []*catma.TxIn{
+        &catma.TxIn{PreviousOutput: catma.OutPoint{Hash: *cb.Hash(), Index: 0}, Sequence: 0xffffffff},
+    }
+    spend.TxOuts = []*catma.TxOut{&catma.TxOut{Value: 1, PKScript: []byte{0x51}}}
+    if _, err := catma.VerifyTx(spend, utxo, 100, script.EvalFlagP2SH, true); err == nil {
+        t.Errorf("Spending immature coin base deemed to be valid")
+    }
+    spend.TxOuts[0].Value = cb.TxOuts[0].Value + 1
+    if _, err := catma.VerifyTx(spend, utxo, 101, script.EvalFlagP2SH, true); err == nil {
+        t.Errorf("Tx creating money deemed to be valid")
+    }
+    spend.TxOuts[0].Value = cb.TxOuts[0].Value - 1000
+    r, err := catma.VerifyTx(spend, utxo, 101, script.EvalFlagP2SH, true)
+    if err != nil {
+        t.Fatalf("Spending mature coin base failed: %s", err)
+    }
+    if r.Fee != 1000 || r.Size != spend.ByteSize() || r.Weight != spend.ByteSize() * 4 {
+        t.Errorf("Bad verify result %+v", r)
+    }
+}
+
+func TestWitnessCommitment(t *testing.T) {
+    height := numbers.SegwitHeight
+    sigScript := script.NewScript()
+    sigScript.AppendPushInt(int64(height))
+    cb := new(catma.Tx)
+    cb.Version = 1
+    cb.TxIns = []*catma.TxIn{&catma.TxIn{SigScript: *sigScript, Sequence: 0xffffffff}}
+    cb.TxIns[0].PreviousOutput.SetNull()
+    cb.TxOuts = []*catma.TxOut{&catma.TxOut{Value: 1, PKScript: []byte{0x51}}}
+    h := new(catma.Header)
+    h.Version = 4
+    h.Timestamp = 1503539857
+    h.MerkleRoot = *cb.Hash()
+    // Without witness data there's no need for a commitment
+    if err := catma.VerifyBlock(h, []*catma.Tx{cb}, height, headerSlice{}, memUtxo{}, true); err != nil {
+        t.Fatalf("Block without witness failed: %s", err)
+    }
+    // The witness root of a block with only a coin base is 0
+    nonce := make([]byte, 32)
+    commitment := klib.Sha256Sha256(make([]byte, 64))
+    pks := append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, commitment[:]...)
+    cb.TxOuts = append(cb.TxOuts, &catma.TxOut{Value: 0, PKScript: pks})
+    h.MerkleRoot = *cb.Hash()
+    if err := catma.VerifyBlock(h, []*catma.Tx{cb}, height, headerSlice{}, memUtxo{}, true); err == nil {
+        t.Errorf("Commitment without coin base witness deemed to be valid")
+    }
+    cb.TxIns[0].Witness = [][]byte{nonce}
+    if err := catma.VerifyBlock(h, []*catma.Tx{cb}, height, headerSlice{}, memUtxo{}, true); err != nil {
+        t.Errorf("Valid witness commitment failed: %s", err)
+    }
+    if catma.IsBlockMutated(h, []*catma.Tx{cb}, height) {
+        t.Errorf("Valid block deemed to be mutated")
+    }
+    // Witness not committed to
+    cb.TxIns[0].Witness = [][]byte{make([]byte, 31)}
+    if !catma.IsBlockMutated(h, []*catma.Tx{cb}, height) {
+        t.Errorf("Bad coin base witness not deemed to be mutated")
+    }
+    cb.TxIns[0].Witness = [][]byte{nonce}
+    if !catma.IsBlockMutated(h, []*catma.Tx{cb, cb}, height) {
+        t.Errorf("Duplicate txs not deemed to be mutated")
+    }
+    pks[len(pks) - 1]++
+    if err := catma.VerifyBlock(h, []*catma.Tx{cb}, height, headerSlice{}, memUtxo{}, true); err == nil {
+        t.Errorf("Bad witness commitment deemed to be valid")
+    }
+    // Witnesses could be what's changed
+    h.MerkleRoot = *cb.Hash()
+    if !catma.IsBlockMutated(h, []*catma.Tx{cb}, height) {
+        t.Errorf("Bad witness commitment not deemed to be mutated")
+    }
+}
+
+// Headers only around the heights a test needs
+type headerMap map[int]*catma.Header
+
+func (m headerMap) Get(height int) *catma.Header {
+    return m[height]
+}
+
+func TestNonFinalTxInBlock(t *testing.T) {
+    var prev klib.Hash256
+    prev.SetUint64(1)
+    tx := new(catma.Tx)
+    tx.Version = 1
+    tx.TxIns = []*catma.TxIn{
+        &catma.TxIn{PreviousOutput: catma.OutPoint{Hash: prev, Index: 0}, Sequence: 0},
+    }
+    tx.TxOuts = []*catma.TxOut{&catma.TxOut{Value: 1, PKScript: []byte{0x51}}}
+    verify := func(height int, timestamp uint32, chain catma.HeaderChain) error {
+        sigScript := script.NewScript()
+        sigScript.AppendPushInt(int64(height))
+        cb := new(catma.Tx)
+        cb.Version = 1
+        cb.TxIns = []*catma.TxIn{&catma.TxIn{SigScript: *sigScript, Sequence: 0xffffffff}}
+        cb.TxIns[0].PreviousOutput.SetNull()
+        cb.TxOuts = []*catma.TxOut{&catma.TxOut{Value: 1, PKScript: []byte{0x51}}}
+        h := new(catma.Header)
+        h.Version = 4
+        h.Timestamp = timestamp
+        root, _ := catma.MerkleRoot([]*klib.Hash256{cb.Hash(), tx.Hash()})
+        h.MerkleRoot = *root
+        utxo := memUtxo{}
+        utxo.Add(&prev, 0, &catma.UtxoEntry{TxOut: catma.TxOut{Value: 10}, Height: 1})
+        return catma.VerifyBlock(h, []*catma.Tx{cb, tx}, height, chain, utxo, true)
+    }
+
+    // Locked by height
+    height := numbers.BIP34Height + 100
+    tx.LockTime = uint32(height)
+    if err := verify(height, 1400000000, headerSlice{}); err == nil {
+        t.Errorf("Tx locked until its block height deemed to be final")
+    }
+    tx.LockTime = uint32(height - 1)
+    if err := verify(height, 1400000000, headerSlice{}); err != nil {
+        t.Errorf("Tx locked until the height before failed: %s", err)
+    }
+    // Final inputs ignore the lock time
+    tx.LockTime = uint32(height)
+    tx.TxIns[0].Sequence = numbers.SequenceFinal
+    if err := verify(height, 1400000000, headerSlice{}); err != nil {
+        t.Errorf("Tx with final inputs failed: %s", err)
+    }
+    tx.TxIns[0].Sequence = 0
+
+    // Locked by time, before BIP113 the block time is the cutoff
+    tx.LockTime = 1400000000
+    if err := verify(height, 1400000000, headerSlice{}); err == nil {
+        t.Errorf("Tx locked until its block time deemed to be final")
+    }
+    if err := verify(height, 1400000001, headerSlice{}); err != nil {
+        t.Errorf("Tx locked until before its block time failed: %s", err)
+    }
+    // Then the median time past
+    height = numbers.CSVHeight
+    chain := headerMap{}
+    for i := 1; i <= numbers.MedianTimeSpan; i++ {
+        h := new(catma.Header)
+        h.Timestamp = 1400000000 + 6 * 600 - uint32(i * 600)
+        chain[height - i] = h
+    }
+    if err := verify(height, 1400000001, chain); err == nil {
+        t.Errorf("Tx locked until the median time past deemed to be final")
+    }
+    tx.LockTime = 1400000000 - 1
+    if err := verify(height, 1400000001, chain); err != nil {
+        t.Errorf("Tx locked until before the median time past failed: %s", err)
+    }
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+    "testing"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+)
+
+// A tx with one input spending output 0 of "prev"
+func lockTimeTx(version uint32, lockTime uint32, sequence uint32, prev *klib.Hash256) *catma.Tx {
+    tx := new(catma.Tx)
+    tx.Version = version
+    tx.LockTime = lockTime
+    tx.TxIns = []*catma.TxIn{
+        &catma.TxIn{PreviousOutput: catma.OutPoint{Hash: *prev, Index: 0}, Sequence: sequence},
+    }
+    tx.TxOuts = []*catma.TxOut{&catma.TxOut{Value: 1, PKScript: []byte{0x51}}}
+    return tx
+}
+
+func TestCheckLockTimeVerify(t *testing.T) {
+    var prev klib.Hash256
+    cases := []struct{
+        pk          string
+        lockTime    uint32
+        sequence    uint32
+        valid       bool
+    }{
+        {"100 CHECKLOCKTIMEVERIFY", 100, 0, true},
+        {"100 CHECKLOCKTIMEVERIFY", 99, 0, false},
+        {"100 CHECKLOCKTIMEVERIFY", 100, 0xffffffff, false},
+        {"100 CHECKLOCKTIMEVERIFY", 500000000, 0, false},
+        {"0x05 0x0065cd1d00 CHECKLOCKTIMEVERIFY", 500000000, 0, true},
+        {"-1 CHECKLOCKTIMEVERIFY", 100, 0, false},
+        {"CHECKLOCKTIMEVERIFY", 100, 0, false},
+    }
+    for _, c := range cases {
+        pk, err := script.Assemble(c.pk)
+        if err != nil {
+            t.Fatalf("Error parsing %s: %s", c.pk, err)
+        }
+        tx := lockTimeTx(1, c.lockTime, c.sequence, &prev)
+        err = catma.VerifyInputWithFlags(pk, tx, 0, script.EvalFlagCheckLockTime)
+        if (err == nil) != c.valid {
+            t.Errorf("%s with lock time %d sequence %x: %v", c.pk, c.lockTime, c.sequence, err)
+        }
+        // Without the flag it's OP_NOP2, leaving the lock time on stack
+        if len(pk) > 1 {
+            if err = catma.VerifyInputWithFlags(pk, tx, 0, script.EvalFlagNone); err != nil {
+                t.Errorf("%s as NOP: %s", c.pk, err)
+            }
+        }
+    }
+}
+
+func TestCheckSequenceVerify(t *testing.T) {
+    var prev klib.Hash256
+    cases := []struct{
+        pk          string
+        version     uint32
+        sequence    uint32
+        valid       bool
+    }{
+        {"10 CHECKSEQUENCEVERIFY", 2, 10, true},
+        {"10 CHECKSEQUENCEVERIFY", 2, 9, false},
+        {"10 CHECKSEQUENCEVERIFY", 1, 10, false},
+        {"10 CHECKSEQUENCEVERIFY", 2, 10 | (1 << 22), false},
+        {"10 CHECKSEQUENCEVERIFY", 2, 10 | (1 << 31), false},
+        {"0x05 0x0000008000 CHECKSEQUENCEVERIFY", 1, 0, true},
+    }
+    for _, c := range cases {
+        pk, err := script.Assemble(c.pk)
+        if err != nil {
+            t.Fatalf("Error parsing %s: %s", c.pk, err)
+        }
+        tx := lockTimeTx(c.version, 0, c.sequence, &prev)
+        err = catma.VerifyInputWithFlags(pk, tx, 0, script.EvalFlagCheckSequence)
+        if (err == nil) != c.valid {
+            t.Errorf("%s with version %d sequence %x: %v", c.pk, c.version, c.sequence, err)
+        }
+    }
+}
+
+func TestDERSig(t *testing.T) {
+    var prev klib.Hash256
+    // Not DER as the first byte is not 0x30, CHECKSIG fails but NOT makes it true
+    pk, err := script.Assemble("0x09 0x310602010102010101 " +
+        "0x21 0x02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa CHECKSIG NOT")
+    if err != nil {
+        t.Fatalf("Error parsing script: %s", err)
+    }
+    tx := lockTimeTx(1, 0, 0, &prev)
+    if err := catma.VerifyInputWithFlags(pk, tx, 0, script.EvalFlagNone); err != nil {
+        t.Errorf("Non-DER signature failed the script without BIP66: %s", err)
+    }
+    if err := catma.VerifyInputWithFlags(pk, tx, 0, script.EvalFlagDERSig); err == nil {
+        t.Errorf("Non-DER signature passed with BIP66")
+    }
+}
+
+func TestSequenceLocks(t *testing.T) {
+    chain := headerSlice{}
+    for i := 0; i < 20; i++ {
+        h := genesisHeader()
+        h.Timestamp += uint32(i * 600)
+        chain = append(chain, h)
+    }
+    var prev klib.Hash256
+    prev.SetUint64(1)
+    utxo := memUtxo{}
+    utxo.Add(&prev, 0, &catma.UtxoEntry{TxOut: catma.TxOut{Value: 1}, Height: 10})
+    // 5 blocks after the output at height 10
+    tx := lockTimeTx(2, 0, 5, &prev)
+    if err := catma.CheckSequenceLocks(tx, 14, chain, utxo); err == nil {
+        t.Errorf("Relative height lock not enforced")
+    }
+    if err := catma.CheckSequenceLocks(tx, 15, chain, utxo); err != nil {
+        t.Errorf("Relative height lock satisfied but failed: %s", err)
+    }
+    // Version 1 txs have no relative lock time
+    tx.Version = 1
+    if err := catma.CheckSequenceLocks(tx, 11, chain, utxo); err != nil {
+        t.Errorf("Version 1 tx failed sequence locks: %s", err)
+    }
+    // 2 * 512 seconds after the median time past before block 10, which is the
+    // time of block 5. Median time past before block 12 is the time of block 6,
+    // 600 seconds after block 5, and that of block 13 is the time of block 7.
+    tx = lockTimeTx(2, 0, 2 | (1 << 22), &prev)
+    if err := catma.CheckSequenceLocks(tx, 12, chain, utxo); err == nil {
+        t.Errorf("Relative time lock not enforced")
+    }
+    if err := catma.CheckSequenceLocks(tx, 13, chain, utxo); err != nil {
+        t.Errorf("Relative time lock satisfied but failed: %s", err)
+    }
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+    "fmt"
+    "testing"
+    "strings"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+)
+
+func asm(t *testing.T, text string) []byte {
+    s, err := script.Assemble(text)
+    if err != nil {
+        t.Fatalf("Error parsing %s: %s", text, err)
+    }
+    return s
+}
+
+func TestDustThreshold(t *testing.T) {
+    cases := []struct{
+        pks         string
+        threshold   int64
+    }{
+        {"DUP HASH160 <" + strings.Repeat("00", 20) + "> EQUALVERIFY CHECKSIG", 546},
+        {"HASH160 <" + strings.Repeat("00", 20) + "> EQUAL", 540},
+        {"0 <" + strings.Repeat("00", 20) + ">", 294},
+        {"0 <" + strings.Repeat("00", 32) + ">", 330},
+        {"1 <" + strings.Repeat("00", 32) + ">", 330},
+        {"RETURN <01>", 0},
+    }
+    for _, c := range cases {
+        out := &catma.TxOut{Value: c.threshold, PKScript: asm(t, c.pks)}
+        if d := out.DustThreshold(3000); d != c.threshold {
+            t.Errorf("Dust threshold of %s: %d, expect %d", c.pks, d, c.threshold)
+        }
+        if out.IsDust(3000) {
+            t.Errorf("%s is dust", c.pks)
+        }
+    }
+}
+
+func TestIsStandard(t *testing.T) {
+    var prev klib.Hash256
+    p2pkh := asm(t, "DUP HASH160 <" + strings.Repeat("00", 20) + "> EQUALVERIFY CHECKSIG")
+    multisig := func(n int) []byte {
+        s := "1"
+        for i := 0; i < n; i++ {
+            s += " <02" + strings.Repeat("00", 32) + ">"
+        }
+        return asm(t, fmt.Sprintf("%s %d CHECKMULTISIG", s, n))
+    }
+    noBareMultiSig := catma.DefaultPolicy()
+    noBareMultiSig.PermitBareMultiSig = false
+    cases := []struct{
+        outs    []*catma.TxOut
+        policy  *catma.Policy
+        valid   bool
+    }{
+        {[]*catma.TxOut{{Value: 546, PKScript: p2pkh}}, nil, true},
+        {[]*catma.TxOut{{Value: 545, PKScript: p2pkh}}, nil, false},
+        {[]*catma.TxOut{{Value: 0, PKScript: asm(t, "RETURN <" + strings.Repeat("00", 80) + ">")}}, nil, true},
+        {[]*catma.TxOut{{Value: 0, PKScript: asm(t, "RETURN <" + strings.Repeat("00", 81) + ">")}}, nil, false},
+        {[]*catma.TxOut{{Value: 0, PKScript: asm(t, "RETURN 1 2")},
+            {Value: 0, PKScript: asm(t, "RETURN")}}, nil, false},
+        {[]*catma.TxOut{{Value: 1000, PKScript: multisig(3)}}, nil, true},
+        {[]*catma.TxOut{{Value: 1000, PKScript: multisig(4)}}, nil, false},
+        {[]*catma.TxOut{{Value: 1000, PKScript: multisig(1)}}, noBareMultiSig, false},
+        {[]*catma.TxOut{{Value: 1000, PKScript: asm(t, "2 <" + strings.Repeat("00", 32) + ">")}}, nil, true},
+        {[]*catma.TxOut{{Value: 1000, PKScript: asm(t, "1 EQUAL")}}, nil, false},
+    }
+    for i, c := range cases {
+        p := c.policy
+        if p == nil {
+            p = catma.DefaultPolicy()
+        }
+        tx := lockTimeTx(2, 0, 0xffffffff, &prev)
+        tx.TxOuts = c.outs
+        if err := tx.IsStandard(p, 1, 1); (err == nil) != c.valid {
+            t.Errorf("Case %d: %v", i, err)
+        }
+    }
+    tx := lockTimeTx(3, 0, 0xffffffff, &prev)
+    tx.TxOuts[0].PKScript = p2pkh
+    tx.TxOuts[0].Value = 1000
+    if err := tx.IsStandard(catma.DefaultPolicy(), 1, 1); err == nil {
+        t.Errorf("Tx version 3 is standard")
+    }
+}
+
+func TestInputsStandard(t *testing.T) {
+    var prev klib.Hash256
+    sig := "<30" + strings.Repeat("00", 70) + ">"
+    pubKey := "<02" + strings.Repeat("00", 32) + ">"
+    redeem := func(sigOps int) string {
+        return "<" + hexOf(asm(t, strings.Repeat("CHECKSIG ", sigOps))) + ">"
+    }
+    cases := []struct{
+        pks     string
+        sigs    string
+        valid   bool
+    }{
+        {"DUP HASH160 <" + strings.Repeat("00", 20) + "> EQUALVERIFY CHECKSIG", sig + " " + pubKey, true},
+        {"DUP HASH160 <" + strings.Repeat("00", 20) + "> EQUALVERIFY CHECKSIG", sig, false},
+        {"1 EQUAL", "1", false},
+        {"HASH160 <" + strings.Repeat("00", 20) + "> EQUAL", redeem(15), true},
+        {"HASH160 <" + strings.Repeat("00", 20) + "> EQUAL", redeem(16), false},
+        {"0 <" + strings.Repeat("00", 20) + ">", "", true},
+        {"2 <" + strings.Repeat("00", 32) + ">", "", false},
+    }
+    for _, c := range cases {
+        tx := lockTimeTx(2, 0, 0xffffffff, &prev)
+        tx.TxIns[0].SigScript = asm(t, c.sigs)
+        prevOuts := prevOutputs{&prevOutput{prev, 0, asm(t, c.pks), 1000}}
+        if err := tx.InputsStandard(catma.DefaultPolicy(), &prevOuts); (err == nil) != c.valid {
+            t.Errorf("%s spent by %s: %v", c.pks, c.sigs, err)
+        }
+    }
+}
+
+func TestParsePolicy(t *testing.T) {
+    p, err := catma.ParsePolicy([]byte(`{"MinRelayFee": 5000, "PermitBareMultiSig": false}`))
+    if err != nil {
+        t.Fatalf("ParsePolicy error %s", err)
+    }
+    d := catma.DefaultPolicy()
+    if p.MinRelayFee != 5000 || p.PermitBareMultiSig || p.DustRelayFee != d.DustRelayFee {
+        t.Errorf("ParsePolicy: %+v", p)
+    }
+    if p.CheckFee(999, 200) == nil || p.CheckFee(1000, 200) != nil {
+        t.Errorf("CheckFee with min relay fee %d", p.MinRelayFee)
+    }
+}
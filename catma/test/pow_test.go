@@ -0,0 +1,129 @@
+package test
+
+import (
+    "time"
+    "strings"
+    "testing"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+)
+
+// A HeaderChain made of a slice
+type headerSlice []*catma.Header
+
+func (s headerSlice) Get(height int) *catma.Header {
+    if height < 0 || height >= len(s) {
+        return nil
+    }
+    return s[height]
+}
+
+func TestCompact(t *testing.T) {
+    for _, bits := range []uint32{0x1d00ffff, 0x1b0404cb, 0x1c05a3f4, 0x1715a35c, 0x03123456} {
+        if c := catma.BigToCompact(catma.CompactToBig(bits)); c != bits {
+            t.Errorf("Compact round trip failed for %x, got %x", bits, c)
+        }
+    }
+    if catma.CompactToBig(0x01003456).Sign() != 0 {
+        t.Errorf("Bad decoding of 0x01003456")
+    }
+    if catma.CompactToBig(0x04923456).Sign() >= 0 {
+        t.Errorf("Negative compact decoded as non-negative")
+    }
+}
+
+func TestProofOfWork(t *testing.T) {
+    h := genesisHeader()
+    if err := catma.CheckProofOfWork(h); err != nil {
+        t.Errorf("Genesis failed proof of work: %s", err)
+    }
+    h.Nonce++
+    if err := catma.CheckProofOfWork(h); err == nil {
+        t.Errorf("Bad nonce passed proof of work")
+    }
+}
+
+// Cases from pow_tests.cpp of the Satoshi client
+func TestCalcNextBits(t *testing.T) {
+    cases := []struct{
+        bits, first, last, expected uint32
+    }{
+        {0x1d00ffff, 1261130161, 1262152739, 0x1d00d86a},
+        {0x1d00ffff, 1231006505, 1233061996, 0x1d00ffff},
+        {0x1c05a3f4, 1279008237, 1279297671, 0x1c0168fd},
+        {0x1c387f6f, 1263163443, 1269211443, 0x1d00e1fd},
+    }
+    for _, c := range cases {
+        if bits := catma.CalcNextBits(c.bits, c.first, c.last); bits != c.expected {
+            t.Errorf("CalcNextBits(%x, %d, %d) = %x, expected %x",
+                c.bits, c.first, c.last, bits, c.expected)
+        }
+    }
+}
+
+func TestCheckHeaderTime(t *testing.T) {
+    chain := headerSlice{genesisHeader()}
+    h := genesisHeader()
+    if catma.MedianTimePast(chain, 1) != h.Timestamp {
+        t.Errorf("Bad median time past")
+    }
+    // Genesis itself doesn't link to genesis, but it has valid proof of work
+    // and the right bits, so only the timestamp rule fails.
+    if err := catma.CheckHeader(h, 1, chain, time.Now()); err == nil {
+        t.Errorf("Timestamp not after median time past deemed to be valid")
+    }
+}
+
+// Headers of a chain with "n" blocks 10 minutes apart, made up on demand
+type madeUpChain int
+
+func (n madeUpChain) Get(height int) *catma.Header {
+    if height < 0 || height >= int(n) {
+        return nil
+    }
+    return &catma.Header{Version: 4, Timestamp: uint32(1400000000 + height * 600), Bits: 0x1b0404cb}
+}
+
+func TestCheckHeaderVersion(t *testing.T) {
+    height := numbers.BIP65Height + 1
+    chain := madeUpChain(height)
+    h := chain.Get(height - 1)
+    h.Timestamp += 600
+    for _, c := range []struct{
+        version     uint32
+        valid       bool
+    }{
+        {4, true},
+        {0x20000000, true},
+        {3, false},
+        // Negative as the Satoshi client sees it
+        {0x80000004, false},
+    } {
+        h.Version = c.version
+        if err := catma.CheckHeaderContext(h, height, chain, time.Now()); (err == nil) != c.valid {
+            t.Errorf("Header of version %x: %v", c.version, err)
+        }
+    }
+}
+
+func TestCheckpoints(t *testing.T) {
+    cps := catma.Checkpoints()
+    for i, cp := range cps {
+        if i > 0 && cp.Height <= cps[i-1].Height {
+            t.Errorf("Checkpoint %d not after %d", cp.Height, cps[i-1].Height)
+        }
+        // Main chain hashes are way below the difficulty 1 target
+        if !strings.HasPrefix(cp.Hash.String(), "00000000") {
+            t.Errorf("Bad checkpoint hash %s at %d", &cp.Hash, cp.Height)
+        }
+        if err := catma.CheckCheckpoint(&cp.Hash, cp.Height); err != nil {
+            t.Errorf("Checkpoint %d doesn't match itself", cp.Height)
+        }
+        if err := catma.CheckCheckpoint(&cp.Hash, cp.Height + 1); err != nil {
+            t.Errorf("Height %d not expected to be checked", cp.Height + 1)
+        }
+    }
+    if err := catma.CheckCheckpoint(&cps[1].Hash, cps[0].Height); err == nil {
+        t.Errorf("Header not matching checkpoint passed")
+    }
+}
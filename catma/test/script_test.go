@@ -1,75 +1,15 @@
 package test
 
 import (
-    "testing"
-    "fmt"
-    "strings"
+    "bytes"
     "strconv"
-    "errors"
+    "testing"
     "encoding/hex"
     "encoding/json"
+    "github.com/oxfeeefeee/kaiju/klib/address"
     "github.com/oxfeeefeee/kaiju/catma/script"
 )
 
-var opcodeNameMap map[string]script.Opcode
-
-func nameMap() map[string]script.Opcode {
-    if opcodeNameMap != nil {
-        return opcodeNameMap
-    }
-
-    m := map[string]script.Opcode{"RESERVED": script.OP_RESERVED,}
-    for op := script.OP_NOP; op <= script.OP_NOP10; op++ {
-        name := op.String()
-        if name == "OP_UNKNOWN" {
-            continue
-        }
-        m[name] = op
-        m[name[3:]] = op
-    }
-    opcodeNameMap = m
-    return opcodeNameMap
-}
-
-func allDigit(s string) bool {
-    for _, c := range s {
-        if c < '0' || c > '9' {
-            return false
-        }
-    }
-    return true
-}
-
-func parseScript(s string) (script.Script, error) {
-    m := nameMap()
-    scr := script.NewScript()
-    words := strings.FieldsFunc(s, func (r rune) bool {
-        return r == ' ' || r == '\n' || r == '\t'
-    })
-    for _, w := range words {
-        if allDigit(w) || (w[0] == '-' && allDigit(w[1:])) {
-            n, err := strconv.Atoi(w)
-            if err != nil {
-                return nil, errors.New(fmt.Sprintf("Error parsing integer: %s", w))
-            }
-            scr.AppendPushInt(int64(n))
-        } else if len(w) > 2 && w[:2] == "0x" {
-            data, err := hex.DecodeString(w[2:])
-            if err != nil {
-                return nil, errors.New(fmt.Sprintf("Error parsing hex: %s", w))
-            }
-            scr.AppendData(data)
-        } else if len(w) >= 2 && w[0] == '\'' && w[len(w)-1] == '\'' {
-            scr.AppendPushData([]byte(w[1:len(w)-1]))
-        } else if op, ok := m[w]; ok {
-            scr.AppendOp(op)
-        } else {
-            return nil, errors.New(fmt.Sprintf("Error parsing unknown word: %s", w))
-        }
-    }
-    return *scr, nil
-}
-
 func testScriptList(t *testing.T, list string, valid bool) {
     var f interface{}
     err := json.Unmarshal([]byte(list), &f)
@@ -82,15 +22,17 @@ func testScriptList(t *testing.T, list string, valid bool) {
         if len(singleCase) < 2 {
             continue
         }
-        sigS, errSig := parseScript(singleCase[0].(string))
-        pkS, errPK := parseScript(singleCase[1].(string))
+        sigS, errSig := script.Assemble(singleCase[0].(string))
+        pkS, errPK := script.Assemble(singleCase[1].(string))
         if errSig != nil || errPK != nil {
             t.Errorf("parse script error %s; %s", errSig, errPK)
         }
         //fmt.Printf("Running: %s--%s\n", singleCase[0].(string), singleCase[1].(string))
         err = script.RunScript(pkS, sigS)
         if valid && err != nil {
-            t.Errorf("Run valid script error %s \n CONTENT:%s--%s", err, singleCase[0].(string), singleCase[1].(string))
+            tr := new(script.TraceRecorder)
+            script.TraceScript(pkS, sigS, nil, script.EvalFlagP2SH, tr)
+            t.Errorf("Run valid script error %s \n CONTENT:%s--%s\n%s", err, singleCase[0].(string), singleCase[1].(string), tr)
         } else if !valid && err == nil {
             t.Errorf("Run invalid script passed, CONTENT:%s--%s", singleCase[0].(string), singleCase[1].(string))
         } else {
@@ -104,9 +46,28 @@ func TestScript(t *testing.T) {
     testScriptList(t, invalidScripts, false)
 }
 
+// The result of a script is false for zero and negative zero of any size
+func TestScriptResult(t *testing.T) {
+    cases := map[string]bool{
+        "0": false,
+        "0x01 0x00": false,
+        "0x01 0x80": false,
+        "0x02 0x0080": false,
+        "0x02 0x8000": true,
+        "0x02 0x0180": true,
+        "0x01 0x01": true,
+    }
+    for str, expected := range cases {
+        sigS, _ := script.Assemble(str)
+        if err := script.RunScript(script.Script{}, sigS); (err == nil) != expected {
+            t.Errorf("Result of %s is not %v: %v", str, expected, err)
+        }
+    }
+}
+
 func TestPKScriptType(t *testing.T) {
     for str, stype := range testScripts() {
-        scr, err := parseScript(str)
+        scr, err := script.Assemble(str)
         if err != nil {
             t.Errorf("TestPKScriptType error: %s", err)
         } else if st := scr.PKScriptType(); st != stype {
@@ -133,3 +94,142 @@ func TestOpcodeName(t *testing.T) {
         //fmt.Printf("value: %x, Opcode: %s\n", i, Opcode(i))
     }
 }
+
+func TestTracer(t *testing.T) {
+    sigS, _ := script.Assemble("1 2")
+    pkS, _ := script.Assemble("IF 3 ELSE 4 ENDIF TOALTSTACK")
+    tr := new(script.TraceRecorder)
+    err := script.TraceScript(pkS, sigS, nil, script.EvalFlagNone, tr)
+    if err != nil {
+        t.Fatalf("TraceScript error %s", err)
+    }
+    if len(tr.Scripts) != 2 || len(tr.Scripts[0].Steps) != 2 || len(tr.Scripts[1].Steps) != 6 {
+        t.Fatalf("Bad trace:\n%s", tr)
+    }
+    steps := tr.Scripts[1].Steps
+    if steps[1].Skipped || !steps[3].Skipped || len(steps[3].Branches) != 1 || steps[3].Branches[0] {
+        t.Errorf("Bad branch trace:\n%s", tr)
+    }
+    last := tr.LastStep()
+    if last.Op != script.OP_TOALTSTACK || len(last.Stack) != 1 || len(last.AltStack) != 1 ||
+        last.AltStack[0][0] != 3 || last.Pc != 5 {
+        t.Errorf("Bad last step %s", last)
+    }
+    // The failing opcode is the last step
+    pkS, _ = script.Assemble("VERIFY 1")
+    sigS, _ = script.Assemble("0")
+    tr = new(script.TraceRecorder)
+    err = script.TraceScript(pkS, sigS, nil, script.EvalFlagNone, tr)
+    if last = tr.LastStep(); err == nil || last.Err != err || last.Op != script.OP_VERIFY {
+        t.Errorf("Bad trace of failed script:\n%s", tr)
+    }
+}
+
+func TestDisassemble(t *testing.T) {
+    pks, _ := hex.DecodeString("76a9144c9c3dfac4207d5d8cb89df5722cb3d712385e3f88ac")
+    expected := "OP_DUP OP_HASH160 <4c9c3dfac4207d5d8cb89df5722cb3d712385e3f> OP_EQUALVERIFY OP_CHECKSIG"
+    if str := script.Disassemble(pks); str != expected {
+        t.Errorf("Bad disassembly %s", str)
+    }
+    // Every opcode round trips, including malformed pushes
+    scripts := []script.Script{{0x4c}, {0x02, 0x01}, {0x4d, 0x01}, {0x51, 0x4e, 0x01, 0, 0}}
+    for i := 0; i < 256; i++ {
+        s := script.Script{byte(i)}
+        switch op := script.Opcode(i); {
+        case op > script.OP_PUSHDATA00 && op < script.OP_PUSHDATA1:
+            s = append(s, bytes.Repeat([]byte{0xab}, i)...)
+        case op == script.OP_PUSHDATA1:
+            s = append(s, 2, 0, 1)
+        case op == script.OP_PUSHDATA2:
+            s = append(s, 3, 0, 0, 1, 2)
+        case op == script.OP_PUSHDATA4:
+            s = append(s, 1, 0, 0, 0, 0x51)
+        }
+        scripts = append(scripts, s)
+    }
+    for _, s := range scripts {
+        str := script.Disassemble(s)
+        s2, err := script.Assemble(str)
+        if err != nil || !bytes.Equal(s, s2) {
+            t.Errorf("Script %x disassembled to %s, assembled to %x %v", []byte(s), str, []byte(s2), err)
+        }
+    }
+    // And the scripts of the test data
+    for _, list := range []string{validScripts, invalidScripts} {
+        var f interface{}
+        if err := json.Unmarshal([]byte(list), &f); err != nil {
+            t.Fatalf("json.Unmarshal error %s", err)
+        }
+        for _, c := range f.([]interface{}) {
+            for _, str := range c.([]interface{})[:2] {
+                s, err := script.Assemble(str.(string))
+                if err != nil {
+                    t.Errorf("Assemble error %s: %s", err, str)
+                    continue
+                }
+                if s2, err := script.Assemble(script.Disassemble(s)); err != nil || !bytes.Equal(s, s2) {
+                    t.Errorf("Script %s doesn't round trip: %s", str, script.Disassemble(s))
+                }
+            }
+        }
+    }
+}
+
+// Small numbers have opcodes of their own, others are pushed
+func TestAssembleInt(t *testing.T) {
+    cases := map[string][]byte{
+        "-1": {byte(script.OP_1NEGATE)},
+        "0": {byte(script.OP_PUSHDATA00)},
+        "17": {0x01, 0x11},
+        "79": {0x01, 0x4f},
+        "-2": {0x01, 0x82},
+    }
+    for i := 1; i <= 16; i++ {
+        cases[strconv.Itoa(i)] = []byte{byte(script.OP_1) + byte(i - 1)}
+    }
+    for str, expected := range cases {
+        if s, err := script.Assemble(str); err != nil || !bytes.Equal(s, expected) {
+            t.Errorf("%s assembled to %x %v", str, []byte(s), err)
+        }
+        n, _ := strconv.ParseInt(str, 10, 64)
+        s := script.NewScript()
+        s.AppendPushInt(n)
+        if !bytes.Equal(*s, expected) {
+            t.Errorf("%d pushed as %x", n, []byte(*s))
+        }
+    }
+}
+
+func TestScriptAddress(t *testing.T) {
+    cases := []struct{
+        pks     string
+        net     *address.Network
+        addr    string
+    }{
+        {"DUP HASH160 <62e907b15cbf27d5425399ebf6f0fb50ebb88f18> EQUALVERIFY CHECKSIG",
+            address.MainNet, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+        {"HASH160 <e9c3dd0c07aac76179ebc76a6c78d4d67c6c160a> EQUAL",
+            address.MainNet, "3P14159f73E4gFr7JterCCQh9QjiTjiZrG"},
+        {"0 <751e76e8199196d454941c45d1b3a323f1433bd6>",
+            address.MainNet, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+        {"0 <1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262>",
+            address.TestNet, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7"},
+        {"1 <751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6>",
+            address.MainNet, "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y"},
+    }
+    for _, c := range cases {
+        pks, _ := script.Assemble(c.pks)
+        addr, err := pks.Address(c.net)
+        if err != nil || addr != c.addr {
+            t.Errorf("Address of %s = %s, %v", c.pks, addr, err)
+        }
+        s, err := script.FromAddress(c.addr, c.net)
+        if err != nil || !bytes.Equal(s, pks) {
+            t.Errorf("FromAddress(%s) = %s, %v", c.addr, script.Disassemble(s), err)
+        }
+    }
+    pks, _ := script.Assemble("RETURN <0102>")
+    if _, err := pks.Address(address.MainNet); err == nil {
+        t.Errorf("Null data script has an address")
+    }
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+    "testing"
+    "math/big"
+    "encoding/hex"
+    "github.com/conformal/btcec"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+)
+
+const taprootFlags = script.EvalFlagP2SH | script.EvalFlagWitness | script.EvalFlagTaproot
+
+func hexOf(p []byte) string {
+    return hex.EncodeToString(p)
+}
+
+// A private key for tests
+func taprootPrivKey(seed string) []byte {
+    return klib.Sha256Sha256([]byte(seed))[:]
+}
+
+// Returns the private key of output key "priv*G + tweak*G", see BIP341
+func tweakPrivKey(priv []byte, tweak []byte) []byte {
+    curve := btcec.S256()
+    d := new(big.Int).SetBytes(priv)
+    if _, y := curve.ScalarBaseMult(priv); y.Bit(0) == 1 {
+        d.Sub(curve.N, d)
+    }
+    d.Add(d, new(big.Int).SetBytes(tweak))
+    d.Mod(d, curve.N)
+    p := make([]byte, 32)
+    b := d.Bytes()
+    copy(p[32-len(b):], b)
+    return p
+}
+
+// Returns the output key committing to "root", and the control block byte
+func taprootOutput(t *testing.T, internal klib.XOnlyPubKey, root []byte) (klib.XOnlyPubKey, byte) {
+    tweak := klib.TaggedHash("TapTweak", internal, root)
+    q, odd, err := internal.Tweak(tweak[:])
+    if err != nil {
+        t.Fatalf("Tweak error %s", err)
+    }
+    c := byte(0xc0)
+    if odd {
+        c |= 1
+    }
+    return q, c
+}
+
+// A tx spending a taproot output with key "q"
+func taprootTx(q klib.XOnlyPubKey) (*catma.Tx, []*catma.TxOut) {
+    var prev klib.Hash256
+    tx := lockTimeTx(2, 0, 0xffffffff, &prev)
+    pks := append([]byte{0x51, 0x20}, q...)
+    return tx, []*catma.TxOut{&catma.TxOut{Value: 100000, PKScript: pks}}
+}
+
+func taprootSign(t *testing.T, tx *catma.Tx, prevOuts []*catma.TxOut, priv []byte,
+    hashType byte, annex []byte, leafHash []byte) []byte {
+    hash, err := tx.TaprootHashToSign(prevOuts, 0, hashType, annex, leafHash, 0xffffffff)
+    if err != nil {
+        t.Fatalf("TaprootHashToSign error %s", err)
+    }
+    sig, err := klib.SignSchnorr(priv, hash[:], make([]byte, 32))
+    if err != nil {
+        t.Fatalf("SignSchnorr error %s", err)
+    }
+    if hashType != 0 {
+        sig = append(sig, hashType)
+    }
+    return sig
+}
+
+func TestTaprootKeyPath(t *testing.T) {
+    priv := taprootPrivKey("internal")
+    internal := klib.SchnorrPubKey(priv)
+    tweak := klib.TaggedHash("TapTweak", internal)
+    q, _ := taprootOutput(t, internal, nil)
+    outPriv := tweakPrivKey(priv, tweak[:])
+    if string(klib.SchnorrPubKey(outPriv)) != string(q) {
+        t.Fatalf("Tweaked private key mismatch")
+    }
+    tx, prevOuts := taprootTx(q)
+    for _, ht := range []byte{0x00, 0x01, 0x02, 0x03, 0x81, 0x82, 0x83} {
+        tx.TxIns[0].Witness = [][]byte{taprootSign(t, tx, prevOuts, outPriv, ht, nil, nil)}
+        if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err != nil {
+            t.Errorf("Key path with hash type %x failed: %s", ht, err)
+        }
+    }
+    sig := taprootSign(t, tx, prevOuts, outPriv, 0, nil, nil)
+    tx.TxIns[0].Witness = [][]byte{append(sig, 0)}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err == nil {
+        t.Errorf("Explicit default hash type deemed to be valid")
+    }
+    // The annex is signed
+    annex := []byte{0x50, 1, 2, 3}
+    tx.TxIns[0].Witness = [][]byte{sig, annex}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err == nil {
+        t.Errorf("Unsigned annex deemed to be valid")
+    }
+    tx.TxIns[0].Witness = [][]byte{taprootSign(t, tx, prevOuts, outPriv, 0, annex, nil), annex}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err != nil {
+        t.Errorf("Key path with annex failed: %s", err)
+    }
+    // Amounts of spent outputs are signed
+    tx.TxIns[0].Witness = [][]byte{sig}
+    prevOuts[0].Value++
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err == nil {
+        t.Errorf("Signature with wrong amount deemed to be valid")
+    }
+    // Anyone can spend before activation, but not with witness v0 rules
+    tx.TxIns[0].Witness = [][]byte{[]byte{1}}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags &^ script.EvalFlagTaproot); err != nil {
+        t.Errorf("Witness v1 before taproot failed: %s", err)
+    }
+}
+
+func TestTapscript(t *testing.T) {
+    priv1, priv2 := taprootPrivKey("key1"), taprootPrivKey("key2")
+    k1, k2 := klib.SchnorrPubKey(priv1), klib.SchnorrPubKey(priv2)
+    internal := klib.SchnorrPubKey(taprootPrivKey("internal"))
+    cases := []struct{
+        script      string
+        // Which keys sign, and in which order the sigs are on the stack
+        signers     [][]byte
+        valid       bool
+    }{
+        {"0x20 0x" + hexOf(k1) + " CHECKSIG", [][]byte{priv1}, true},
+        {"0x20 0x" + hexOf(k1) + " CHECKSIG", [][]byte{priv2}, false},
+        {"0x20 0x" + hexOf(k1) + " CHECKSIG", [][]byte{nil}, false},
+        {"0x20 0x" + hexOf(k1) + " CHECKSIG NOT", [][]byte{nil}, true},
+        {"0x20 0x" + hexOf(k1) + " CHECKSIGVERIFY 1", [][]byte{priv1}, true},
+        // 2-of-2 with OP_CHECKSIGADD
+        {"0x20 0x" + hexOf(k1) + " CHECKSIG 0x20 0x" + hexOf(k2) + " CHECKSIGADD 2 NUMEQUAL",
+            [][]byte{priv2, priv1}, true},
+        {"0x20 0x" + hexOf(k1) + " CHECKSIG 0x20 0x" + hexOf(k2) + " CHECKSIGADD 2 NUMEQUAL",
+            [][]byte{nil, priv1}, false},
+        {"0x20 0x" + hexOf(k1) + " CHECKSIG 0x20 0x" + hexOf(k2) + " CHECKSIGADD 1 NUMEQUAL",
+            [][]byte{nil, priv1}, true},
+        // Multisig is disabled
+        {"1 0x20 0x" + hexOf(k1) + " 1 CHECKMULTISIG", [][]byte{nil, priv1}, false},
+        // Unknown public key types always succeed with non-empty signatures
+        {"0x21 0x02" + hexOf(k1) + " CHECKSIG", [][]byte{priv1}, true},
+        {"0 CHECKSIG", [][]byte{priv1}, false},
+        // OP_SUCCESSx, even after OP_RETURN
+        {"RETURN 0x50", nil, true},
+        {"RETURN 0xbb", nil, true},
+        {"RETURN 0xba", nil, false},
+        // MINIMALIF
+        {"IF 1 ENDIF", [][]byte{nil}, false},
+    }
+    for _, c := range cases {
+        s, err := script.Assemble(c.script)
+        if err != nil {
+            t.Fatalf("Error parsing %s: %s", c.script, err)
+        }
+        leaf := script.TapLeafHash(0xc0, s)
+        q, cb := taprootOutput(t, internal, leaf)
+        tx, prevOuts := taprootTx(q)
+        witness := make([][]byte, 0)
+        for _, p := range c.signers {
+            if p == nil {
+                witness = append(witness, []byte{})
+            } else {
+                witness = append(witness, taprootSign(t, tx, prevOuts, p, 0, nil, leaf))
+            }
+        }
+        if c.script == "IF 1 ENDIF" {
+            witness[0] = []byte{2}
+        }
+        control := append([]byte{cb}, internal...)
+        tx.TxIns[0].Witness = append(witness, s, control)
+        err = catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags)
+        if (err == nil) != c.valid {
+            t.Errorf("%s: %v", c.script, err)
+        }
+        // The control block has to commit to the output key parity
+        control[0] ^= 1
+        if err = catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err == nil {
+            t.Errorf("%s with bad control block deemed to be valid", c.script)
+        }
+    }
+}
+
+// Script path of a tree with two leaves
+func TestTaprootScriptTree(t *testing.T) {
+    internal := klib.SchnorrPubKey(taprootPrivKey("internal"))
+    s1, s2 := script.Script{0x51}, script.Script{0x52}
+    l1, l2 := script.TapLeafHash(0xc0, s1), script.TapLeafHash(0xc0, s2)
+    q, cb := taprootOutput(t, internal, script.TapBranchHash(l1, l2))
+    tx, prevOuts := taprootTx(q)
+    control := append(append([]byte{cb}, internal...), l2...)
+    tx.TxIns[0].Witness = [][]byte{s1, control}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err != nil {
+        t.Errorf("Script path of first leaf failed: %s", err)
+    }
+    control = append(append([]byte{cb}, internal...), l1...)
+    tx.TxIns[0].Witness = [][]byte{s2, control}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err != nil {
+        t.Errorf("Script path of second leaf failed: %s", err)
+    }
+    tx.TxIns[0].Witness = [][]byte{s1, control}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err == nil {
+        t.Errorf("Script path with wrong merkle path deemed to be valid")
+    }
+    // Unknown leaf versions succeed as long as the commitment is right
+    l3 := script.TapLeafHash(0xc2, s1)
+    q, cb = taprootOutput(t, internal, l3)
+    tx, prevOuts = taprootTx(q)
+    tx.TxIns[0].Witness = [][]byte{[]byte{0}, s1, append([]byte{cb + 2}, internal...)}
+    if err := catma.VerifyInputWithPrevOuts(prevOuts, tx, 0, taprootFlags); err != nil {
+        t.Errorf("Unknown leaf version failed: %s", err)
+    }
+}
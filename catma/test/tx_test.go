@@ -5,6 +5,7 @@ import (
     "testing"
     "encoding/json"
     "encoding/hex"
+    "github.com/conformal/btcec"
     "github.com/oxfeeefeee/kaiju/klib"
     "github.com/oxfeeefeee/kaiju/knet/btcmsg"
     "github.com/oxfeeefeee/kaiju/catma"
@@ -20,6 +21,7 @@ type prevOutput struct {
     prevHash klib.Hash256
     prevIndex uint32
     pkScript []byte
+    amount int64
 }
 
 func (p *prevOutput) String() string {
@@ -31,7 +33,7 @@ type prevOutputs []*prevOutput
 func (p *prevOutputs) GetTxOut(op *catma.OutPoint) *catma.TxOut {
     for _, out := range *p {
         if op.Hash == out.prevHash && op.Index == out.prevIndex {
-            return &catma.TxOut{0, out.pkScript}
+            return &catma.TxOut{Value: out.amount, PKScript: out.pkScript}
         }
     }
     return nil
@@ -51,7 +53,7 @@ func (c *txTestCase) valid() error {
 
     for i, txin := range c.tx.TxIns {
         txo := c.pos.GetTxOut(&txin.PreviousOutput)
-        err := catma.VerifyInputWithFlags(txo.PKScript, c.tx, i, c.flags)
+        err := catma.VerifyInputWithAmount(txo.PKScript, txo.Value, c.tx, i, c.flags)
         if err != nil {
             //fmt.Printf("tx Fail!\n")
             return err
@@ -80,11 +82,14 @@ func parsePrevOutputs(t *testing.T, data interface{}) []*prevOutput {
         var po prevOutput
         po.prevHash.SetString(ip[0].(string))
         po.prevIndex = uint32(ip[1].(float64))
-        script, err := parseScript(ip[2].(string))
+        script, err := script.Assemble(ip[2].(string))
         if err != nil {
             t.Errorf("error parsing script %s, data: %s", err, ip[2].(string))
         }
         po.pkScript = script
+        if len(ip) > 3 {
+            po.amount = int64(ip[3].(float64))
+        }
         prevOuts = append(prevOuts, &po)
     }
     return prevOuts
@@ -114,6 +119,8 @@ func parseFlags(data interface{}) script.EvalFlag {
             flag |= script.EvalFlagP2SH
         case "NULLDUMMY":
             flag |= script.EvalFlagNullDummy
+        case "WITNESS":
+            flag |= script.EvalFlagWitness
         }
     }
     return flag
@@ -152,4 +159,137 @@ func TestTx(t *testing.T) {
             }
         }
     }
-}
\ No newline at end of file
+}
+
+// Results with the signature cache must be the same as without
+func TestSigCache(t *testing.T) {
+    defer script.SetSigCacheSize(script.DefaultSigCacheSize)
+    var f interface{}
+    if err := json.Unmarshal([]byte(validTxs), &f); err != nil {
+        t.Fatalf("json.Unmarshal error %s", err)
+    }
+    for _, c := range f.([]interface{}) {
+        tc := parseTestCase(t, c)
+        if tc == nil {
+            continue
+        }
+        // Changing an output changes the sighash of most sighash types
+        tc.tx.TxOuts[0].Value++
+        script.SetSigCacheSize(0)
+        expected := tc.valid() == nil
+        tc.tx.TxOuts[0].Value--
+        script.SetSigCacheSize(script.DefaultSigCacheSize)
+        for i := 0; i < 2; i++ {
+            if err := tc.valid(); err != nil {
+                t.Errorf("valid tx deemed to be invalid on run %d: %s", i, err)
+            }
+        }
+        tc.tx.TxOuts[0].Value++
+        if (tc.valid() == nil) != expected {
+            t.Errorf("Signature cache changed result of %v", c)
+        }
+    }
+}
+
+// A pubkey and a sig cached as valid, split at another place, mustn't pass
+// as a valid pair. "<pk> CHECKSIGVERIFY <pk[:k]> CHECKSIG" spent by
+// "<pk[k:] sig> <sig>" hashes the same bytes for both checks.
+func TestSigCacheSplit(t *testing.T) {
+    key, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{1}, 32))
+    pk := key.PubKey().SerializeCompressed()
+    k := len(pk) - 1
+    pkScript := script.NewScript()
+    pkScript.AppendPushData(pk)
+    pkScript.AppendOp(script.OP_CHECKSIGVERIFY)
+    pkScript.AppendPushData(pk[:k])
+    pkScript.AppendOp(script.OP_CHECKSIG)
+
+    var prev klib.Hash256
+    tx := lockTimeTx(1, 0, 0xffffffff, &prev)
+    hash, err := tx.HashToSign(*pkScript, 0, catma.SIGHASH_ALL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s, err := key.Sign(hash[:])
+    if err != nil {
+        t.Fatal(err)
+    }
+    sig := append(s.Serialize(), catma.SIGHASH_ALL)
+    sigScript := script.NewScript()
+    sigScript.AppendPushData(append(append([]byte{}, pk[k:]...), sig...))
+    sigScript.AppendPushData(sig)
+    tx.TxIns[0].SigScript = *sigScript
+    if err := catma.VerifyInputWithFlags(*pkScript, tx, 0, script.EvalFlagP2SH); err == nil {
+        t.Errorf("Sig split from a cached one deemed to be valid")
+    }
+}
+
+// Runs the tx cases through VerifyTx, which verifies inputs in parallel
+func TestVerifyTxParallel(t *testing.T) {
+    catma.SetScriptWorkers(4)
+    defer catma.SetScriptWorkers(0)
+    for _, data := range []string{validTxs, invalidTxs} {
+        var f interface{}
+        if err := json.Unmarshal([]byte(data), &f); err != nil {
+            t.Fatalf("json.Unmarshal error %s", err)
+        }
+        for _, c := range f.([]interface{}) {
+            tc := parseTestCase(t, c)
+            if tc == nil || tc.tx.IsCoinBase() {
+                continue
+            }
+            utxo := memUtxo{}
+            for i, po := range tc.pos {
+                e := &catma.UtxoEntry{TxOut: catma.TxOut{PKScript: po.pkScript}}
+                if i == 0 {
+                    // Just enough to pay for all the outputs
+                    for _, txo := range tc.tx.TxOuts {
+                        e.Value += txo.Value
+                    }
+                }
+                utxo.Add(&po.prevHash, po.prevIndex, e)
+            }
+            _, err := catma.VerifyTx(tc.tx, utxo, 1, tc.flags, false)
+            if (err == nil) != (data == validTxs) {
+                t.Errorf("VerifyTx result %v doesn't match case %v", err, c)
+            }
+            if err != nil && len(utxo) != len(tc.pos) {
+                t.Errorf("UTXO set changed by invalid tx")
+            }
+        }
+    }
+}
+
+func TestWitnessTx(t *testing.T) {
+    var f interface{}
+    if err := json.Unmarshal([]byte(validWitnessTxs), &f); err != nil {
+        t.Fatalf("json.Unmarshal error %s", err)
+    }
+    for _, c := range f.([]interface{}) {
+        tc := parseTestCase(t, c)
+        if err := tc.valid(); err != nil {
+            t.Errorf("valid tx deemed to be invalid: %s, %v", err, c)
+        }
+        // Witness serialization has to round trip
+        data := c.([]interface{})[1].(string)
+        if hex.EncodeToString(tc.tx.WitnessBytes()) != data {
+            t.Errorf("tx serialization mismatch: %v", c)
+        }
+        if tc.tx.HasWitness() && *tc.tx.Hash() == *tc.tx.WitnessHash() {
+            t.Errorf("wtxid equals txid: %v", c)
+        }
+        if s := tc.tx.StripWitness(); !bytes.Equal(s.WitnessBytes(), tc.tx.Bytes()) ||
+            hex.EncodeToString(tc.tx.WitnessBytes()) != data {
+            t.Errorf("tx stripped of witness mismatch: %v", c)
+        }
+    }
+    if err := json.Unmarshal([]byte(invalidWitnessTxs), &f); err != nil {
+        t.Fatalf("json.Unmarshal error %s", err)
+    }
+    for _, c := range f.([]interface{}) {
+        tc := parseTestCase(t, c)
+        if err := tc.valid(); err == nil {
+            t.Errorf("invalid tx deemed to be valid: %v", c)
+        }
+    }
+}
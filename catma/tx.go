@@ -5,6 +5,8 @@ import (
     //"errors"
     "encoding/binary"
     "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
 )
 
 const (
@@ -35,6 +37,8 @@ type TxIn struct {
     SigScript       []byte
     // http://bitcoin.stackexchange.com/questions/2025/what-is-txins-sequence
     Sequence        uint32 
+    // Witness stack (BIP141), not part of the tx hash
+    Witness         [][]byte
 }
 
 type Tx struct {
@@ -44,8 +48,28 @@ type Tx struct {
     LockTime        uint32
 }
 
-func (to *TxOut) IsDust() bool {
-    return false // TODO_1
+// Returns the value below which the output costs more to spend than it is
+// worth, with fee rate "dustRelayFee" in satoshi per 1000 bytes.
+// Unspendable outputs are never dust.
+func (to *TxOut) DustThreshold(dustRelayFee int64) int64 {
+    s := script.Script(to.PKScript)
+    if (len(s) > 0 && script.Opcode(s[0]) == script.OP_RETURN) || len(s) > numbers.MaxScriptSize {
+        return 0
+    }
+    size := 8 + klib.VarString(to.PKScript).ByteSize()
+    if _, _, ok := s.WitnessProgram(); ok {
+        // Input spending it: outpoint, empty sigScript, sequence,
+        // and a witness of a sig and a pubkey, discounted
+        size += 32 + 4 + 1 + 107 / numbers.WitnessScaleFactor + 4
+    } else {
+        // Outpoint, sigScript of a sig and a pubkey, sequence
+        size += 32 + 4 + 1 + 107 + 4
+    }
+    return int64(size) * dustRelayFee / 1000
+}
+
+func (to *TxOut) IsDust(dustRelayFee int64) bool {
+    return to.Value < to.DustThreshold(dustRelayFee)
 }
 
 func (to *TxOut) Bytes() []byte {
@@ -74,11 +98,76 @@ func (op *OutPoint) IsNull() bool {
     return op.Hash.IsZero() && op.Index == 0xffffffff
 }
 
-// Returns the sha256^2 of serialized Tx
+// Returns the sha256^2 of serialized Tx, without witness
 func (t *Tx) Hash() *klib.Hash256 {
     return klib.Sha256Sha256(t.Bytes())
 }
 
+// Returns the sha256^2 of serialized Tx with witness, i.e. the wtxid,
+// which is the same as Hash if tx has no witness
+func (t *Tx) WitnessHash() *klib.Hash256 {
+    return klib.Sha256Sha256(t.WitnessBytes())
+}
+
+// If any of the inputs has witness data
+func (t *Tx) HasWitness() bool {
+    for _, txin := range t.TxIns {
+        if len(txin.Witness) > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// Returns a copy of Tx without witness, for peers not asking for it (BIP144).
+// Inputs are copied, the rest is shared.
+func (t *Tx) StripWitness() *Tx {
+    c := *t
+    c.TxIns = make([]*TxIn, len(t.TxIns))
+    for i, txin := range t.TxIns {
+        in := *txin
+        in.Witness = nil
+        c.TxIns[i] = &in
+    }
+    return &c
+}
+
+// Returns the data size of serialized Tx with witness
+func (t *Tx) WitnessByteSize() int {
+    size := t.ByteSize()
+    if !t.HasWitness() {
+        return size
+    }
+    size += 2 // Marker and flag
+    for _, txin := range t.TxIns {
+        size += klib.VarUint(len(txin.Witness)).ByteSize()
+        for _, item := range txin.Witness {
+            size += klib.VarString(item).ByteSize()
+        }
+    }
+    return size
+}
+
+// Returns the weight (BIP141), witness data is discounted to 1/4
+func (t *Tx) Weight() int {
+    return t.ByteSize() * (numbers.WitnessScaleFactor - 1) + t.WitnessByteSize()
+}
+
+// Returns if tx signals it can be replaced by a tx paying more fee (BIP125)
+func (t *Tx) SignalsRBF() bool {
+    for _, txin := range t.TxIns {
+        if txin.Sequence <= numbers.MaxBIP125RBFSequence {
+            return true
+        }
+    }
+    return false
+}
+
+// Returns the weight in virtual bytes, rounded up, which fee rates are based on
+func (t *Tx) VirtualSize() int {
+    return (t.Weight() + numbers.WitnessScaleFactor - 1) / numbers.WitnessScaleFactor
+}
+
 // Returns the data size of serialized Tx
 func (t *Tx) ByteSize() int {
     opLen := 32/*OutPoint.Hash*/ + 4/*OutPoint.Index*/
@@ -98,10 +187,23 @@ func (t *Tx) ByteSize() int {
     return totalLen
 }
 
-// Returns the serialized byte of the Tx
+// Returns the serialized byte of the Tx, without witness
 func (t *Tx) Bytes() []byte {
+    return t.serialize(false)
+}
+
+// Returns the serialized byte of the Tx, with witness if there is any
+func (t *Tx) WitnessBytes() []byte {
+    return t.serialize(t.HasWitness())
+}
+
+func (t *Tx) serialize(witness bool) []byte {
     p := new(bytes.Buffer)
     binary.Write(p, binary.LittleEndian, t.Version)
+    if witness {
+        // Marker and flag, the marker being an empty input list
+        p.Write([]byte{0x00, 0x01})
+    }
 
     p.Write(klib.VarUint(len(t.TxIns)).Bytes())
     for _, txin := range t.TxIns {
@@ -114,6 +216,14 @@ func (t *Tx) Bytes() []byte {
         binary.Write(p, binary.LittleEndian, txout.Value)
         p.Write(klib.VarString(txout.PKScript).Bytes())
     }
+    if witness {
+        for _, txin := range t.TxIns {
+            p.Write(klib.VarUint(len(txin.Witness)).Bytes())
+            for _, item := range txin.Witness {
+                p.Write(klib.VarString(item).Bytes())
+            }
+        }
+    }
     binary.Write(p, binary.LittleEndian, t.LockTime)
     return p.Bytes()
 }
@@ -46,6 +46,19 @@ var (
     errDustTxOut = errors.New("TxIsStandard: dust output")
 
     errMoreThanOneReturn = errors.New("TxIsStandard: more than one OP_RETURN")
+
+    errDataCarrierSize = errors.New("TxIsStandard: OP_RETURN output too large")
+
+    errBareMultiSig = errors.New("TxIsStandard: bare multisig output")
+
+    // Tx.InputsStandard -------------------------------------------------------------
+    errInputNotFound = errors.New("Tx.InputsStandard: input not found")
+
+    errNonStandardInput = errors.New("Tx.InputsStandard: non-standard input")
+
+    errP2SHSigOps = errors.New("Tx.InputsStandard: too many P2SH sigops")
+
+    errStdSigOps = errors.New("Tx.InputsStandard: too many sigops")
     )
 
 // CheckTransaction in Satoshi client
@@ -66,7 +79,7 @@ func (t *Tx) FormatCheck() error {
             return errNegativeVOut
         }
         valueOut += txout.Value
-        if valueOut > numbers.SatoshiInTotal {
+        if txout.Value > numbers.SatoshiInTotal || valueOut > numbers.SatoshiInTotal {
             return errTooLargeVout
         }
     }
@@ -93,21 +106,20 @@ func (t *Tx) FormatCheck() error {
     return nil
 }
 
-// Check if Tx is standard.
-func (t *Tx) IsStandard(blockHeight uint32, blockTime uint32) error {
-    if t.Version > numbers.TxCurrentVersion || t.Version < 1 {
+// Check if Tx is standard under policy "p", without looking at its inputs.
+func (t *Tx) IsStandard(p *Policy, blockHeight uint32, blockTime uint32) error {
+    if t.Version > p.MaxTxVersion || t.Version < 1 {
         return errBadVersion
     }
     if ! t.IsFinal(blockHeight, blockTime) {
         return errNotFinal
     }
-    // Uses ">=" to follow the Satoshi client
-    if t.ByteSize() >= numbers.MaxStandardTxSize {
+    if t.Weight() > p.MaxTxWeight {
         return errStdSizeLimit
     }
     for _, txin := range t.TxIns {
         s := script.Script(txin.SigScript)
-        if len(s) > numbers.MaxSigScriptSize {
+        if len(s) > p.MaxSigScriptSize {
             return errSigScriptSizeLimit
         }
         if !s.IsPushOnly() {
@@ -119,12 +131,25 @@ func (t *Tx) IsStandard(blockHeight uint32, blockTime uint32) error {
     }
     dataOut := 0
     for _, txout := range t.TxOuts {
-        sType := script.Script(txout.PKScript).PKScriptType()
-        if sType == script.PKS_NonStandard {
+        s := script.Script(txout.PKScript)
+        switch s.PKScriptType() {
+        case script.PKS_NonStandard:
             return errNonStandardPKScript
-        } else if sType == script.PKS_NullData {
+        case script.PKS_NullData:
+            if len(s) > p.MaxDataCarrierSize {
+                return errDataCarrierSize
+            }
             dataOut++
-        } else if txout.IsDust() {
+            continue
+        case script.PKS_MultiSig:
+            if !p.PermitBareMultiSig {
+                return errBareMultiSig
+            }
+            if s.MultiSigKeyCount() > numbers.MaxStandardMultiSigKeys {
+                return errNonStandardPKScript
+            }
+        }
+        if txout.IsDust(p.DustRelayFee) {
             return errDustTxOut
         }
     }
@@ -134,55 +159,74 @@ func (t *Tx) IsStandard(blockHeight uint32, blockTime uint32) error {
     return nil
 }
 
-// Returns if Tx is final
+// Returns if Tx is final in a block at "blockHeight", "blockTime" is the
+// median time past once BIP113 is active
 func (t *Tx) IsFinal(blockHeight uint32, blockTime uint32) bool {
     if t.LockTime == 0 {
         return true
     }
     if t.LockTime < numbers.LockTimeThreshold {
-        return t.LockTime < blockHeight
-    } else {
-        return t.LockTime < blockTime
+        if t.LockTime < blockHeight {
+            return true
+        }
+    } else if t.LockTime < blockTime {
+        return true
+    }
+    // Lock time is ignored if all the inputs are final
+    for _, txin := range t.TxIns {
+        if txin.Sequence != numbers.SequenceFinal {
+            return false
+        }
     }
+    return true
 }
 
-// Check inputs and the "script" of pay-to-script-hash
-func (t *Tx) InputsStandard(utxos UTXOs) bool {
+// Check inputs and the "script" of pay-to-script-hash under policy "p",
+// also checks the sigops of the tx.
+func (t *Tx) InputsStandard(p *Policy, utxos UTXOs) error {
     if t.IsCoinBase() {
-        return true
+        return nil
     }
+    sigOpCost := t.legacySigOpCount() * numbers.WitnessScaleFactor
     for _, txi := range t.TxIns {
         txo := utxos.GetTxOut(&txi.PreviousOutput)
+        if txo == nil {
+            return errInputNotFound
+        }
         pkScript := script.Script(txo.PKScript)
         ttype := pkScript.PKScriptType()
         ok, argCount := pkScript.SigArgsExpected(ttype)
         if !ok {
-            return false
+            return errNonStandardInput
         }
         err, result := script.RunSigScript(txi.SigScript)
         if err != nil {
-            return false
+            return errNonStandardInput
         }
         if ttype == script.PKS_ScriptHash {
             if len(result) == 0 {
-                return false
+                return errNonStandardInput
             }
-            pkScript := script.Script(result[len(result)-1])
-            ttype := pkScript.PKScriptType()
-            if ttype == script.PKS_ScriptHash {
-                return false // Recursive P2SH
+            // Any redeem script is fine as long as it has few sigops
+            count := pkScript.P2SHSigOpCount(txi.SigScript)
+            if count > p.MaxP2SHSigOps {
+                return errP2SHSigOps
             }
-            ok, count := pkScript.SigArgsExpected(ttype)
-            if !ok {
-                return false
+            sigOpCost += count * numbers.WitnessScaleFactor
+            redeem := script.Script(result[len(result)-1])
+            if _, _, ok := redeem.WitnessProgram(); ok {
+                argCount = 1
+            } else {
+                argCount = len(result)
             }
-            argCount += count
         }
         if len(result) != argCount {
-            return false
+            return errNonStandardInput
         }
+        sigOpCost += pkScript.WitnessSigOpCount(txi.SigScript, txi.Witness)
     }
-    return true
+    if sigOpCost > p.MaxTxSigOpsCost {
+        return errStdSigOps
+    }
+    return nil
 }
-
-
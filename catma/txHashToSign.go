@@ -3,6 +3,7 @@ package catma
 import (
     "bytes"
     "errors"
+    "crypto/sha256"
     "encoding/binary"
     "github.com/oxfeeefeee/kaiju/klib"
     "github.com/oxfeeefeee/kaiju/catma/numbers"
@@ -11,6 +12,10 @@ import (
 type InputEntry struct {
     tx              *Tx
     index           int
+    // Value of the output being spent, only signed by segwit inputs
+    amount          int64
+    // Outputs spent by all the inputs of tx, only signed by taproot inputs
+    prevOuts        []*TxOut
 }
 
 // Returns the data(Hash of custom serialized tx) to sign for an input of a TX
@@ -18,6 +23,33 @@ func (e *InputEntry) HashToSign(subScript []byte, hashType byte) (*klib.Hash256,
     return e.tx.HashToSign(subScript, e.index, hashType)
 }
 
+// Returns the data to sign for a segwit version 0 input, see BIP143
+func (e *InputEntry) WitnessHashToSign(subScript []byte, hashType byte) (*klib.Hash256, error) {
+    return e.tx.WitnessHashToSign(subScript, e.index, e.amount, hashType)
+}
+
+// Returns the data to sign for a taproot input, see BIP341
+func (e *InputEntry) TaprootHashToSign(hashType byte, annex []byte, leafHash []byte,
+    codeSepPos uint32) (*klib.Hash256, error) {
+    return e.tx.TaprootHashToSign(e.prevOuts, e.index, hashType, annex, leafHash, codeSepPos)
+}
+
+func (e *InputEntry) Witness() [][]byte {
+    return e.tx.TxIns[e.index].Witness
+}
+
+func (e *InputEntry) TxVersion() uint32 {
+    return e.tx.Version
+}
+
+func (e *InputEntry) LockTime() uint32 {
+    return e.tx.LockTime
+}
+
+func (e *InputEntry) Sequence() uint32 {
+    return e.tx.TxIns[e.index].Sequence
+}
+
 func (t *Tx) HashToSign(subScript []byte, ii int, hashType byte) (*klib.Hash256, error) {
     if ii >= len(t.TxIns) {
         return nil, errors.New("Tx.StringToSign invalid index")
@@ -86,4 +118,144 @@ func (t *Tx) HashToSign(subScript []byte, ii int, hashType byte) (*klib.Hash256,
     // Notice hashTypes needs to take 4 bytes
     binary.Write(p, binary.LittleEndian, uint32(hashType))
     return klib.Sha256Sha256(p.Bytes()), nil
-}
\ No newline at end of file
+}
+
+// BIP143 transaction digest, which fixes the quadratic hashing of HashToSign
+// and commits to the value of the output being spent.
+func (t *Tx) WitnessHashToSign(subScript []byte, ii int, amount int64, hashType byte) (*klib.Hash256, error) {
+    if ii >= len(t.TxIns) {
+        return nil, errors.New("Tx.WitnessHashToSign invalid index")
+    }
+    anyoneCanPay := (hashType & SIGHASH_ANYONECANPAY) != 0
+    htype := hashType & numbers.HashTypeMask
+    var hashPrevouts, hashSequence, hashOutputs klib.Hash256
+    if !anyoneCanPay {
+        p := new(bytes.Buffer)
+        for _, txin := range t.TxIns {
+            binary.Write(p, binary.LittleEndian, txin.PreviousOutput)
+        }
+        hashPrevouts = *klib.Sha256Sha256(p.Bytes())
+    }
+    if !anyoneCanPay && htype != SIGHASH_SINGLE && htype != SIGHASH_NONE {
+        p := new(bytes.Buffer)
+        for _, txin := range t.TxIns {
+            binary.Write(p, binary.LittleEndian, txin.Sequence)
+        }
+        hashSequence = *klib.Sha256Sha256(p.Bytes())
+    }
+    if htype != SIGHASH_SINGLE && htype != SIGHASH_NONE {
+        p := new(bytes.Buffer)
+        for _, txout := range t.TxOuts {
+            binary.Write(p, binary.LittleEndian, txout.Value)
+            p.Write(((klib.VarString)(txout.PKScript)).Bytes())
+        }
+        hashOutputs = *klib.Sha256Sha256(p.Bytes())
+    } else if htype == SIGHASH_SINGLE && ii < len(t.TxOuts) {
+        p := new(bytes.Buffer)
+        txout := t.TxOuts[ii]
+        binary.Write(p, binary.LittleEndian, txout.Value)
+        p.Write(((klib.VarString)(txout.PKScript)).Bytes())
+        hashOutputs = *klib.Sha256Sha256(p.Bytes())
+    }
+    txin := t.TxIns[ii]
+    p := new(bytes.Buffer)
+    binary.Write(p, binary.LittleEndian, t.Version)
+    p.Write(hashPrevouts[:])
+    p.Write(hashSequence[:])
+    binary.Write(p, binary.LittleEndian, txin.PreviousOutput)
+    p.Write(((klib.VarString)(subScript)).Bytes())
+    binary.Write(p, binary.LittleEndian, amount)
+    binary.Write(p, binary.LittleEndian, txin.Sequence)
+    p.Write(hashOutputs[:])
+    binary.Write(p, binary.LittleEndian, t.LockTime)
+    binary.Write(p, binary.LittleEndian, uint32(hashType))
+    return klib.Sha256Sha256(p.Bytes()), nil
+}
+
+// BIP341 signature message of input "ii", "prevOuts" are the outputs spent
+// by all the inputs. "leafHash" is nil for key path spending, otherwise
+// "leafHash" and "codeSepPos" are signed too as defined in BIP342.
+func (t *Tx) TaprootHashToSign(prevOuts []*TxOut, ii int, hashType byte, annex []byte,
+    leafHash []byte, codeSepPos uint32) (*klib.Hash256, error) {
+    if ii >= len(t.TxIns) {
+        return nil, errors.New("Tx.TaprootHashToSign invalid index")
+    }
+    if len(prevOuts) != len(t.TxIns) {
+        return nil, errors.New("Tx.TaprootHashToSign spent outputs missing")
+    }
+    for _, txo := range prevOuts {
+        if txo == nil {
+            return nil, errors.New("Tx.TaprootHashToSign spent outputs missing")
+        }
+    }
+    anyoneCanPay := (hashType & SIGHASH_ANYONECANPAY) != 0
+    htype := hashType & 0x03
+    if !(hashType <= 0x03 || (hashType >= 0x81 && hashType <= 0x83)) {
+        return nil, errors.New("Tx.TaprootHashToSign invalid hash type")
+    }
+    if htype == SIGHASH_SINGLE && ii >= len(t.TxOuts) {
+        return nil, errors.New("Tx.TaprootHashToSign no output for SIGHASH_SINGLE")
+    }
+    p := new(bytes.Buffer)
+    p.WriteByte(0) // Epoch
+    p.WriteByte(hashType)
+    binary.Write(p, binary.LittleEndian, t.Version)
+    binary.Write(p, binary.LittleEndian, t.LockTime)
+    if !anyoneCanPay {
+        prevouts, amounts := sha256.New(), sha256.New()
+        pkScripts, sequences := sha256.New(), sha256.New()
+        for i, txin := range t.TxIns {
+            binary.Write(prevouts, binary.LittleEndian, txin.PreviousOutput)
+            binary.Write(amounts, binary.LittleEndian, prevOuts[i].Value)
+            pkScripts.Write(((klib.VarString)(prevOuts[i].PKScript)).Bytes())
+            binary.Write(sequences, binary.LittleEndian, txin.Sequence)
+        }
+        p.Write(prevouts.Sum(nil))
+        p.Write(amounts.Sum(nil))
+        p.Write(pkScripts.Sum(nil))
+        p.Write(sequences.Sum(nil))
+    }
+    if htype != SIGHASH_NONE && htype != SIGHASH_SINGLE {
+        outputs := sha256.New()
+        for _, txout := range t.TxOuts {
+            binary.Write(outputs, binary.LittleEndian, txout.Value)
+            outputs.Write(((klib.VarString)(txout.PKScript)).Bytes())
+        }
+        p.Write(outputs.Sum(nil))
+    }
+    spendType := byte(0)
+    if leafHash != nil {
+        spendType |= 2
+    }
+    if annex != nil {
+        spendType |= 1
+    }
+    p.WriteByte(spendType)
+    if anyoneCanPay {
+        txin := t.TxIns[ii]
+        binary.Write(p, binary.LittleEndian, txin.PreviousOutput)
+        binary.Write(p, binary.LittleEndian, prevOuts[ii].Value)
+        p.Write(((klib.VarString)(prevOuts[ii].PKScript)).Bytes())
+        binary.Write(p, binary.LittleEndian, txin.Sequence)
+    } else {
+        binary.Write(p, binary.LittleEndian, uint32(ii))
+    }
+    if annex != nil {
+        h := sha256.Sum256(((klib.VarString)(annex)).Bytes())
+        p.Write(h[:])
+    }
+    if htype == SIGHASH_SINGLE {
+        txout := t.TxOuts[ii]
+        output := new(bytes.Buffer)
+        binary.Write(output, binary.LittleEndian, txout.Value)
+        output.Write(((klib.VarString)(txout.PKScript)).Bytes())
+        h := sha256.Sum256(output.Bytes())
+        p.Write(h[:])
+    }
+    if leafHash != nil {
+        p.Write(leafHash)
+        p.WriteByte(0) // Key version
+        binary.Write(p, binary.LittleEndian, codeSepPos)
+    }
+    return klib.TaggedHash("TapSighash", p.Bytes()), nil
+}
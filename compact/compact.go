@@ -0,0 +1,54 @@
+// Package compact implements compact blocks (BIP152): blocks are relayed as
+// short ids of their txs, which the receiver mostly has in mempool already.
+package compact
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/binary"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+// Version of compact blocks with short ids of wtxids, the only one supported
+const Version = 2
+
+// Short ids are the lower 6 bytes of SipHash
+const shortIDMask = 1 << (btcmsg.ShortIDSize * 8) - 1
+
+// SipHash keys of the short ids of a compact block
+type shortIDKeys struct {
+    k0, k1      uint64
+}
+
+// The keys are taken from sha256 of the header and the nonce
+func newShortIDKeys(h *catma.Header, nonce uint64) shortIDKeys {
+    p := new(bytes.Buffer)
+    binary.Write(p, binary.LittleEndian, h)
+    binary.Write(p, binary.LittleEndian, nonce)
+    sum := sha256.Sum256(p.Bytes())
+    return shortIDKeys{
+        binary.LittleEndian.Uint64(sum[0:8]),
+        binary.LittleEndian.Uint64(sum[8:16]),
+    }
+}
+
+func (k shortIDKeys) shortID(wtxid *klib.Hash256) uint64 {
+    return klib.SipHash(k.k0, k.k1, wtxid[:]) & shortIDMask
+}
+
+// Builds the compact block of a block, only the coin base is prefilled.
+// "nonce" should be random, so that collisions of short ids differ between peers.
+func NewBlock(h *catma.Header, txs []*catma.Tx, nonce uint64) *btcmsg.Message_cmpctblock {
+    m := btcmsg.NewCmpctBlockMsg().(*btcmsg.Message_cmpctblock)
+    m.Header = h
+    m.Nonce = nonce
+    m.PrefilledTxs = []*btcmsg.PrefilledTx{&btcmsg.PrefilledTx{Index: 0, Tx: (*btcmsg.Tx)(txs[0])}}
+    keys := newShortIDKeys(h, nonce)
+    m.ShortIDs = make([]uint64, len(txs) - 1)
+    for i := 1; i < len(txs); i++ {
+        m.ShortIDs[i - 1] = keys.shortID(txs[i].WitnessHash())
+    }
+    return m
+}
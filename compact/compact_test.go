@@ -0,0 +1,123 @@
+package compact
+
+import (
+    "testing"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+func testTx(seed byte) *catma.Tx {
+    var h klib.Hash256
+    h[0] = seed
+    tx := &catma.Tx{Version: 2}
+    tx.TxIns = []*catma.TxIn{&catma.TxIn{PreviousOutput: catma.OutPoint{Hash: h},
+        SigScript: []byte{0x01, seed}, Sequence: 0xffffffff}}
+    tx.TxOuts = []*catma.TxOut{&catma.TxOut{Value: int64(seed) * 1000, PKScript: []byte{0x51}}}
+    return tx
+}
+
+func testBlock(n int) (*catma.Header, []*catma.Tx) {
+    txs := make([]*catma.Tx, n)
+    for i := range txs {
+        txs[i] = testTx(byte(i + 1))
+    }
+    root, _ := catma.TxsMerkleRoot(txs)
+    return &catma.Header{Version: 4, MerkleRoot: *root, Timestamp: 1600000000}, txs
+}
+
+// Encodes and decodes the message, as if it's been through the network
+func roundTrip(t *testing.T, m *btcmsg.Message_cmpctblock) *btcmsg.Message_cmpctblock {
+    raw, err := m.Encode()
+    if err != nil {
+        t.Fatalf("Encode error %s", err)
+    }
+    m2 := btcmsg.NewCmpctBlockMsg().(*btcmsg.Message_cmpctblock)
+    if err := m2.Decode(raw); err != nil {
+        t.Fatalf("Decode error %s", err)
+    }
+    return m2
+}
+
+func TestRebuildBlock(t *testing.T) {
+    h, txs := testBlock(5)
+    m := roundTrip(t, NewBlock(h, txs, 12345))
+    if len(m.ShortIDs) != 4 || len(m.PrefilledTxs) != 1 || m.Nonce != 12345 {
+        t.Fatalf("Bad compact block, %d short ids, %d prefilled", len(m.ShortIDs), len(m.PrefilledTxs))
+    }
+    // Pool has all but txs 2 and 4, and some unrelated ones
+    pool := []*catma.Tx{txs[3], testTx(100), txs[1], testTx(101)}
+    b, err := NewPartialBlock(m, pool)
+    if err != nil {
+        t.Fatalf("NewPartialBlock error %s", err)
+    }
+    missing := b.Missing()
+    if len(missing) != 2 || missing[0] != 2 || missing[1] != 4 {
+        t.Fatalf("Missing %v, expect [2 4]", missing)
+    }
+    if err := b.Fill(txs[2:3]); err != errWrongTxCount {
+        t.Errorf("Fill with too few txs: %v", err)
+    }
+    if err := b.Fill([]*catma.Tx{txs[2], txs[4]}); err != nil {
+        t.Fatalf("Fill error %s", err)
+    }
+    for i, tx := range b.Txs() {
+        if *tx.Hash() != *txs[i].Hash() {
+            t.Errorf("Tx %d is %s, expect %s", i, tx.Hash(), txs[i].Hash())
+        }
+    }
+}
+
+func TestRebuildFailures(t *testing.T) {
+    h, txs := testBlock(3)
+    m := NewBlock(h, txs, 1)
+    b, err := NewPartialBlock(m, nil)
+    if err != nil {
+        t.Fatalf("NewPartialBlock error %s", err)
+    }
+    // Wrong txs don't match the merkle root
+    if err := b.Fill([]*catma.Tx{txs[2], txs[1]}); err != ErrShortIDCollision {
+        t.Errorf("Fill with wrong txs: %v", err)
+    }
+    m.ShortIDs[1] = m.ShortIDs[0]
+    if _, err := NewPartialBlock(m, nil); err != ErrShortIDCollision {
+        t.Errorf("Duplicate short ids: %v", err)
+    }
+    m = NewBlock(h, txs, 1)
+    m.PrefilledTxs[0].Index = 3
+    if _, err := NewPartialBlock(m, nil); err != errBadCompactBlock {
+        t.Errorf("Prefilled tx out of range: %v", err)
+    }
+}
+
+func TestBlockTxnMsg(t *testing.T) {
+    _, txs := testBlock(3)
+    get := btcmsg.NewGetBlockTxnMsg().(*btcmsg.Message_getblocktxn)
+    get.BlockHash = *txs[0].Hash()
+    get.Indexes = []int{1, 5, 6, 100}
+    raw, err := get.Encode()
+    if err != nil {
+        t.Fatalf("Encode error %s", err)
+    }
+    get2 := btcmsg.NewGetBlockTxnMsg().(*btcmsg.Message_getblocktxn)
+    if err := get2.Decode(raw); err != nil {
+        t.Fatalf("Decode error %s", err)
+    }
+    if get2.BlockHash != get.BlockHash || len(get2.Indexes) != 4 || get2.Indexes[3] != 100 {
+        t.Errorf("Bad getblocktxn %+v", get2)
+    }
+    resp := btcmsg.NewBlockTxnMsg().(*btcmsg.Message_blocktxn)
+    resp.BlockHash = get.BlockHash
+    resp.Txs = []*btcmsg.Tx{(*btcmsg.Tx)(txs[1]), (*btcmsg.Tx)(txs[2])}
+    raw, err = resp.Encode()
+    if err != nil {
+        t.Fatalf("Encode error %s", err)
+    }
+    resp2 := btcmsg.NewBlockTxnMsg().(*btcmsg.Message_blocktxn)
+    if err := resp2.Decode(raw); err != nil {
+        t.Fatalf("Decode error %s", err)
+    }
+    if len(resp2.Txs) != 2 || *(*catma.Tx)(resp2.Txs[1]).Hash() != *txs[2].Hash() {
+        t.Errorf("Bad blocktxn")
+    }
+}
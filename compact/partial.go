@@ -0,0 +1,118 @@
+package compact
+
+import (
+    "errors"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+// The smallest weight of a tx, used to bound the tx count of a block
+const minTxWeight = 10 * numbers.WitnessScaleFactor
+
+// Returned when the block can't be rebuilt from short ids, the full block
+// has to be downloaded instead
+var ErrShortIDCollision = errors.New("PartialBlock: short id collision")
+
+var (
+    errBadCompactBlock = errors.New("NewPartialBlock: invalid compact block")
+
+    errWrongTxCount = errors.New("PartialBlock.Fill: wrong number of txs")
+
+    errBadMerkleRoot = errors.New("PartialBlock.Fill: merkle root mismatch")
+)
+
+// A block being rebuilt from a compact block
+type PartialBlock struct {
+    Header      *catma.Header
+    // nil for the ones missing
+    txs         []*catma.Tx
+}
+
+// Fills the block with the prefilled txs and the txs in "pool" matching
+// the short ids.
+// A short id matching more than one tx in pool is left missing.
+func NewPartialBlock(m *btcmsg.Message_cmpctblock, pool []*catma.Tx) (*PartialBlock, error) {
+    total := len(m.ShortIDs) + len(m.PrefilledTxs)
+    if total == 0 || total > numbers.MaxBlockWeight / minTxWeight {
+        return nil, errBadCompactBlock
+    }
+    b := &PartialBlock{Header: m.Header, txs: make([]*catma.Tx, total)}
+    for _, p := range m.PrefilledTxs {
+        if p.Index >= total || p.Tx == nil {
+            return nil, errBadCompactBlock
+        }
+        b.txs[p.Index] = (*catma.Tx)(p.Tx)
+    }
+    // Positions of short ids, the ones not prefilled in order
+    positions := make(map[uint64]int, len(m.ShortIDs))
+    j := 0
+    for i, tx := range b.txs {
+        if tx != nil {
+            continue
+        }
+        if j >= len(m.ShortIDs) {
+            // Prefilled txs at the same position
+            return nil, errBadCompactBlock
+        }
+        id := m.ShortIDs[j]
+        if _, ok := positions[id]; ok {
+            return nil, ErrShortIDCollision
+        }
+        positions[id] = i
+        j++
+    }
+    keys := newShortIDKeys(m.Header, m.Nonce)
+    ambiguous := make(map[int]bool)
+    for _, tx := range pool {
+        i, ok := positions[keys.shortID(tx.WitnessHash())]
+        if !ok || ambiguous[i] {
+            continue
+        }
+        if b.txs[i] != nil {
+            b.txs[i] = nil
+            ambiguous[i] = true
+            continue
+        }
+        b.txs[i] = tx
+    }
+    return b, nil
+}
+
+// Positions of the txs missing, in increasing order
+func (b *PartialBlock) Missing() []int {
+    missing := make([]int, 0)
+    for i, tx := range b.txs {
+        if tx == nil {
+            missing = append(missing, i)
+        }
+    }
+    return missing
+}
+
+// Fills in the missing txs in order and checks the merkle root.
+// ErrShortIDCollision is returned if a tx from pool turns out to be wrong.
+func (b *PartialBlock) Fill(txs []*catma.Tx) error {
+    missing := b.Missing()
+    if len(txs) != len(missing) {
+        return errWrongTxCount
+    }
+    for i, pos := range missing {
+        b.txs[pos] = txs[i]
+    }
+    root, mutated := catma.TxsMerkleRoot(b.txs)
+    if mutated {
+        return errBadMerkleRoot
+    }
+    if *root != b.Header.MerkleRoot {
+        // Missing txs from the peer are committed to by the merkle root, it
+        // must be one from pool with the same short id
+        return ErrShortIDCollision
+    }
+    return nil
+}
+
+// Txs of the block, only complete after Fill
+func (b *PartialBlock) Txs() []*catma.Tx {
+    return b.txs
+}
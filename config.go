@@ -19,6 +19,29 @@ type Config struct {
     KdbWAFileName       string
     MaxKdbWAValueLen    int
     KDBCapacity         uint32
+    UndoDirName         string
+    // How many recent blocks keep undo data, i.e. the deepest reorg supported
+    MaxUndoBlocks       int
+    // Goroutines used to verify scripts, 0 means one for each CPU
+    ScriptWorkers       int
+    // Max entries of the cache of valid signatures, 0 disables it
+    SigCacheSize        int
+    // Max total virtual size of txs in mempool
+    MempoolMaxSize      int
+    // File in DataDir keeping fee estimates across restarts
+    FeeEstimatesFileName string
+    // Relay policy, fields not set take defaults of catma.DefaultPolicy
+    Policy              json.RawMessage
+    // Address the JSON-RPC server listens on, empty disables it
+    RPCListen           string
+    // Basic auth credentials of RPC, besides the cookie
+    RPCUser             string
+    RPCPassword         string
+    // File in DataDir with the cookie of RPC, rewritten on every start
+    RPCCookieFileName   string
+    // Address notifications are published on, "tcp://host:port" or
+    // "ipc://path" of a Unix socket, empty disables them
+    ZMQListen           string
 }
 
 var cfg *Config
@@ -13,10 +13,22 @@ const NetWorkMagicTestNet = 0xDAB5BFFA
 const AlertPublicKey = "04fc9702847840aaf195de8442ebecedf5b095cdbb9bc716bda9110971b28a49e0ead8564ff0db22209e0374782c093bb899692d524e9d6a6956e7c5ecbcd68284"
 
 // Bitcoin network protocol version
-const ProtocolVersion uint32 = 70002
+const ProtocolVersion uint32 = 70014
+
+// Lowest protocol version supporting "sendheaders" (BIP130)
+const SendHeadersVersion uint32 = 70012
+
+// Lowest protocol version supporting compact blocks (BIP152)
+const CompactBlocksVersion uint32 = 70014
 
 // What serivices does this node provides
-const NodeServices uint64 = 1
+const NodeServices uint64 = NodeNetwork | NodeWitness
+
+// Service bits
+const (
+    NodeNetwork uint64 = 1
+    NodeWitness uint64 = 1 << 3
+)
 
 const ListenPort int = 8333
 
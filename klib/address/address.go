@@ -0,0 +1,88 @@
+package address
+
+import (
+    "errors"
+    "strings"
+    )
+
+// Address prefixes of a network
+type Network struct {
+    Name                string
+    PubKeyHashPrefix    byte    // Base58Check version of P2PKH addresses
+    ScriptHashPrefix    byte    // Base58Check version of P2SH addresses
+    Bech32HRP           string  // Human readable part of segwit addresses
+}
+
+var (
+    MainNet = &Network{"mainnet", 0x00, 0x05, "bc"}
+    TestNet = &Network{"testnet", 0x6f, 0xc4, "tb"}
+    RegTest = &Network{"regtest", 0x6f, 0xc4, "bcrt"}
+)
+
+// Returns the network by name, nil if unknown
+func NetworkByName(name string) *Network {
+    for _, n := range []*Network{MainNet, TestNet, RegTest} {
+        if n.Name == name {
+            return n
+        }
+    }
+    return nil
+}
+
+type AddrType byte
+
+const (
+    AddrPubKeyHash AddrType = iota
+    AddrScriptHash
+    AddrWitness
+)
+
+// A decoded address, Hash is the pubkey hash, the script hash or the
+// witness program depending on Type.
+type Address struct {
+    Type        AddrType
+    Version     int     // Witness version, AddrWitness only
+    Hash        []byte
+}
+
+var errAddrFormat = errors.New("Address: unknown format")
+
+// Parses a P2PKH, P2SH or segwit address of network "net"
+func Decode(addr string, net *Network) (*Address, error) {
+    if strings.HasPrefix(strings.ToLower(addr), net.Bech32HRP + "1") {
+        version, program, err := SegwitDecode(net.Bech32HRP, addr)
+        if err != nil {
+            return nil, err
+        }
+        return &Address{AddrWitness, version, program}, nil
+    }
+    version, payload, err := Base58CheckDecode(addr)
+    if err != nil {
+        return nil, err
+    }
+    if len(payload) != 20 {
+        return nil, errAddrFormat
+    }
+    switch version {
+    case net.PubKeyHashPrefix:
+        return &Address{AddrPubKeyHash, 0, payload}, nil
+    case net.ScriptHashPrefix:
+        return &Address{AddrScriptHash, 0, payload}, nil
+    default:
+        return nil, errors.New("Address: wrong network")
+    }
+}
+
+// Returns the string form of the address on network "net"
+func (a *Address) Encode(net *Network) (string, error) {
+    switch a.Type {
+    case AddrPubKeyHash:
+        return Base58CheckEncode(net.PubKeyHashPrefix, a.Hash), nil
+    case AddrScriptHash:
+        return Base58CheckEncode(net.ScriptHashPrefix, a.Hash), nil
+    case AddrWitness:
+        return SegwitEncode(net.Bech32HRP, a.Version, a.Hash)
+    default:
+        return "", errAddrFormat
+    }
+}
@@ -0,0 +1,120 @@
+package address
+
+import (
+    "testing"
+    "strings"
+    "encoding/hex"
+)
+
+func TestBase58(t *testing.T) {
+    cases := []struct{
+        hex     string
+        b58     string
+    }{
+        {"", ""},
+        {"61", "2g"},
+        {"626262", "a3gV"},
+        {"636363", "aPEr"},
+        {"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+        {"00000000000000000000", "1111111111"},
+    }
+    for _, c := range cases {
+        p, _ := hex.DecodeString(c.hex)
+        if s := Base58Encode(p); s != c.b58 {
+            t.Errorf("Base58Encode(%s) = %s, want %s", c.hex, s, c.b58)
+        }
+        d, err := Base58Decode(c.b58)
+        if err != nil || hex.EncodeToString(d) != c.hex {
+            t.Errorf("Base58Decode(%s) = %x, %v", c.b58, d, err)
+        }
+    }
+    if _, err := Base58Decode("0OIl"); err == nil {
+        t.Errorf("Invalid base58 characters accepted")
+    }
+}
+
+func TestBech32(t *testing.T) {
+    valid := []struct{
+        s       string
+        variant Bech32Variant
+    }{
+        {"A12UEL5L", Bech32},
+        {"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", Bech32},
+        {"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w", Bech32},
+        {"A1LQFN3A", Bech32m},
+        {"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", Bech32m},
+        {"split1checkupstagehandshakeupstreamerranterredcaperredlc445v", Bech32m},
+    }
+    for _, c := range valid {
+        hrp, data, variant, err := Bech32Decode(c.s)
+        if err != nil || variant != c.variant {
+            t.Errorf("Bech32Decode(%s): %v, variant %d", c.s, err, variant)
+            continue
+        }
+        if s := Bech32Encode(hrp, data, variant); s != strings.ToLower(c.s) {
+            t.Errorf("Bech32Encode round trip: %s != %s", s, c.s)
+        }
+    }
+    invalid := []string{
+        "A12UEL5l",     // Mixed case
+        "A12UEL5M",     // Bad checksum
+        "12UEL5L",      // Empty hrp
+        "a1ab",         // Too short checksum
+        "abcdef1bpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",  // Invalid character 'b'
+    }
+    for _, s := range invalid {
+        if _, _, _, err := Bech32Decode(s); err == nil {
+            t.Errorf("Invalid bech32 string %s accepted", s)
+        }
+    }
+}
+
+func TestAddress(t *testing.T) {
+    cases := []struct{
+        addr    string
+        net     *Network
+        typ     AddrType
+        version int
+        hash    string
+    }{
+        {"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", MainNet, AddrPubKeyHash, 0,
+            "62e907b15cbf27d5425399ebf6f0fb50ebb88f18"},
+        {"3P14159f73E4gFr7JterCCQh9QjiTjiZrG", MainNet, AddrScriptHash, 0,
+            "e9c3dd0c07aac76179ebc76a6c78d4d67c6c160a"},
+        {"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", MainNet, AddrWitness, 0,
+            "751e76e8199196d454941c45d1b3a323f1433bd6"},
+        {"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", TestNet, AddrWitness, 0,
+            "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+        {"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", MainNet, AddrWitness, 1,
+            "751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+    }
+    for _, c := range cases {
+        a, err := Decode(c.addr, c.net)
+        if err != nil {
+            t.Errorf("Decode(%s): %s", c.addr, err)
+            continue
+        }
+        if a.Type != c.typ || a.Version != c.version || hex.EncodeToString(a.Hash) != c.hash {
+            t.Errorf("Decode(%s) = %v", c.addr, a)
+        }
+        if s, err := a.Encode(c.net); err != nil || s != strings.ToLower(c.addr) && s != c.addr {
+            t.Errorf("Encode(%s) = %s, %v", c.addr, s, err)
+        }
+    }
+    invalid := []struct{
+        addr    string
+        net     *Network
+    }{
+        {"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", TestNet},    // Wrong network
+        {"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", MainNet},    // Bad checksum
+        {"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", MainNet},
+        {"bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du", MainNet}, // Version 2 with bech32 checksum
+        {"tb1pw508d6qejxtdg4y5r3zarqfsj6c3", TestNet},      // Version 1 with bech32 checksum
+        {"bc1gmk9yu", MainNet},                             // Empty program
+    }
+    for _, c := range invalid {
+        if _, err := Decode(c.addr, c.net); err == nil {
+            t.Errorf("Invalid address %s accepted", c.addr)
+        }
+    }
+}
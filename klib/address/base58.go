@@ -0,0 +1,83 @@
+// Bitcoin address encoding: Base58Check for legacy addresses, bech32 and
+// bech32m for segwit addresses (BIP173, BIP350)
+package address
+
+import (
+    "bytes"
+    "errors"
+    "math/big"
+    "github.com/oxfeeefeee/kaiju/klib"
+    )
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+    errBase58Char = errors.New("Base58: invalid character")
+
+    errBase58Checksum = errors.New("Base58Check: checksum mismatch")
+
+    errBase58TooShort = errors.New("Base58Check: data too short")
+)
+
+// Encodes p in base58, each leading zero byte becomes a '1'
+func Base58Encode(p []byte) string {
+    x := new(big.Int).SetBytes(p)
+    radix := big.NewInt(58)
+    mod := new(big.Int)
+    out := make([]byte, 0, len(p) * 138 / 100 + 1)
+    for x.Sign() > 0 {
+        x.DivMod(x, radix, mod)
+        out = append(out, base58Alphabet[mod.Int64()])
+    }
+    for _, b := range p {
+        if b != 0 {
+            break
+        }
+        out = append(out, base58Alphabet[0])
+    }
+    for i, j := 0, len(out) - 1; i < j; i, j = i + 1, j - 1 {
+        out[i], out[j] = out[j], out[i]
+    }
+    return string(out)
+}
+
+func Base58Decode(s string) ([]byte, error) {
+    x := new(big.Int)
+    radix := big.NewInt(58)
+    for _, c := range []byte(s) {
+        i := bytes.IndexByte([]byte(base58Alphabet), c)
+        if i < 0 {
+            return nil, errBase58Char
+        }
+        x.Mul(x, radix)
+        x.Add(x, big.NewInt(int64(i)))
+    }
+    zeros := 0
+    for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+        zeros++
+    }
+    return append(make([]byte, zeros), x.Bytes()...), nil
+}
+
+// Base58 of version, payload and the first 4 bytes of their sha256^2
+func Base58CheckEncode(version byte, payload []byte) string {
+    p := append([]byte{version}, payload...)
+    sum := klib.Sha256Sha256(p)
+    return Base58Encode(append(p, sum[:4]...))
+}
+
+// Returns the version and payload of a Base58Check string
+func Base58CheckDecode(s string) (byte, []byte, error) {
+    p, err := Base58Decode(s)
+    if err != nil {
+        return 0, nil, err
+    }
+    if len(p) < 5 {
+        return 0, nil, errBase58TooShort
+    }
+    sum := klib.Sha256Sha256(p[:len(p)-4])
+    if !bytes.Equal(sum[:4], p[len(p)-4:]) {
+        return 0, nil, errBase58Checksum
+    }
+    return p[0], p[1:len(p)-4], nil
+}
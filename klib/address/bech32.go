@@ -0,0 +1,190 @@
+package address
+
+import (
+    "errors"
+    "strings"
+    )
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Checksum variants, bech32 for witness version 0, bech32m for the others
+type Bech32Variant int
+
+const (
+    Bech32 Bech32Variant = iota
+    Bech32m
+)
+
+// The checksum of each variant is xor'ed with its constant
+var bech32Consts = [...]uint32{1, 0x2bc830a3}
+
+var (
+    errBech32Length = errors.New("Bech32: invalid length")
+
+    errBech32Case = errors.New("Bech32: mixed case")
+
+    errBech32Char = errors.New("Bech32: invalid character")
+
+    errBech32Checksum = errors.New("Bech32: checksum mismatch")
+
+    errBech32Padding = errors.New("Bech32: invalid padding")
+)
+
+func bech32Polymod(values []byte) uint32 {
+    gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+    chk := uint32(1)
+    for _, v := range values {
+        b := chk >> 25
+        chk = (chk & 0x1ffffff) << 5 ^ uint32(v)
+        for i := uint(0); i < 5; i++ {
+            if (b >> i) & 1 == 1 {
+                chk ^= gen[i]
+            }
+        }
+    }
+    return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+    p := make([]byte, 0, len(hrp) * 2 + 1)
+    for _, c := range []byte(hrp) {
+        p = append(p, c >> 5)
+    }
+    p = append(p, 0)
+    for _, c := range []byte(hrp) {
+        p = append(p, c & 31)
+    }
+    return p
+}
+
+// Encodes 5-bit values "data" with human readable part "hrp"
+func Bech32Encode(hrp string, data []byte, variant Bech32Variant) string {
+    values := append(bech32HrpExpand(hrp), data...)
+    values = append(values, 0, 0, 0, 0, 0, 0)
+    mod := bech32Polymod(values) ^ bech32Consts[variant]
+    var b strings.Builder
+    b.WriteString(hrp)
+    b.WriteByte('1')
+    for _, d := range data {
+        b.WriteByte(bech32Charset[d])
+    }
+    for i := 0; i < 6; i++ {
+        b.WriteByte(bech32Charset[(mod >> uint(5 * (5 - i))) & 31])
+    }
+    return b.String()
+}
+
+// Returns the human readable part and 5-bit values of a bech32 or bech32m string
+func Bech32Decode(s string) (string, []byte, Bech32Variant, error) {
+    if len(s) > 90 {
+        return "", nil, 0, errBech32Length
+    }
+    lower, upper := strings.ToLower(s), strings.ToUpper(s)
+    if s != lower && s != upper {
+        return "", nil, 0, errBech32Case
+    }
+    s = lower
+    pos := strings.LastIndexByte(s, '1')
+    if pos < 1 || pos + 7 > len(s) {
+        return "", nil, 0, errBech32Length
+    }
+    hrp := s[:pos]
+    for _, c := range []byte(hrp) {
+        if c < 33 || c > 126 {
+            return "", nil, 0, errBech32Char
+        }
+    }
+    data := make([]byte, 0, len(s) - pos - 1)
+    for _, c := range []byte(s[pos+1:]) {
+        i := strings.IndexByte(bech32Charset, c)
+        if i < 0 {
+            return "", nil, 0, errBech32Char
+        }
+        data = append(data, byte(i))
+    }
+    mod := bech32Polymod(append(bech32HrpExpand(hrp), data...))
+    for v, c := range bech32Consts {
+        if mod == c {
+            return hrp, data[:len(data)-6], Bech32Variant(v), nil
+        }
+    }
+    return "", nil, 0, errBech32Checksum
+}
+
+// Regroups bits, e.g. from 8-bit bytes to 5-bit values of bech32
+func convertBits(data []byte, from uint, to uint, pad bool) ([]byte, error) {
+    acc, bits := uint32(0), uint(0)
+    maxv := uint32(1) << to - 1
+    out := make([]byte, 0, len(data) * int(from) / int(to) + 1)
+    for _, v := range data {
+        if uint32(v) >> from != 0 {
+            return nil, errBech32Char
+        }
+        acc = acc << from | uint32(v)
+        bits += from
+        for bits >= to {
+            bits -= to
+            out = append(out, byte(acc >> bits & maxv))
+        }
+    }
+    if pad {
+        if bits > 0 {
+            out = append(out, byte(acc << (to - bits) & maxv))
+        }
+    } else if bits >= from || acc << (to - bits) & maxv != 0 {
+        return nil, errBech32Padding
+    }
+    return out, nil
+}
+
+// Encodes a witness program as segwit address (BIP173, BIP350)
+func SegwitEncode(hrp string, version int, program []byte) (string, error) {
+    if err := checkWitnessProgram(version, program); err != nil {
+        return "", err
+    }
+    data, _ := convertBits(program, 8, 5, true)
+    variant := Bech32m
+    if version == 0 {
+        variant = Bech32
+    }
+    return Bech32Encode(hrp, append([]byte{byte(version)}, data...), variant), nil
+}
+
+// Returns the witness version and program of a segwit address with "hrp"
+func SegwitDecode(hrp string, addr string) (int, []byte, error) {
+    h, data, variant, err := Bech32Decode(addr)
+    if err != nil {
+        return 0, nil, err
+    }
+    if h != hrp {
+        return 0, nil, errors.New("SegwitDecode: wrong network")
+    }
+    if len(data) < 1 {
+        return 0, nil, errBech32Length
+    }
+    version := int(data[0])
+    if (version == 0 && variant != Bech32) || (version != 0 && variant != Bech32m) {
+        return 0, nil, errors.New("SegwitDecode: wrong checksum variant")
+    }
+    program, err := convertBits(data[1:], 5, 8, false)
+    if err != nil {
+        return 0, nil, err
+    }
+    if err := checkWitnessProgram(version, program); err != nil {
+        return 0, nil, err
+    }
+    return version, program, nil
+}
+
+func checkWitnessProgram(version int, program []byte) error {
+    if version < 0 || version > 16 {
+        return errors.New("Segwit: invalid witness version")
+    }
+    if len(program) < 2 || len(program) > 40 {
+        return errors.New("Segwit: invalid program length")
+    }
+    if version == 0 && len(program) != 20 && len(program) != 32 {
+        return errors.New("Segwit: invalid program length for version 0")
+    }
+    return nil
+}
@@ -20,5 +20,8 @@ type Sig []byte
 // Returns signature in golang format
 func (s Sig) GoSig() (*big.Int, *big.Int, error) {
     sig, err := btcec.ParseSignature(s, btcec.S256())
-    return sig.R, sig.S, err 
+    if err != nil {
+        return nil, nil, err
+    }
+    return sig.R, sig.S, nil
 }
\ No newline at end of file
@@ -279,9 +279,12 @@ func readHeader(f File) (*Stats, uint32, int64, error) {
     if _, err := f.Read(p); err != nil {
         return nil, 0, 0, err
     }
-    if p[0] != 'K' || p[1] != 'D' || p[2] != 'B' || Version != p[3] {
+    if p[0] != 'K' || p[1] != 'D' || p[2] != 'B' {
         return nil, 0, 0, errInvalid
     }
+    if Version != p[3] {
+        return nil, 0, 0, ErrVersion
+    }
     if SlotSize != p[4] || ValLenUnit != p[5] || HeaderSize != p[6] {
         return nil, 0, 0, errInvalid   
     }
@@ -8,8 +8,12 @@ import (
     "github.com/oxfeeefeee/kaiju/log"
 )
 
-// File format version number
-const Version = 1
+// File format version number, also bumped when what Kaiju stores in it changes
+// encoding. Version 2: outputs with height and coin base flag.
+const Version = 2
+
+// Files of other versions are not loaded, they have to be rebuilt
+var ErrVersion = errors.New("KDB file of another version")
 
 // The slot size is 10, in which 6 bytes is KeySize and 4 bytes is the data pointer.
 const SlotSize = 10
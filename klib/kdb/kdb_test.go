@@ -136,6 +136,22 @@ func TestMemoryKDB(t *testing.T) {
     t.Log("KDB:",db2)
 }
 
+// Files written by other versions are refused
+func TestVersion(t *testing.T) {
+    buf := klib.NewMemFile(1024 * 1024)
+    wa := klib.NewMemFile(1024 * 1024)
+    if _, err := New(100, buf, wa); err != nil {
+        t.Fatalf("Failed to create KDB: %s", err)
+    }
+    buf.Seek(3, 0)
+    buf.Write([]byte{Version - 1})
+    buf.Seek(0, 0)
+    wa.Seek(0, 0)
+    if _, err := Load(buf, wa); err != ErrVersion {
+        t.Errorf("KDB of version %d loaded: %v", Version - 1, err)
+    }
+}
+
 func TestKDB(t *testing.T) {
 
     cfg := kaiju.GetConfig()
@@ -15,14 +15,17 @@ import (
 // And all node record the index of its parent.
 
 type Node struct {
-    // Parent index of the node
-    parentIndex int16
-    // Record how far to move when do the two passes deleting
-    moveDist int16 
+    // Parent index of the node, a block can have lots of siblings
+    parentIndex int32
     // The value stored in the node
     Value interface{}
 }
 
+// Returns the index of the parent node, which is at one level less deep
+func (n *Node) ParentIndex() int {
+    return int(n.parentIndex)
+}
+
 func (n *Node) String() string {
     return fmt.Sprintf("[%d->%v]", n.parentIndex, n.Value)
 }
@@ -32,7 +35,7 @@ type nodeArray []*Node
 type KTree []nodeArray
 
 func NewKTree(rootVal interface{}) *KTree {
-    return &KTree{nodeArray{&Node{0, 0, rootVal,},},}
+    return &KTree{nodeArray{&Node{0, rootVal,},},}
 }
 
 func (t *KTree) String() string {
@@ -78,7 +81,7 @@ func (t *KTree) AddChild(depth int, index int, value interface{}) error {
         *t = append(*t, nodeArray{})
     }
     nodes := (*t)[depth+1]
-    (*t)[depth+1] = append(nodes, &Node{int16(index), 0, value,})
+    (*t)[depth+1] = append(nodes, &Node{int32(index), value,})
     return nil
 }
 
@@ -86,55 +89,41 @@ func (t *KTree) AddChild(depth int, index int, value interface{}) error {
 // and the sub-tree of the node
 func (t *KTree) Remove(depth int, index int) error {
     if depth <= 0 || depth >= len(*t) || index >= len((*t)[depth]) {
-        return errors.New("KTree.AddChild depth out of range.")
+        return errors.New("KTree.Remove depth out of range.")
     }
-    // First pass, mark all nodes that's to be deleted
-    // and calculate move distance
-    // 1.1 process the first depth level
-    firstLevel := (*t)[depth]
-    firstLevel[index].moveDist = -1
-    for i := index + 1; i < len(firstLevel); i++ {
-        firstLevel[i].moveDist = 1
-    }
-    // 1.2 the rest of the sub-tree
-    deleted := map[int]bool{index:true,}
-    for i := depth + 1; i < len(*t); i++ {
+    // Nodes removed from the level above, and where the kept ones moved to
+    var deleted map[int]bool
+    var moved []int
+    for i := depth; i < len(*t); i++ {
+        nodes := (*t)[i]
+        kept := make(nodeArray, 0, len(nodes))
         newDeleted := make(map[int]bool)
-        dist := 0
-        for j, node := range (*t)[i] {
-            if deleted[int(node.parentIndex)] {
-                dist++
+        newMoved := make([]int, len(nodes))
+        for j, node := range nodes {
+            if i == depth {
+                if j == index {
+                    newDeleted[j] = true
+                    continue
+                }
+            } else if deleted[int(node.parentIndex)] {
                 newDeleted[j] = true
-                node.moveDist = -1
+                continue
             } else {
-                node.moveDist = int16(dist)
-                parentMove := (*t)[i-1][node.parentIndex].moveDist
-                // update parentIndex to what-would-be after deletion
-                node.parentIndex -= parentMove
+                node.parentIndex = int32(moved[node.parentIndex])
             }
+            newMoved[j] = len(kept)
+            kept = append(kept, node)
         }
-        deleted = newDeleted
-        if len(deleted) == 0 {
+        (*t)[i] = kept
+        if len(newDeleted) == 0 {
+            // Nothing moved on this level, deeper levels stay the same
             break
         }
+        deleted, moved = newDeleted, newMoved
     }
-    // Second pass, delete them
-    for i := depth; i < len(*t); i++ {
-        finalDist := 0
-        nodes := (*t)[i]
-        for j, node := range (*t)[i] {
-            if node.moveDist > 0 {
-                nodes[j-int(node.moveDist)] = node
-                finalDist = int(node.moveDist)
-            }
-        }
-        if finalDist == 0 {
-            // Didn't move any node, we can stop now
-            break
-        } else {
-            // Remove the space left by moved nodes
-            (*t)[i] = nodes[:len(nodes)-finalDist]
-        }
+    // Levels left empty at the bottom
+    for len(*t) > 1 && len((*t)[len(*t)-1]) == 0 {
+        *t = (*t)[:len(*t)-1]
     }
     return nil
 }
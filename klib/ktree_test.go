@@ -33,4 +33,36 @@ func TestKTree(t *testing.T) {
     
     tree.Remove(1, 1)
     t.Logf("tree:\n%s", tree)
+    expected := "0\t0-[0->1]\t\n" +
+        "1\t0-[0->10]\t1-[0->12]\t2-[0->13]\t\n" +
+        "2\t0-[1->200]\t1-[1->201]\t\n" +
+        "3\t0-[0->31]\t1-[1->34]\t\n"
+    if tree.String() != expected {
+        t.Errorf("Bad tree after removing:\n%s", tree)
+    }
+    // The last node of a level, then the rest of a level
+    tree.Remove(3, 0)
+    tree.Remove(1, 2)
+    tree.Remove(1, 1)
+    expected = "0\t0-[0->1]\t\n1\t0-[0->10]\t\n"
+    if tree.String() != expected {
+        t.Errorf("Bad tree after removing:\n%s", tree)
+    }
+}
+
+// Parent indices take more than 16 bits
+func TestKTreeWide(t *testing.T) {
+    tree := NewKTree(0)
+    for i := 0; i < 40000; i++ {
+        tree.AddChild(0, 0, i)
+    }
+    tree.AddChild(1, 39999, "last")
+    n, _ := tree.Node(2, 0)
+    if n.ParentIndex() != 39999 {
+        t.Errorf("Bad parent index %d", n.ParentIndex())
+    }
+    tree.Remove(1, 0)
+    if n.ParentIndex() != 39998 {
+        t.Errorf("Bad parent index %d after removing", n.ParentIndex())
+    }
 }
\ No newline at end of file
@@ -0,0 +1,145 @@
+package klib
+
+import (
+    "errors"
+    "math/big"
+    "crypto/sha256"
+    "github.com/conformal/btcec"
+    )
+
+// Public key of BIP340, only the X coordinate is kept, Y is always even
+type XOnlyPubKey []byte
+
+// Schnorr signature of BIP340, R.x followed by s
+type SchnorrSig []byte
+
+var errXOnlyPubKey = errors.New("XOnlyPubKey: invalid public key")
+
+// Returns sha256(sha256(tag) || sha256(tag) || msgs...), as defined in BIP340
+func TaggedHash(tag string, msgs ...[]byte) *Hash256 {
+    th := sha256.Sum256([]byte(tag))
+    h := sha256.New()
+    h.Write(th[:])
+    h.Write(th[:])
+    for _, m := range msgs {
+        h.Write(m)
+    }
+    var hash Hash256
+    copy(hash[:], h.Sum(nil))
+    return &hash
+}
+
+// Returns the point with X coordinate k and even Y, i.e. lift_x in BIP340
+func (k XOnlyPubKey) point() (*big.Int, *big.Int, error) {
+    if len(k) != 32 {
+        return nil, nil, errXOnlyPubKey
+    }
+    curve := btcec.S256()
+    if new(big.Int).SetBytes(k).Cmp(curve.P) >= 0 {
+        return nil, nil, errXOnlyPubKey
+    }
+    pk, err := btcec.ParsePubKey(append([]byte{0x02}, k...), curve)
+    if err != nil {
+        return nil, nil, errXOnlyPubKey
+    }
+    return pk.X, pk.Y, nil
+}
+
+// Verifies a BIP340 signature of a 32 bytes message
+func (k XOnlyPubKey) VerifySchnorr(msg []byte, sig SchnorrSig) bool {
+    if len(sig) != 64 || len(msg) != 32 {
+        return false
+    }
+    px, py, err := k.point()
+    if err != nil {
+        return false
+    }
+    curve := btcec.S256()
+    r := new(big.Int).SetBytes(sig[:32])
+    s := new(big.Int).SetBytes(sig[32:])
+    if r.Cmp(curve.P) >= 0 || s.Cmp(curve.N) >= 0 {
+        return false
+    }
+    e := new(big.Int).SetBytes(TaggedHash("BIP0340/challenge", sig[:32], k, msg)[:])
+    e.Mod(e, curve.N)
+    // R = s*G - e*P
+    e.Sub(curve.N, e)
+    sx, sy := curve.ScalarBaseMult(s.Bytes())
+    ex, ey := curve.ScalarMult(px, py, e.Bytes())
+    rx, ry := curve.Add(sx, sy, ex, ey)
+    if rx.Sign() == 0 && ry.Sign() == 0 {
+        return false
+    }
+    return ry.Bit(0) == 0 && rx.Cmp(r) == 0
+}
+
+// Returns k + tweak*G as an x-only key, and whether its Y is odd.
+// This is how taproot output keys are derived from internal keys (BIP341).
+func (k XOnlyPubKey) Tweak(tweak []byte) (XOnlyPubKey, bool, error) {
+    px, py, err := k.point()
+    if err != nil {
+        return nil, false, err
+    }
+    curve := btcec.S256()
+    if new(big.Int).SetBytes(tweak).Cmp(curve.N) >= 0 {
+        return nil, false, errors.New("XOnlyPubKey.Tweak: tweak out of range")
+    }
+    tx, ty := curve.ScalarBaseMult(tweak)
+    qx, qy := curve.Add(px, py, tx, ty)
+    if qx.Sign() == 0 && qy.Sign() == 0 {
+        return nil, false, errors.New("XOnlyPubKey.Tweak: point at infinity")
+    }
+    return XOnlyPubKey(bytes32(qx)), qy.Bit(0) == 1, nil
+}
+
+// Signs a 32 bytes message with private key "priv" as defined in BIP340,
+// "aux" is the 32 bytes auxiliary random data.
+func SignSchnorr(priv []byte, msg []byte, aux []byte) (SchnorrSig, error) {
+    curve := btcec.S256()
+    d := new(big.Int).SetBytes(priv)
+    if d.Sign() == 0 || d.Cmp(curve.N) >= 0 {
+        return nil, errors.New("SignSchnorr: private key out of range")
+    }
+    if len(msg) != 32 || len(aux) != 32 {
+        return nil, errors.New("SignSchnorr: bad message or aux size")
+    }
+    px, py := curve.ScalarBaseMult(d.Bytes())
+    if py.Bit(0) == 1 {
+        d.Sub(curve.N, d)
+    }
+    pk := bytes32(px)
+    t := bytes32(d)
+    auxHash := TaggedHash("BIP0340/aux", aux)
+    for i := range t {
+        t[i] ^= auxHash[i]
+    }
+    k := new(big.Int).SetBytes(TaggedHash("BIP0340/nonce", t, pk, msg)[:])
+    k.Mod(k, curve.N)
+    if k.Sign() == 0 {
+        return nil, errors.New("SignSchnorr: bad nonce")
+    }
+    rx, ry := curve.ScalarBaseMult(k.Bytes())
+    if ry.Bit(0) == 1 {
+        k.Sub(curve.N, k)
+    }
+    r := bytes32(rx)
+    e := new(big.Int).SetBytes(TaggedHash("BIP0340/challenge", r, pk, msg)[:])
+    e.Mul(e, d)
+    e.Add(e, k)
+    e.Mod(e, curve.N)
+    return SchnorrSig(append(r, bytes32(e)...)), nil
+}
+
+// Returns the x-only public key of private key "priv"
+func SchnorrPubKey(priv []byte) XOnlyPubKey {
+    x, _ := btcec.S256().ScalarBaseMult(priv)
+    return XOnlyPubKey(bytes32(x))
+}
+
+// Returns v as 32 bytes big endian
+func bytes32(v *big.Int) []byte {
+    p := make([]byte, 32)
+    b := v.Bytes()
+    copy(p[32-len(b):], b)
+    return p
+}
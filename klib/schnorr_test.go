@@ -0,0 +1,62 @@
+package klib
+
+import (
+    "bytes"
+    "testing"
+    "encoding/hex"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+    p, err := hex.DecodeString(s)
+    if err != nil {
+        t.Fatalf("hex.DecodeString error %s", err)
+    }
+    return p
+}
+
+// Test vector 0 of BIP340
+func TestSchnorrVector(t *testing.T) {
+    priv := decodeHex(t, "0000000000000000000000000000000000000000000000000000000000000003")
+    pk := decodeHex(t, "F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9")
+    sig := decodeHex(t, "E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA8215" +
+        "25F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0")
+    msg := make([]byte, 32)
+    if !bytes.Equal(SchnorrPubKey(priv), pk) {
+        t.Errorf("Bad public key %x", SchnorrPubKey(priv))
+    }
+    s, err := SignSchnorr(priv, msg, make([]byte, 32))
+    if err != nil || !bytes.Equal(s, sig) {
+        t.Errorf("Bad signature %x %v", s, err)
+    }
+    if !XOnlyPubKey(pk).VerifySchnorr(msg, sig) {
+        t.Errorf("Valid signature failed")
+    }
+    // Public key not on the curve
+    bad := decodeHex(t, "EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34")
+    if XOnlyPubKey(bad).VerifySchnorr(msg, sig) {
+        t.Errorf("Invalid public key deemed to be valid")
+    }
+}
+
+func TestSchnorrSignVerify(t *testing.T) {
+    priv := Sha256Sha256([]byte("kaiju"))[:]
+    pk := SchnorrPubKey(priv)
+    msg := Sha256Sha256([]byte("message"))[:]
+    sig, err := SignSchnorr(priv, msg, msg)
+    if err != nil {
+        t.Fatalf("SignSchnorr error %s", err)
+    }
+    if !pk.VerifySchnorr(msg, sig) {
+        t.Errorf("Valid signature failed")
+    }
+    for _, i := range []int{0, 31, 32, 63} {
+        sig[i] ^= 1
+        if pk.VerifySchnorr(msg, sig) {
+            t.Errorf("Modified signature deemed to be valid")
+        }
+        sig[i] ^= 1
+    }
+    if pk.VerifySchnorr(Sha256Sha256(msg)[:], sig) {
+        t.Errorf("Signature of another message deemed to be valid")
+    }
+}
@@ -45,13 +45,25 @@ func (i ScriptInt) Bytes() []byte {
     return p
 }
 
+// Like ToScriptInt, but allows up to "size" bytes, e.g. 5 bytes for lock times.
+// "size" is at most 8, check overflow before call this.
+func ToLongScriptInt(p []byte, size int) ScriptInt {
+    var i ScriptInt
+    i.setBytes(p, size)
+    return i
+}
+
 // Check overflow before call this, otherwise it could panic
 func (i *ScriptInt) SetBytes(p []byte) {
+    i.setBytes(p, scriptIntMaxSize)
+}
+
+func (i *ScriptInt) setBytes(p []byte, size int) {
     if len(p) == 0 {
         *i = 0
         return
     } 
-    if len(p) > scriptIntMaxSize {
+    if len(p) > size {
         panic("ScriptInt.SetBytes overflow")
     }
     var val int64
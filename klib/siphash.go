@@ -0,0 +1,54 @@
+package klib
+
+import (
+    "encoding/binary"
+)
+
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+    v0 += v1
+    v1 = v1 << 13 | v1 >> 51
+    v1 ^= v0
+    v0 = v0 << 32 | v0 >> 32
+    v2 += v3
+    v3 = v3 << 16 | v3 >> 48
+    v3 ^= v2
+    v0 += v3
+    v3 = v3 << 21 | v3 >> 43
+    v3 ^= v0
+    v2 += v1
+    v1 = v1 << 17 | v1 >> 47
+    v1 ^= v2
+    v2 = v2 << 32 | v2 >> 32
+    return v0, v1, v2, v3
+}
+
+// SipHash-2-4 of "data" with the 128 bit key (k0, k1), used by the short tx
+// ids of compact blocks (BIP152)
+func SipHash(k0, k1 uint64, data []byte) uint64 {
+    v0 := k0 ^ 0x736f6d6570736575
+    v1 := k1 ^ 0x646f72616e646f6d
+    v2 := k0 ^ 0x6c7967656e657261
+    v3 := k1 ^ 0x7465646279746573
+    n := len(data)
+    for ; len(data) >= 8; data = data[8:] {
+        m := binary.LittleEndian.Uint64(data)
+        v3 ^= m
+        v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+        v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+        v0 ^= m
+    }
+    // The last block holds the remaining bytes, and the length in the top byte
+    last := uint64(n) << 56
+    for i, b := range data {
+        last |= uint64(b) << (8 * uint(i))
+    }
+    v3 ^= last
+    v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+    v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+    v0 ^= last
+    v2 ^= 0xff
+    for i := 0; i < 4; i++ {
+        v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+    }
+    return v0 ^ v1 ^ v2 ^ v3
+}
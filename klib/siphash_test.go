@@ -0,0 +1,26 @@
+package klib
+
+import (
+    "testing"
+)
+
+func TestSipHash(t *testing.T) {
+    // Test vectors from the SipHash paper, key is 00 01 02 ... 0f and
+    // messages are 00 01 02 ... of increasing length
+    k0, k1 := uint64(0x0706050403020100), uint64(0x0f0e0d0c0b0a0908)
+    expects := map[int]uint64{
+        0: 0x726fdb47dd0e0e31,
+        1: 0x74f839c593dc67fd,
+        8: 0x93f5f5799a932462,
+        15: 0xa129ca6149be45e5,
+    }
+    for n, expect := range expects {
+        data := make([]byte, n)
+        for i := range data {
+            data[i] = byte(i)
+        }
+        if h := SipHash(k0, k1, data); h != expect {
+            t.Errorf("SipHash of %d bytes: %x, expect %x", n, h, expect)
+        }
+    }
+}
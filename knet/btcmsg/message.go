@@ -45,7 +45,7 @@ type Tx catma.Tx
 
 func (tx *Tx) Serialize(w io.Writer) error {
     t := (*catma.Tx)(tx)
-    _, err := w.Write(t.Bytes())
+    _, err := w.Write(t.WitnessBytes())
     return err
 }
 
@@ -53,6 +53,17 @@ func (tx *Tx) Deserialize(r io.Reader) error {
     lastError := readData(r, &tx.Version, nil)
     var listSize klib.VarUint
     lastError = readData(r, &listSize, lastError)
+    // An empty input list is the marker of witness serialization (BIP144)
+    witness := false
+    if lastError == nil && listSize == 0 {
+        var flag byte
+        lastError = readData(r, &flag, lastError)
+        if lastError == nil && flag != 1 {
+            return errors.New("Unknown tx serialization flag")
+        }
+        witness = true
+        lastError = readData(r, &listSize, lastError)
+    }
     if lastError != nil {
         return lastError
     } else if listSize > klib.VarUint(kaiju.MaxInvListSize) {
@@ -79,10 +90,38 @@ func (tx *Tx) Deserialize(r io.Reader) error {
         lastError = readData(r, &txouts[i].Value, lastError)
         lastError = readData(r, (*klib.VarString)(&txouts[i].PKScript), lastError)
     }
+    if witness {
+        for _, txin := range txins {
+            lastError = readWitness(r, txin, lastError)
+        }
+        // A tx with no inputs is rejected by FormatCheck anyway, and it's
+        // ambiguous with the legacy serialization
+        if lastError == nil && len(txins) > 0 && !(*catma.Tx)(tx).HasWitness() {
+            return errors.New("Superfluous witness record")
+        }
+    }
     lastError = readData(r, &tx.LockTime, lastError)
     return lastError
 } 
 
+func readWitness(r io.Reader, txin *catma.TxIn, lastError error) error {
+    var count klib.VarUint
+    lastError = readData(r, &count, lastError)
+    if lastError != nil {
+        return lastError
+    } else if count > klib.VarUint(kaiju.MaxInvListSize) {
+        return errors.New("Witness stack too large")
+    }
+    if count == 0 {
+        return nil
+    }
+    txin.Witness = make([][]byte, count)
+    for i := range txin.Witness {
+        lastError = readData(r, (*klib.VarString)(&txin.Witness[i]), lastError)
+    }
+    return lastError
+}
+
 func writeData(w io.Writer, data interface{}, lastError error) error {
     if lastError != nil {
         return lastError
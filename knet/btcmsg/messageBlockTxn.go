@@ -0,0 +1,59 @@
+package btcmsg
+
+import (
+    "bytes"
+    "errors"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+// Bitcoin protocol message: "blocktxn" (BIP152), the response of "getblocktxn"
+type Message_blocktxn struct {
+    BlockHash       klib.Hash256
+    // In the order they are requested
+    Txs             []*Tx
+}
+
+func NewBlockTxnMsg() Message {
+    return &Message_blocktxn{}
+}
+
+func (m *Message_blocktxn) Command() string {
+    return "blocktxn"
+}
+
+func (m *Message_blocktxn) Encode() ([]byte, error) {
+    buf := new(bytes.Buffer)
+    var err error;
+
+    err = writeData(buf, &m.BlockHash, err)
+    listSize := klib.VarUint(len(m.Txs))
+    err = writeData(buf, &listSize, err)
+    for _, t := range m.Txs {
+        err = writeData(buf, t, err)
+    }
+    if err != nil {
+        return nil, err;
+    }
+    return buf.Bytes(), nil
+}
+
+func (m *Message_blocktxn) Decode(payload []byte) error {
+    buf := bytes.NewBuffer(payload)
+    var err error;
+    var listSize klib.VarUint;
+
+    err = readData(buf, &m.BlockHash, err)
+    err = readData(buf, &listSize, err)
+    if err != nil {
+        return err
+    } else if listSize > klib.VarUint(kaiju.MaxInvListSize) {
+        return errors.New("Message_blocktxn list too long")
+    }
+    m.Txs = make([]*Tx, listSize)
+    for i := range m.Txs {
+        m.Txs[i] = new(Tx)
+        err = readData(buf, m.Txs[i], err)
+    }
+    return err
+}
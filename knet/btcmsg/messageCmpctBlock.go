@@ -0,0 +1,113 @@
+package btcmsg
+
+import (
+    "bytes"
+    "errors"
+    "encoding/binary"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+)
+
+// Size in bytes of the short tx ids of compact blocks
+const ShortIDSize = 6
+
+// A tx sent along with a compact block, usually the coin base
+type PrefilledTx struct {
+    // Position in the block
+    Index       int
+    Tx          *Tx
+}
+
+// Bitcoin protocol message: "cmpctblock" (BIP152)
+type Message_cmpctblock struct {
+    Header          *catma.Header
+    // Salt of the short ids
+    Nonce           uint64
+    // Short ids of the txs not prefilled, in the order of the block
+    ShortIDs        []uint64
+    PrefilledTxs    []*PrefilledTx
+}
+
+func NewCmpctBlockMsg() Message {
+    return &Message_cmpctblock{
+        Header: new(catma.Header),
+    }
+}
+
+func (m *Message_cmpctblock) Command() string {
+    return "cmpctblock"
+}
+
+func (m *Message_cmpctblock) Encode() ([]byte, error) {
+    buf := new(bytes.Buffer)
+    var err error;
+
+    err = writeData(buf, m.Header, err)
+    err = writeData(buf, m.Nonce, err)
+    listSize := klib.VarUint(len(m.ShortIDs))
+    err = writeData(buf, &listSize, err)
+    id := make([]byte, 8)
+    for _, s := range m.ShortIDs {
+        binary.LittleEndian.PutUint64(id, s)
+        err = writeData(buf, id[:ShortIDSize], err)
+    }
+    listSize = klib.VarUint(len(m.PrefilledTxs))
+    err = writeData(buf, &listSize, err)
+    // Indices are encoded as the difference from the last one, minus 1
+    last := -1
+    for _, p := range m.PrefilledTxs {
+        if p.Index <= last {
+            return nil, errors.New("Message_cmpctblock prefilled txs out of order")
+        }
+        diff := klib.VarUint(p.Index - last - 1)
+        err = writeData(buf, &diff, err)
+        err = writeData(buf, p.Tx, err)
+        last = p.Index
+    }
+    if err != nil {
+        return nil, err;
+    }
+    return buf.Bytes(), nil
+}
+
+func (m *Message_cmpctblock) Decode(payload []byte) error {
+    buf := bytes.NewBuffer(payload)
+    var err error;
+    var listSize klib.VarUint;
+
+    err = readData(buf, m.Header, err)
+    err = readData(buf, &m.Nonce, err)
+    err = readData(buf, &listSize, err)
+    if err != nil {
+        return err
+    } else if listSize > klib.VarUint(kaiju.MaxInvListSize) {
+        return errors.New("Message_cmpctblock short id list too long")
+    }
+    m.ShortIDs = make([]uint64, listSize)
+    id := make([]byte, 8)
+    for i := range m.ShortIDs {
+        err = readData(buf, id[:ShortIDSize], err)
+        m.ShortIDs[i] = binary.LittleEndian.Uint64(id)
+    }
+    err = readData(buf, &listSize, err)
+    if err != nil {
+        return err
+    } else if listSize > klib.VarUint(kaiju.MaxInvListSize) {
+        return errors.New("Message_cmpctblock prefilled tx list too long")
+    }
+    m.PrefilledTxs = make([]*PrefilledTx, listSize)
+    last := -1
+    for i := range m.PrefilledTxs {
+        var diff klib.VarUint
+        err = readData(buf, &diff, err)
+        if err == nil && diff > klib.VarUint(kaiju.MaxInvListSize) {
+            return errors.New("Message_cmpctblock prefilled tx index too large")
+        }
+        p := &PrefilledTx{Index: last + 1 + int(diff), Tx: new(Tx)}
+        err = readData(buf, p.Tx, err)
+        m.PrefilledTxs[i] = p
+        last = p.Index
+    }
+    return err
+}
@@ -0,0 +1,72 @@
+package btcmsg
+
+import (
+    "bytes"
+    "errors"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+// Bitcoin protocol message: "getblocktxn" (BIP152)
+type Message_getblocktxn struct {
+    BlockHash       klib.Hash256
+    // Positions in the block of the txs requested, in increasing order
+    Indexes         []int
+}
+
+func NewGetBlockTxnMsg() Message {
+    return &Message_getblocktxn{}
+}
+
+func (m *Message_getblocktxn) Command() string {
+    return "getblocktxn"
+}
+
+func (m *Message_getblocktxn) Encode() ([]byte, error) {
+    buf := new(bytes.Buffer)
+    var err error;
+
+    err = writeData(buf, &m.BlockHash, err)
+    listSize := klib.VarUint(len(m.Indexes))
+    err = writeData(buf, &listSize, err)
+    // Encoded as the difference from the last one, minus 1
+    last := -1
+    for _, i := range m.Indexes {
+        if i <= last {
+            return nil, errors.New("Message_getblocktxn indexes out of order")
+        }
+        diff := klib.VarUint(i - last - 1)
+        err = writeData(buf, &diff, err)
+        last = i
+    }
+    if err != nil {
+        return nil, err;
+    }
+    return buf.Bytes(), nil
+}
+
+func (m *Message_getblocktxn) Decode(payload []byte) error {
+    buf := bytes.NewBuffer(payload)
+    var err error;
+    var listSize klib.VarUint;
+
+    err = readData(buf, &m.BlockHash, err)
+    err = readData(buf, &listSize, err)
+    if err != nil {
+        return err
+    } else if listSize > klib.VarUint(kaiju.MaxInvListSize) {
+        return errors.New("Message_getblocktxn list too long")
+    }
+    m.Indexes = make([]int, listSize)
+    last := -1
+    for i := range m.Indexes {
+        var diff klib.VarUint
+        err = readData(buf, &diff, err)
+        if err == nil && diff > klib.VarUint(kaiju.MaxInvListSize) {
+            return errors.New("Message_getblocktxn index too large")
+        }
+        m.Indexes[i] = last + 1 + int(diff)
+        last = m.Indexes[i]
+    }
+    return err
+}
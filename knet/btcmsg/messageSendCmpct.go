@@ -0,0 +1,43 @@
+package btcmsg
+
+import (
+    "bytes"
+)
+
+// Bitcoin protocol message: "sendcmpct" (BIP152)
+type Message_sendcmpct struct {
+    // If new blocks should be announced with "cmpctblock" right away,
+    // i.e. high bandwidth mode
+    Announce        bool
+    // 2 for short ids of wtxids
+    Version         uint64
+}
+
+func NewSendCmpctMsg() Message {
+    return &Message_sendcmpct{}
+}
+
+func (m *Message_sendcmpct) Command() string {
+    return "sendcmpct"
+}
+
+func (m *Message_sendcmpct) Encode() ([]byte, error) {
+    buf := new(bytes.Buffer)
+    var err error;
+
+    err = writeData(buf, m.Announce, err)
+    err = writeData(buf, m.Version, err)
+    if err != nil {
+        return nil, err;
+    }
+    return buf.Bytes(), nil
+}
+
+func (m *Message_sendcmpct) Decode(payload []byte) error {
+    buf := bytes.NewBuffer(payload)
+    var err error;
+
+    err = readData(buf, &m.Announce, err)
+    err = readData(buf, &m.Version, err)
+    return err
+}
@@ -0,0 +1,24 @@
+package btcmsg
+
+// Bitcoin protocol message: "sendheaders" (BIP130), asks the peer to announce
+// new blocks with "headers" instead of "inv"
+type Message_sendheaders struct {
+    //No content
+}
+
+func NewSendHeadersMsg() Message {
+    return new(Message_sendheaders)
+}
+
+func (m *Message_sendheaders) Command() string {
+    return "sendheaders"
+}
+
+func (m *Message_sendheaders) Encode() ([]byte, error) {
+    return []byte{}, nil
+}
+
+func (m *Message_sendheaders) Decode(payload []byte) error {
+    // Nothing needs to be done
+    return nil
+}
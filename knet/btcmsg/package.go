@@ -4,7 +4,6 @@ package btcmsg
 
 import (
     "io"
-    "fmt"
     "errors"
     "bytes"
     "encoding/binary"
@@ -29,6 +28,11 @@ var messageRegistry map[string]func() Message = map[string]func() Message {
     "alert":        NewAlertMsg,
     "ping":         NewPingMsg,
     "pong":         NewPongMsg,
+    "sendheaders":  NewSendHeadersMsg,
+    "sendcmpct":    NewSendCmpctMsg,
+    "cmpctblock":   NewCmpctBlockMsg,
+    "getblocktxn":  NewGetBlockTxnMsg,
+    "blocktxn":     NewBlockTxnMsg,
 }
 
 // Write a btc message to a io.Writer
@@ -111,7 +115,8 @@ func decodeMessageFromPayload(command string, payload []byte) (Message, error) {
         err := msg.Decode(payload)
         return msg, err
     }
-    return nil, errors.New(fmt.Sprintf("Invalid command type %s", command))
+    // Newer peers send messages we don't know, e.g. "feefilter", they are ignored
+    return nil, nil
 }
 
 // checksum is the first 4 bytes of sha256(payload)
@@ -3,6 +3,7 @@ package knet
 
 import (
     "net"
+    "sync"
     "time"
     "math"
     "github.com/oxfeeefeee/kaiju"
@@ -14,12 +15,15 @@ type CC struct {
     ap              *addrPool
     // To control how many dailing in progress
     dialControl     chan struct{}
+    // Monitors added to new peers
+    monitors        []peer.Monitor
+    mmutex          sync.Mutex
 }
 
 func newCC() *CC {
     return &CC{
-        newAddrPool(), 
-        make(chan struct{}, kaiju.MaxDialConcurrency), 
+        ap: newAddrPool(), 
+        dialControl: make(chan struct{}, kaiju.MaxDialConcurrency), 
     }
 }
 
@@ -32,16 +36,31 @@ func (cc *CC) addSeedAddr(ipstr string, port int) {
 }
 
 func (cc *CC) start(peerMonitors []peer.Monitor) {
+    cc.monitors = peerMonitors
     go func() {
         for {
             // Flow control for dial:
             // dialControl is a buffered channel of size MaxDialConcurrency
             cc.dialControl <- struct{}{}
-            go cc.doConnect(peerMonitors)      
+            go cc.doConnect(cc.peerMonitors())      
         }
     }()
 }
 
+func (cc *CC) peerMonitors() []peer.Monitor {
+    cc.mmutex.Lock()
+    defer cc.mmutex.Unlock()
+    return cc.monitors
+}
+
+func (cc *CC) addMonitor(m peer.Monitor) {
+    cc.mmutex.Lock()
+    defer cc.mmutex.Unlock()
+    ms := make([]peer.Monitor, len(cc.monitors), len(cc.monitors) + 1)
+    copy(ms, cc.monitors)
+    cc.monitors = append(ms, m)
+}
+
 // Member of peer.Monitor interface
 func (cc *CC) ListenTypes() []string {
     return []string{"addr",}
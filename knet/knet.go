@@ -48,6 +48,14 @@ func Peers() peer.Manager {
     return instance.pm
 }
 
+// Adds a monitor to all the peers, including the ones connected later
+func AddMonitor(m peer.Monitor) {
+    instance.cc.addMonitor(m)
+    for _, h := range Peers().Handles() {
+        h.AddMonitors([]peer.Monitor{m})
+    }
+}
+
 // Send a message and expect more than one messages in return
 // i.e. getting blocks or txs
 func MsgForMsgs(m btcmsg.Message, handler MsgHandler, count int) error {
@@ -51,6 +51,24 @@ func (h Handle) MsgForMsg(m btcmsg.Message, f MsgFilter) struct{btcmsg.Message;
     return msg
 }
 
+// Protocol version of the peer, 0 if the handle is invalid
+func (h Handle) Version() uint32 {
+    p := peerMgr.getPeer(h)
+    if p == nil {
+        return 0
+    }
+    return p.Version()
+}
+
+// Returns nil if the handle is invalid
+func (h Handle) Status() *Status {
+    p := peerMgr.getPeer(h)
+    if p == nil {
+        return nil
+    }
+    return p.Status()
+}
+
 func (h Handle) Start() error{
     p := peerMgr.getPeer(h)
     if p == nil {
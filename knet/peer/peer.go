@@ -23,6 +23,17 @@ const timeToKick = time.Second * 90
 // Returns (isTheMessageSwallowed, shouldWeStopExpectingMessage)
 type MsgFilter func(btcmsg.Message) (accept bool, stop bool)
 
+// A snapshot of a connected peer
+type Status struct {
+    Addr            string
+    Services        uint64
+    Version         uint32
+    UserAgent       string
+    StartHeight     int32
+    Outgoing        bool
+    Since           time.Time
+}
+
 // Descriptor of message being sent
 type msgSent struct {
     msg         btcmsg.Message
@@ -45,6 +56,14 @@ type Peer struct {
     handle          Handle
     // Standard bitcoin protocol peer info 
     info            *btcmsg.PeerInfo
+    // Protocol version of the remote node
+    version         uint32
+    // Services, user agent and best height the remote node announced
+    services        uint64
+    userAgent       string
+    startHeight     int32
+    // When the handshake is done
+    since           time.Time
     // Is this an outgoing or incoming connection? the handshaking differs
     outgoing        bool
     // Network connection to remote node
@@ -90,8 +109,12 @@ func Launch(info *btcmsg.PeerInfo, conn net.Conn, outgoing bool, moni []Monitor)
     if err != nil {
         return InvalidHandle, err
     }
-    go p.onPeerUp(p)
-    return peerMgr.addPeer(p)
+    // Monitors are notified after the peer gets its handle
+    h, err := peerMgr.addPeer(p)
+    if err == nil {
+        go p.onPeerUp(p)
+    }
+    return h, err
 }
 
 func (p *Peer) Handle() Handle {
@@ -102,6 +125,24 @@ func (p *Peer) BtcInfo() *btcmsg.PeerInfo {
     return p.info
 }
 
+// Protocol version the remote node announced in its "version" message
+func (p *Peer) Version() uint32 {
+    return p.version
+}
+
+// What's known about the remote node
+func (p *Peer) Status() *Status {
+    return &Status{
+        Addr: p.conn.RemoteAddr().String(),
+        Services: p.services,
+        Version: p.version,
+        UserAgent: p.userAgent,
+        StartHeight: p.startHeight,
+        Outgoing: p.outgoing,
+        Since: p.since,
+    }
+}
+
 // Send a bitcoin message to remote peer
 // SendMsg mustn't block for Pool to work properly
 func (p *Peer) sendMsg(m btcmsg.Message, timeout time.Duration, ch chan error) {
@@ -156,6 +197,7 @@ func (p *Peer) start() error{
         p.conn.Close()
         return err;
     }
+    p.since = time.Now()
     p.keepAliveTimer = time.NewTimer(timeToPing)
     p.kickTimer = time.NewTimer(timeToKick)
     go p.loopMain()
@@ -234,7 +276,7 @@ func (p *Peer) loopReceiveMsg() {
         if err != nil {
             //log.Infof("loopReceiveMsg error: %s", err.Error())
             break
-        } else {
+        } else if msg != nil {
             if !p.handleMessage(msg) {
                 p.onPeerMsg(p.handle, msg)
             }
@@ -305,6 +347,10 @@ func (p *Peer) versionHankshake() error {
         if ver, ok := msg.(*btcmsg.Message_version); ok {
             // TODO: more check
             p.info = ver.Addr_from
+            p.version = ver.Version
+            p.services = ver.Services
+            p.userAgent = string(ver.User_agent)
+            p.startHeight = ver.Start_height
         } else {
             return errors.New("Wrong message type when doing versionHankshake")
         }
@@ -19,6 +19,8 @@ type Manager interface {
     Borrow() Handle
     // Return a borrowed handle
     Return(h Handle)
+    // Returns handles of all the connected peers
+    Handles() []Handle
 }
 
 type peerManager struct {
@@ -104,6 +106,16 @@ func (m *peerManager) Return(h Handle) {
     delete(m.borrowed, h)
 }
 
+func (m *peerManager) Handles() []Handle {
+    m.mutex.RLock()
+    defer m.mutex.RUnlock()
+    hs := make([]Handle, 0, len(m.peers))
+    for h, _ := range m.peers {
+        hs = append(hs, h)
+    }
+    return hs
+}
+
 func (m *peerManager) getPeer(h Handle) *Peer {
     if h == InvalidHandle {
         return nil
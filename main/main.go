@@ -2,15 +2,31 @@
 package main
 
 import (
+    "os"
+    "fmt"
+    "syscall"
+    "os/signal"
     _ "github.com/oxfeeefeee/kaiju"
     _ "github.com/oxfeeefeee/kaiju/profiling"
     "github.com/oxfeeefeee/kaiju/log"
     "github.com/oxfeeefeee/kaiju/knet"
     "github.com/oxfeeefeee/kaiju/node"
+    "github.com/oxfeeefeee/kaiju/rpc"
+    "github.com/oxfeeefeee/kaiju/zmq"
 )
 
+var rpcServer *rpc.Server
+
+var notifier *zmq.Notifier
+
 func mainCleanUp(){
     log.Infof("Cleaning up...")
+    if rpcServer != nil {
+        rpcServer.Stop()
+    }
+    if notifier != nil {
+        notifier.Stop()
+    }
     err := node.Destroy()
     if err != nil {
         log.Infof("Error destroying node: %s", err.Error())
@@ -18,7 +34,8 @@ func mainCleanUp(){
 }
 
 func mainFunc() {
-    c := make(chan struct{})
+    c := make(chan os.Signal, 1)
+    signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
     log.Infof("Starting KNet...")
     ch, err := knet.Start(10)
@@ -34,14 +51,39 @@ func mainFunc() {
         log.Infof("Error initializing Node: %s", err.Error())
         return;
     }
+    // Before starting, so that blocks connected by catching up are published
+    notifier, err = zmq.Start()
+    if err != nil {
+        log.Infof("Error starting ZMQ notifications: %s", err)
+    }
     log.Infof("Starting Node...")
     node.Start()
     log.Infof("Node started.")
 
-    // Don't quit
-    _ = <- c
+    rpcServer, err = rpc.Start()
+    if err != nil {
+        log.Infof("Error starting RPC server: %s", err)
+    }
+
+    // Run until told to stop, or the node can't go on
+    select {
+    case s := <- c:
+        log.Infof("Got %s, shutting down", s)
+        mainCleanUp()
+    case err := <- node.Fatal():
+        log.Errorf("Node stopped: %s, delete the data directory and resync", err)
+        mainCleanUp()
+        os.Exit(1)
+    }
 }
 
 func main() {
+    if len(os.Args) > 1 && os.Args[1] == "trace" {
+        if err := traceCmd(os.Args[2:]); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
     mainFunc()
 }
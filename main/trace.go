@@ -0,0 +1,94 @@
+// "kaiju trace": replays a tx input against the output it spends, and prints
+// every step of script evaluation.
+package main
+
+import (
+    "os"
+    "fmt"
+    "flag"
+    "bytes"
+    "errors"
+    "strings"
+    "strconv"
+    "encoding/hex"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+)
+
+const defaultTraceFlags = "P2SH,STRICTENC,NULLDUMMY,DERSIG,CHECKLOCKTIMEVERIFY,CHECKSEQUENCEVERIFY,WITNESS,TAPROOT"
+
+func traceCmd(args []string) error {
+    fs := flag.NewFlagSet("trace", flag.ExitOnError)
+    txHex := fs.String("tx", "", "the tx in hex")
+    input := fs.Int("input", 0, "index of the input to replay")
+    pkHex := fs.String("pkscript", "", "PKScript of the output spent by the input, in hex")
+    amount := fs.Int64("amount", 0, "value of the output spent by the input, needed by segwit")
+    prevOuts := fs.String("prevouts", "",
+        "outputs spent by all the inputs as comma separated amount:pkscript, needed by taproot")
+    flagNames := fs.String("flags", defaultTraceFlags, "comma separated script flags")
+    fs.Parse(args)
+
+    data, err := hex.DecodeString(*txHex)
+    if err != nil {
+        return fmt.Errorf("Bad tx hex: %s", err)
+    }
+    var btx btcmsg.Tx
+    if err = btx.Deserialize(bytes.NewReader(data)); err != nil {
+        return fmt.Errorf("Bad tx: %s", err)
+    }
+    tx := (*catma.Tx)(&btx)
+    if *input < 0 || *input >= len(tx.TxIns) {
+        return errors.New("Input index out of range")
+    }
+    flags, err := script.ParseEvalFlags(*flagNames)
+    if err != nil {
+        return err
+    }
+    outs := make([]*catma.TxOut, len(tx.TxIns))
+    if *prevOuts != "" {
+        if outs, err = parsePrevOuts(*prevOuts, len(tx.TxIns)); err != nil {
+            return err
+        }
+    } else {
+        pks, err := hex.DecodeString(*pkHex)
+        if err != nil {
+            return fmt.Errorf("Bad pkscript hex: %s", err)
+        }
+        outs[*input] = &catma.TxOut{Value: *amount, PKScript: pks}
+    }
+
+    tr := new(script.TraceRecorder)
+    err = catma.TraceInput(outs, tx, *input, flags, tr)
+    fmt.Print(tr)
+    if err != nil {
+        fmt.Printf("Input %d of %s failed: %s\n", *input, tx.Hash(), err)
+        os.Exit(1)
+    }
+    fmt.Printf("Input %d of %s OK\n", *input, tx.Hash())
+    return nil
+}
+
+func parsePrevOuts(s string, count int) ([]*catma.TxOut, error) {
+    items := strings.Split(s, ",")
+    if len(items) != count {
+        return nil, errors.New("Number of prevouts doesn't match number of inputs")
+    }
+    outs := make([]*catma.TxOut, count)
+    for i, item := range items {
+        parts := strings.Split(item, ":")
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("Bad prevout %s", item)
+        }
+        v, err := strconv.ParseInt(parts[0], 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("Bad prevout amount %s", parts[0])
+        }
+        pks, err := hex.DecodeString(parts[1])
+        if err != nil {
+            return nil, fmt.Errorf("Bad prevout pkscript %s", parts[1])
+        }
+        outs[i] = &catma.TxOut{Value: v, PKScript: pks}
+    }
+    return outs, nil
+}
@@ -0,0 +1,271 @@
+// Fee rate estimation from the time txs take to get confirmed
+package mempool
+
+import (
+    "sort"
+    "sync"
+    "bytes"
+    "errors"
+    "encoding/binary"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+)
+
+// Max number of blocks an estimate can target
+const MaxEstimateTarget = 144
+
+const (
+    // Fee rates of buckets, in satoshi per 1000 virtual bytes
+    minBucketFeeRate = 1000
+    maxBucketFeeRate = 10000000
+    bucketSpacing = 1.05
+    // Weight of data points is multiplied by this on each block, i.e. a
+    // data point counts half after about 350 blocks
+    estimateDecay = 0.998
+    // Min number of data points for a range of buckets to be estimated, an
+    // average of 0.1 tx per block
+    sufficientTxs = 0.1 / (1 - estimateDecay)
+    estimatorFileVersion = 1
+)
+
+var (
+    errBadTarget = errors.New("FeeEstimator.EstimateFee: target out of range")
+
+    errBadConfidence = errors.New("FeeEstimator.EstimateFee: confidence out of range")
+
+    errNoEstimate = errors.New("FeeEstimator.EstimateFee: not enough data")
+
+    errEstimatorFile = errors.New("FeeEstimator.FromBytes: unknown file format")
+)
+
+// A tx in pool waiting to be confirmed
+type trackedTx struct {
+    // Chain height when the tx entered pool
+    height      int
+    feeRate     int64
+    bucket      int
+}
+
+// Records how many blocks txs take to get confirmed after entering pool,
+// grouped by fee rate. Txs leaving pool without confirmation are counted
+// as failures for targets they have waited longer than.
+// All counts decay as blocks come, so estimates follow recent blocks.
+type FeeEstimator struct {
+    // Upper fee rate of each bucket, the last one has no upper limit
+    bounds      []float64
+    // Height of the last block processed
+    best        int
+    // Decayed counts of txs confirmed, for each bucket
+    total       []float64
+    // Decayed sum of fee rates of txs confirmed, for each bucket
+    feeSums     []float64
+    // [target-1][bucket] decayed counts of txs confirmed within target blocks
+    confirmed   [][]float64
+    // [target-1][bucket] decayed counts of txs left pool unconfirmed after
+    // waiting at least target blocks
+    failed      [][]float64
+    tracked     map[klib.Hash256]*trackedTx
+    mutex       sync.Mutex
+}
+
+func NewFeeEstimator() *FeeEstimator {
+    bounds := make([]float64, 0)
+    for r := float64(minBucketFeeRate); r < maxBucketFeeRate; r *= bucketSpacing {
+        bounds = append(bounds, r)
+    }
+    bounds = append(bounds, maxBucketFeeRate)
+    n := len(bounds)
+    e := &FeeEstimator{
+        bounds: bounds,
+        total: make([]float64, n),
+        feeSums: make([]float64, n),
+        confirmed: make([][]float64, MaxEstimateTarget),
+        failed: make([][]float64, MaxEstimateTarget),
+        tracked: make(map[klib.Hash256]*trackedTx),
+    }
+    for i := 0; i < MaxEstimateTarget; i++ {
+        e.confirmed[i] = make([]float64, n)
+        e.failed[i] = make([]float64, n)
+    }
+    return e
+}
+
+func (e *FeeEstimator) bucketOf(feeRate int64) int {
+    r := float64(feeRate)
+    i := sort.Search(len(e.bounds), func(i int) bool { return e.bounds[i] >= r })
+    if i == len(e.bounds) {
+        i--
+    }
+    return i
+}
+
+// Starts tracking a tx newly added to pool
+func (e *FeeEstimator) processTx(d *TxDesc) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    if _, ok := e.tracked[d.Hash]; ok {
+        return
+    }
+    e.tracked[d.Hash] = &trackedTx{d.Height, d.FeeRate(), e.bucketOf(d.FeeRate())}
+}
+
+// Stops tracking a tx leaving pool without being confirmed, e.g. evicted
+// or replaced. Does nothing for txs already confirmed by processBlock.
+func (e *FeeEstimator) removeTx(hash *klib.Hash256) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    t, ok := e.tracked[*hash]
+    if !ok {
+        return
+    }
+    delete(e.tracked, *hash)
+    waited := e.best - t.height
+    if waited > MaxEstimateTarget {
+        waited = MaxEstimateTarget
+    }
+    for i := 0; i < waited; i++ {
+        e.failed[i][t.bucket]++
+    }
+}
+
+// Records the tracked txs confirmed by the block at "height"
+func (e *FeeEstimator) processBlock(height int, txs []*catma.Tx) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    if height <= e.best {
+        // Already seen, or connected again after a reorg
+        return
+    }
+    e.best = height
+    e.decay()
+    for _, tx := range txs {
+        hash := tx.Hash()
+        t, ok := e.tracked[*hash]
+        if !ok {
+            continue
+        }
+        delete(e.tracked, *hash)
+        blocks := height - t.height
+        if blocks <= 0 {
+            continue
+        }
+        e.total[t.bucket]++
+        e.feeSums[t.bucket] += float64(t.feeRate)
+        for i := blocks - 1; i < MaxEstimateTarget; i++ {
+            e.confirmed[i][t.bucket]++
+        }
+    }
+}
+
+func (e *FeeEstimator) decay() {
+    for b := range e.bounds {
+        e.total[b] *= estimateDecay
+        e.feeSums[b] *= estimateDecay
+        for i := 0; i < MaxEstimateTarget; i++ {
+            e.confirmed[i][b] *= estimateDecay
+            e.failed[i][b] *= estimateDecay
+        }
+    }
+}
+
+// Returns the fee rate, in satoshi per 1000 virtual bytes, for a tx to get
+// confirmed within "target" blocks with probability of at least "confidence",
+// which is between 0 and 1.
+// Buckets are grouped from the highest fee rate down until each group has
+// enough data points, the result is the average fee rate of the lowest
+// group that succeeds often enough. Txs still in pool that have waited
+// longer than target count against their buckets.
+func (e *FeeEstimator) EstimateFee(target int, confidence float64) (int64, error) {
+    if target < 1 || target > MaxEstimateTarget {
+        return 0, errBadTarget
+    }
+    if confidence <= 0 || confidence > 1 {
+        return 0, errBadConfidence
+    }
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    pending := make([]float64, len(e.bounds))
+    for _, t := range e.tracked {
+        if e.best - t.height >= target {
+            pending[t.bucket]++
+        }
+    }
+    i := target - 1
+    result := int64(-1)
+    var conf, total, fees, count float64
+    for b := len(e.bounds) - 1; b >= 0; b-- {
+        conf += e.confirmed[i][b]
+        total += e.total[b]
+        fees += e.feeSums[b]
+        count += e.total[b] + e.failed[i][b] + pending[b]
+        if count < sufficientTxs {
+            continue
+        }
+        if conf / count < confidence {
+            break
+        }
+        result = int64(fees / total + 0.5)
+        conf, total, fees, count = 0, 0, 0, 0
+    }
+    if result < 0 {
+        return 0, errNoEstimate
+    }
+    return result, nil
+}
+
+// Serializes the recorded data, txs tracked are not included
+func (e *FeeEstimator) Bytes() []byte {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    p := new(bytes.Buffer)
+    header := []uint32{estimatorFileVersion, uint32(e.best),
+        uint32(len(e.bounds)), MaxEstimateTarget}
+    binary.Write(p, binary.LittleEndian, header)
+    binary.Write(p, binary.LittleEndian, e.total)
+    binary.Write(p, binary.LittleEndian, e.feeSums)
+    for i := 0; i < MaxEstimateTarget; i++ {
+        binary.Write(p, binary.LittleEndian, e.confirmed[i])
+        binary.Write(p, binary.LittleEndian, e.failed[i])
+    }
+    return p.Bytes()
+}
+
+// Restores data saved by Bytes, data of a different bucket layout is refused
+func (e *FeeEstimator) FromBytes(data []byte) error {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    r := bytes.NewReader(data)
+    header := make([]uint32, 4)
+    if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+        return err
+    }
+    if header[0] != estimatorFileVersion || int(header[2]) != len(e.bounds) ||
+        header[3] != MaxEstimateTarget {
+        return errEstimatorFile
+    }
+    n := len(e.bounds)
+    total, feeSums := make([]float64, n), make([]float64, n)
+    confirmed := make([][]float64, MaxEstimateTarget)
+    failed := make([][]float64, MaxEstimateTarget)
+    if err := binary.Read(r, binary.LittleEndian, total); err != nil {
+        return err
+    }
+    if err := binary.Read(r, binary.LittleEndian, feeSums); err != nil {
+        return err
+    }
+    for i := 0; i < MaxEstimateTarget; i++ {
+        confirmed[i], failed[i] = make([]float64, n), make([]float64, n)
+        if err := binary.Read(r, binary.LittleEndian, confirmed[i]); err != nil {
+            return err
+        }
+        if err := binary.Read(r, binary.LittleEndian, failed[i]); err != nil {
+            return err
+        }
+    }
+    if r.Len() != 0 {
+        return errors.New("FeeEstimator.FromBytes: trailing data")
+    }
+    e.best = int(header[1])
+    e.total, e.feeSums, e.confirmed, e.failed = total, feeSums, confirmed, failed
+    return nil
+}
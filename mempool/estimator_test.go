@@ -0,0 +1,161 @@
+package mempool
+
+import (
+    "testing"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool/mempooltest"
+)
+
+// Txs entering pool each block, paying "rate" and confirmed "wait" blocks
+// later, or removed unconfirmed when "wait" is negative
+type txClass struct {
+    rate        int64
+    wait        int
+}
+
+type estimatedTx struct {
+    d           *TxDesc
+    leave       int
+    confirm     bool
+}
+
+// Runs the estimator through "blocks" blocks with "n" txs of each class
+// entering pool every block
+func feedEstimator(e *FeeEstimator, blocks int, n int, classes ...txClass) {
+    seq := int64(0)
+    pending := make([]*estimatedTx, 0)
+    for h := 1; h <= blocks; h++ {
+        left := pending[:0]
+        confirmed := make([]*catma.Tx, 0)
+        removed := make([]*TxDesc, 0)
+        for _, p := range pending {
+            if p.leave != h {
+                left = append(left, p)
+            } else if p.confirm {
+                confirmed = append(confirmed, p.d.Tx)
+            } else {
+                removed = append(removed, p.d)
+            }
+        }
+        pending = left
+        e.processBlock(h, confirmed)
+        for _, d := range removed {
+            e.removeTx(&d.Hash)
+        }
+        for _, c := range classes {
+            for i := 0; i < n; i++ {
+                seq++
+                tx := mempooltest.Spend(seq, catma.OutPoint{})
+                d := &TxDesc{Tx: tx, Hash: *tx.Hash(), Fee: c.rate, VSize: 1000, Height: h}
+                e.processTx(d)
+                p := &estimatedTx{d, h + c.wait, c.wait > 0}
+                if c.wait < 0 {
+                    p.leave = h - c.wait
+                }
+                pending = append(pending, p)
+            }
+        }
+    }
+}
+
+func TestEstimateFee(t *testing.T) {
+    e := NewFeeEstimator()
+    if _, err := e.EstimateFee(2, 0.8); err != errNoEstimate {
+        t.Errorf("Estimate with no data: %v", err)
+    }
+    feedEstimator(e, 100, 10, txClass{20000, 1}, txClass{2000, 6})
+    expects := []struct {
+        target      int
+        confidence  float64
+        rate        int64
+    }{
+        {1, 0.8, 20000},
+        {3, 0.8, 20000},
+        {6, 0.8, 2000},
+        {20, 0.95, 2000},
+    }
+    for _, x := range expects {
+        if r, err := e.EstimateFee(x.target, x.confidence); err != nil || r != x.rate {
+            t.Errorf("EstimateFee(%d, %f) = %d, %v; expect %d",
+                x.target, x.confidence, r, err, x.rate)
+        }
+    }
+    if _, err := e.EstimateFee(0, 0.8); err != errBadTarget {
+        t.Errorf("Target 0: %v", err)
+    }
+    if _, err := e.EstimateFee(MaxEstimateTarget + 1, 0.8); err != errBadTarget {
+        t.Errorf("Target too big: %v", err)
+    }
+    if _, err := e.EstimateFee(2, 1.5); err != errBadConfidence {
+        t.Errorf("Bad confidence: %v", err)
+    }
+}
+
+func TestEstimateFailures(t *testing.T) {
+    e := NewFeeEstimator()
+    // Txs of the middle rate never get confirmed
+    feedEstimator(e, 100, 10, txClass{20000, 1}, txClass{5000, -10}, txClass{2000, 2})
+    if r, err := e.EstimateFee(6, 0.8); err != nil || r != 20000 {
+        t.Errorf("EstimateFee = %d, %v; expect 20000", r, err)
+    }
+    // Failures only count for targets the txs have waited
+    if r, err := e.EstimateFee(12, 0.8); err != nil || r != 2000 {
+        t.Errorf("EstimateFee = %d, %v; expect 2000", r, err)
+    }
+}
+
+func TestEstimatorBytes(t *testing.T) {
+    e := NewFeeEstimator()
+    feedEstimator(e, 50, 10, txClass{20000, 1}, txClass{2000, 6})
+    e2 := NewFeeEstimator()
+    if err := e2.FromBytes(e.Bytes()); err != nil {
+        t.Fatalf("FromBytes error %s", err)
+    }
+    for _, target := range []int{1, 6, 30} {
+        r1, err1 := e.EstimateFee(target, 0.8)
+        r2, err2 := e2.EstimateFee(target, 0.8)
+        if r1 != r2 || err1 != err2 {
+            t.Errorf("Target %d, estimate %d, %v after loading, expect %d, %v",
+                target, r2, err2, r1, err1)
+        }
+    }
+    if e2.best != 50 {
+        t.Errorf("Best height %d after loading, expect 50", e2.best)
+    }
+    data := e.Bytes()
+    if err := NewFeeEstimator().FromBytes(data[:len(data) - 1]); err == nil {
+        t.Errorf("Truncated data loaded")
+    }
+    data[0]++
+    if err := NewFeeEstimator().FromBytes(data); err != errEstimatorFile {
+        t.Errorf("Data of unknown version: %v", err)
+    }
+}
+
+func TestPoolEstimator(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    e := NewFeeEstimator()
+    p.SetEstimator(e)
+    tx := mempooltest.Spend(90000, c.AddCoin(1, 100000))
+    evicted := mempooltest.Spend(90000, c.AddCoin(2, 100000))
+    for _, x := range []*catma.Tx{tx, evicted} {
+        if _, err := p.AcceptTx(x); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    if len(e.tracked) != 2 {
+        t.Fatalf("%d txs tracked, expect 2", len(e.tracked))
+    }
+    c.Tip++
+    p.RemoveBlock([]*catma.Tx{tx})
+    p.Remove(evicted.Hash())
+    if len(e.tracked) != 0 || e.best != c.Height() {
+        t.Errorf("Estimator not updated, %d txs tracked, best %d", len(e.tracked), e.best)
+    }
+    b := e.bucketOf(10000 * 1000 / int64(tx.VirtualSize()))
+    if e.total[b] != 1 || e.confirmed[0][b] != 1 || e.failed[0][b] != 1 {
+        t.Errorf("Bad counts: total %f, confirmed %f, failed %f",
+            e.total[b], e.confirmed[0][b], e.failed[0][b])
+    }
+}
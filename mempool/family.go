@@ -0,0 +1,83 @@
+package mempool
+
+import (
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+)
+
+// Returns the txs in pool spending outputs of tx directly
+func (p *Pool) children(d *TxDesc) []*TxDesc {
+    cs := make([]*TxDesc, 0)
+    for i, _ := range d.Tx.TxOuts {
+        if c, ok := p.spends[catma.OutPoint{Hash: d.Hash, Index: uint32(i)}]; ok {
+            cs = append(cs, c)
+        }
+    }
+    return cs
+}
+
+// Returns the unconfirmed ancestors of tx in pool, not including tx itself.
+// Tx doesn't have to be in pool.
+func (p *Pool) ancestorsOf(tx *catma.Tx) map[klib.Hash256]*TxDesc {
+    result := make(map[klib.Hash256]*TxDesc)
+    todo := []*catma.Tx{tx}
+    for len(todo) > 0 {
+        t := todo[len(todo)-1]
+        todo = todo[:len(todo)-1]
+        for _, txi := range t.TxIns {
+            h := txi.PreviousOutput.Hash
+            if a, ok := p.txs[h]; ok {
+                if _, done := result[h]; !done {
+                    result[h] = a
+                    todo = append(todo, a.Tx)
+                }
+            }
+        }
+    }
+    return result
+}
+
+// Returns the descendants of tx in pool, not including tx itself
+func (p *Pool) descendantsOf(d *TxDesc) map[klib.Hash256]*TxDesc {
+    result := make(map[klib.Hash256]*TxDesc)
+    todo := []*TxDesc{d}
+    for len(todo) > 0 {
+        t := todo[len(todo)-1]
+        todo = todo[:len(todo)-1]
+        for _, c := range p.children(t) {
+            if _, done := result[c.Hash]; !done {
+                result[c.Hash] = c
+                todo = append(todo, c)
+            }
+        }
+    }
+    return result
+}
+
+// Returns tx and its ancestors in pool, parents before children,
+// which is the order they can be included in a block
+func (p *Pool) WithAncestors(hash *klib.Hash256) []*TxDesc {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    d, ok := p.txs[*hash]
+    if !ok {
+        return nil
+    }
+    result := make([]*TxDesc, 0, d.Ancestors.Count)
+    done := make(map[klib.Hash256]bool)
+    var visit func(d *TxDesc)
+    visit = func(d *TxDesc) {
+        if done[d.Hash] {
+            return
+        }
+        done[d.Hash] = true
+        for _, txi := range d.Tx.TxIns {
+            if a, ok := p.txs[txi.PreviousOutput.Hash]; ok {
+                visit(a)
+            }
+        }
+        result = append(result, d)
+    }
+    visit(d)
+    return result
+}
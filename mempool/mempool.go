@@ -0,0 +1,631 @@
+// Package mempool keeps unconfirmed txs that are valid to be included in
+// the next block, and follow the relay policy.
+package mempool
+
+import (
+    "math"
+    "sync"
+    "time"
+    "errors"
+    "container/heap"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+)
+
+// The chain txs in pool are built on
+type Chain interface {
+    Headers() catma.HeaderChain
+    // Only Get is used, the UTXO set is never changed by the pool
+    Utxo() catma.UtxoSet
+    // Height of the last block connected to the UTXO set
+    Height() int
+}
+
+// Count, virtual size and fees of a tx together with its ancestors
+// or descendants in pool
+type PackageStats struct {
+    Count       int
+    Size        int
+    Fees        int64
+}
+
+func (s *PackageStats) FeeRate() int64 {
+    return s.Fees * 1000 / int64(s.Size)
+}
+
+func (s *PackageStats) add(d *TxDesc) {
+    s.Count++
+    s.Size += d.VSize
+    s.Fees += d.Fee
+}
+
+func (s *PackageStats) sub(d *TxDesc) {
+    s.Count--
+    s.Size -= d.VSize
+    s.Fees -= d.Fee
+}
+
+// A tx in pool
+type TxDesc struct {
+    Tx          *catma.Tx
+    Hash        klib.Hash256
+    Fee         int64
+    // Virtual size, which fee rate is based on
+    VSize       int
+    SigOpCost   int
+    Added       time.Time
+    // Chain height when the tx was added
+    Height      int
+    // Including the tx itself
+    Ancestors   PackageStats
+    Descendants PackageStats
+    // Position in the eviction heap
+    index       int
+}
+
+// Returns the fee rate in satoshi per 1000 virtual bytes
+func (d *TxDesc) FeeRate() int64 {
+    return d.Fee * 1000 / int64(d.VSize)
+}
+
+// The fee rate a miner gets by including tx, which needs its ancestors
+// included too. A child paying a high fee raises nothing but its own score,
+// parents get mined along with it.
+func (d *TxDesc) AncestorScore() int64 {
+    if r := d.Ancestors.FeeRate(); r < d.FeeRate() {
+        return r
+    }
+    return d.FeeRate()
+}
+
+// The fee rate lost by evicting tx, which takes its descendants along.
+// A parent with a high paying child (CPFP) is kept by this score.
+func (d *TxDesc) DescendantScore() int64 {
+    if r := d.Descendants.FeeRate(); r > d.FeeRate() {
+        return r
+    }
+    return d.FeeRate()
+}
+
+// Why a tx left pool
+type RemoveReason int
+
+const (
+    // Included in a block
+    RemovedConfirmed RemoveReason = iota
+    // Spends the same outputs as a tx in a block
+    RemovedConflict
+    // Replaced by fee (BIP125)
+    RemovedReplaced
+    // Evicted to keep pool within its max size
+    RemovedEvicted
+    // Removed by Remove
+    RemovedByCaller
+    // No longer valid after blocks are disconnected
+    RemovedReorg
+)
+
+func (r RemoveReason) String() string {
+    switch r {
+    case RemovedConfirmed:
+        return "confirmed"
+    case RemovedConflict:
+        return "conflict"
+    case RemovedReplaced:
+        return "replaced"
+    case RemovedEvicted:
+        return "evicted"
+    case RemovedByCaller:
+        return "removed"
+    case RemovedReorg:
+        return "reorg"
+    }
+    return "unknown"
+}
+
+// Called when a tx enters pool
+type TxAddedHandler func(d *TxDesc)
+
+// Called when a tx leaves pool
+type TxRemovedHandler func(d *TxDesc, reason RemoveReason)
+
+type Pool struct {
+    chain       Chain
+    policy      *catma.Policy
+    // Max total virtual size of txs
+    maxSize     int
+    size        int
+    txs         map[klib.Hash256]*TxDesc
+    // Outputs spent by txs in pool
+    spends      map[catma.OutPoint]*TxDesc
+    // Lowest DescendantScore first
+    byScore     scoreHeap
+    // Records confirmation times of txs, nil if not set
+    estimator   *FeeEstimator
+    // Fee rate of the txs evicted lately plus the incremental relay fee,
+    // which decays from when a block comes after the last eviction
+    rollingMinFee   int64
+    rollingUpdated  time.Time
+    blockSinceBump  bool
+    addedHandlers   []TxAddedHandler
+    removedHandlers []TxRemovedHandler
+    mutex       sync.RWMutex
+}
+
+// Returned by AcceptTx when some inputs are neither in pool nor in the
+// UTXO set, which is normal for txs whose parents are not received yet.
+var ErrMissingInputs = errors.New("Pool.AcceptTx: missing inputs")
+
+// Returned by AcceptTxMaxFee when tx pays more than the max fee rate
+var ErrMaxFeeExceeded = errors.New("Pool.AcceptTx: fee rate over the max")
+
+var (
+    errAlreadyInPool = errors.New("Pool.AcceptTx: tx already in pool")
+
+    errCoinBase = errors.New("Pool.AcceptTx: coin base tx")
+
+    errTooManyAncestors = errors.New("Pool.AcceptTx: too many unconfirmed ancestors")
+
+    errTooManyDescendants = errors.New("Pool.AcceptTx: too many unconfirmed descendants of ancestor")
+
+    errPoolFull = errors.New("Pool.AcceptTx: fee rate too low for a full pool")
+
+    errMinFeeNotMet = errors.New("Pool.AcceptTx: fee rate below the min fee of pool")
+)
+
+// Time for the min fee of pool to halve, when pool is at least half full
+const rollingFeeHalfLife = 12 * time.Hour
+
+// Creates a pool holding up to "maxSize" virtual bytes of txs
+func New(chain Chain, policy *catma.Policy, maxSize int) *Pool {
+    return &Pool{
+        chain: chain,
+        policy: policy,
+        maxSize: maxSize,
+        txs: make(map[klib.Hash256]*TxDesc),
+        spends: make(map[catma.OutPoint]*TxDesc),
+    }
+}
+
+// Lets "e" track txs entering and leaving pool from now on
+func (p *Pool) SetEstimator(e *FeeEstimator) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    p.estimator = e
+}
+
+// Registers a handler to be called when a tx enters pool.
+// Handlers are called with pool locked, they must not block or call pool.
+func (p *Pool) OnTxAdded(f TxAddedHandler) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    p.addedHandlers = append(p.addedHandlers, f)
+}
+
+// Registers a handler to be called when a tx leaves pool, same as OnTxAdded
+// handlers must not block or call pool.
+func (p *Pool) OnTxRemoved(f TxRemovedHandler) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    p.removedHandlers = append(p.removedHandlers, f)
+}
+
+// Validates tx against the UTXO set and txs in pool, and adds it to pool.
+// Txs in pool spending the same outputs get replaced if tx follows the
+// replace-by-fee rules (BIP125).
+// Txs with the lowest DescendantScore are evicted if the pool gets too big.
+func (p *Pool) AcceptTx(tx *catma.Tx) (*TxDesc, error) {
+    return p.AcceptTxMaxFee(tx, 0)
+}
+
+// Same as AcceptTx, but rejects tx paying more than "maxFeeRate" satoshis
+// per 1000 vbytes, which is likely a mistake. 0 means no limit.
+func (p *Pool) AcceptTxMaxFee(tx *catma.Tx, maxFeeRate int64) (*TxDesc, error) {
+    // Scripts are verified without holding pool, which may have changed by
+    // then, so the other checks are done again before tx is added
+    p.mutex.RLock()
+    _, _, prevOuts, flags, err := p.checkTx(tx, maxFeeRate)
+    p.mutex.RUnlock()
+    if err != nil {
+        return nil, err
+    }
+    for {
+        if err := catma.VerifyTxScripts(prevOuts, tx, flags); err != nil {
+            return nil, err
+        }
+        p.mutex.Lock()
+        d, replaced, _, again, err := p.checkTx(tx, maxFeeRate)
+        if err != nil {
+            p.mutex.Unlock()
+            return nil, err
+        }
+        // Flags change with the tip only when a soft fork gets active
+        if again == flags {
+            defer p.mutex.Unlock()
+            return p.accept(d, replaced)
+        }
+        p.mutex.Unlock()
+        flags = again
+    }
+}
+
+// Adds tx checked in place of the txs it replaces
+func (p *Pool) accept(d *TxDesc, replaced map[klib.Hash256]*TxDesc) (*TxDesc, error) {
+    for _, r := range replaced {
+        p.removeWithDescendants(r, RemovedReplaced)
+    }
+    p.add(d)
+    p.trim()
+    if _, ok := p.txs[d.Hash]; !ok {
+        return nil, errPoolFull
+    }
+    return d, nil
+}
+
+// Checks tx except scripts, which pool is not changed by.
+// Returns the desc of tx, the txs in pool it replaces, and what
+// checkTxAlone returns for verifying scripts.
+func (p *Pool) checkTx(tx *catma.Tx, maxFeeRate int64) (*TxDesc,
+    map[klib.Hash256]*TxDesc, []*catma.TxOut, script.EvalFlag, error) {
+    d, prevOuts, flags, err := p.checkTxAlone(tx)
+    if err != nil {
+        return nil, nil, nil, 0, err
+    }
+    if maxFeeRate > 0 && d.Fee > maxFeeRate * int64(d.VSize) / 1000 {
+        return nil, nil, nil, 0, ErrMaxFeeExceeded
+    }
+    if r := p.minFeeRate(time.Now()); d.Fee < r * int64(d.VSize) / 1000 {
+        return nil, nil, nil, 0, errMinFeeNotMet
+    }
+    conflicts := make(map[klib.Hash256]*TxDesc)
+    for _, txi := range tx.TxIns {
+        if c, ok := p.spends[txi.PreviousOutput]; ok {
+            conflicts[c.Hash] = c
+        }
+    }
+    replaced := make(map[klib.Hash256]*TxDesc)
+    if len(conflicts) > 0 {
+        if replaced, err = p.checkReplacement(d, conflicts); err != nil {
+            return nil, nil, nil, 0, err
+        }
+    }
+    if err := p.checkLimits(d, replaced); err != nil {
+        return nil, nil, nil, 0, err
+    }
+    // Txs replaced are gone once removed, so the replacement has to make it
+    // before anything is removed
+    if len(replaced) > 0 && p.evictsReplacement(d, replaced) {
+        return nil, nil, nil, 0, errPoolFull
+    }
+    return d, conflicts, prevOuts, flags, nil
+}
+
+// Checks tx on its own except scripts, as if no tx in pool conflicts with it.
+// Returns outputs spent by tx and script flags for verifying scripts.
+func (p *Pool) checkTxAlone(tx *catma.Tx) (*TxDesc, []*catma.TxOut, script.EvalFlag, error) {
+    hash := tx.Hash()
+    if _, ok := p.txs[*hash]; ok {
+        return nil, nil, 0, errAlreadyInPool
+    }
+    if err := tx.FormatCheck(); err != nil {
+        return nil, nil, 0, err
+    }
+    if tx.IsCoinBase() {
+        return nil, nil, 0, errCoinBase
+    }
+    headers := p.chain.Headers()
+    height := p.chain.Height() + 1
+    mtp := catma.MedianTimePast(headers, height)
+    if err := tx.IsStandard(p.policy, uint32(height), mtp); err != nil {
+        return nil, nil, 0, err
+    }
+    view := newPoolView(p, height)
+    prevOuts := make([]*catma.TxOut, len(tx.TxIns))
+    for i, txi := range tx.TxIns {
+        op := &txi.PreviousOutput
+        txo, err := view.Get(&op.Hash, op.Index)
+        if err == catma.ErrUtxoNotFound {
+            return nil, nil, 0, ErrMissingInputs
+        } else if err != nil {
+            return nil, nil, 0, err
+        }
+        prevOuts[i] = &txo.TxOut
+    }
+    if err := tx.InputsStandard(p.policy, view); err != nil {
+        return nil, nil, 0, err
+    }
+    if err := catma.CheckSequenceLocks(tx, height, headers, view); err != nil {
+        return nil, nil, 0, err
+    }
+    flags := catma.BlockEvalFlags(headers.Get(height - 1), height) | catma.StandardEvalFlags
+    r, err := catma.VerifyTx(tx, view, height, flags, true)
+    if err != nil {
+        return nil, nil, 0, err
+    }
+    vsize := tx.VirtualSize()
+    if err := p.policy.CheckFee(r.Fee, vsize); err != nil {
+        return nil, nil, 0, err
+    }
+    return &TxDesc{
+        Tx: tx,
+        Hash: *hash,
+        Fee: r.Fee,
+        VSize: vsize,
+        SigOpCost: r.SigOpCost,
+        Added: time.Now(),
+        Height: height - 1,
+    }, prevOuts, flags, nil
+}
+
+// Checks the limits of ancestors and descendants, as if "replaced" were
+// already removed
+func (p *Pool) checkLimits(d *TxDesc, replaced map[klib.Hash256]*TxDesc) error {
+    ancestors := p.ancestorsOf(d.Tx)
+    stats := PackageStats{1, d.VSize, d.Fee}
+    for _, a := range ancestors {
+        stats.add(a)
+    }
+    if stats.Count > p.policy.MaxAncestors || stats.Size > p.policy.MaxAncestorSize {
+        return errTooManyAncestors
+    }
+    for _, a := range ancestors {
+        desc := a.Descendants
+        for _, r := range replaced {
+            if _, ok := p.ancestorsOf(r.Tx)[a.Hash]; ok {
+                desc.sub(r)
+            }
+        }
+        if desc.Count + 1 > p.policy.MaxDescendants ||
+            desc.Size + d.VSize > p.policy.MaxDescendantSize {
+            return errTooManyDescendants
+        }
+    }
+    return nil
+}
+
+func (p *Pool) add(d *TxDesc) {
+    d.Ancestors = PackageStats{1, d.VSize, d.Fee}
+    d.Descendants = PackageStats{1, d.VSize, d.Fee}
+    for _, a := range p.ancestorsOf(d.Tx) {
+        d.Ancestors.add(a)
+        a.Descendants.add(d)
+        heap.Fix(&p.byScore, a.index)
+    }
+    p.txs[d.Hash] = d
+    for _, txi := range d.Tx.TxIns {
+        p.spends[txi.PreviousOutput] = d
+    }
+    heap.Push(&p.byScore, d)
+    p.size += d.VSize
+    if p.estimator != nil {
+        p.estimator.processTx(d)
+    }
+    for _, f := range p.addedHandlers {
+        f(d)
+    }
+}
+
+// Removes tx alone, its descendants stay
+func (p *Pool) remove(d *TxDesc, reason RemoveReason) {
+    for _, c := range p.descendantsOf(d) {
+        c.Ancestors.sub(d)
+    }
+    for _, a := range p.ancestorsOf(d.Tx) {
+        a.Descendants.sub(d)
+        heap.Fix(&p.byScore, a.index)
+    }
+    delete(p.txs, d.Hash)
+    for _, txi := range d.Tx.TxIns {
+        delete(p.spends, txi.PreviousOutput)
+    }
+    heap.Remove(&p.byScore, d.index)
+    p.size -= d.VSize
+    if p.estimator != nil {
+        p.estimator.removeTx(&d.Hash)
+    }
+    for _, f := range p.removedHandlers {
+        f(d, reason)
+    }
+}
+
+// Removes tx and all the txs in pool spending its outputs
+func (p *Pool) removeWithDescendants(d *TxDesc, reason RemoveReason) {
+    if _, ok := p.txs[d.Hash]; !ok {
+        return
+    }
+    // Children first, so that tx has no descendants when removed
+    for _, c := range p.children(d) {
+        p.removeWithDescendants(c, reason)
+    }
+    p.remove(d, reason)
+}
+
+// Evicts txs with the lowest DescendantScore until pool is small enough,
+// descendants are evicted along as they can't be mined without parents.
+func (p *Pool) trim() {
+    now := time.Now()
+    for p.size > p.maxSize && len(p.byScore) > 0 {
+        d := p.byScore[0]
+        // Txs paying no more than the ones evicted would be evicted next
+        rate := d.Descendants.FeeRate() + p.policy.IncrementalRelayFee
+        if rate > p.decayedMinFee(now) {
+            p.rollingMinFee = rate
+            p.rollingUpdated = now
+            p.blockSinceBump = false
+        }
+        p.removeWithDescendants(d, RemovedEvicted)
+    }
+}
+
+// Returns the fee rate txs have to pay to get in pool, in satoshi per 1000
+// virtual bytes, 0 if no tx has been evicted lately
+func (p *Pool) MinFeeRate() int64 {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    return p.minFeeRate(time.Now())
+}
+
+func (p *Pool) minFeeRate(now time.Time) int64 {
+    r := p.decayedMinFee(now)
+    if r > 0 && r < p.policy.IncrementalRelayFee {
+        return p.policy.IncrementalRelayFee
+    }
+    return r
+}
+
+// The rolling min fee at "now". It halves every rollingFeeHalfLife once a
+// block is connected after the last eviction, faster if pool is not that
+// full, and goes 0 below half the incremental relay fee.
+func (p *Pool) decayedMinFee(now time.Time) int64 {
+    if !p.blockSinceBump || p.rollingMinFee == 0 {
+        return p.rollingMinFee
+    }
+    halfLife := rollingFeeHalfLife
+    if p.size < p.maxSize / 4 {
+        halfLife /= 4
+    } else if p.size < p.maxSize / 2 {
+        halfLife /= 2
+    }
+    halves := float64(now.Sub(p.rollingUpdated)) / float64(halfLife)
+    r := int64(float64(p.rollingMinFee) / math.Pow(2, halves))
+    if r < p.policy.IncrementalRelayFee / 2 {
+        return 0
+    }
+    return r
+}
+
+// Removes the txs included in a newly connected block, and the ones
+// conflicting with them, i.e. spending the same outputs.
+// Called after the block is connected to the chain.
+func (p *Pool) RemoveBlock(txs []*catma.Tx) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    // Before removing, so that txs confirmed are not taken as failures
+    if p.estimator != nil {
+        p.estimator.processBlock(p.chain.Height(), txs)
+    }
+    // The min fee starts to decay from now on
+    now := time.Now()
+    p.rollingMinFee = p.decayedMinFee(now)
+    p.rollingUpdated = now
+    p.blockSinceBump = true
+    for _, tx := range txs {
+        // Children of a confirmed tx stay, they spend the UTXO set now
+        if d, ok := p.txs[*tx.Hash()]; ok {
+            p.remove(d, RemovedConfirmed)
+        }
+        if tx.IsCoinBase() {
+            continue
+        }
+        for _, txi := range tx.TxIns {
+            if d, ok := p.spends[txi.PreviousOutput]; ok {
+                p.removeWithDescendants(d, RemovedConflict)
+            }
+        }
+    }
+}
+
+// Removes txs no longer valid on top of the chain after blocks are disconnected:
+// spending outputs gone from the UTXO set, e.g. of the disconnected blocks,
+// spending coin bases not mature any more, or locked by time or sequence.
+// Called after the blocks are disconnected, before their txs are put back.
+func (p *Pool) RemoveForReorg() {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    headers := p.chain.Headers()
+    height := p.chain.Height() + 1
+    mtp := catma.MedianTimePast(headers, height)
+    view := newPoolView(p, height)
+    ds := make([]*TxDesc, 0, len(p.txs))
+    for _, d := range p.txs {
+        ds = append(ds, d)
+    }
+    for _, d := range ds {
+        if _, ok := p.txs[d.Hash]; !ok {
+            // Removed along with an ancestor
+            continue
+        }
+        if !validAfterReorg(d.Tx, headers, mtp, view) {
+            p.removeWithDescendants(d, RemovedReorg)
+        }
+    }
+}
+
+// If inputs of tx are still there for the next block, which tx is final and
+// mature to be in
+func validAfterReorg(tx *catma.Tx, headers catma.HeaderChain, mtp uint32, view *poolView) bool {
+    height := view.height
+    if !tx.IsFinal(uint32(height), mtp) {
+        return false
+    }
+    for _, txi := range tx.TxIns {
+        op := &txi.PreviousOutput
+        txo, err := view.Get(&op.Hash, op.Index)
+        if err != nil {
+            return false
+        }
+        if txo.CoinBase && height - int(txo.Height) < numbers.CoinbaseMaturity {
+            return false
+        }
+    }
+    return catma.CheckSequenceLocks(tx, height, headers, view) == nil
+}
+
+// Removes tx and its descendants, returns if tx was in pool
+func (p *Pool) Remove(hash *klib.Hash256) bool {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    d, ok := p.txs[*hash]
+    if ok {
+        p.removeWithDescendants(d, RemovedByCaller)
+    }
+    return ok
+}
+
+// Returns tx in pool, nil if not found
+func (p *Pool) Get(hash *klib.Hash256) *TxDesc {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    return p.txs[*hash]
+}
+
+func (p *Pool) Has(hash *klib.Hash256) bool {
+    return p.Get(hash) != nil
+}
+
+// Returns the tx in pool spending "op", nil if none
+func (p *Pool) Spender(op *catma.OutPoint) *TxDesc {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    return p.spends[*op]
+}
+
+func (p *Pool) Count() int {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    return len(p.txs)
+}
+
+// Total virtual size of txs in pool
+func (p *Pool) Size() int {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    return p.size
+}
+
+// Returns all the txs in pool, in no particular order
+func (p *Pool) TxDescs() []*TxDesc {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    ds := make([]*TxDesc, 0, len(p.txs))
+    for _, d := range p.txs {
+        ds = append(ds, d)
+    }
+    return ds
+}
+
+func (p *Pool) Policy() *catma.Policy {
+    return p.policy
+}
@@ -0,0 +1,476 @@
+package mempool
+
+import (
+    "sync"
+    "bytes"
+    "testing"
+    "math/big"
+    "crypto/sha256"
+    "code.google.com/p/go.crypto/ripemd160"
+    "github.com/conformal/btcec"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    "github.com/oxfeeefeee/kaiju/mempool/mempooltest"
+)
+
+func TestAcceptTx(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    coin := c.AddCoin(1, 100000)
+    tx := mempooltest.Spend(90000, coin)
+    d, err := p.AcceptTx(tx)
+    if err != nil {
+        t.Fatalf("AcceptTx error %s", err)
+    }
+    if d.Fee != 10000 || d.VSize != tx.VirtualSize() || p.Count() != 1 || p.Size() != d.VSize {
+        t.Errorf("Bad tx desc %+v", d)
+    }
+    if _, err := p.AcceptTx(tx); err == nil {
+        t.Errorf("Tx accepted twice")
+    }
+    if _, err := p.AcceptTx(mempooltest.Spend(80000, coin)); err == nil {
+        t.Errorf("Double spend accepted")
+    }
+    // Child of tx in pool
+    child := mempooltest.Spend(80000, mempooltest.OutOf(tx))
+    if _, err := p.AcceptTx(child); err != nil {
+        t.Errorf("Child tx error %s", err)
+    }
+    if _, err := p.AcceptTx(mempooltest.Spend(70000, mempooltest.OutOf(mempooltest.Spend(1, coin)))); err != ErrMissingInputs {
+        t.Errorf("Orphan tx: %v", err)
+    }
+    // Below min relay fee
+    if _, err := p.AcceptTx(mempooltest.Spend(79999, c.AddCoin(2, 80000))); err == nil {
+        t.Errorf("Tx with too low fee accepted")
+    }
+    // Spending more than inputs
+    if _, err := p.AcceptTx(mempooltest.Spend(80001, c.AddCoin(3, 80000))); err == nil {
+        t.Errorf("Tx with negative fee accepted")
+    }
+    // Failing script
+    bad := mempooltest.Spend(70000, c.AddCoin(4, 80000))
+    bad.TxIns[0].SigScript = []byte{0x01, 0x52}
+    if _, err := p.AcceptTx(bad); err == nil {
+        t.Errorf("Tx with bad script accepted")
+    }
+    if p.Count() != 2 {
+        t.Errorf("Pool has %d txs, expect 2", p.Count())
+    }
+}
+
+func TestMaxFee(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    tx := mempooltest.Spend(90000, c.AddCoin(1, 100000))
+    rate := int64(10000 * 1000 / tx.VirtualSize())
+    if _, err := p.AcceptTxMaxFee(tx, rate - 1); err != ErrMaxFeeExceeded || p.Count() != 0 {
+        t.Errorf("Tx over max fee rate: %v", err)
+    }
+    if _, err := p.AcceptTxMaxFee(tx, rate + 1); err != nil {
+        t.Errorf("Tx under max fee rate: %s", err)
+    }
+}
+
+// DER of a signature, S is taken as it is
+func derSig(r, s *big.Int) []byte {
+    enc := func(n *big.Int) []byte {
+        b := n.Bytes()
+        if b[0] & 0x80 != 0 {
+            b = append([]byte{0}, b...)
+        }
+        return append([]byte{0x02, byte(len(b))}, b...)
+    }
+    body := append(enc(r), enc(s)...)
+    return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+// Spends a P2PKH output with a real signature, so that CHECKSIG runs under
+// the standard flags
+func TestAcceptSignedTx(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    key, _ := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{1}, 32))
+    pk := key.PubKey().SerializeCompressed()
+    sha := sha256.Sum256(pk)
+    r := ripemd160.New()
+    r.Write(sha[:])
+    pkScript := append(append([]byte{0x76, 0xa9, 0x14}, r.Sum(nil)...), 0x88, 0xac)
+    coin := catma.OutPoint{Hash: klib.Hash256{1}, Index: 0}
+    c.Coins[coin] = &catma.UtxoEntry{
+        TxOut: catma.TxOut{Value: 100000, PKScript: pkScript}, Height: 1}
+
+    tx := mempooltest.Spend(90000, coin)
+    hash, err := tx.HashToSign(pkScript, 0, catma.SIGHASH_ALL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sig, err := key.Sign(hash[:])
+    if err != nil {
+        t.Fatal(err)
+    }
+    sign := func(s *big.Int) {
+        sigScript := script.NewScript()
+        sigScript.AppendPushData(append(derSig(sig.R, s), catma.SIGHASH_ALL))
+        sigScript.AppendPushData(pk)
+        tx.TxIns[0].SigScript = *sigScript
+    }
+    // Malleated to N - S, valid by consensus but not relayed
+    sign(new(big.Int).Sub(btcec.S256().N, sig.S))
+    if _, err := p.AcceptTx(tx); err == nil {
+        t.Errorf("Tx with high S accepted")
+    }
+    sign(sig.S)
+    if _, err := p.AcceptTx(tx); err != nil {
+        t.Errorf("Signed tx error %s", err)
+    }
+}
+
+func TestRemoveBlock(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    coin1, coin2 := c.AddCoin(1, 100000), c.AddCoin(2, 100000)
+    parent := mempooltest.Spend(90000, coin1)
+    child := mempooltest.Spend(80000, mempooltest.OutOf(parent))
+    other := mempooltest.Spend(90000, coin2)
+    grandChild := mempooltest.Spend(70000, mempooltest.OutOf(other))
+    added := 0
+    p.OnTxAdded(func(d *TxDesc) { added++ })
+    removed := make(map[klib.Hash256]RemoveReason)
+    p.OnTxRemoved(func(d *TxDesc, r RemoveReason) { removed[d.Hash] = r })
+    for _, tx := range []*catma.Tx{parent, child, other, grandChild} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    // The block confirms parent, and a tx conflicting with other
+    conflict := mempooltest.Spend(95000, coin2)
+    p.RemoveBlock([]*catma.Tx{parent, conflict})
+    if p.Has(parent.Hash()) || !p.Has(child.Hash()) {
+        t.Errorf("Confirmed tx or its child wrongly removed")
+    }
+    if p.Has(other.Hash()) || p.Has(grandChild.Hash()) {
+        t.Errorf("Conflicted tx or its child not removed")
+    }
+    if p.Count() != 1 || p.Size() != child.VirtualSize() {
+        t.Errorf("Pool has %d txs of size %d", p.Count(), p.Size())
+    }
+    if p.Spender(&coin2) != nil {
+        t.Errorf("Spent output of removed tx still in pool")
+    }
+    if added != 4 || len(removed) != 3 || removed[*parent.Hash()] != RemovedConfirmed ||
+        removed[*other.Hash()] != RemovedConflict || removed[*grandChild.Hash()] != RemovedConflict {
+        t.Errorf("Handlers got %d added, removed %v", added, removed)
+    }
+}
+
+func TestRemoveForReorg(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    // Created by the block to be disconnected
+    coin1 := c.AddCoin(1, 100000)
+    parent := mempooltest.Spend(90000, coin1)
+    child := mempooltest.Spend(80000, mempooltest.OutOf(parent))
+    // Mature only with the block
+    coinBase := c.AddCoin(2, 100000)
+    c.Coins[coinBase].CoinBase = true
+    c.Coins[coinBase].Height = uint32(c.Tip + 1 - numbers.CoinbaseMaturity)
+    spendCoinBase := mempooltest.Spend(90000, coinBase)
+    // Final only with the block
+    locked := mempooltest.Spend(90000, c.AddCoin(3, 100000))
+    locked.LockTime = uint32(c.Tip)
+    locked.TxIns[0].Sequence = numbers.SequenceFinal - 1
+    other := mempooltest.Spend(90000, c.AddCoin(4, 100000))
+    removed := make(map[klib.Hash256]RemoveReason)
+    p.OnTxRemoved(func(d *TxDesc, r RemoveReason) { removed[d.Hash] = r })
+    for _, tx := range []*catma.Tx{parent, child, spendCoinBase, locked, other} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+
+    delete(c.Coins, coin1)
+    c.Tip--
+    p.RemoveForReorg()
+    if p.Count() != 1 || !p.Has(other.Hash()) || p.Size() != other.VirtualSize() {
+        t.Errorf("Pool has %d txs of size %d", p.Count(), p.Size())
+    }
+    if len(removed) != 4 {
+        t.Errorf("Removed %v", removed)
+    }
+    for _, r := range removed {
+        if r != RemovedReorg {
+            t.Errorf("Removed as %s", r)
+        }
+    }
+    if p.Spender(&coinBase) != nil {
+        t.Errorf("Spent output of removed tx still in pool")
+    }
+}
+
+func TestEviction(t *testing.T) {
+    c := mempooltest.NewChain()
+    size := mempooltest.Spend(0, c.AddCoin(0, 0)).VirtualSize()
+    p := New(c, catma.DefaultPolicy(), size * 3)
+    low := mempooltest.Spend(99000, c.AddCoin(1, 100000))
+    lowChild := mempooltest.Spend(98000, mempooltest.OutOf(low))
+    mid := mempooltest.Spend(95000, c.AddCoin(2, 100000))
+    for _, tx := range []*catma.Tx{low, lowChild, mid} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    // Evicting low takes its child along
+    high := mempooltest.Spend(90000, c.AddCoin(3, 100000))
+    if _, err := p.AcceptTx(high); err != nil {
+        t.Fatalf("AcceptTx error %s", err)
+    }
+    if p.Has(low.Hash()) || p.Has(lowChild.Hash()) || !p.Has(mid.Hash()) || !p.Has(high.Hash()) {
+        t.Errorf("Wrong txs evicted")
+    }
+    if p.Size() > size * 3 {
+        t.Errorf("Pool size %d over limit %d", p.Size(), size * 3)
+    }
+    p2 := New(c, catma.DefaultPolicy(), size)
+    if _, err := p2.AcceptTx(mid); err != nil {
+        t.Fatalf("AcceptTx error %s", err)
+    }
+    if _, err := p2.AcceptTx(low); err != errPoolFull {
+        t.Errorf("Low fee tx accepted by full pool: %v", err)
+    }
+}
+
+// Evicting txs raises the min fee of pool, which decays after a block
+func TestRollingMinFee(t *testing.T) {
+    c := mempooltest.NewChain()
+    low := mempooltest.Spend(99000, c.AddCoin(1, 100000))
+    mid := mempooltest.Spend(95000, c.AddCoin(2, 100000))
+    high := mempooltest.Spend(90000, c.AddCoin(3, 100000))
+    size := low.VirtualSize()
+    p := New(c, catma.DefaultPolicy(), size * 2)
+    for _, tx := range []*catma.Tx{low, mid, high} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    if p.Has(low.Hash()) {
+        t.Fatalf("Low fee tx not evicted")
+    }
+    minFee := int64(1000) * 1000 / int64(size) + p.policy.IncrementalRelayFee
+    if p.MinFeeRate() != minFee {
+        t.Errorf("Min fee rate %d, expect %d", p.MinFeeRate(), minFee)
+    }
+    p.Remove(high.Hash())
+    // Room for it, but paying not much more than the tx evicted
+    tx := mempooltest.Spend(98950, c.AddCoin(4, 100000))
+    if _, err := p.AcceptTx(tx); err != errMinFeeNotMet {
+        t.Errorf("Tx below min fee: %v", err)
+    }
+    // No decay before a block
+    p.rollingUpdated = p.rollingUpdated.Add(-rollingFeeHalfLife)
+    if p.MinFeeRate() != minFee {
+        t.Errorf("Min fee rate %d decayed without a block", p.MinFeeRate())
+    }
+    p.RemoveBlock(nil)
+    // Half full, so it halves every half life
+    p.rollingUpdated = p.rollingUpdated.Add(-rollingFeeHalfLife)
+    if r := p.MinFeeRate(); r < minFee / 2 - 1 || r > minFee / 2 {
+        t.Errorf("Min fee rate %d after a half life, expect %d", r, minFee / 2)
+    }
+    if _, err := p.AcceptTx(tx); err != nil {
+        t.Errorf("Tx over decayed min fee: %v", err)
+    }
+    p.rollingUpdated = p.rollingUpdated.Add(-10 * rollingFeeHalfLife)
+    if p.MinFeeRate() != 0 {
+        t.Errorf("Min fee rate %d not gone", p.MinFeeRate())
+    }
+}
+
+// Double spends accepted at the same time, only one of each gets in
+func TestAcceptConcurrently(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    var txs []*catma.Tx
+    for i := 0; i < 20; i++ {
+        coin := c.AddCoin(byte(i + 1), 100000)
+        txs = append(txs, mempooltest.Spend(90000, coin), mempooltest.Spend(80000, coin))
+    }
+    var wg sync.WaitGroup
+    for _, tx := range txs {
+        wg.Add(1)
+        go func(tx *catma.Tx) {
+            defer wg.Done()
+            p.AcceptTx(tx)
+        }(tx)
+    }
+    wg.Wait()
+    if p.Count() != 20 {
+        t.Errorf("Pool has %d txs, expect 20", p.Count())
+    }
+}
+
+// Child pays for parent
+func TestCPFP(t *testing.T) {
+    c := mempooltest.NewChain()
+    size := mempooltest.Spend(0, c.AddCoin(0, 0)).VirtualSize()
+    p := New(c, catma.DefaultPolicy(), size * 3)
+    parent := mempooltest.Spend(99000, c.AddCoin(1, 100000))
+    child := mempooltest.Spend(50000, mempooltest.OutOf(parent))
+    mid := mempooltest.Spend(95000, c.AddCoin(2, 100000))
+    for _, tx := range []*catma.Tx{parent, child, mid} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    pd, cd := p.Get(parent.Hash()), p.Get(child.Hash())
+    if pd.Descendants.Count != 2 || pd.Descendants.Fees != 50000 || cd.Ancestors.Count != 2 {
+        t.Errorf("Bad package stats %+v %+v", pd.Descendants, cd.Ancestors)
+    }
+    if pd.DescendantScore() != int64(50000 * 1000 / (2 * size)) {
+        t.Errorf("Parent descendant score %d", pd.DescendantScore())
+    }
+    if cd.AncestorScore() != pd.DescendantScore() || cd.AncestorScore() >= cd.FeeRate() {
+        t.Errorf("Child ancestor score %d", cd.AncestorScore())
+    }
+    if ds := p.WithAncestors(child.Hash()); len(ds) != 2 || ds[0] != pd || ds[1] != cd {
+        t.Errorf("WithAncestors of child: %v", ds)
+    }
+    // The parent is kept by its child, mid is evicted instead
+    if _, err := p.AcceptTx(mempooltest.Spend(90000, c.AddCoin(3, 100000))); err != nil {
+        t.Fatalf("AcceptTx error %s", err)
+    }
+    if !p.Has(parent.Hash()) || !p.Has(child.Hash()) || p.Has(mid.Hash()) {
+        t.Errorf("Wrong txs evicted")
+    }
+    // Confirming the parent leaves the child alone
+    p.RemoveBlock([]*catma.Tx{parent})
+    if cd.Ancestors.Count != 1 || cd.Ancestors.Fees != cd.Fee {
+        t.Errorf("Ancestors of child after parent confirmed %+v", cd.Ancestors)
+    }
+}
+
+func TestPackageLimits(t *testing.T) {
+    c := mempooltest.NewChain()
+    policy := catma.DefaultPolicy()
+    policy.MaxAncestors = 3
+    policy.MaxDescendants = 4
+    p := New(c, policy, 1000000)
+    root := mempooltest.Spend(45000, c.AddCoin(1, 100000))
+    root.TxOuts = append(root.TxOuts, &catma.TxOut{Value: 45000, PKScript: mempooltest.AnyoneCanSpend})
+    child := mempooltest.Spend(44000, mempooltest.OutOf(root))
+    grandChild := mempooltest.Spend(43000, mempooltest.OutOf(child))
+    child2 := mempooltest.Spend(44000, catma.OutPoint{Hash: *root.Hash(), Index: 1})
+    for _, tx := range []*catma.Tx{root, child, grandChild, child2} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    if _, err := p.AcceptTx(mempooltest.Spend(42000, mempooltest.OutOf(grandChild))); err != errTooManyAncestors {
+        t.Errorf("Tx with too many ancestors: %v", err)
+    }
+    // Root would have 5 descendants including itself
+    if _, err := p.AcceptTx(mempooltest.Spend(43000, mempooltest.OutOf(child2))); err != errTooManyDescendants {
+        t.Errorf("Tx with too many descendants of ancestor: %v", err)
+    }
+    if d := p.Get(root.Hash()); d.Descendants.Count != 4 {
+        t.Errorf("Root has %d descendants", d.Descendants.Count)
+    }
+}
+
+func rbfSpend(value int64, ops ...catma.OutPoint) *catma.Tx {
+    tx := mempooltest.Spend(value, ops...)
+    for _, txi := range tx.TxIns {
+        txi.Sequence = numbers.MaxBIP125RBFSequence
+    }
+    return tx
+}
+
+func TestReplaceByFee(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := New(c, catma.DefaultPolicy(), 1000000)
+    coin := c.AddCoin(1, 100000)
+    orig := rbfSpend(99000, coin)
+    child := mempooltest.Spend(98000, mempooltest.OutOf(orig))
+    for _, tx := range []*catma.Tx{orig, child} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    size := orig.VirtualSize()
+    // Has to pay for both orig and child, plus its own relay
+    if _, err := p.AcceptTx(mempooltest.Spend(98000, coin)); err != errReplacementFee {
+        t.Errorf("Replacement not paying for descendants: %v", err)
+    }
+    if _, err := p.AcceptTx(mempooltest.Spend(98000 - int64(size) + 1, coin)); err != errReplacementFee {
+        t.Errorf("Replacement not paying for relay: %v", err)
+    }
+    // New unconfirmed inputs are not allowed
+    other := mempooltest.Spend(90000, c.AddCoin(2, 100000))
+    if _, err := p.AcceptTx(other); err != nil {
+        t.Fatalf("AcceptTx error %s", err)
+    }
+    if _, err := p.AcceptTx(mempooltest.Spend(150000, coin, mempooltest.OutOf(other))); err != errNewUnconfirmedInput {
+        t.Errorf("Replacement with new unconfirmed input: %v", err)
+    }
+    repl := mempooltest.Spend(98000 - int64(size), coin)
+    if _, err := p.AcceptTx(repl); err != nil {
+        t.Fatalf("Replacement error %s", err)
+    }
+    if p.Has(orig.Hash()) || p.Has(child.Hash()) || !p.Has(repl.Hash()) || p.Count() != 2 {
+        t.Errorf("Replaced txs still in pool")
+    }
+    // The replacement doesn't signal, so it stays unless full RBF
+    repl2 := mempooltest.Spend(90000, coin)
+    if _, err := p.AcceptTx(repl2); err != errNotReplaceable {
+        t.Errorf("Replacing tx not signaling: %v", err)
+    }
+    p.Policy().FullRBF = true
+    if _, err := p.AcceptTx(repl2); err != nil {
+        t.Errorf("Full RBF replacement error %s", err)
+    }
+    // Signaling is inherited from ancestors
+    p.Policy().FullRBF = false
+    parent := rbfSpend(90000, c.AddCoin(3, 100000))
+    kid := mempooltest.Spend(89000, mempooltest.OutOf(parent))
+    for _, tx := range []*catma.Tx{parent, kid} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    if _, err := p.AcceptTx(mempooltest.Spend(80000, mempooltest.OutOf(parent))); err != nil {
+        t.Errorf("Replacing tx with signaling parent: %s", err)
+    }
+}
+
+// A replacement a full pool would evict is rejected, keeping the tx it
+// was to replace
+func TestReplaceInFullPool(t *testing.T) {
+    c := mempooltest.NewChain()
+    coin := c.AddCoin(1, 100000)
+    orig := rbfSpend(99000, coin)
+    mid := mempooltest.Spend(90000, c.AddCoin(2, 100000))
+    p := New(c, catma.DefaultPolicy(), orig.VirtualSize() + mid.VirtualSize())
+    for _, tx := range []*catma.Tx{orig, mid} {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+    // Larger than orig, with a fee rate between orig and mid
+    repl := mempooltest.Spend(94000, coin)
+    repl.TxOuts = append(repl.TxOuts, &catma.TxOut{Value: 1000, PKScript: mempooltest.AnyoneCanSpend})
+    if _, err := p.AcceptTx(repl); err != errPoolFull {
+        t.Errorf("Replacement to be evicted accepted: %v", err)
+    }
+    if !p.Has(orig.Hash()) || !p.Has(mid.Hash()) || p.Has(repl.Hash()) {
+        t.Errorf("Pool changed by rejected replacement")
+    }
+    // Paying more than mid, mid is evicted for it
+    repl.TxOuts[0].Value = 79000
+    if _, err := p.AcceptTx(repl); err != nil {
+        t.Fatalf("Replacement error %s", err)
+    }
+    if p.Has(orig.Hash()) || p.Has(mid.Hash()) || !p.Has(repl.Hash()) {
+        t.Errorf("Wrong txs in pool after replacement")
+    }
+}
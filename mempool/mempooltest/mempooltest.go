@@ -0,0 +1,125 @@
+// Package mempooltest has a made up chain for tests of mempool and of the
+// packages built on it, with coins anyone can spend.
+package mempooltest
+
+import (
+    "time"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+)
+
+// P2SH of redeem script OP_1, anyone can spend it with a standard sigScript
+var AnyoneCanSpend = []byte{0xa9, 0x14,
+    0xda, 0x17, 0x45, 0xe9, 0xb5, 0x49, 0xbd, 0x0b, 0xfa, 0x1a,
+    0x56, 0x99, 0x71, 0xc7, 0x7e, 0xba, 0x30, 0xcd, 0x5a, 0x4b, 0x87}
+
+// P2WSH of witness script OP_1
+var AnyoneCanSpendWitness = []byte{0x00, 0x20,
+    0x4a, 0xe8, 0x15, 0x72, 0xf0, 0x6e, 0x1b, 0x88, 0xfd, 0x5c, 0xed, 0x7a,
+    0x1a, 0x00, 0x09, 0x45, 0x43, 0x2e, 0x83, 0xe1, 0x55, 0x1e, 0x6f, 0x72,
+    0x1e, 0xe9, 0xc0, 0x0b, 0x8c, 0xc3, 0x32, 0x60}
+
+// Headers of a chain with "n" blocks, made up on demand
+type Headers int
+
+func (n Headers) Get(height int) *catma.Header {
+    if height < 0 || height >= int(n) {
+        return nil
+    }
+    return &catma.Header{
+        Version: 4,
+        Timestamp: uint32(1600000000 + height * 600),
+        Bits: numbers.PowLimitBits,
+        Nonce: uint32(height),
+    }
+}
+
+// UtxoSet in memory, which a pool or a template must never change
+type Utxo map[catma.OutPoint]*catma.UtxoEntry
+
+func (m Utxo) Get(h *klib.Hash256, i uint32) (*catma.UtxoEntry, error) {
+    if txo, ok := m[catma.OutPoint{Hash: *h, Index: i}]; ok {
+        return txo, nil
+    }
+    return nil, catma.ErrUtxoNotFound
+}
+
+func (m Utxo) Use(h *klib.Hash256, i uint32, _ *catma.UtxoEntry) error {
+    panic("UTXO set changed")
+}
+
+func (m Utxo) Add(h *klib.Hash256, i uint32, txo *catma.UtxoEntry) error {
+    panic("UTXO set changed")
+}
+
+// The chain as a mempool.Chain
+type Chain struct {
+    // Height of the tip, blocks are connected by increasing it
+    Tip         int
+    Coins       Utxo
+}
+
+// With taproot active
+func NewChain() *Chain {
+    return &Chain{numbers.TaprootHeight + 100, make(Utxo)}
+}
+
+func (c *Chain) Headers() catma.HeaderChain {
+    return Headers(c.Tip + 1)
+}
+
+func (c *Chain) Utxo() catma.UtxoSet {
+    return c.Coins
+}
+
+func (c *Chain) Height() int {
+    return c.Tip
+}
+
+// Timestamp for the next block
+func (c *Chain) Now() time.Time {
+    return c.Headers().Get(c.Tip).Time().Add(10 * time.Minute)
+}
+
+// Adds a coin anyone can spend, "seed" makes the outpoint
+func (c *Chain) AddCoin(seed byte, value int64) catma.OutPoint {
+    return c.addCoin(seed, value, AnyoneCanSpend)
+}
+
+// Adds a coin anyone can spend with a witness
+func (c *Chain) AddWitnessCoin(seed byte, value int64) catma.OutPoint {
+    return c.addCoin(seed, value, AnyoneCanSpendWitness)
+}
+
+func (c *Chain) addCoin(seed byte, value int64, pks []byte) catma.OutPoint {
+    var h klib.Hash256
+    h[0] = seed
+    op := catma.OutPoint{Hash: h, Index: 0}
+    c.Coins[op] = &catma.UtxoEntry{TxOut: catma.TxOut{Value: value, PKScript: pks}, Height: 1}
+    return op
+}
+
+// Tx spending "ops" added by AddCoin, paying "value" to AnyoneCanSpend
+func Spend(value int64, ops ...catma.OutPoint) *catma.Tx {
+    tx := &catma.Tx{Version: 2}
+    for _, op := range ops {
+        tx.TxIns = append(tx.TxIns, &catma.TxIn{PreviousOutput: op,
+            SigScript: []byte{0x01, 0x51}, Sequence: 0xffffffff})
+    }
+    tx.TxOuts = []*catma.TxOut{&catma.TxOut{Value: value, PKScript: AnyoneCanSpend}}
+    return tx
+}
+
+// Tx spending "op" added by AddWitnessCoin
+func SpendWitness(value int64, op catma.OutPoint) *catma.Tx {
+    tx := Spend(value, op)
+    tx.TxIns[0].SigScript = nil
+    tx.TxIns[0].Witness = [][]byte{[]byte{0x51}}
+    return tx
+}
+
+// The first output of tx
+func OutOf(tx *catma.Tx) catma.OutPoint {
+    return catma.OutPoint{Hash: *tx.Hash(), Index: 0}
+}
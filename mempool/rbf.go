@@ -0,0 +1,124 @@
+// Replace-by-fee, see BIP125
+package mempool
+
+import (
+    "sort"
+    "errors"
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+var (
+    errNotReplaceable = errors.New("Pool.AcceptTx: conflicting tx doesn't signal replaceability")
+
+    errTooManyReplacements = errors.New("Pool.AcceptTx: replacing too many txs")
+
+    errSpendsReplaced = errors.New("Pool.AcceptTx: replacement spends tx it replaces")
+
+    errNewUnconfirmedInput = errors.New("Pool.AcceptTx: replacement adds unconfirmed input")
+
+    errReplacementFeeRate = errors.New("Pool.AcceptTx: replacement fee rate not higher than replaced tx")
+
+    errReplacementFee = errors.New("Pool.AcceptTx: replacement doesn't pay for replaced txs and its own relay")
+)
+
+// Returns if tx or any of its ancestors in pool signals replaceability
+func (p *Pool) replaceable(d *TxDesc) bool {
+    if d.Tx.SignalsRBF() {
+        return true
+    }
+    for _, a := range p.ancestorsOf(d.Tx) {
+        if a.Tx.SignalsRBF() {
+            return true
+        }
+    }
+    return false
+}
+
+// Checks if tx "d" can replace txs "conflicts" spending the same outputs,
+// returns all the txs to be replaced, i.e. "conflicts" and their descendants.
+func (p *Pool) checkReplacement(d *TxDesc, conflicts map[klib.Hash256]*TxDesc) (map[klib.Hash256]*TxDesc, error) {
+    replaced := make(map[klib.Hash256]*TxDesc)
+    parents := make(map[klib.Hash256]bool)
+    for h, c := range conflicts {
+        if !p.policy.FullRBF && !p.replaceable(c) {
+            return nil, errNotReplaceable
+        }
+        // A replacement has to be better than each of them
+        if d.FeeRate() <= c.FeeRate() {
+            return nil, errReplacementFeeRate
+        }
+        replaced[h] = c
+        for dh, dd := range p.descendantsOf(c) {
+            replaced[dh] = dd
+        }
+        for _, txi := range c.Tx.TxIns {
+            parents[txi.PreviousOutput.Hash] = true
+        }
+    }
+    if len(replaced) > p.policy.MaxReplacements {
+        return nil, errTooManyReplacements
+    }
+    for _, txi := range d.Tx.TxIns {
+        h := txi.PreviousOutput.Hash
+        if _, ok := replaced[h]; ok {
+            return nil, errSpendsReplaced
+        }
+        // Unconfirmed inputs would lower the chance of being mined
+        if _, ok := p.txs[h]; ok && !parents[h] {
+            return nil, errNewUnconfirmedInput
+        }
+    }
+    fees := int64(0)
+    for _, r := range replaced {
+        fees += r.Fee
+    }
+    if d.Fee < fees || d.Fee - fees < int64(d.VSize) * p.policy.IncrementalRelayFee / 1000 {
+        return nil, errReplacementFee
+    }
+    return replaced, nil
+}
+
+// Returns if taking "d" in place of "replaced" would make a full pool evict
+// "d" or one of its ancestors. Txs replaced are removed before trimming, so
+// pool would end up with neither of them.
+func (p *Pool) evictsReplacement(d *TxDesc, replaced map[klib.Hash256]*TxDesc) bool {
+    size := p.size + d.VSize
+    for _, r := range replaced {
+        size -= r.VSize
+    }
+    if size <= p.maxSize {
+        return false
+    }
+    ancestors := p.ancestorsOf(d.Tx)
+    // Evicted in the order trim goes, lowest DescendantScore first
+    cands := make([]*TxDesc, 0, len(p.byScore))
+    for _, c := range p.byScore {
+        if _, ok := replaced[c.Hash]; !ok {
+            cands = append(cands, c)
+        }
+    }
+    sort.Slice(cands, func(i, j int) bool {
+        return cands[i].DescendantScore() < cands[j].DescendantScore()
+    })
+    evicted := make(map[klib.Hash256]bool)
+    for _, c := range cands {
+        if size <= p.maxSize {
+            return false
+        }
+        if evicted[c.Hash] {
+            continue
+        }
+        if _, ok := ancestors[c.Hash]; ok || c.DescendantScore() >= d.FeeRate() {
+            return true
+        }
+        evicted[c.Hash] = true
+        size -= c.VSize
+        for h, dd := range p.descendantsOf(c) {
+            if _, ok := replaced[h]; !ok && !evicted[h] {
+                evicted[h] = true
+                size -= dd.VSize
+            }
+        }
+    }
+    return size > p.maxSize
+}
@@ -0,0 +1,32 @@
+package mempool
+
+// Txs in pool ordered by DescendantScore, lowest first, see container/heap
+type scoreHeap []*TxDesc
+
+func (h scoreHeap) Len() int {
+    return len(h)
+}
+
+func (h scoreHeap) Less(i, j int) bool {
+    return h[i].DescendantScore() < h[j].DescendantScore()
+}
+
+func (h scoreHeap) Swap(i, j int) {
+    h[i], h[j] = h[j], h[i]
+    h[i].index = i
+    h[j].index = j
+}
+
+func (h *scoreHeap) Push(x interface{}) {
+    d := x.(*TxDesc)
+    d.index = len(*h)
+    *h = append(*h, d)
+}
+
+func (h *scoreHeap) Pop() interface{} {
+    old := *h
+    d := old[len(old)-1]
+    *h = old[:len(old)-1]
+    d.index = -1
+    return d
+}
@@ -0,0 +1,65 @@
+package mempool
+
+import (
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+)
+
+// The UTXO set of the chain plus outputs of txs in pool.
+// Changes are kept in the view, so a tx can be verified without touching
+// the UTXO set.
+type poolView struct {
+    pool        *Pool
+    // Height of the next block, which is given to outputs of txs in pool
+    height      int
+    used        map[catma.OutPoint]bool
+    added       map[catma.OutPoint]*catma.UtxoEntry
+}
+
+func newPoolView(p *Pool, height int) *poolView {
+    return &poolView{
+        pool: p,
+        height: height,
+        used: make(map[catma.OutPoint]bool),
+        added: make(map[catma.OutPoint]*catma.UtxoEntry),
+    }
+}
+
+func (v *poolView) Get(h *klib.Hash256, i uint32) (*catma.UtxoEntry, error) {
+    op := catma.OutPoint{Hash: *h, Index: i}
+    if v.used[op] {
+        return nil, catma.ErrUtxoNotFound
+    }
+    if txo, ok := v.added[op]; ok {
+        return txo, nil
+    }
+    if d, ok := v.pool.txs[*h]; ok {
+        if int(i) >= len(d.Tx.TxOuts) {
+            return nil, catma.ErrUtxoNotFound
+        }
+        return &catma.UtxoEntry{TxOut: *d.Tx.TxOuts[i], Height: uint32(v.height)}, nil
+    }
+    return v.pool.chain.Utxo().Get(h, i)
+}
+
+func (v *poolView) Use(h *klib.Hash256, i uint32, _ *catma.UtxoEntry) error {
+    if _, err := v.Get(h, i); err != nil {
+        return err
+    }
+    v.used[catma.OutPoint{Hash: *h, Index: i}] = true
+    return nil
+}
+
+func (v *poolView) Add(h *klib.Hash256, i uint32, txo *catma.UtxoEntry) error {
+    v.added[catma.OutPoint{Hash: *h, Index: i}] = txo
+    return nil
+}
+
+// Member of catma.UTXOs, used by Tx.InputsStandard
+func (v *poolView) GetTxOut(op *catma.OutPoint) *catma.TxOut {
+    txo, err := v.Get(&op.Hash, op.Index)
+    if err != nil {
+        return nil
+    }
+    return &txo.TxOut
+}
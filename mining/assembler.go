@@ -0,0 +1,338 @@
+// Package mining builds block templates out of mempool for external miners,
+// kaiju itself doesn't mine.
+package mining
+
+import (
+    "time"
+    "errors"
+    "container/heap"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    "github.com/oxfeeefeee/kaiju/mempool"
+)
+
+// BIP9 version bits with no deployment signaled
+const templateVersion = 0x20000000
+
+const (
+    // Weight and sigop cost kept for the coin base
+    coinBaseWeight = 4000
+    coinBaseSigOpCost = 400
+    // Selection stops after this many packages in a row don't fit
+    // into an almost full block
+    maxConsecutiveFailures = 1000
+)
+
+var errStalePrev = errors.New("VerifyBlock: previous block is not the chain tip")
+
+// A block ready to be mined, except for the nonce
+type Template struct {
+    Header      *catma.Header
+    // Coin base first
+    Txs         []*catma.Tx
+    // Fee and sigop cost of each tx, the ones of the coin base are the
+    // total fees and its own sigop cost
+    Fees        []int64
+    SigOpCosts  []int
+    Height      int
+    // The earliest timestamp allowed
+    MinTime     uint32
+    // Total weight and sigop cost of the block
+    Weight      int
+    SigOpCost   int
+}
+
+// A tx in pool waiting to be selected
+type candidate struct {
+    d           *mempool.TxDesc
+    weight      int
+    // Number of its ancestors in pool, a tx always has more than its parents
+    depth       int
+    parents     []*candidate
+    children    []*candidate
+    // Itself plus its ancestors not selected yet
+    pkg         mempool.PackageStats
+    pkgWeight   int
+    pkgSigOps   int
+    selected    bool
+    excluded    bool
+    // Bumped when pkg changes, outdated heap items are skipped
+    version     int
+}
+
+// Fee rate miners get by selecting the tx along with its package, the same
+// as TxDesc.AncestorScore
+func (c *candidate) score() int64 {
+    if r := c.pkg.FeeRate(); r < c.d.FeeRate() {
+        return r
+    }
+    return c.d.FeeRate()
+}
+
+// Itself and its ancestors not selected yet, parents first
+func (c *candidate) unselectedAncestors() []*candidate {
+    found := make(map[*candidate]bool)
+    var walk func(x *candidate)
+    walk = func(x *candidate) {
+        if x.selected || found[x] {
+            return
+        }
+        found[x] = true
+        for _, p := range x.parents {
+            walk(p)
+        }
+    }
+    walk(c)
+    list := make([]*candidate, 0, len(found))
+    for x, _ := range found {
+        list = append(list, x)
+    }
+    sortByDepth(list)
+    return list
+}
+
+// Itself and all its descendants
+func (c *candidate) descendants() map[*candidate]bool {
+    found := make(map[*candidate]bool)
+    var walk func(x *candidate)
+    walk = func(x *candidate) {
+        if found[x] {
+            return
+        }
+        found[x] = true
+        for _, ch := range x.children {
+            walk(ch)
+        }
+    }
+    walk(c)
+    return found
+}
+
+func sortByDepth(list []*candidate) {
+    // Insertion sort, packages are small
+    for i := 1; i < len(list); i++ {
+        for j := i; j > 0 && list[j].depth < list[j-1].depth; j-- {
+            list[j], list[j-1] = list[j-1], list[j]
+        }
+    }
+}
+
+type heapItem struct {
+    c           *candidate
+    version     int
+    score       int64
+}
+
+// Highest score first
+type candidateHeap []*heapItem
+
+func (h candidateHeap) Len() int { return len(h) }
+
+func (h candidateHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+
+func (h candidateHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *candidateHeap) Push(x interface{}) {
+    *h = append(*h, x.(*heapItem))
+}
+
+func (h *candidateHeap) Pop() interface{} {
+    old := *h
+    n := len(old)
+    item := old[n - 1]
+    *h = old[0 : n - 1]
+    return item
+}
+
+// Builds a block on top of "chain" with txs in "pool", paying the subsidy and
+// fees to "payTo". Txs are selected by ancestor fee rate, so a child paying for
+// its parents (CPFP) gets them in.
+// The template is verified before returned, except for proof of work.
+func NewTemplate(chain mempool.Chain, pool *mempool.Pool, payTo []byte, now time.Time) (*Template, error) {
+    headers := chain.Headers()
+    height := chain.Height() + 1
+    prev := headers.Get(height - 1)
+    if prev == nil {
+        return nil, errStalePrev
+    }
+    bits, err := catma.NextBits(headers, height)
+    if err != nil {
+        return nil, err
+    }
+    mtp := catma.MedianTimePast(headers, height)
+    t := &Template{
+        Header: &catma.Header{
+            Version: templateVersion,
+            PrevBlock: *prev.Hash(),
+            Timestamp: uint32(now.Unix()),
+            Bits: bits,
+        },
+        Txs: []*catma.Tx{nil},
+        Fees: []int64{0},
+        SigOpCosts: []int{0},
+        Height: height,
+        MinTime: mtp + 1,
+        Weight: coinBaseWeight,
+        SigOpCost: coinBaseSigOpCost,
+    }
+    if t.Header.Timestamp < t.MinTime {
+        t.Header.Timestamp = t.MinTime
+    }
+    t.selectTxs(pool.TxDescs(), mtp)
+    flags := catma.BlockEvalFlags(t.Header, height)
+    t.Txs[0] = t.coinBase(payTo, (flags & script.EvalFlagWitness) != 0)
+    cbSigOps := 0
+    for _, txout := range t.Txs[0].TxOuts {
+        cbSigOps += script.Script(txout.PKScript).SigOpCount(false)
+    }
+    t.SigOpCosts[0] = cbSigOps * numbers.WitnessScaleFactor
+    root, _ := catma.TxsMerkleRoot(t.Txs)
+    t.Header.MerkleRoot = *root
+    t.Weight = catma.BlockWeight(t.Txs)
+    t.SigOpCost += t.SigOpCosts[0] - coinBaseSigOpCost
+    if err := VerifyBlock(t.Header, t.Txs, chain, now); err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+// Adds txs of the best packages until the block is full
+func (t *Template) selectTxs(descs []*mempool.TxDesc, mtp uint32) {
+    cands := make(map[klib.Hash256]*candidate)
+    for _, d := range descs {
+        cands[d.Hash] = &candidate{d: d, weight: d.Tx.Weight()}
+    }
+    for _, c := range cands {
+        for _, txi := range c.d.Tx.TxIns {
+            if p, ok := cands[txi.PreviousOutput.Hash]; ok {
+                c.parents = append(c.parents, p)
+                p.children = append(p.children, c)
+            }
+        }
+    }
+    // Txs in pool are final for the block they were accepted for, the chain
+    // might have changed since then
+    for _, c := range cands {
+        if !c.d.Tx.IsFinal(uint32(t.Height), mtp) {
+            for x, _ := range c.descendants() {
+                x.excluded = true
+            }
+        }
+    }
+    h := make(candidateHeap, 0, len(cands))
+    for _, c := range cands {
+        if c.excluded {
+            continue
+        }
+        ancestors := c.unselectedAncestors()
+        c.depth = len(ancestors) - 1
+        for _, a := range ancestors {
+            c.pkg.Count++
+            c.pkg.Size += a.d.VSize
+            c.pkg.Fees += a.d.Fee
+            c.pkgWeight += a.weight
+            c.pkgSigOps += a.d.SigOpCost
+        }
+        h = append(h, &heapItem{c, 0, c.score()})
+    }
+    heap.Init(&h)
+    failures := 0
+    for h.Len() > 0 {
+        item := heap.Pop(&h).(*heapItem)
+        c := item.c
+        if c.selected || item.version != c.version {
+            continue
+        }
+        if t.Weight + c.pkgWeight > numbers.MaxBlockWeight ||
+            t.SigOpCost + c.pkgSigOps > numbers.MaxBlockSigOpsCost {
+            failures++
+            if failures > maxConsecutiveFailures &&
+                t.Weight > numbers.MaxBlockWeight - coinBaseWeight {
+                break
+            }
+            continue
+        }
+        failures = 0
+        for _, a := range c.unselectedAncestors() {
+            t.add(a)
+            for x, _ := range a.descendants() {
+                if x == a || x.selected || x.excluded {
+                    continue
+                }
+                x.pkg.Count--
+                x.pkg.Size -= a.d.VSize
+                x.pkg.Fees -= a.d.Fee
+                x.pkgWeight -= a.weight
+                x.pkgSigOps -= a.d.SigOpCost
+                x.version++
+                heap.Push(&h, &heapItem{x, x.version, x.score()})
+            }
+        }
+    }
+}
+
+func (t *Template) add(c *candidate) {
+    c.selected = true
+    t.Txs = append(t.Txs, c.d.Tx)
+    t.Fees = append(t.Fees, c.d.Fee)
+    t.SigOpCosts = append(t.SigOpCosts, c.d.SigOpCost)
+    t.Fees[0] += c.d.Fee
+    t.Weight += c.weight
+    t.SigOpCost += c.d.SigOpCost
+}
+
+// The coin base claims subsidy plus fees, and commits to the witness
+// of txs if segwit is active
+func (t *Template) coinBase(payTo []byte, witness bool) *catma.Tx {
+    sigScript := script.NewScript()
+    // BIP34 height, plus an extra nonce for miners to change
+    sigScript.AppendPushInt(int64(t.Height))
+    sigScript.AppendPushInt(0)
+    txin := &catma.TxIn{SigScript: *sigScript, Sequence: 0xffffffff}
+    txin.PreviousOutput.SetNull()
+    cb := &catma.Tx{
+        Version: 1,
+        TxIns: []*catma.TxIn{txin},
+        TxOuts: []*catma.TxOut{&catma.TxOut{
+            Value: catma.BlockSubsidy(t.Height) + t.Fees[0],
+            PKScript: payTo,
+        }},
+    }
+    if witness {
+        reserved := make([]byte, 32)
+        txin.Witness = [][]byte{reserved}
+        // The coin base itself is not committed to
+        commitment := catma.WitnessCommitment(t.Txs, reserved)
+        cb.TxOuts = append(cb.TxOuts, &catma.TxOut{
+            Value: 0,
+            PKScript: catma.WitnessCommitmentScript(commitment),
+        })
+    }
+    return cb
+}
+
+// Returns the witness commitment output of the coin base, nil if none
+func (t *Template) WitnessCommitment() []byte {
+    cb := t.Txs[0]
+    if len(cb.TxOuts) < 2 {
+        return nil
+    }
+    return cb.TxOuts[len(cb.TxOuts) - 1].PKScript
+}
+
+// TestBlockValidity in Satoshi client: verifies a block extending "chain"
+// without changing the UTXO set. Proof of work is not checked.
+func VerifyBlock(h *catma.Header, txs []*catma.Tx, chain mempool.Chain, now time.Time) error {
+    headers := chain.Headers()
+    height := chain.Height() + 1
+    prev := headers.Get(height - 1)
+    if prev == nil || *prev.Hash() != h.PrevBlock {
+        return errStalePrev
+    }
+    if err := catma.CheckHeaderContext(h, height, headers, now); err != nil {
+        return err
+    }
+    return catma.VerifyBlock(h, txs, height, headers, newUtxoView(chain.Utxo()), false)
+}
@@ -0,0 +1,119 @@
+package mining
+
+import (
+    "testing"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/mempool/mempooltest"
+)
+
+func accept(t *testing.T, p *mempool.Pool, txs ...*catma.Tx) {
+    for _, tx := range txs {
+        if _, err := p.AcceptTx(tx); err != nil {
+            t.Fatalf("AcceptTx error %s", err)
+        }
+    }
+}
+
+func TestEmptyTemplate(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := mempool.New(c, catma.DefaultPolicy(), 1000000)
+    tmpl, err := NewTemplate(c, p, []byte{0x51}, c.Now())
+    if err != nil {
+        t.Fatalf("NewTemplate error %s", err)
+    }
+    if len(tmpl.Txs) != 1 || tmpl.Height != c.Height() + 1 {
+        t.Fatalf("Bad template, %d txs at height %d", len(tmpl.Txs), tmpl.Height)
+    }
+    if tmpl.Header.PrevBlock != *c.Headers().Get(c.Height()).Hash() {
+        t.Errorf("Template not on top of the tip")
+    }
+    cb := tmpl.Txs[0]
+    if cb.TxOuts[0].Value != catma.BlockSubsidy(tmpl.Height) || tmpl.WitnessCommitment() == nil {
+        t.Errorf("Bad coin base %+v", cb.TxOuts)
+    }
+    r := tmpl.Result()
+    if r.Height != tmpl.Height || r.CoinBaseValue != cb.TxOuts[0].Value ||
+        r.Bits != "1d00ffff" || len(r.Transactions) != 0 || r.WitnessCommitment == "" {
+        t.Errorf("Bad getblocktemplate result %+v", r)
+    }
+    if r.Target != "00000000ffff0000000000000000000000000000000000000000000000000000" {
+        t.Errorf("Bad target %s", r.Target)
+    }
+}
+
+func TestTemplateTxOrder(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := mempool.New(c, catma.DefaultPolicy(), 1000000)
+    low := mempooltest.Spend(99000, c.AddCoin(1, 100000))
+    mid := mempooltest.Spend(95000, c.AddCoin(2, 100000))
+    // A parent paying little with a child paying a lot (CPFP)
+    parent := mempooltest.Spend(99800, c.AddCoin(3, 100000))
+    child := mempooltest.Spend(79800, mempooltest.OutOf(parent))
+    witness := mempooltest.SpendWitness(97000, c.AddWitnessCoin(4, 100000))
+    accept(t, p, low, mid, parent, child, witness)
+    tmpl, err := NewTemplate(c, p, []byte{0x51}, c.Now())
+    if err != nil {
+        t.Fatalf("NewTemplate error %s", err)
+    }
+    expects := []*catma.Tx{parent, child, mid, witness, low}
+    if len(tmpl.Txs) != len(expects) + 1 {
+        t.Fatalf("Template has %d txs, expect %d", len(tmpl.Txs), len(expects) + 1)
+    }
+    for i, tx := range expects {
+        if *tmpl.Txs[i + 1].Hash() != *tx.Hash() {
+            t.Errorf("Tx %d is %s, expect %s", i + 1, tmpl.Txs[i + 1].Hash(), tx.Hash())
+        }
+    }
+    fees := int64(1000 + 5000 + 200 + 20000 + 3000)
+    if tmpl.Fees[0] != fees || tmpl.Txs[0].TxOuts[0].Value != catma.BlockSubsidy(tmpl.Height) + fees {
+        t.Errorf("Bad fees %d, coin base value %d", tmpl.Fees[0], tmpl.Txs[0].TxOuts[0].Value)
+    }
+    if tmpl.Weight != catma.BlockWeight(tmpl.Txs) {
+        t.Errorf("Weight %d, expect %d", tmpl.Weight, catma.BlockWeight(tmpl.Txs))
+    }
+    r := tmpl.Result()
+    if len(r.Transactions[1].Depends) != 1 || r.Transactions[1].Depends[0] != 1 {
+        t.Errorf("Child depends on %v, expect [1]", r.Transactions[1].Depends)
+    }
+    if w := r.Transactions[3]; w.TxID == w.Hash || w.Fee != 3000 {
+        t.Errorf("Bad witness tx %+v", w)
+    }
+}
+
+func TestVerifyBlock(t *testing.T) {
+    c := mempooltest.NewChain()
+    p := mempool.New(c, catma.DefaultPolicy(), 1000000)
+    accept(t, p, mempooltest.SpendWitness(97000, c.AddWitnessCoin(1, 100000)))
+    tmpl, err := NewTemplate(c, p, []byte{0x51}, c.Now())
+    if err != nil {
+        t.Fatalf("NewTemplate error %s", err)
+    }
+    data, err := EncodeBlock(tmpl.Header, tmpl.Txs)
+    if err != nil {
+        t.Fatalf("EncodeBlock error %s", err)
+    }
+    h, txs, err := DecodeBlock(data)
+    if err != nil {
+        t.Fatalf("DecodeBlock error %s", err)
+    }
+    if err := VerifyBlock(h, txs, c, c.Now()); err != nil {
+        t.Errorf("Decoded block error %s", err)
+    }
+    if _, _, err := DecodeBlock(data[:len(data) - 2]); err != ErrBlockDecode {
+        t.Errorf("Truncated block decoded")
+    }
+    // Claiming more than subsidy plus fees
+    txs[0].TxOuts[0].Value++
+    root, _ := catma.TxsMerkleRoot(txs)
+    h.MerkleRoot = *root
+    if err := VerifyBlock(h, txs, c, c.Now()); err == nil {
+        t.Errorf("Block with bad coin base value passed")
+    }
+    h2 := *tmpl.Header
+    h2.PrevBlock = klib.Hash256{}
+    if err := VerifyBlock(&h2, tmpl.Txs, c, c.Now()); err != errStalePrev {
+        t.Errorf("Block not on the tip: %v", err)
+    }
+}
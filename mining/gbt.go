@@ -0,0 +1,183 @@
+// getblocktemplate (BIP22, BIP23) and submitblock
+package mining
+
+import (
+    "fmt"
+    "errors"
+    "encoding/hex"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+var ErrBlockDecode = errors.New("DecodeBlock: block decode failed")
+
+// Parameters of getblocktemplate
+type TemplateRequest struct {
+    // "template" (the default) or "proposal"
+    Mode            string      `json:"mode"`
+    // Hex of the proposed block
+    Data            string      `json:"data"`
+    Rules           []string    `json:"rules"`
+    Capabilities    []string    `json:"capabilities"`
+}
+
+// Rules the client supports
+func (r *TemplateRequest) HasRule(rule string) bool {
+    for _, s := range r.Rules {
+        if s == rule {
+            return true
+        }
+    }
+    return false
+}
+
+// A tx of the template, the coin base is not included
+type TemplateTx struct {
+    Data            string      `json:"data"`
+    TxID            string      `json:"txid"`
+    Hash            string      `json:"hash"`
+    // 1-based indices of the txs in template it spends
+    Depends         []int       `json:"depends"`
+    Fee             int64       `json:"fee"`
+    SigOps          int         `json:"sigops"`
+    Weight          int         `json:"weight"`
+}
+
+// Result of getblocktemplate, the client builds its own coin base
+type TemplateResult struct {
+    Capabilities    []string            `json:"capabilities"`
+    Version         uint32              `json:"version"`
+    Rules           []string            `json:"rules"`
+    VbAvailable     map[string]int      `json:"vbavailable"`
+    VbRequired      int                 `json:"vbrequired"`
+    PreviousBlock   string              `json:"previousblockhash"`
+    Transactions    []*TemplateTx       `json:"transactions"`
+    CoinBaseAux     map[string]string   `json:"coinbaseaux"`
+    CoinBaseValue   int64               `json:"coinbasevalue"`
+    Target          string              `json:"target"`
+    MinTime         uint32              `json:"mintime"`
+    Mutable         []string            `json:"mutable"`
+    NonceRange      string              `json:"noncerange"`
+    SigOpLimit      int                 `json:"sigoplimit"`
+    SizeLimit       int                 `json:"sizelimit"`
+    WeightLimit     int                 `json:"weightlimit"`
+    CurTime         uint32              `json:"curtime"`
+    Bits            string              `json:"bits"`
+    Height          int                 `json:"height"`
+    WitnessCommitment string            `json:"default_witness_commitment,omitempty"`
+}
+
+// Soft forks in effect for the template, "!" means clients not knowing the rule
+// can't use the template as is (BIP9)
+func (t *Template) Rules() []string {
+    rules := make([]string, 0)
+    flags := catma.BlockEvalFlags(t.Header, t.Height)
+    if (flags & script.EvalFlagCheckSequence) != 0 {
+        rules = append(rules, "csv")
+    }
+    if (flags & script.EvalFlagWitness) != 0 {
+        rules = append(rules, "!segwit")
+    }
+    if (flags & script.EvalFlagTaproot) != 0 {
+        rules = append(rules, "taproot")
+    }
+    return rules
+}
+
+// Returns the template in the format of getblocktemplate
+func (t *Template) Result() *TemplateResult {
+    index := make(map[klib.Hash256]int)
+    txs := make([]*TemplateTx, 0, len(t.Txs) - 1)
+    for i := 1; i < len(t.Txs); i++ {
+        tx := t.Txs[i]
+        hash := tx.Hash()
+        index[*hash] = i
+        depends := make([]int, 0)
+        seen := make(map[int]bool)
+        for _, txi := range tx.TxIns {
+            if j, ok := index[txi.PreviousOutput.Hash]; ok && !seen[j] {
+                seen[j] = true
+                depends = append(depends, j)
+            }
+        }
+        txs = append(txs, &TemplateTx{
+            Data: hex.EncodeToString(tx.WitnessBytes()),
+            TxID: hash.String(),
+            Hash: tx.WitnessHash().String(),
+            Depends: depends,
+            Fee: t.Fees[i],
+            SigOps: t.SigOpCosts[i],
+            Weight: tx.Weight(),
+        })
+    }
+    target := new(klib.Hash256)
+    copy(target[:], reverse(catma.CompactToBig(t.Header.Bits).Bytes()))
+    r := &TemplateResult{
+        Capabilities: []string{"proposal"},
+        Version: t.Header.Version,
+        Rules: t.Rules(),
+        VbAvailable: make(map[string]int),
+        PreviousBlock: t.Header.PrevBlock.String(),
+        Transactions: txs,
+        CoinBaseAux: make(map[string]string),
+        CoinBaseValue: t.Txs[0].TxOuts[0].Value,
+        Target: target.String(),
+        MinTime: t.MinTime,
+        Mutable: []string{"time", "transactions", "prevblock"},
+        NonceRange: "00000000ffffffff",
+        SigOpLimit: numbers.MaxBlockSigOpsCost,
+        SizeLimit: numbers.MaxBlockWeight,
+        WeightLimit: numbers.MaxBlockWeight,
+        CurTime: t.Header.Timestamp,
+        Bits: fmt.Sprintf("%08x", t.Header.Bits),
+        Height: t.Height,
+    }
+    if c := t.WitnessCommitment(); c != nil {
+        r.WitnessCommitment = hex.EncodeToString(c)
+    }
+    return r
+}
+
+// Big endian to little endian
+func reverse(b []byte) []byte {
+    r := make([]byte, len(b))
+    for i, v := range b {
+        r[len(b) - 1 - i] = v
+    }
+    return r
+}
+
+// Decodes a serialized block, as given to submitblock or a proposal
+func DecodeBlock(data string) (*catma.Header, []*catma.Tx, error) {
+    raw, err := hex.DecodeString(data)
+    if err != nil {
+        return nil, nil, ErrBlockDecode
+    }
+    m := btcmsg.NewBlockMsg().(*btcmsg.Message_block)
+    if err := m.Decode(raw); err != nil || len(m.Txs) == 0 {
+        return nil, nil, ErrBlockDecode
+    }
+    txs := make([]*catma.Tx, len(m.Txs))
+    for i, tx := range m.Txs {
+        txs[i] = (*catma.Tx)(tx)
+    }
+    return m.Header, txs, nil
+}
+
+// Serializes a block, the reverse of DecodeBlock
+func EncodeBlock(h *catma.Header, txs []*catma.Tx) (string, error) {
+    m := btcmsg.NewBlockMsg().(*btcmsg.Message_block)
+    m.Header = h
+    m.Txs = make([]*btcmsg.Tx, len(txs))
+    for i, tx := range txs {
+        m.Txs[i] = (*btcmsg.Tx)(tx)
+    }
+    raw, err := m.Encode()
+    if err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(raw), nil
+}
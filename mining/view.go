@@ -0,0 +1,50 @@
+package mining
+
+import (
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+)
+
+// The UTXO set with changes kept in memory, so a block can be verified
+// without touching the UTXO set
+type utxoView struct {
+    base        catma.UtxoSet
+    used        map[catma.OutPoint]bool
+    added       map[catma.OutPoint]*catma.UtxoEntry
+}
+
+func newUtxoView(base catma.UtxoSet) *utxoView {
+    return &utxoView{
+        base: base,
+        used: make(map[catma.OutPoint]bool),
+        added: make(map[catma.OutPoint]*catma.UtxoEntry),
+    }
+}
+
+func (v *utxoView) Get(h *klib.Hash256, i uint32) (*catma.UtxoEntry, error) {
+    op := catma.OutPoint{Hash: *h, Index: i}
+    if v.used[op] {
+        return nil, catma.ErrUtxoNotFound
+    }
+    if txo, ok := v.added[op]; ok {
+        return txo, nil
+    }
+    return v.base.Get(h, i)
+}
+
+func (v *utxoView) Use(h *klib.Hash256, i uint32, _ *catma.UtxoEntry) error {
+    if _, err := v.Get(h, i); err != nil {
+        return err
+    }
+    op := catma.OutPoint{Hash: *h, Index: i}
+    delete(v.added, op)
+    v.used[op] = true
+    return nil
+}
+
+func (v *utxoView) Add(h *klib.Hash256, i uint32, txo *catma.UtxoEntry) error {
+    op := catma.OutPoint{Hash: *h, Index: i}
+    delete(v.used, op)
+    v.added[op] = txo
+    return nil
+}
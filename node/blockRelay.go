@@ -0,0 +1,387 @@
+package node
+
+import (
+    "sync"
+    "math/rand"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/compact"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/blockchain"
+    "github.com/oxfeeefeee/kaiju/knet"
+    "github.com/oxfeeefeee/kaiju/knet/peer"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+// Most peers asked to announce new blocks with "cmpctblock" right away
+const maxHighBandwidthPeers = 3
+
+// Number of the latest blocks kept in memory to serve peers, we don't keep
+// blocks otherwise
+const maxRecentBlocks = 10
+
+// A block connected recently
+type recentBlock struct {
+    hash        klib.Hash256
+    header      *catma.Header
+    txs         []*catma.Tx
+    cmpct       *btcmsg.Message_cmpctblock
+}
+
+// A compact block waiting for the txs we don't have
+type pendingBlock struct {
+    block       *compact.PartialBlock
+    from        peer.Handle
+}
+
+// Relays new blocks on top of the chain tip with compact blocks (BIP152).
+// The peers that gave us new blocks first are asked to send "cmpctblock"
+// without announcing them first (high bandwidth mode).
+type blockRelay struct {
+    pool        *mempool.Pool
+    // Peers that sent "sendcmpct" of our version, true if they want high
+    // bandwidth mode
+    cmpctPeers  map[peer.Handle]bool
+    // Peers that sent "sendheaders"
+    headerPeers map[peer.Handle]bool
+    // Peers we asked for high bandwidth mode, the latest last
+    hbPeers     []peer.Handle
+    pending     map[klib.Hash256]*pendingBlock
+    recent      []*recentBlock
+    mutex       sync.Mutex
+}
+
+func newBlockRelay(pool *mempool.Pool) *blockRelay {
+    return &blockRelay{
+        pool: pool,
+        cmpctPeers: make(map[peer.Handle]bool),
+        headerPeers: make(map[peer.Handle]bool),
+        pending: make(map[klib.Hash256]*pendingBlock),
+    }
+}
+
+// Member of peer.Monitor interface
+func (r *blockRelay) ListenTypes() []string {
+    return []string{"block", "sendheaders", "sendcmpct", "cmpctblock", "getblocktxn", "blocktxn"}
+}
+
+// Member of peer.Monitor interface
+func (r *blockRelay) OnPeerUp(p *peer.Peer) {
+    greet(p.Handle())
+}
+
+// Tells the peer how we want new blocks announced
+func greet(h peer.Handle) {
+    if h.Version() >= kaiju.SendHeadersVersion {
+        h.SendMsg(btcmsg.NewSendHeadersMsg(), 0)
+    }
+    if h.Version() >= kaiju.CompactBlocksVersion {
+        sendCmpct(h, false)
+    }
+}
+
+// Member of peer.Monitor interface
+func (r *blockRelay) OnPeerDown(p *peer.Peer) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    h := p.Handle()
+    delete(r.cmpctPeers, h)
+    delete(r.headerPeers, h)
+    for i, hb := range r.hbPeers {
+        if hb == h {
+            r.hbPeers = append(r.hbPeers[:i], r.hbPeers[i+1:]...)
+            break
+        }
+    }
+    for k, b := range r.pending {
+        if b.from == h {
+            delete(r.pending, k)
+        }
+    }
+}
+
+// Member of peer.Monitor interface
+func (r *blockRelay) OnPeerMsg(h peer.Handle, msg btcmsg.Message) {
+    switch m := msg.(type) {
+    case *btcmsg.Message_block:
+        r.onBlock(h, m)
+    case *btcmsg.Message_sendheaders:
+        r.mutex.Lock()
+        r.headerPeers[h] = true
+        r.mutex.Unlock()
+    case *btcmsg.Message_sendcmpct:
+        if m.Version == compact.Version {
+            r.mutex.Lock()
+            r.cmpctPeers[h] = m.Announce
+            r.mutex.Unlock()
+        }
+    case *btcmsg.Message_cmpctblock:
+        r.onCmpctBlock(h, m)
+    case *btcmsg.Message_getblocktxn:
+        r.onGetBlockTxn(h, m)
+    case *btcmsg.Message_blocktxn:
+        r.onBlockTxn(h, m)
+    }
+}
+
+func sendCmpct(h peer.Handle, announce bool) {
+    m := btcmsg.NewSendCmpctMsg().(*btcmsg.Message_sendcmpct)
+    m.Announce = announce
+    m.Version = compact.Version
+    h.SendMsg(m, 0)
+}
+
+// If the peer sent "sendcmpct" of our version
+func (r *blockRelay) isCmpctPeer(h peer.Handle) bool {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    _, ok := r.cmpctPeers[h]
+    return ok
+}
+
+// If the block is worth processing, i.e. new and on top of the chain tip
+func isNewTipBlock(h *catma.Header) bool {
+    return isSynced() && extendsTip(h) && !isConnected(h.Hash())
+}
+
+func (r *blockRelay) onBlock(h peer.Handle, m *btcmsg.Message_block) {
+    // Blocks not on top of the tip are kept by the tip follower
+    if !isSynced() || isConnected(m.Header.Hash()) {
+        return
+    }
+    r.mutex.Lock()
+    delete(r.pending, *m.Header.Hash())
+    r.mutex.Unlock()
+    txs := make([]*catma.Tx, len(m.Txs))
+    for i, tx := range m.Txs {
+        txs[i] = (*catma.Tx)(tx)
+    }
+    r.process(h, m.Header, txs)
+}
+
+// Rebuilds the block with txs in mempool, and asks for the missing ones
+func (r *blockRelay) onCmpctBlock(h peer.Handle, m *btcmsg.Message_cmpctblock) {
+    if !isNewTipBlock(m.Header) {
+        return
+    }
+    // Cheap to check before the work of rebuilding
+    if err := catma.CheckProofOfWork(m.Header); err != nil {
+        log.Debugf("Bad compact block %s: %s", m.Header.Hash(), err)
+        return
+    }
+    descs := r.pool.TxDescs()
+    pooled := make([]*catma.Tx, len(descs))
+    for i, d := range descs {
+        pooled[i] = d.Tx
+    }
+    b, err := compact.NewPartialBlock(m, pooled)
+    if err == compact.ErrShortIDCollision {
+        follower.requestFull(h, m.Header.Hash())
+        return
+    } else if err != nil {
+        log.Debugf("Bad compact block %s: %s", m.Header.Hash(), err)
+        return
+    }
+    missing := b.Missing()
+    if len(missing) == 0 {
+        r.fill(h, b, nil)
+        return
+    }
+    hash := m.Header.Hash()
+    r.mutex.Lock()
+    r.pending[*hash] = &pendingBlock{b, h}
+    r.mutex.Unlock()
+    req := btcmsg.NewGetBlockTxnMsg().(*btcmsg.Message_getblocktxn)
+    req.BlockHash = *hash
+    req.Indexes = missing
+    h.SendMsg(req, 0)
+}
+
+func (r *blockRelay) onBlockTxn(h peer.Handle, m *btcmsg.Message_blocktxn) {
+    r.mutex.Lock()
+    p, ok := r.pending[m.BlockHash]
+    if ok && p.from == h {
+        delete(r.pending, m.BlockHash)
+    }
+    r.mutex.Unlock()
+    if !ok || p.from != h {
+        return
+    }
+    txs := make([]*catma.Tx, len(m.Txs))
+    for i, tx := range m.Txs {
+        txs[i] = (*catma.Tx)(tx)
+    }
+    r.fill(h, p.block, txs)
+}
+
+// Completes the block with the missing txs, falls back to the full block if
+// short ids turn out to be ambiguous, or the block rebuilt is invalid
+func (r *blockRelay) fill(h peer.Handle, b *compact.PartialBlock, txs []*catma.Tx) {
+    err := b.Fill(txs)
+    if err == compact.ErrShortIDCollision {
+        follower.requestFull(h, b.Header.Hash())
+        return
+    } else if err != nil {
+        log.Debugf("Bad compact block %s: %s", b.Header.Hash(), err)
+        return
+    }
+    if reason := r.process(h, b.Header, b.Txs()); reason != "" {
+        // Short ids commit to witnesses, so only a tx of mempool colliding
+        // with the short id of a tx mined makes a block other than the one sent
+        log.Debugf("Compact block %s rebuilt invalid: %s", b.Header.Hash(), reason)
+        follower.requestFull(h, b.Header.Hash())
+    }
+}
+
+func requestBlock(h peer.Handle, hash *klib.Hash256) {
+    getData := btcmsg.NewGetDataMsg().(*btcmsg.Message_getdata)
+    getData.Inventory = []*blockchain.InvElement{
+        &blockchain.InvElement{InvType: blockchain.InvTypeWitnessBlock, Hash: *hash}}
+    h.SendMsg(getData, 0)
+}
+
+// Returns the reason the block is rejected as invalid, "" if it's not
+func (r *blockRelay) process(h peer.Handle, header *catma.Header, txs []*catma.Tx) string {
+    ok, reason := follower.process(h, header, txs)
+    if ok {
+        r.promote(h)
+    }
+    return reason
+}
+
+// Asks the peer that just gave us a new block for high bandwidth mode, the
+// one asked the earliest gets demoted if there are too many
+func (r *blockRelay) promote(h peer.Handle) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    if _, ok := r.cmpctPeers[h]; !ok {
+        return
+    }
+    for i, hb := range r.hbPeers {
+        if hb == h {
+            r.hbPeers = append(append(r.hbPeers[:i], r.hbPeers[i+1:]...), h)
+            return
+        }
+    }
+    r.hbPeers = append(r.hbPeers, h)
+    sendCmpct(h, true)
+    if len(r.hbPeers) > maxHighBandwidthPeers {
+        sendCmpct(r.hbPeers[0], false)
+        r.hbPeers = r.hbPeers[1:]
+    }
+}
+
+// Keeps a newly connected block to serve peers
+func (r *blockRelay) add(h *catma.Header, txs []*catma.Tx) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    r.recent = append(r.recent, &recentBlock{
+        hash: *h.Hash(),
+        header: h,
+        txs: txs,
+        cmpct: compact.NewBlock(h, txs, uint64(rand.Int63())),
+    })
+    if len(r.recent) > maxRecentBlocks {
+        r.recent = r.recent[1:]
+    }
+    // Pending blocks are not on top of the tip any more
+    r.pending = make(map[klib.Hash256]*pendingBlock)
+}
+
+func (r *blockRelay) find(hash *klib.Hash256) *recentBlock {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for _, b := range r.recent {
+        if b.hash == *hash {
+            return b
+        }
+    }
+    return nil
+}
+
+// Returns tx in recent blocks and the header of its block, nils if not found
+func (r *blockRelay) findTx(hash *klib.Hash256) (*catma.Tx, *catma.Header) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for i := len(r.recent) - 1; i >= 0; i-- {
+        b := r.recent[i]
+        for _, tx := range b.txs {
+            if *tx.Hash() == *hash {
+                return tx, b.header
+            }
+        }
+    }
+    return nil, nil
+}
+
+// Sends "cmpctblock" to peers in high bandwidth mode, "headers" to the ones
+// that sent "sendheaders", and "inv" to the others
+func (r *blockRelay) announce(h *catma.Header, from peer.Handle) {
+    b := r.find(h.Hash())
+    if b == nil {
+        return
+    }
+    inv := btcmsg.NewInvMsg().(*btcmsg.Message_inv)
+    inv.Inventory = []*blockchain.InvElement{
+        &blockchain.InvElement{InvType: blockchain.InvTypeBlock, Hash: b.hash}}
+    headers := btcmsg.NewHeadersMsg().(*btcmsg.Message_headers)
+    headers.Headers = []*catma.Header{b.header}
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    for _, p := range knet.Peers().Handles() {
+        if p == from {
+            continue
+        }
+        if r.cmpctPeers[p] {
+            p.SendMsg(b.cmpct, 0)
+        } else if r.headerPeers[p] {
+            p.SendMsg(headers, 0)
+        } else {
+            p.SendMsg(inv, 0)
+        }
+    }
+}
+
+// Sends the txs a peer misses to rebuild a block we sent as "cmpctblock"
+func (r *blockRelay) onGetBlockTxn(h peer.Handle, m *btcmsg.Message_getblocktxn) {
+    b := r.find(&m.BlockHash)
+    if b == nil {
+        return
+    }
+    resp := btcmsg.NewBlockTxnMsg().(*btcmsg.Message_blocktxn)
+    resp.BlockHash = m.BlockHash
+    resp.Txs = make([]*btcmsg.Tx, len(m.Indexes))
+    for i, idx := range m.Indexes {
+        if idx >= len(b.txs) {
+            return
+        }
+        resp.Txs[i] = (*btcmsg.Tx)(b.txs[idx])
+    }
+    h.SendMsg(resp, 0)
+}
+
+// Sends a recent block asked by "getdata", either full or compact
+func (r *blockRelay) onGetData(h peer.Handle, e *blockchain.InvElement) {
+    b := r.find(&e.Hash)
+    if b == nil {
+        return
+    }
+    switch e.InvType &^ blockchain.InvTypeWitnessFlag {
+    case blockchain.InvTypeBlock:
+        m := btcmsg.NewBlockMsg().(*btcmsg.Message_block)
+        m.Header = b.header
+        m.Txs = make([]*btcmsg.Tx, len(b.txs))
+        for i, tx := range b.txs {
+            // Witness only to those asking for it (BIP144)
+            if e.InvType & blockchain.InvTypeWitnessFlag == 0 {
+                tx = tx.StripWitness()
+            }
+            m.Txs[i] = (*btcmsg.Tx)(tx)
+        }
+        h.SendMsg(m, 0)
+    case blockchain.InvTypeCmpctBlock:
+        h.SendMsg(b.cmpct, 0)
+    }
+}
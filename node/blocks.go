@@ -0,0 +1,167 @@
+package node
+
+import (
+    "sync"
+    "time"
+    "sync/atomic"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mining"
+    "github.com/oxfeeefeee/kaiju/knet/peer"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+    "github.com/oxfeeefeee/kaiju/node/catchUp"
+    "github.com/oxfeeefeee/kaiju/node/event"
+)
+
+// Blocks are connected and disconnected one at a time
+var blockMutex sync.Mutex
+
+// Hash of the last block connected to the UTXO set. The best header chain
+// could have switched to another branch before the blocks get disconnected,
+// so it's tracked on its own.
+var tip klib.Hash256
+
+var tipMutex sync.RWMutex
+
+// Gets the error the node can't go on after
+var fatal = make(chan error, 1)
+
+// Returns the channel getting the error the node stops on, e.g. a reorg deeper
+// than the undo data kept. The node should be destroyed and synced again.
+func Fatal() <-chan error {
+    return fatal
+}
+
+// Stops connecting blocks, as if not synced, and reports "err"
+func halt(err error) {
+    atomic.StoreInt32(&synced, 0)
+    select {
+    case fatal <- err:
+    default:
+    }
+}
+
+func chainTip() klib.Hash256 {
+    tipMutex.RLock()
+    defer tipMutex.RUnlock()
+    return tip
+}
+
+func setChainTip(hash *klib.Hash256) {
+    tipMutex.Lock()
+    defer tipMutex.Unlock()
+    tip = *hash
+}
+
+// If block "h" is on top of the last block connected
+func extendsTip(h *catma.Header) bool {
+    return h.PrevBlock == chainTip()
+}
+
+// If the block with "hash" is already connected
+func isConnected(hash *klib.Hash256) bool {
+    headers := storage.Get().Headers()
+    height, ok := headers.Height(hash)
+    top := chainView{}.Height()
+    // Not if blocks of the best chain are yet to replace the connected ones
+    return ok && height <= top && *headers.Get(top).Hash() == chainTip()
+}
+
+// Verifies a new block on top of the chain tip and connects it, then announces
+// it to the peers except "from".
+// Returns "" if the block is accepted, or the reason it's not as the strings
+// of submitblock (BIP22).
+func acceptBlock(h *catma.Header, txs []*catma.Tx, from peer.Handle) (string, error) {
+    blockMutex.Lock()
+    defer blockMutex.Unlock()
+    headers := storage.Get().Headers()
+    hash := h.Hash()
+    if isConnected(hash) {
+        return "duplicate", nil
+    }
+    if _, ok := headers.Height(&h.PrevBlock); !ok {
+        return "bad-prevblk", nil
+    }
+    if !isSynced() || !extendsTip(h) {
+        // Blocks not on top of the tip are left to catching up
+        return "inconclusive", nil
+    }
+    if err := catma.CheckProofOfWork(h); err != nil {
+        return err.Error(), nil
+    }
+    height := chainView{}.Height() + 1
+    if err := mining.VerifyBlock(h, txs, chainView{}, time.Now()); err != nil {
+        markInvalid(headers, h, txs, height)
+        return err.Error(), nil
+    }
+    if err := headers.Append([]*catma.Header{h}); err != nil {
+        return "", err
+    }
+    if hh, ok := headers.Height(hash); !ok || hh != height {
+        // Valid, but another branch of headers has more work
+        return "inconclusive", nil
+    }
+    // Verified above, scripts don't have to run again
+    if err := catchUp.ConnectBlock(h, txs, height, false); err != nil {
+        log.Errorf("Failed to connect block %d %s: %s", height, hash, err)
+        return "", err
+    }
+    setChainTip(hash)
+    log.Infof("Block %d %s connected, %d txs", height, hash, len(txs))
+    blocks.add(h, txs)
+    blocks.announce(h, from)
+    return "", nil
+}
+
+// Marks block "h" at "height" of the best header chain invalid after it failed
+// to verify, so that the best valid chain is followed instead. Headers are
+// checked when appended, so it's the txs that are invalid, unless they are not
+// the ones the header commits to. Returns if the block is marked.
+func markInvalid(headers storage.HeaderArray, h *catma.Header, txs []*catma.Tx, height int) bool {
+    hash := h.Hash()
+    if hh, ok := headers.Height(hash); !ok || hh != height || catma.IsBlockMutated(h, txs, height) {
+        return false
+    }
+    if err := headers.Invalidate(hash); err != nil {
+        log.Errorf("Failed to mark block %d %s invalid: %s", height, hash, err)
+        return false
+    }
+    return true
+}
+
+// Disconnects blocks of "db" from the branch the best header chain switched
+// away from, txs of the ones still in memory go back to mempool, and txs in
+// mempool no longer valid are removed. The node halts if a block can't be
+// disconnected.
+func disconnectBlocks(db storage.UtxoDB, r *storage.Reorg) {
+    blockMutex.Lock()
+    defer blockMutex.Unlock()
+    txs := make([]*catma.Tx, 0)
+    for height := db.Height(); height > r.Fork; height-- {
+        i := height - r.Fork - 1
+        if i >= len(r.Disconnected) {
+            break
+        }
+        h := r.Disconnected[i]
+        hash := h.Hash()
+        if *hash != chainTip() {
+            break
+        }
+        if err := db.DisconnectBlock(uint32(height)); err != nil {
+            log.Errorf("Failed to disconnect block %d %s: %s", height, hash, err)
+            halt(err)
+            return
+        }
+        setChainTip(&h.PrevBlock)
+        bus.Publish(&event.BlockDisconnected{Height: height, Header: h})
+        if b := blocks.find(hash); b != nil {
+            txs = append(append([]*catma.Tx{}, b.txs[1:]...), txs...)
+        }
+    }
+    // Before the txs are back, which have no children in pool then
+    pool.RemoveForReorg()
+    for _, tx := range txs {
+        pool.AcceptTx(tx)
+    }
+}
@@ -0,0 +1,146 @@
+package node
+
+import (
+    "errors"
+    "testing"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/mempool/mempooltest"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+)
+
+// Best header chain in memory, only what markInvalid needs works
+type memHeaders struct {
+    storage.HeaderArray
+    heights     map[klib.Hash256]int
+    invalid     []klib.Hash256
+}
+
+func (m *memHeaders) Height(hash *klib.Hash256) (int, bool) {
+    height, ok := m.heights[*hash]
+    return height, ok
+}
+
+func (m *memHeaders) Invalidate(hash *klib.Hash256) error {
+    m.invalid = append(m.invalid, *hash)
+    delete(m.heights, *hash)
+    return nil
+}
+
+// UTXO set that only disconnects blocks, failing at height "failAt"
+type memUtxoDB struct {
+    storage.UtxoDB
+    height          int
+    failAt          int
+    disconnected    []int
+}
+
+func (m *memUtxoDB) Height() int {
+    return m.height
+}
+
+func (m *memUtxoDB) DisconnectBlock(height uint32) error {
+    if int(height) != m.height {
+        return errors.New("memUtxoDB: not the top block")
+    } else if m.height == m.failAt {
+        return errors.New("memUtxoDB: no undo data")
+    }
+    m.disconnected = append(m.disconnected, m.height)
+    m.height--
+    return nil
+}
+
+func coinBase(seed uint32) *catma.Tx {
+    cb := &catma.Tx{Version: 1, LockTime: seed}
+    cb.TxIns = []*catma.TxIn{&catma.TxIn{SigScript: []byte{0x01, 0x01}, Sequence: 0xffffffff}}
+    cb.TxIns[0].PreviousOutput.SetNull()
+    cb.TxOuts = []*catma.TxOut{&catma.TxOut{Value: 1, PKScript: mempooltest.AnyoneCanSpend}}
+    return cb
+}
+
+// Header of a block of "txs" after "prev"
+func blockHeader(prev *catma.Header, txs []*catma.Tx) *catma.Header {
+    hashes := make([]*klib.Hash256, len(txs))
+    for i, tx := range txs {
+        hashes[i] = tx.Hash()
+    }
+    root, _ := catma.MerkleRoot(hashes)
+    return &catma.Header{Version: 4, PrevBlock: *prev.Hash(), MerkleRoot: *root, Timestamp: prev.Timestamp + 600}
+}
+
+func TestMarkInvalid(t *testing.T) {
+    c := mempooltest.NewChain()
+    txs := []*catma.Tx{coinBase(0),
+        mempooltest.Spend(90000, c.AddCoin(1, 100000)), mempooltest.Spend(90000, c.AddCoin(2, 100000))}
+    h := blockHeader(&catma.Header{}, txs)
+    headers := &memHeaders{heights: map[klib.Hash256]int{*h.Hash(): 100}}
+    // Not the txs the header commits to, the block could be fine
+    if markInvalid(headers, h, append(txs, txs[2]), 100) || markInvalid(headers, h, txs[:2], 100) {
+        t.Errorf("Mutated block marked invalid")
+    }
+    if markInvalid(headers, h, txs, 101) {
+        t.Errorf("Block not of the best chain marked invalid")
+    }
+    if !markInvalid(headers, h, txs, 100) || len(headers.invalid) != 1 || headers.invalid[0] != *h.Hash() {
+        t.Errorf("Invalid block not marked, %v", headers.invalid)
+    }
+}
+
+func TestDisconnectBlocks(t *testing.T) {
+    c := mempooltest.NewChain()
+    pool = mempool.New(c, catma.DefaultPolicy(), 1000000)
+    blocks = newBlockRelay(pool)
+    defer func() {
+        pool, blocks = nil, nil
+    }()
+    parent := mempooltest.Spend(90000, c.AddCoin(1, 100000))
+    child := mempooltest.Spend(80000, mempooltest.OutOf(parent))
+    // Blocks 11 to 13 of the old branch, the last two are still in memory
+    fork := &catma.Header{Nonce: 10}
+    r := &storage.Reorg{Fork: 10}
+    prev := fork
+    for i, tx := range []*catma.Tx{nil, parent, child} {
+        txs := []*catma.Tx{coinBase(uint32(i))}
+        if tx != nil {
+            txs = append(txs, tx)
+        }
+        h := blockHeader(prev, txs)
+        if tx != nil {
+            blocks.add(h, txs)
+        }
+        r.Disconnected = append(r.Disconnected, h)
+        prev = h
+    }
+
+    // Block 13 is not connected yet
+    db := &memUtxoDB{height: 12, failAt: -1}
+    setChainTip(r.Disconnected[1].Hash())
+    disconnectBlocks(db, r)
+    if db.height != 10 || len(db.disconnected) != 2 || db.disconnected[0] != 12 {
+        t.Errorf("Blocks disconnected: %v", db.disconnected)
+    }
+    if chainTip() != *fork.Hash() {
+        t.Errorf("Chain tip not moved back to the fork")
+    }
+    if !pool.Has(parent.Hash()) || pool.Has(child.Hash()) {
+        t.Errorf("Txs of disconnected blocks not back to mempool")
+    }
+    pool.Remove(parent.Hash())
+
+    // Halts, keeping the blocks from the one failed
+    db = &memUtxoDB{height: 13, failAt: 12}
+    setChainTip(r.Disconnected[2].Hash())
+    disconnectBlocks(db, r)
+    if db.height != 12 || chainTip() != *r.Disconnected[1].Hash() {
+        t.Errorf("Disconnected down to %d", db.height)
+    }
+    select {
+    case <-Fatal():
+    default:
+        t.Errorf("Node not halted")
+    }
+    if pool.Has(child.Hash()) {
+        t.Errorf("Txs back to mempool after halting")
+    }
+}
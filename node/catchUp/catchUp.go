@@ -9,9 +9,38 @@ package catchUp
 
 import (
     "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/catma"
     "github.com/oxfeeefeee/kaiju/blockchain/storage"
 )
 
+// Called after a block is verified and saved
+type BlockHandler func(height int, txs []*catma.Tx)
+
+var blockHandlers []BlockHandler
+
+// Registers a handler to be notified of new blocks, not thread safe,
+// should be called before CatchUp
+func OnBlock(f BlockHandler) {
+    blockHandlers = append(blockHandlers, f)
+}
+
+// Verifies the block at "height" and connects it to the UTXO set, then notifies
+// the handlers. Scripts are not run unless "verify".
+func ConnectBlock(h *catma.Header, txs []*catma.Tx, height int, verify bool) error {
+    db := storage.Get().OutputDB()
+    headers := storage.Get().Headers()
+    if err := catma.VerifyBlock(h, txs, height, headers, db, !verify); err != nil {
+        return err
+    }
+    if err := db.Commit(uint32(height), false); err != nil {
+        return err
+    }
+    for _, f := range blockHandlers {
+        f(height, txs)
+    }
+    return nil
+}
+
 func CatchUp() {
     headersCatchUp()
 
@@ -21,6 +50,7 @@ func CatchUp() {
 }
 
 func headersCatchUp() {
+    checkpointHeaders()
     for !headerUpToDate() {
         moreHeaders()
     }
@@ -2,13 +2,40 @@ package catchUp
 
 import (
     "time"
+    "errors"
     "github.com/oxfeeefeee/kaiju/log"
     "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
     "github.com/oxfeeefeee/kaiju/knet"
     "github.com/oxfeeefeee/kaiju/knet/btcmsg"
     "github.com/oxfeeefeee/kaiju/blockchain/storage"
 )
 
+// Number of peers downloading headers between checkpoints at the same time
+const headersParal = 8
+
+// Times a segment is tried before giving up
+const headersMaxTries = 5
+
+var (
+    errHeadersEmpty = errors.New("headerSegment.download: no headers returned")
+
+    errHeadersNotLinked = errors.New("headerSegment.download: headers not linked")
+
+    errHeadersCheckpoint = errors.New("headerSegment.download: headers don't end at checkpoint")
+
+    errHeadersCanceled = errors.New("headerSegment.downloadRetry: canceled")
+)
+
+// Headers from a known header to the next checkpoint
+type headerSegment struct {
+    // The header the segment starts after
+    from        klib.Hash256
+    height      int
+    to          catma.Checkpoint
+    done        chan []*catma.Header
+}
+
 // Returns if we should stop catching up
 func headerUpToDate() bool {
     headers := storage.Get().Headers()
@@ -16,6 +43,131 @@ func headerUpToDate() bool {
     return h.Time().Add(time.Hour * 2).After(time.Now())
 }
 
+// Downloads the headers up to the last checkpoint, the segments between
+// checkpoints are downloaded by different peers in parallel. Headers of
+// a segment are only checked to be linked with enough work, and then appended
+// in order to be fully validated against the headers before them.
+func checkpointHeaders() {
+    headers := storage.Get().Headers()
+    tip := headers.Len() - 1
+    segs := make([]*headerSegment, 0)
+    from, height := *headers.Get(tip).Hash(), tip
+    for _, cp := range catma.Checkpoints() {
+        if cp.Height <= tip {
+            continue
+        }
+        segs = append(segs, &headerSegment{from, height, cp, make(chan []*catma.Header, 1)})
+        from, height = cp.Hash, cp.Height
+    }
+    if len(segs) == 0 {
+        return
+    }
+    log.Infof("Downloading headers from %d to %d in %d segments", tip, height, len(segs))
+    jobs := make(chan *headerSegment, len(segs))
+    for _, s := range segs {
+        jobs <- s
+    }
+    close(jobs)
+    // Closed to stop the segments not done yet
+    quit := make(chan struct{})
+    defer close(quit)
+    for i := 0; i < headersParal; i++ {
+        go func() {
+            for s := range jobs {
+                hs, err := s.downloadRetry(quit)
+                if err == errHeadersCanceled {
+                    return
+                } else if err != nil {
+                    log.Infof("Error downloading headers up to %d: %s", s.to.Height, err)
+                }
+                s.done <- hs
+            }
+        }()
+    }
+    for _, s := range segs {
+        hs := <-s.done
+        if hs == nil {
+            return
+        }
+        if err := headers.Append(hs); err != nil {
+            // The rest are downloaded again one batch at a time
+            log.Infof("Error appending headers: %s", err)
+            return
+        }
+    }
+}
+
+// Tries up to headersMaxTries times, unless "quit" is closed
+func (s *headerSegment) downloadRetry(quit chan struct{}) ([]*catma.Header, error) {
+    var err error
+    for i := 0; i < headersMaxTries; i++ {
+        select {
+        case <-quit:
+            return nil, errHeadersCanceled
+        default:
+        }
+        var hs []*catma.Header
+        if hs, err = s.download(); err == nil {
+            return hs, nil
+        }
+        log.Debugf("Error downloading headers up to %d: %s", s.to.Height, err)
+        select {
+        case <-quit:
+            return nil, errHeadersCanceled
+        case <-time.After(time.Second):
+        }
+    }
+    return nil, err
+}
+
+func (s *headerSegment) download() ([]*catma.Header, error) {
+    count := s.to.Height - s.height
+    hs := make([]*catma.Header, 0, count)
+    last := s.from
+    for len(hs) < count {
+        mg := btcmsg.NewGetHeadersMsg().(*btcmsg.Message_getheaders)
+        locator := last
+        mg.BlockLocators = []*klib.Hash256{&locator}
+        mg.HashStop = &s.to.Hash
+        // Other segments could be downloading from the same peer
+        f := func(m btcmsg.Message) (bool, bool) {
+            mh, ok := m.(*btcmsg.Message_headers)
+            ok = ok && (len(mh.Headers) == 0 || mh.Headers[0].PrevBlock == locator)
+            return ok, true
+        }
+        h := knet.Peers().Borrow()
+        ret := h.MsgForMsg(mg, f)
+        knet.Peers().Return(h)
+        if ret.Error != nil {
+            return nil, ret.Error
+        }
+        mh := ret.Message.(*btcmsg.Message_headers)
+        if len(mh.Headers) == 0 {
+            return nil, errHeadersEmpty
+        }
+        for _, ch := range mh.Headers {
+            // No honest peer sends these, get another one next time
+            if ch.PrevBlock != last {
+                h.Kick()
+                return nil, errHeadersNotLinked
+            }
+            if err := catma.CheckProofOfWork(ch); err != nil {
+                h.Kick()
+                return nil, err
+            }
+            last = *ch.Hash()
+            hs = append(hs, ch)
+            if len(hs) == count {
+                break
+            }
+        }
+    }
+    if last != s.to.Hash {
+        return nil, errHeadersCheckpoint
+    }
+    return hs, nil
+}
+
 func moreHeaders() {
     headers := storage.Get().Headers()
     l := headers.GetLocator()
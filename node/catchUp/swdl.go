@@ -229,17 +229,13 @@ func download(req map[int]*blockchain.InvElement) map[int]interface{} {
 }
 
 func saveBlock(m btcmsg.Message, i int, verify bool) {
-    db := storage.Get().OutputDB()
     bm, _ := m.(*btcmsg.Message_block)
-    for _, tx := range bm.Txs {
-        ctx := (*catma.Tx)(tx)
-        err := catma.VerifyTx(ctx, db, true, false, !verify)
-        if err != nil {
-            log.Panicf("Process tx %s error: %s", ctx.Hash(), err)
-        }
+    txs := make([]*catma.Tx, len(bm.Txs))
+    for j, tx := range bm.Txs {
+        txs[j] = (*catma.Tx)(tx)
     }
-    if err := db.Commit(uint32(i),false); err != nil {
-        log.Panicf("db commit error: %s", err)
+    if err := ConnectBlock(bm.Header, txs, i, verify); err != nil {
+        log.Panicf("Process block %d %s error: %s", i, bm.Header.Hash(), err)
     }
 }
 
@@ -0,0 +1,136 @@
+package event
+
+import (
+    "sync"
+    "sync/atomic"
+)
+
+// What to do when the channel of a subscriber is full. Publishing never waits
+// for subscribers, as events are published from where the node can't block.
+type Overflow int
+
+const (
+    // The new event is dropped
+    DropNewest Overflow = iota
+    // The oldest event in channel is dropped to make room for the new one
+    DropOldest
+    // The subscription is cancelled and its channel closed, for subscribers
+    // that can't miss any event
+    Cancel
+)
+
+// A subscriber's view of the bus
+type Subscription struct {
+    types       Type
+    overflow    Overflow
+    ch          chan Event
+    // Number of events dropped
+    dropped     uint64
+    // Serializes publishing to ch, so that DropOldest drops the oldest
+    mutex       sync.Mutex
+    bus         *Bus
+}
+
+// Events of the types subscribed, the channel is closed once the
+// subscription is cancelled
+func (s *Subscription) Events() <-chan Event {
+    return s.ch
+}
+
+// Returns the number of events dropped for the channel being full
+func (s *Subscription) Dropped() uint64 {
+    return atomic.LoadUint64(&s.dropped)
+}
+
+// Stops receiving events and closes the channel
+func (s *Subscription) Cancel() {
+    s.bus.remove(s)
+}
+
+// Returns false if the subscription is to be cancelled
+func (s *Subscription) send(e Event) bool {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    select {
+    case s.ch <- e:
+        return true
+    default:
+    }
+    atomic.AddUint64(&s.dropped, 1)
+    switch s.overflow {
+    case DropOldest:
+        select {
+        case <-s.ch:
+        default:
+        }
+        select {
+        case s.ch <- e:
+        default:
+        }
+    case Cancel:
+        return false
+    }
+    return true
+}
+
+// Dispatches events to subscribers
+type Bus struct {
+    subs        map[*Subscription]bool
+    mutex       sync.RWMutex
+}
+
+func NewBus() *Bus {
+    return &Bus{subs: make(map[*Subscription]bool)}
+}
+
+// Subscribes to events of "types", the channel holds up to "size" events
+// not received yet, more are handled as "overflow" says
+func (b *Bus) Subscribe(types Type, size int, overflow Overflow) *Subscription {
+    s := &Subscription{
+        types: types,
+        overflow: overflow,
+        ch: make(chan Event, size),
+        bus: b,
+    }
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    b.subs[s] = true
+    return s
+}
+
+func (b *Bus) remove(s *Subscription) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    if b.subs[s] {
+        delete(b.subs, s)
+        close(s.ch)
+    }
+}
+
+// Sends "e" to the subscribers of its type, never blocks
+func (b *Bus) Publish(e Event) {
+    cancelled := make([]*Subscription, 0)
+    b.mutex.RLock()
+    for s, _ := range b.subs {
+        if s.types & e.Type() != 0 && !s.send(e) {
+            cancelled = append(cancelled, s)
+        }
+    }
+    b.mutex.RUnlock()
+    for _, s := range cancelled {
+        b.remove(s)
+    }
+}
+
+// If anyone subscribes to events of "t", so that events nobody wants are
+// not built
+func (b *Bus) HasSubscribers(t Type) bool {
+    b.mutex.RLock()
+    defer b.mutex.RUnlock()
+    for s, _ := range b.subs {
+        if s.types & t != 0 {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,84 @@
+package event
+
+import (
+    "testing"
+)
+
+func tipEvent(height int) Event {
+    return &HeaderTipChanged{Height: height}
+}
+
+// Heights of the events in channel, without waiting
+func drain(s *Subscription) []int {
+    heights := make([]int, 0)
+    for {
+        select {
+        case e, ok := <-s.Events():
+            if !ok {
+                return heights
+            }
+            heights = append(heights, e.(*HeaderTipChanged).Height)
+        default:
+            return heights
+        }
+    }
+}
+
+func TestSubscribeTypes(t *testing.T) {
+    b := NewBus()
+    tips := b.Subscribe(TypeHeaderTipChanged, 10, DropNewest)
+    txs := b.Subscribe(TypeTxAcceptedToMempool | TypeTxRemovedFromMempool, 10, DropNewest)
+    if !b.HasSubscribers(TypeHeaderTipChanged) || b.HasSubscribers(TypeBlockConnected) {
+        t.Errorf("Wrong subscribers")
+    }
+    b.Publish(tipEvent(1))
+    b.Publish(&TxAcceptedToMempool{Fee: 1000})
+    if hs := drain(tips); len(hs) != 1 || hs[0] != 1 {
+        t.Errorf("Tip subscriber got %v", hs)
+    }
+    select {
+    case e := <-txs.Events():
+        if e.Type() != TypeTxAcceptedToMempool || e.(*TxAcceptedToMempool).Fee != 1000 {
+            t.Errorf("Bad tx event %+v", e)
+        }
+    default:
+        t.Errorf("Tx event not received")
+    }
+    tips.Cancel()
+    if _, ok := <-tips.Events(); ok {
+        t.Errorf("Channel not closed after cancel")
+    }
+    // Cancelling twice is fine
+    tips.Cancel()
+    b.Publish(tipEvent(2))
+    if b.HasSubscribers(TypeHeaderTipChanged) {
+        t.Errorf("Cancelled subscriber still there")
+    }
+}
+
+func TestOverflow(t *testing.T) {
+    b := NewBus()
+    newest := b.Subscribe(TypeAll, 2, DropNewest)
+    oldest := b.Subscribe(TypeAll, 2, DropOldest)
+    cancel := b.Subscribe(TypeAll, 2, Cancel)
+    for i := 1; i <= 3; i++ {
+        b.Publish(tipEvent(i))
+    }
+    if hs := drain(newest); len(hs) != 2 || hs[1] != 2 || newest.Dropped() != 1 {
+        t.Errorf("DropNewest got %v, %d dropped", hs, newest.Dropped())
+    }
+    if hs := drain(oldest); len(hs) != 2 || hs[0] != 2 || hs[1] != 3 || oldest.Dropped() != 1 {
+        t.Errorf("DropOldest got %v, %d dropped", hs, oldest.Dropped())
+    }
+    // Events before the overflow are still there
+    if hs := drain(cancel); len(hs) != 2 || hs[1] != 2 {
+        t.Errorf("Cancel got %v", hs)
+    }
+    if _, ok := <-cancel.Events(); ok {
+        t.Errorf("Subscription not cancelled on overflow")
+    }
+    b.Publish(tipEvent(4))
+    if hs := drain(newest); len(hs) != 1 || hs[0] != 4 {
+        t.Errorf("DropNewest got %v after draining", hs)
+    }
+}
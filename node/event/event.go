@@ -0,0 +1,98 @@
+// Package event publishes what happens to the node, i.e. blocks connected and
+// txs entering mempool, to subscribers over buffered channels.
+package event
+
+import (
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool"
+)
+
+// Types of events, as bits so that subscribers can ask for more than one
+type Type uint
+
+const (
+    TypeBlockConnected Type = 1 << iota
+    TypeBlockDisconnected
+    TypeTxAcceptedToMempool
+    TypeTxRemovedFromMempool
+    TypeHeaderTipChanged
+
+    TypeAll = TypeBlockConnected | TypeBlockDisconnected | TypeTxAcceptedToMempool |
+        TypeTxRemovedFromMempool | TypeHeaderTipChanged
+)
+
+func (t Type) String() string {
+    switch t {
+    case TypeBlockConnected:
+        return "BlockConnected"
+    case TypeBlockDisconnected:
+        return "BlockDisconnected"
+    case TypeTxAcceptedToMempool:
+        return "TxAcceptedToMempool"
+    case TypeTxRemovedFromMempool:
+        return "TxRemovedFromMempool"
+    case TypeHeaderTipChanged:
+        return "HeaderTipChanged"
+    }
+    return "Unknown"
+}
+
+// Events are one of the types below, switch on them or on Type()
+type Event interface {
+    Type() Type
+}
+
+// A block connected to the UTXO set
+type BlockConnected struct {
+    Height      int
+    Header      *catma.Header
+    Txs         []*catma.Tx
+}
+
+func (e *BlockConnected) Type() Type {
+    return TypeBlockConnected
+}
+
+// A block disconnected from the UTXO set in a reorg
+type BlockDisconnected struct {
+    Height      int
+    Header      *catma.Header
+}
+
+func (e *BlockDisconnected) Type() Type {
+    return TypeBlockDisconnected
+}
+
+// A tx entering mempool
+type TxAcceptedToMempool struct {
+    Tx          *catma.Tx
+    Hash        klib.Hash256
+    Fee         int64
+    VSize       int
+}
+
+func (e *TxAcceptedToMempool) Type() Type {
+    return TypeTxAcceptedToMempool
+}
+
+// A tx leaving mempool
+type TxRemovedFromMempool struct {
+    Tx          *catma.Tx
+    Hash        klib.Hash256
+    Reason      mempool.RemoveReason
+}
+
+func (e *TxRemovedFromMempool) Type() Type {
+    return TypeTxRemovedFromMempool
+}
+
+// The best header changed, blocks are usually connected shortly after
+type HeaderTipChanged struct {
+    Height      int
+    Header      *catma.Header
+}
+
+func (e *HeaderTipChanged) Type() Type {
+    return TypeHeaderTipChanged
+}
@@ -0,0 +1,37 @@
+package node
+
+import (
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+    "github.com/oxfeeefeee/kaiju/node/catchUp"
+    "github.com/oxfeeefeee/kaiju/node/event"
+)
+
+var bus = event.NewBus()
+
+// Subscribes to events of the node, of "types" OR'ed together. The channel
+// holds up to "size" events not received yet, more are handled as "overflow"
+// says, i.e. the node never waits for subscribers.
+func Subscribe(types event.Type, size int, overflow event.Overflow) *event.Subscription {
+    return bus.Subscribe(types, size, overflow)
+}
+
+// Feeds the bus with what storage, catching up and mempool tell us
+func initEvents() {
+    catchUp.OnBlock(func(height int, txs []*catma.Tx) {
+        if bus.HasSubscribers(event.TypeBlockConnected) {
+            h := storage.Get().Headers().Get(height)
+            bus.Publish(&event.BlockConnected{Height: height, Header: h, Txs: txs})
+        }
+    })
+    storage.Get().Headers().OnTip(func(tip *catma.Header, height int) {
+        bus.Publish(&event.HeaderTipChanged{Height: height, Header: tip})
+    })
+    pool.OnTxAdded(func(d *mempool.TxDesc) {
+        bus.Publish(&event.TxAcceptedToMempool{Tx: d.Tx, Hash: d.Hash, Fee: d.Fee, VSize: d.VSize})
+    })
+    pool.OnTxRemoved(func(d *mempool.TxDesc, reason mempool.RemoveReason) {
+        bus.Publish(&event.TxRemovedFromMempool{Tx: d.Tx, Hash: d.Hash, Reason: reason})
+    })
+}
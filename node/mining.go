@@ -0,0 +1,90 @@
+package node
+
+import (
+    "time"
+    "errors"
+    "sync/atomic"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/mining"
+    "github.com/oxfeeefeee/kaiju/knet"
+    "github.com/oxfeeefeee/kaiju/knet/peer"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+)
+
+var (
+    errNotSynced = errors.New("GetBlockTemplate: node is downloading blocks")
+
+    errNoPeers = errors.New("GetBlockTemplate: node is not connected")
+
+    errNoSegwit = errors.New("GetBlockTemplate: client must support the segwit rule")
+
+    errBadMode = errors.New("GetBlockTemplate: invalid mode")
+)
+
+// Set once the node has caught up with the network
+var synced int32
+
+func isSynced() bool {
+    return atomic.LoadInt32(&synced) != 0
+}
+
+// getblocktemplate (BIP22), also checks block proposals (BIP23).
+// Returns a *mining.TemplateResult for templates, and for proposals nil if
+// the block is valid, or a string of the reason it's not.
+func GetBlockTemplate(req *mining.TemplateRequest) (interface{}, error) {
+    switch req.Mode {
+    case "", "template":
+    case "proposal":
+        return checkProposal(req.Data)
+    default:
+        return nil, errBadMode
+    }
+    if !isSynced() {
+        return nil, errNotSynced
+    }
+    if len(knet.Peers().Handles()) == 0 {
+        return nil, errNoPeers
+    }
+    if !req.HasRule("segwit") {
+        return nil, errNoSegwit
+    }
+    // Clients build their own coin base, ours is only for verifying the template
+    payTo := []byte{byte(script.OP_1)}
+    t, err := mining.NewTemplate(chainView{}, pool, payTo, time.Now())
+    if err != nil {
+        log.Errorf("Bad block template: %s", err)
+        return nil, err
+    }
+    return t.Result(), nil
+}
+
+func checkProposal(data string) (interface{}, error) {
+    h, txs, err := mining.DecodeBlock(data)
+    if err != nil {
+        return nil, err
+    }
+    if _, ok := storage.Get().Headers().Height(h.Hash()); ok {
+        return "duplicate", nil
+    }
+    if err := mining.VerifyBlock(h, txs, chainView{}, time.Now()); err != nil {
+        return err.Error(), nil
+    }
+    return nil, nil
+}
+
+// submitblock (BIP22), the block has to extend the chain tip.
+// Returns nil if the block is accepted, or a string of the reason it's not.
+func SubmitBlock(data string) (interface{}, error) {
+    h, txs, err := mining.DecodeBlock(data)
+    if err != nil {
+        return nil, err
+    }
+    reason, err := acceptBlock(h, txs, peer.InvalidHandle)
+    if err != nil {
+        return nil, err
+    } else if reason != "" {
+        return reason, nil
+    }
+    return nil, nil
+}
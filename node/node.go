@@ -4,15 +4,116 @@
 package node 
 
 import (
+    "os"
+    "io/ioutil"
+    "sync/atomic"
+    "path/filepath"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/mempool"
     "github.com/oxfeeefeee/kaiju/blockchain"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
     "github.com/oxfeeefeee/kaiju/node/catchUp"
 )
 
+var policy *catma.Policy
+
+var pool *mempool.Pool
+
+var estimator *mempool.FeeEstimator
+
+var blocks *blockRelay
+
+var follower *tipFollower
+
+// The chain of the node, as seen by mempool
+type chainView struct{}
+
+func (c chainView) Headers() catma.HeaderChain {
+    return storage.Get().Headers()
+}
+
+func (c chainView) Utxo() catma.UtxoSet {
+    return storage.Get().OutputDB()
+}
+
+func (c chainView) Height() int {
+    return storage.Get().OutputDB().Height()
+}
+
 func Init() error {
-    return blockchain.Init()
+    catma.SetScriptWorkers(kaiju.GetConfig().ScriptWorkers)
+    script.SetSigCacheSize(kaiju.GetConfig().SigCacheSize)
+    p, err := catma.ParsePolicy(kaiju.GetConfig().Policy)
+    if err != nil {
+        log.Errorf("Bad relay policy in config: %s", err)
+        return err
+    }
+    policy = p
+    if err := blockchain.Init(); err != nil {
+        return err
+    }
+    pool = mempool.New(chainView{}, policy, kaiju.GetConfig().MempoolMaxSize)
+    estimator = mempool.NewFeeEstimator()
+    loadFeeEstimates()
+    pool.SetEstimator(estimator)
+    blocks = newBlockRelay(pool)
+    catchUp.OnBlock(func(height int, txs []*catma.Tx) {
+        pool.RemoveBlock(txs)
+    })
+    initEvents()
+    return nil
+}
+
+// The relay policy of the node, from config
+func Policy() *catma.Policy {
+    return policy
+}
+
+// Unconfirmed txs of the node
+func Mempool() *mempool.Pool {
+    return pool
+}
+
+// Fee estimates learned from txs in mempool getting confirmed
+func FeeEstimator() *mempool.FeeEstimator {
+    return estimator
+}
+
+func feeEstimatesPath() string {
+    cfg := kaiju.GetConfig()
+    return filepath.Join(kaiju.ConfigFileDir(), cfg.DataDir, cfg.FeeEstimatesFileName)
+}
+
+// Estimates saved by the last run, starts from scratch if anything goes wrong
+func loadFeeEstimates() {
+    data, err := ioutil.ReadFile(feeEstimatesPath())
+    if os.IsNotExist(err) {
+        return
+    } else if err != nil {
+        log.Infof("Failed to read fee estimates: %s", err)
+        return
+    }
+    if err := estimator.FromBytes(data); err != nil {
+        log.Infof("Failed to load fee estimates: %s", err)
+    }
+}
+
+func saveFeeEstimates() error {
+    return ioutil.WriteFile(feeEstimatesPath(), estimator.Bytes(), os.ModePerm)
 }
 
+// Closes the block storage, blocks being connected are waited for and no
+// more are connected after it.
 func Destroy() error {
+    blockMutex.Lock()
+    if estimator != nil {
+        if err := saveFeeEstimates(); err != nil {
+            log.Errorf("Failed to save fee estimates: %s", err)
+        }
+    }
     return blockchain.Destroy()
 }
 
@@ -20,6 +121,8 @@ func Start() {
     go func() {
         // First make sure our blockchain is up to date
         catchUp.CatchUp()
+        setChainTip(storage.Get().Headers().Get(chainView{}.Height()).Hash())
+        atomic.StoreInt32(&synced, 1)
         // Then run node
         runNode()
     }()
@@ -0,0 +1,49 @@
+package node
+
+import (
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/knet/peer"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+)
+
+// If the node has caught up with the network
+func Synced() bool {
+    return isSynced()
+}
+
+// Hash and height of the last block connected
+func BestBlock() (klib.Hash256, int) {
+    height := chainView{}.Height()
+    if isSynced() {
+        return chainTip(), height
+    }
+    // Connected by catching up, which doesn't track the tip
+    return *storage.Get().Headers().Get(height).Hash(), height
+}
+
+// Validates tx and adds it to mempool, then announces it to peers.
+// Tx paying more than "maxFeeRate" satoshis per 1000 vbytes is rejected,
+// 0 means no limit.
+func SendTx(tx *catma.Tx, maxFeeRate int64) (*mempool.TxDesc, error) {
+    d, err := pool.AcceptTxMaxFee(tx, maxFeeRate)
+    if err != nil {
+        return nil, err
+    }
+    announceTx(&d.Hash, peer.InvalidHandle)
+    return d, nil
+}
+
+// Looks for tx in mempool and then in recent blocks, blocks are not kept
+// otherwise. Returns the header of the block containing tx, nil if tx is
+// in mempool, or nil tx if it's not found.
+func FindTx(hash *klib.Hash256) (*catma.Tx, *catma.Header) {
+    if d := pool.Get(hash); d != nil {
+        return d.Tx, nil
+    }
+    if blocks == nil {
+        return nil, nil
+    }
+    return blocks.findTx(hash)
+}
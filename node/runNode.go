@@ -1,5 +1,17 @@
 package node 
 
+import (
+    "github.com/oxfeeefeee/kaiju/knet"
+)
+
 func runNode() {
-    
+    follower = newTipFollower()
+    knet.AddMonitor(newTxRelay(pool))
+    knet.AddMonitor(blocks)
+    knet.AddMonitor(follower)
+    // Peers connected during catching up were not greeted by the monitors
+    for _, h := range knet.Peers().Handles() {
+        greet(h)
+        askHeaders(h)
+    }
 }
\ No newline at end of file
@@ -0,0 +1,302 @@
+package node
+
+import (
+    "sync"
+    "time"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/blockchain"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+    "github.com/oxfeeefeee/kaiju/knet"
+    "github.com/oxfeeefeee/kaiju/knet/peer"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+// Max number of headers in a "headers" message, more are to be asked for
+// if a peer sends this many
+const maxHeadersPerMsg = 2000
+
+// Most blocks requested at the same time
+const maxBlocksInFlight = 16
+
+// A block not received in time can be requested again, maybe from another peer
+const blockRequestTimeout = time.Second * 30
+
+// Most blocks kept waiting for their parents
+const maxOrphans = 100
+
+// Verifies and connects a block, replaced by tests
+var accept = acceptBlock
+
+// A block requested with "getdata"
+type blockRequest struct {
+    from        peer.Handle
+    time        time.Time
+}
+
+// A block received before its parent is connected
+type orphanBlock struct {
+    header      *catma.Header
+    txs         []*catma.Tx
+    from        peer.Handle
+}
+
+// Keeps the node at the chain tip once caught up: learns new headers from
+// "headers" and "inv" announcements, downloads the blocks of the best header
+// chain and connects them, holding the ones arriving before their parents.
+type tipFollower struct {
+    requested   map[klib.Hash256]*blockRequest
+    orphans     map[klib.Hash256]*orphanBlock
+    // Hashes of orphans by their parents
+    children    map[klib.Hash256][]klib.Hash256
+    // Blocks whose compact blocks turned out useless, asked for in full
+    fullOnly    map[klib.Hash256]bool
+    mutex       sync.Mutex
+}
+
+func newTipFollower() *tipFollower {
+    f := &tipFollower{
+        requested: make(map[klib.Hash256]*blockRequest),
+        orphans: make(map[klib.Hash256]*orphanBlock),
+        children: make(map[klib.Hash256][]klib.Hash256),
+        fullOnly: make(map[klib.Hash256]bool),
+    }
+    storage.Get().Headers().OnReorg(f.onReorg)
+    return f
+}
+
+// Member of peer.Monitor interface
+func (f *tipFollower) ListenTypes() []string {
+    return []string{"headers"}
+}
+
+// Member of peer.Monitor interface
+func (f *tipFollower) OnPeerUp(p *peer.Peer) {
+    // Blocks could have been found while the peer was connecting
+    askHeaders(p.Handle())
+}
+
+// Member of peer.Monitor interface
+func (f *tipFollower) OnPeerDown(p *peer.Peer) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    h := p.Handle()
+    for k, r := range f.requested {
+        if r.from == h {
+            delete(f.requested, k)
+        }
+    }
+}
+
+// Member of peer.Monitor interface
+func (f *tipFollower) OnPeerMsg(h peer.Handle, msg btcmsg.Message) {
+    if m, ok := msg.(*btcmsg.Message_headers); ok {
+        f.onHeaders(h, m)
+    }
+}
+
+// Sends "getheaders" from our best header to the peer
+func askHeaders(h peer.Handle) {
+    mg := btcmsg.NewGetHeadersMsg().(*btcmsg.Message_getheaders)
+    mg.BlockLocators = storage.Get().Headers().GetLocator()
+    mg.HashStop = new(klib.Hash256)
+    h.SendMsg(mg, 0)
+}
+
+// New headers announced (BIP130), or in response to "getheaders"
+func (f *tipFollower) onHeaders(h peer.Handle, m *btcmsg.Message_headers) {
+    if len(m.Headers) == 0 {
+        return
+    }
+    headers := storage.Get().Headers()
+    if err := headers.Append(m.Headers); err != nil {
+        if _, ok := headers.Height(&m.Headers[0].PrevBlock); ok || err == storage.ErrInvalidChain {
+            log.Infof("Invalid headers from peer: %s", err)
+            h.Kick()
+        } else {
+            // Missed some, or they are of a branch we don't know of
+            askHeaders(h)
+        }
+        return
+    }
+    if len(m.Headers) == maxHeadersPerMsg {
+        askHeaders(h)
+    }
+    f.fetch(h)
+}
+
+// A block announced with "inv", passed on by the tx relay
+func (f *tipFollower) onInv(h peer.Handle, e *blockchain.InvElement) {
+    if _, ok := storage.Get().Headers().Height(&e.Hash); !ok {
+        askHeaders(h)
+    } else {
+        f.fetch(h)
+    }
+}
+
+// Connects the orphans it can, then requests from peer "h" the blocks of the
+// best header chain that are not connected yet, the next few of them
+func (f *tipFollower) fetch(h peer.Handle) {
+    f.connectOrphans()
+    headers := storage.Get().Headers()
+    top := chainView{}.Height()
+    end := headers.Len() - 1
+    if end > top + maxBlocksInFlight {
+        end = top + maxBlocksInFlight
+    }
+    hashes := make([]klib.Hash256, 0, end - top)
+    for height := top + 1; height <= end; height++ {
+        hashes = append(hashes, *headers.Get(height).Hash())
+    }
+    want := f.wantBlocks(h, hashes, blocks.isCmpctPeer(h), time.Now())
+    if len(want) > 0 {
+        getData := btcmsg.NewGetDataMsg().(*btcmsg.Message_getdata)
+        getData.Inventory = want
+        h.SendMsg(getData, 0)
+    }
+}
+
+// Returns what to ask peer "h" for of the blocks after the chain tip with
+// "hashes", the ones not requested yet or timed out. "cmpct" tells if the
+// peer sends compact blocks.
+func (f *tipFollower) wantBlocks(h peer.Handle, hashes []klib.Hash256, cmpct bool, now time.Time) []*blockchain.InvElement {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    want := make([]*blockchain.InvElement, 0)
+    for _, hash := range hashes {
+        if _, ok := f.orphans[hash]; ok {
+            continue
+        }
+        if r, ok := f.requested[hash]; ok && now.Sub(r.time) < blockRequestTimeout {
+            continue
+        }
+        f.requested[hash] = &blockRequest{h, now}
+        want = append(want, &blockchain.InvElement{InvType: blockchain.InvTypeWitnessBlock, Hash: hash})
+    }
+    if len(want) == 1 && len(hashes) == 1 && cmpct && !f.fullOnly[hashes[0]] {
+        // Only the new tip, which we most likely have the txs of
+        want[0].InvType = blockchain.InvTypeCmpctBlock
+    }
+    return want
+}
+
+// Asks peer "h" for the full block after its compact block turned out
+// useless, it's never asked for as a compact block again
+func (f *tipFollower) requestFull(h peer.Handle, hash *klib.Hash256) {
+    f.mutex.Lock()
+    f.fullOnly[*hash] = true
+    f.requested[*hash] = &blockRequest{h, time.Now()}
+    f.mutex.Unlock()
+    requestBlock(h, hash)
+}
+
+// Connects a downloaded block and the orphans waiting for it, blocks with
+// parents not connected yet are kept as orphans.
+// Returns if the block is connected, and the reason it's rejected as invalid,
+// "" if it's not.
+func (f *tipFollower) process(h peer.Handle, header *catma.Header, txs []*catma.Tx) (bool, string) {
+    hash := *header.Hash()
+    f.mutex.Lock()
+    delete(f.requested, hash)
+    f.mutex.Unlock()
+    reason, err := accept(header, txs, h)
+    switch {
+    case err != nil:
+        log.Errorf("Failed to accept block %s: %s", &hash, err)
+        return false, ""
+    case reason == "bad-prevblk" || reason == "inconclusive":
+        f.addOrphan(&orphanBlock{header, txs, h})
+        if reason == "bad-prevblk" {
+            askHeaders(h)
+        }
+        return false, ""
+    case reason == "duplicate":
+        return false, ""
+    case reason != "":
+        log.Debugf("Block %s rejected: %s", &hash, reason)
+        return false, reason
+    }
+    f.mutex.Lock()
+    delete(f.fullOnly, hash)
+    f.mutex.Unlock()
+    f.fetch(h)
+    return true, ""
+}
+
+// Connects the orphans on top of the chain tip
+func (f *tipFollower) connectOrphans() {
+    for {
+        tip := chainTip()
+        o := f.popOrphan(&tip)
+        if o == nil {
+            return
+        }
+        if reason, err := accept(o.header, o.txs, o.from); err != nil || reason != "" {
+            log.Debugf("Orphan block %s rejected: %s %v", o.header.Hash(), reason, err)
+        }
+    }
+}
+
+func (f *tipFollower) addOrphan(o *orphanBlock) {
+    hash := *o.header.Hash()
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    if _, ok := f.orphans[hash]; ok {
+        return
+    }
+    if len(f.orphans) >= maxOrphans {
+        // Evicts a random one, map iteration order is random
+        for k, _ := range f.orphans {
+            f.removeOrphan(&k)
+            break
+        }
+    }
+    f.orphans[hash] = o
+    prev := o.header.PrevBlock
+    f.children[prev] = append(f.children[prev], hash)
+}
+
+// Removes and returns an orphan with parent "prev", or nil if there is none
+func (f *tipFollower) popOrphan(prev *klib.Hash256) *orphanBlock {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    for _, hash := range f.children[*prev] {
+        if o, ok := f.orphans[hash]; ok {
+            f.removeOrphan(&hash)
+            return o
+        }
+    }
+    return nil
+}
+
+func (f *tipFollower) removeOrphan(hash *klib.Hash256) {
+    o := f.orphans[*hash]
+    delete(f.orphans, *hash)
+    prev := o.header.PrevBlock
+    siblings := f.children[prev]
+    for i, s := range siblings {
+        if s == *hash {
+            siblings = append(siblings[:i], siblings[i+1:]...)
+            break
+        }
+    }
+    if len(siblings) == 0 {
+        delete(f.children, prev)
+    } else {
+        f.children[prev] = siblings
+    }
+}
+
+// The best header chain switched to another branch, blocks of the old one
+// are disconnected before blocks of the new one get downloaded. Called with
+// headers being appended or invalidated, which could be by acceptBlock holding
+// blockMutex.
+func (f *tipFollower) onReorg(r *storage.Reorg) {
+    go func() {
+        disconnectBlocks(storage.Get().OutputDB(), r)
+        if hs := knet.Peers().Handles(); len(hs) > 0 {
+            f.fetch(hs[0])
+        }
+    }()
+}
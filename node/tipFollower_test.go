@@ -0,0 +1,123 @@
+package node
+
+import (
+    "time"
+    "testing"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/blockchain"
+    "github.com/oxfeeefeee/kaiju/knet/peer"
+)
+
+// A tip follower not watching the header chain
+func testFollower() *tipFollower {
+    return &tipFollower{
+        requested: make(map[klib.Hash256]*blockRequest),
+        orphans: make(map[klib.Hash256]*orphanBlock),
+        children: make(map[klib.Hash256][]klib.Hash256),
+        fullOnly: make(map[klib.Hash256]bool),
+    }
+}
+
+// Replaces acceptBlock with one connecting blocks on top of the tip, and
+// rejecting the ones in "invalid". Returns the blocks connected.
+func fakeAccept(invalid map[klib.Hash256]bool) (*[]klib.Hash256, func()) {
+    connected := make([]klib.Hash256, 0)
+    a := accept
+    accept = func(h *catma.Header, txs []*catma.Tx, from peer.Handle) (string, error) {
+        hash := h.Hash()
+        if invalid[*hash] {
+            return "bad-txns", nil
+        } else if !extendsTip(h) {
+            return "inconclusive", nil
+        }
+        setChainTip(hash)
+        connected = append(connected, *hash)
+        return "", nil
+    }
+    return &connected, func() { accept = a }
+}
+
+func TestWantBlocks(t *testing.T) {
+    f := testFollower()
+    h := peer.Handle(1)
+    tip := []klib.Hash256{klib.Hash256{1}}
+    now := time.Now()
+    check := func(want []*blockchain.InvElement, n int, invType uint32) {
+        if len(want) != n {
+            t.Fatalf("%d blocks wanted instead of %d", len(want), n)
+        }
+        for _, e := range want {
+            if e.InvType != invType {
+                t.Errorf("Block wanted as %d instead of %d", e.InvType, invType)
+            }
+        }
+    }
+    // The new tip alone is asked for as a compact block
+    check(f.wantBlocks(h, tip, true, now), 1, blockchain.InvTypeCmpctBlock)
+    check(f.wantBlocks(h, tip, true, now), 0, 0)
+    check(f.wantBlocks(h, tip, false, now.Add(blockRequestTimeout)), 1, blockchain.InvTypeWitnessBlock)
+
+    // Its compact block rebuilt into an invalid block, the full block is
+    // asked for from then on
+    f.fullOnly[tip[0]] = true
+    later := now.Add(blockRequestTimeout * 2)
+    check(f.wantBlocks(h, tip, true, later), 1, blockchain.InvTypeWitnessBlock)
+    check(f.wantBlocks(h, tip, true, later.Add(blockRequestTimeout)), 1, blockchain.InvTypeWitnessBlock)
+
+    // More than the tip, orphans are not asked for again
+    more := []klib.Hash256{klib.Hash256{2}, klib.Hash256{3}, klib.Hash256{4}}
+    f.orphans[more[1]] = &orphanBlock{}
+    check(f.wantBlocks(h, more, true, now), 2, blockchain.InvTypeWitnessBlock)
+    check(f.wantBlocks(h, more[:1], true, now.Add(blockRequestTimeout)), 1, blockchain.InvTypeCmpctBlock)
+}
+
+func TestConnectOrphans(t *testing.T) {
+    f := testFollower()
+    tip := &catma.Header{Nonce: 1}
+    a := &catma.Header{PrevBlock: *tip.Hash()}
+    b := &catma.Header{PrevBlock: *a.Hash()}
+    c := &catma.Header{PrevBlock: *b.Hash()}
+    bad := &catma.Header{PrevBlock: *tip.Hash(), Nonce: 1}
+    // Its parent is invalid
+    other := &catma.Header{PrevBlock: *bad.Hash()}
+    connected, done := fakeAccept(map[klib.Hash256]bool{*bad.Hash(): true})
+    defer done()
+    setChainTip(tip.Hash())
+    for _, h := range []*catma.Header{c, b, bad, other} {
+        f.addOrphan(&orphanBlock{h, nil, peer.InvalidHandle})
+    }
+    // The invalid one is tried and dropped
+    f.connectOrphans()
+    if len(*connected) != 0 || len(f.orphans) != 3 || f.orphans[*bad.Hash()] != nil {
+        t.Fatalf("%d orphans connected, %d left", len(*connected), len(f.orphans))
+    }
+    f.addOrphan(&orphanBlock{a, nil, peer.InvalidHandle})
+    f.connectOrphans()
+    if len(*connected) != 3 || (*connected)[1] != *b.Hash() || (*connected)[2] != *c.Hash() {
+        t.Errorf("Orphans connected: %v", *connected)
+    }
+    if len(f.orphans) != 1 || f.orphans[*other.Hash()] == nil || len(f.children) != 1 {
+        t.Errorf("%d orphans left", len(f.orphans))
+    }
+}
+
+func TestProcessInvalid(t *testing.T) {
+    f := testFollower()
+    tip := &catma.Header{Nonce: 2}
+    bad := &catma.Header{PrevBlock: *tip.Hash()}
+    hash := *bad.Hash()
+    connected, done := fakeAccept(map[klib.Hash256]bool{hash: true})
+    defer done()
+    setChainTip(tip.Hash())
+    f.requested[hash] = &blockRequest{peer.InvalidHandle, time.Now()}
+    f.fullOnly[hash] = true
+    ok, reason := f.process(peer.InvalidHandle, bad, nil)
+    if ok || reason != "bad-txns" || len(*connected) != 0 || chainTip() != *tip.Hash() {
+        t.Errorf("Invalid block processed: %v %s", ok, reason)
+    }
+    // Not asked for again, nor kept as an orphan
+    if _, ok := f.requested[hash]; ok || len(f.orphans) != 0 {
+        t.Errorf("Invalid block still wanted")
+    }
+}
@@ -0,0 +1,137 @@
+package node
+
+import (
+    "sync"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/blockchain"
+    "github.com/oxfeeefeee/kaiju/knet"
+    "github.com/oxfeeefeee/kaiju/knet/peer"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+// Gets txs announced by peers into mempool, and announces the accepted ones
+// to other peers.
+type txRelay struct {
+    pool        *mempool.Pool
+    // Txs rejected recently, so they are not requested again
+    rejected    map[klib.Hash256]bool
+    mutex       sync.Mutex
+}
+
+func newTxRelay(pool *mempool.Pool) *txRelay {
+    return &txRelay{
+        pool: pool,
+        rejected: make(map[klib.Hash256]bool),
+    }
+}
+
+// Member of peer.Monitor interface
+func (r *txRelay) ListenTypes() []string {
+    return []string{"inv", "tx", "getdata"}
+}
+
+// Member of peer.Monitor interface
+func (r *txRelay) OnPeerUp(p *peer.Peer) {
+}
+
+// Member of peer.Monitor interface
+func (r *txRelay) OnPeerDown(p *peer.Peer) {
+}
+
+// Member of peer.Monitor interface
+func (r *txRelay) OnPeerMsg(h peer.Handle, msg btcmsg.Message) {
+    switch m := msg.(type) {
+    case *btcmsg.Message_inv:
+        r.onInv(h, m)
+    case *btcmsg.Message_tx:
+        r.onTx(h, (*catma.Tx)(&m.Content))
+    case *btcmsg.Message_getdata:
+        r.onGetData(h, m)
+    }
+}
+
+// Asks for the announced txs we don't have
+func (r *txRelay) onInv(h peer.Handle, m *btcmsg.Message_inv) {
+    want := make([]*blockchain.InvElement, 0)
+    for _, e := range m.Inventory {
+        if e.InvType &^ blockchain.InvTypeWitnessFlag == blockchain.InvTypeBlock {
+            follower.onInv(h, e)
+            continue
+        } else if e.InvType &^ blockchain.InvTypeWitnessFlag != blockchain.InvTypeTx {
+            continue
+        }
+        if r.pool.Has(&e.Hash) || r.isRejected(&e.Hash) {
+            continue
+        }
+        want = append(want, &blockchain.InvElement{InvType: blockchain.InvTypeWitnessTx, Hash: e.Hash})
+    }
+    if len(want) > 0 {
+        getData := btcmsg.NewGetDataMsg().(*btcmsg.Message_getdata)
+        getData.Inventory = want
+        h.SendMsg(getData, 0)
+    }
+}
+
+func (r *txRelay) onTx(h peer.Handle, tx *catma.Tx) {
+    d, err := r.pool.AcceptTx(tx)
+    if err == mempool.ErrMissingInputs {
+        return
+    } else if err != nil {
+        log.Debugf("Tx %s rejected: %s", tx.Hash(), err)
+        r.reject(tx.Hash())
+        return
+    }
+    log.Debugf("Tx %s accepted, fee %d, pool size %d", &d.Hash, d.Fee, r.pool.Count())
+    announceTx(&d.Hash, h)
+}
+
+// Sends "inv" of a tx to all peers except "from"
+func announceTx(hash *klib.Hash256, from peer.Handle) {
+    inv := btcmsg.NewInvMsg().(*btcmsg.Message_inv)
+    inv.Inventory = []*blockchain.InvElement{&blockchain.InvElement{InvType: blockchain.InvTypeTx, Hash: *hash}}
+    for _, other := range knet.Peers().Handles() {
+        if other != from {
+            other.SendMsg(inv, 0)
+        }
+    }
+}
+
+// Sends the requested txs in pool, blocks are left to the block relay
+func (r *txRelay) onGetData(h peer.Handle, m *btcmsg.Message_getdata) {
+    for _, e := range m.Inventory {
+        if e.InvType &^ blockchain.InvTypeWitnessFlag != blockchain.InvTypeTx {
+            blocks.onGetData(h, e)
+            continue
+        }
+        if d := r.pool.Get(&e.Hash); d != nil {
+            tx := d.Tx
+            // Witness only to those asking for it (BIP144)
+            if e.InvType & blockchain.InvTypeWitnessFlag == 0 {
+                tx = tx.StripWitness()
+            }
+            txMsg := btcmsg.NewTxMsg().(*btcmsg.Message_tx)
+            txMsg.Content = btcmsg.Tx(*tx)
+            h.SendMsg(txMsg, 0)
+        }
+    }
+}
+
+func (r *txRelay) isRejected(hash *klib.Hash256) bool {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    return r.rejected[*hash]
+}
+
+func (r *txRelay) reject(hash *klib.Hash256) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    // Forgets all of them once in a while, a rejected tx might become valid
+    if len(r.rejected) >= kaiju.MaxInvListSize {
+        r.rejected = make(map[klib.Hash256]bool)
+    }
+    r.rejected[*hash] = true
+}
@@ -0,0 +1,147 @@
+package rpc
+
+import (
+    "fmt"
+    "bytes"
+    "encoding/hex"
+    "encoding/binary"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/node"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+)
+
+type blockchainInfo struct {
+    Chain               string      `json:"chain"`
+    Blocks              int         `json:"blocks"`
+    Headers             int         `json:"headers"`
+    BestBlockHash       string      `json:"bestblockhash"`
+    Difficulty          float64     `json:"difficulty"`
+    Time                uint32      `json:"time"`
+    MedianTime          uint32      `json:"mediantime"`
+    VerificationProgress float64    `json:"verificationprogress"`
+    InitialBlockDownload bool       `json:"initialblockdownload"`
+    ChainWork           string      `json:"chainwork"`
+    Pruned              bool        `json:"pruned"`
+    PruneHeight         int         `json:"pruneheight"`
+    Warnings            string      `json:"warnings"`
+}
+
+type blockHeader struct {
+    Hash                string      `json:"hash"`
+    Confirmations       int         `json:"confirmations"`
+    Height              int         `json:"height"`
+    Version             uint32      `json:"version"`
+    VersionHex          string      `json:"versionHex"`
+    MerkleRoot          string      `json:"merkleroot"`
+    Time                uint32      `json:"time"`
+    MedianTime          uint32      `json:"mediantime"`
+    Nonce               uint32      `json:"nonce"`
+    Bits                string      `json:"bits"`
+    Difficulty          float64     `json:"difficulty"`
+    ChainWork           string      `json:"chainwork"`
+    PreviousBlockHash   string      `json:"previousblockhash,omitempty"`
+    NextBlockHash       string      `json:"nextblockhash,omitempty"`
+}
+
+// Difficulty as a multiple of the minimum, the way bitcoind computes it
+func difficulty(bits uint32) float64 {
+    shift := (bits >> 24) & 0xff
+    diff := float64(0x0000ffff) / float64(bits & 0x00ffffff)
+    for ; shift < 29; shift++ {
+        diff *= 256
+    }
+    for ; shift > 29; shift-- {
+        diff /= 256
+    }
+    return diff
+}
+
+func chainWork(height int) string {
+    return fmt.Sprintf("%064x", storage.Get().Headers().Work(height))
+}
+
+func getBlockchainInfo(p params) (interface{}, error) {
+    headers := storage.Get().Headers()
+    hash, height := node.BestBlock()
+    h := headers.Get(height)
+    top := headers.Len() - 1
+    // Blocks are not counted by txs as bitcoind does, close enough
+    progress := 1.0
+    if height < top {
+        progress = float64(height) / float64(top)
+    }
+    return &blockchainInfo{
+        Chain: "main",
+        Blocks: height,
+        Headers: top,
+        BestBlockHash: hash.String(),
+        Difficulty: difficulty(h.Bits),
+        Time: h.Timestamp,
+        MedianTime: catma.MedianTimePast(headers, height + 1),
+        VerificationProgress: progress,
+        InitialBlockDownload: !node.Synced(),
+        ChainWork: chainWork(height),
+        // Blocks are not kept once connected, but a few recent ones
+        Pruned: true,
+        PruneHeight: height + 1,
+        Warnings: "",
+    }, nil
+}
+
+func getBlockHash(p params) (interface{}, error) {
+    var height int
+    if err := p.get(0, &height); err != nil {
+        return nil, err
+    }
+    if _, top := node.BestBlock(); height < 0 || height > top {
+        return nil, newError(codeInvalidParameter, "Block height out of range")
+    }
+    return storage.Get().Headers().Get(height).Hash().String(), nil
+}
+
+func getBlockHeader(p params) (interface{}, error) {
+    hash, err := p.hash(0, "blockhash")
+    if err != nil {
+        return nil, err
+    }
+    verbose, err := p.flag(1, true)
+    if err != nil {
+        return nil, err
+    }
+    headers := storage.Get().Headers()
+    height, ok := headers.Height(hash)
+    if !ok {
+        return nil, newError(codeNotFound, "Block not found")
+    }
+    h := headers.Get(height)
+    if !verbose {
+        buf := new(bytes.Buffer)
+        binary.Write(buf, binary.LittleEndian, h)
+        return hex.EncodeToString(buf.Bytes()), nil
+    }
+    _, top := node.BestBlock()
+    r := &blockHeader{
+        Hash: hash.String(),
+        Confirmations: -1,
+        Height: height,
+        Version: h.Version,
+        VersionHex: fmt.Sprintf("%08x", h.Version),
+        MerkleRoot: h.MerkleRoot.String(),
+        Time: h.Timestamp,
+        MedianTime: catma.MedianTimePast(headers, height + 1),
+        Nonce: h.Nonce,
+        Bits: fmt.Sprintf("%08x", h.Bits),
+        Difficulty: difficulty(h.Bits),
+        ChainWork: chainWork(height),
+    }
+    if height <= top {
+        r.Confirmations = top - height + 1
+    }
+    if height > 0 {
+        r.PreviousBlockHash = h.PrevBlock.String()
+    }
+    if height < top {
+        r.NextBlockHash = headers.Get(height + 1).Hash().String()
+    }
+    return r, nil
+}
@@ -0,0 +1,146 @@
+package rpc
+
+import (
+    "fmt"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/mining"
+    "github.com/oxfeeefeee/kaiju/node"
+    "github.com/oxfeeefeee/kaiju/knet"
+)
+
+type mempoolInfo struct {
+    Loaded          bool        `json:"loaded"`
+    Size            int         `json:"size"`
+    Bytes           int         `json:"bytes"`
+    MaxMempool      int         `json:"maxmempool"`
+    MempoolMinFee   amount      `json:"mempoolminfee"`
+    MinRelayTxFee   amount      `json:"minrelaytxfee"`
+}
+
+type peerInfo struct {
+    ID              uint64      `json:"id"`
+    Addr            string      `json:"addr"`
+    Services        string      `json:"services"`
+    ConnTime        int64       `json:"conntime"`
+    Version         uint32      `json:"version"`
+    SubVer          string      `json:"subver"`
+    Inbound         bool        `json:"inbound"`
+    StartingHeight  int32       `json:"startingheight"`
+}
+
+type feeEstimate struct {
+    FeeRate         *amount     `json:"feerate,omitempty"`
+    Errors          []string    `json:"errors,omitempty"`
+    Blocks          int         `json:"blocks"`
+}
+
+// Confidences of the estimate modes
+var estimateConfidence = map[string]float64{
+    "unset": 0.95,
+    "conservative": 0.95,
+    "economical": 0.85,
+}
+
+func getMempoolInfo(p params) (interface{}, error) {
+    pool := node.Mempool()
+    minFee := amount(node.Policy().MinRelayFee)
+    poolMinFee := minFee
+    if r := amount(pool.MinFeeRate()); r > poolMinFee {
+        poolMinFee = r
+    }
+    return &mempoolInfo{
+        Loaded: true,
+        Size: pool.Count(),
+        Bytes: pool.Size(),
+        MaxMempool: kaiju.GetConfig().MempoolMaxSize,
+        MempoolMinFee: poolMinFee,
+        MinRelayTxFee: minFee,
+    }, nil
+}
+
+func getPeerInfo(p params) (interface{}, error) {
+    infos := make([]*peerInfo, 0)
+    for _, h := range knet.Peers().Handles() {
+        s := h.Status()
+        if s == nil {
+            // Gone already
+            continue
+        }
+        infos = append(infos, &peerInfo{
+            ID: uint64(h),
+            Addr: s.Addr,
+            Services: fmt.Sprintf("%016x", s.Services),
+            ConnTime: s.Since.Unix(),
+            Version: s.Version,
+            SubVer: s.UserAgent,
+            Inbound: !s.Outgoing,
+            StartingHeight: s.StartHeight,
+        })
+    }
+    return infos, nil
+}
+
+func estimateSmartFee(p params) (interface{}, error) {
+    var target int
+    if err := p.get(0, &target); err != nil {
+        return nil, err
+    }
+    mode := "conservative"
+    if err := p.opt(1, &mode); err != nil {
+        return nil, err
+    }
+    confidence, ok := estimateConfidence[mode]
+    if !ok {
+        return nil, newError(codeInvalidParameter, "Invalid estimate_mode parameter")
+    }
+    if target < 1 {
+        return nil, newError(codeInvalidParameter, "Invalid conf_target")
+    } else if target > mempool.MaxEstimateTarget {
+        target = mempool.MaxEstimateTarget
+    }
+    r := &feeEstimate{Blocks: target}
+    rate, err := node.FeeEstimator().EstimateFee(target, confidence)
+    if err != nil {
+        r.Errors = []string{"Insufficient data or no feerate found"}
+    } else {
+        // Both are per 1000 virtual bytes
+        a := amount(rate)
+        r.FeeRate = &a
+    }
+    return r, nil
+}
+
+func getBlockTemplate(p params) (interface{}, error) {
+    req := new(mining.TemplateRequest)
+    if err := p.opt(0, req); err != nil {
+        return nil, err
+    }
+    if req.Mode != "proposal" {
+        if !node.Synced() {
+            return nil, newError(codeInInitialDownload, "Kaiju is in initial sync and waiting for blocks...")
+        }
+        if len(knet.Peers().Handles()) == 0 {
+            return nil, newError(codeNotConnected, "Kaiju is not connected!")
+        }
+    }
+    r, err := node.GetBlockTemplate(req)
+    if err != nil {
+        return nil, newError(codeInvalidParameter, err.Error())
+    }
+    return r, nil
+}
+
+func submitBlock(p params) (interface{}, error) {
+    var data string
+    if err := p.get(0, &data); err != nil {
+        return nil, err
+    }
+    r, err := node.SubmitBlock(data)
+    if err == mining.ErrBlockDecode {
+        return nil, newError(codeDeserialization, "Block decode failed")
+    } else if err != nil {
+        return nil, newError(codeVerify, err.Error())
+    }
+    return r, nil
+}
@@ -0,0 +1,188 @@
+// Package rpc serves the commonly used calls of bitcoind's JSON-RPC interface
+// over HTTP, so that tools written for bitcoind work with kaiju as well.
+package rpc
+
+import (
+    "fmt"
+    "encoding/json"
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+// Error codes, the same as bitcoind's
+const (
+    codeMisc            = -1
+    codeType            = -3
+    codeNotFound        = -5
+    codeNotConnected    = -9
+    codeInInitialDownload = -10
+    codeInvalidParameter = -8
+    codeDeserialization = -22
+    codeVerify          = -25
+    codeVerifyRejected  = -26
+    codeAlreadyInChain  = -27
+    codeInvalidRequest  = -32600
+    codeMethodNotFound  = -32601
+    codeInvalidParams   = -32602
+    codeParse           = -32700
+)
+
+// Error of a call, sent back as the "error" of the response
+type Error struct {
+    Code        int         `json:"code"`
+    Message     string      `json:"message"`
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+func newError(code int, msg string) *Error {
+    return &Error{Code: code, Message: msg}
+}
+
+// Turns whatever a method returns into an *Error
+func toError(err error) *Error {
+    if e, ok := err.(*Error); ok {
+        return e
+    }
+    return newError(codeMisc, err.Error())
+}
+
+type request struct {
+    Method      string              `json:"method"`
+    Params      json.RawMessage     `json:"params"`
+    ID          json.RawMessage     `json:"id"`
+}
+
+type response struct {
+    Result      interface{}         `json:"result"`
+    Error       *Error              `json:"error"`
+    ID          json.RawMessage     `json:"id"`
+}
+
+// Positional params of a call, named ones are put in place by the
+// names a method declares
+type params []json.RawMessage
+
+// A call, the names of its params are in order
+type method struct {
+    f           func(p params) (interface{}, error)
+    names       []string
+}
+
+var methods = map[string]*method{
+    "getblockchaininfo": {getBlockchainInfo, nil},
+    "getblockhash": {getBlockHash, []string{"height"}},
+    "getblockheader": {getBlockHeader, []string{"blockhash", "verbose"}},
+    "getrawtransaction": {getRawTransaction, []string{"txid", "verbose", "blockhash"}},
+    "sendrawtransaction": {sendRawTransaction, []string{"hexstring", "maxfeerate"}},
+    "gettxout": {getTxOut, []string{"txid", "n", "include_mempool"}},
+    "getmempoolinfo": {getMempoolInfo, nil},
+    "getpeerinfo": {getPeerInfo, nil},
+    "estimatesmartfee": {estimateSmartFee, []string{"conf_target", "estimate_mode"}},
+    "getblocktemplate": {getBlockTemplate, []string{"template_request"}},
+    "submitblock": {submitBlock, []string{"hexdata", "dummy"}},
+}
+
+// Params as sent, either an array or an object of names of the method
+func (m *method) params(raw json.RawMessage) (params, error) {
+    if len(raw) == 0 || string(raw) == "null" {
+        return params{}, nil
+    }
+    var p params
+    if err := json.Unmarshal(raw, &p); err == nil {
+        return p, nil
+    }
+    var named map[string]json.RawMessage
+    if err := json.Unmarshal(raw, &named); err != nil {
+        return nil, newError(codeInvalidRequest, "Params must be an array or object")
+    }
+    p = make(params, 0, len(m.names))
+    for name, v := range named {
+        i := m.index(name)
+        if i < 0 {
+            return nil, newError(codeInvalidParameter, "Unknown named parameter " + name)
+        }
+        for len(p) <= i {
+            p = append(p, nil)
+        }
+        p[i] = v
+    }
+    return p, nil
+}
+
+func (m *method) index(name string) int {
+    for i, n := range m.names {
+        if n == name {
+            return i
+        }
+    }
+    return -1
+}
+
+// If param "i" is given
+func (p params) has(i int) bool {
+    return i < len(p) && len(p[i]) > 0 && string(p[i]) != "null"
+}
+
+// Decodes param "i" into "v", which is required
+func (p params) get(i int, v interface{}) error {
+    if !p.has(i) {
+        return newError(codeInvalidParams, fmt.Sprintf("Missing parameter %d", i + 1))
+    }
+    return p.opt(i, v)
+}
+
+// Decodes param "i" into "v" if it's given, "v" is left as it is otherwise
+func (p params) opt(i int, v interface{}) error {
+    if !p.has(i) {
+        return nil
+    }
+    if err := json.Unmarshal(p[i], v); err != nil {
+        return newError(codeType, fmt.Sprintf("Wrong type of parameter %d", i + 1))
+    }
+    return nil
+}
+
+// Decodes param "i" as a hash in hex, "name" is for the error
+func (p params) hash(i int, name string) (*klib.Hash256, error) {
+    var s string
+    if err := p.get(i, &s); err != nil {
+        return nil, err
+    }
+    h, err := new(klib.Hash256).SetString(s)
+    if err != nil {
+        return nil, newError(codeInvalidParameter, name + " must be a hexadecimal string of length 64")
+    }
+    return h, nil
+}
+
+// Decodes param "i" as a bool, which older clients send as a number,
+// "def" if it's not given
+func (p params) flag(i int, def bool) (bool, error) {
+    if !p.has(i) {
+        return def, nil
+    }
+    var b bool
+    if err := json.Unmarshal(p[i], &b); err == nil {
+        return b, nil
+    }
+    var n int
+    if err := p.opt(i, &n); err != nil {
+        return false, err
+    }
+    return n != 0, nil
+}
+
+// Amount in satoshi, shown in BTC as bitcoind does
+type amount int64
+
+const satoshiPerBTC = 100000000
+
+func (a amount) MarshalJSON() ([]byte, error) {
+    sign, v := "", int64(a)
+    if v < 0 {
+        sign, v = "-", -v
+    }
+    return []byte(fmt.Sprintf("%s%d.%08d", sign, v / satoshiPerBTC, v % satoshiPerBTC)), nil
+}
@@ -0,0 +1,180 @@
+package rpc
+
+import (
+    "os"
+    "net"
+    "time"
+    "bytes"
+    "io/ioutil"
+    "net/http"
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/hex"
+    "encoding/json"
+    "path/filepath"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/log"
+)
+
+// User name of the cookie, its password is random and changes every start
+const cookieUser = "__cookie__"
+
+// Requests larger than this are cut off
+const maxRequestSize = 1 << 25
+
+// Slows down guessing of passwords
+const authFailDelay = time.Millisecond * 250
+
+type Server struct {
+    // User and password from config, user being empty disables them
+    user        string
+    password    string
+    // Password of cookieUser
+    cookie      string
+    cookiePath  string
+    listener    net.Listener
+}
+
+func newServer(user, password string) (*Server, error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return nil, err
+    }
+    return &Server{user: user, password: password, cookie: hex.EncodeToString(b)}, nil
+}
+
+// Starts serving on the address in config, returns nil if RPC is disabled.
+// The cookie is written to its file for clients on the same machine.
+func Start() (*Server, error) {
+    cfg := kaiju.GetConfig()
+    if cfg.RPCListen == "" {
+        return nil, nil
+    }
+    s, err := newServer(cfg.RPCUser, cfg.RPCPassword)
+    if err != nil {
+        return nil, err
+    }
+    s.cookiePath = filepath.Join(kaiju.ConfigFileDir(), cfg.DataDir, cfg.RPCCookieFileName)
+    if err := ioutil.WriteFile(s.cookiePath, []byte(cookieUser + ":" + s.cookie), 0600); err != nil {
+        return nil, err
+    }
+    l, err := net.Listen("tcp", cfg.RPCListen)
+    if err != nil {
+        os.Remove(s.cookiePath)
+        return nil, err
+    }
+    s.listener = l
+    go func() {
+        err := http.Serve(l, s)
+        log.Infof("RPC server stopped: %s", err)
+    }()
+    log.Infof("RPC server listening on %s", cfg.RPCListen)
+    return s, nil
+}
+
+// Stops listening and removes the cookie file
+func (s *Server) Stop() error {
+    os.Remove(s.cookiePath)
+    return s.listener.Close()
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+    user, password, ok := r.BasicAuth()
+    if !ok {
+        return false
+    }
+    if user == cookieUser {
+        return subtle.ConstantTimeCompare([]byte(password), []byte(s.cookie)) == 1
+    }
+    return s.user != "" &&
+        subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1 &&
+        subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+        http.Error(w, "JSONRPC server handles only POST requests", http.StatusMethodNotAllowed)
+        return
+    }
+    if !s.authorized(r) {
+        log.Infof("Incorrect RPC password from %s", r.RemoteAddr)
+        time.Sleep(authFailDelay)
+        w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+        http.Error(w, "", http.StatusUnauthorized)
+        return
+    }
+    body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+    body = bytes.TrimSpace(body)
+    if len(body) > 0 && body[0] == '[' {
+        // A batch, errors are in the responses so the status is always OK
+        var reqs []json.RawMessage
+        if err := json.Unmarshal(body, &reqs); err != nil {
+            reply(w, http.StatusInternalServerError, &response{Error: newError(codeParse, "Parse error")})
+            return
+        }
+        resps := make([]*response, len(reqs))
+        for i, req := range reqs {
+            resps[i] = handle(req)
+        }
+        reply(w, http.StatusOK, resps)
+        return
+    }
+    resp := handle(body)
+    status := http.StatusOK
+    if resp.Error != nil {
+        switch resp.Error.Code {
+        case codeInvalidRequest:
+            status = http.StatusBadRequest
+        case codeMethodNotFound:
+            status = http.StatusNotFound
+        default:
+            status = http.StatusInternalServerError
+        }
+    }
+    reply(w, status, resp)
+}
+
+func reply(w http.ResponseWriter, status int, v interface{}) {
+    data, err := json.Marshal(v)
+    if err != nil {
+        log.Errorf("Failed to encode RPC response: %s", err)
+        http.Error(w, "", http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    w.Write(append(data, '\n'))
+}
+
+// Runs a single call
+func handle(raw json.RawMessage) *response {
+    var req request
+    if err := json.Unmarshal(raw, &req); err != nil {
+        if _, ok := err.(*json.SyntaxError); ok {
+            return &response{Error: newError(codeParse, "Parse error")}
+        }
+        return &response{Error: newError(codeInvalidRequest, "Invalid request object")}
+    }
+    resp := &response{ID: req.ID}
+    m, ok := methods[req.Method]
+    if !ok {
+        resp.Error = newError(codeMethodNotFound, "Method not found")
+        return resp
+    }
+    p, err := m.params(req.Params)
+    if err != nil {
+        resp.Error = toError(err)
+        return resp
+    }
+    result, err := m.f(p)
+    if err != nil {
+        resp.Error = toError(err)
+    } else {
+        resp.Result = result
+    }
+    return resp
+}
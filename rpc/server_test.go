@@ -0,0 +1,161 @@
+package rpc
+
+import (
+    "strings"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+    "encoding/json"
+)
+
+func init() {
+    // Echoes back the params, as they are put in place
+    methods["echo"] = &method{
+        f: func(p params) (interface{}, error) {
+            var a string
+            if err := p.get(0, &a); err != nil {
+                return nil, err
+            }
+            b, err := p.flag(1, false)
+            if err != nil {
+                return nil, err
+            }
+            return []interface{}{a, b}, nil
+        },
+        names: []string{"a", "b"},
+    }
+}
+
+func post(s *Server, user, password, body string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+    if user != "" {
+        r.SetBasicAuth(user, password)
+    }
+    w := httptest.NewRecorder()
+    s.ServeHTTP(w, r)
+    return w
+}
+
+func call(t *testing.T, s *Server, body string) (int, *response) {
+    w := post(s, "user", "pass", body)
+    resp := new(response)
+    if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+        t.Fatalf("Bad response to %s: %s", body, w.Body.String())
+    }
+    return w.Code, resp
+}
+
+func TestAuth(t *testing.T) {
+    s, err := newServer("user", "pass")
+    if err != nil {
+        t.Fatal(err)
+    }
+    req := `{"method":"echo","params":["x"],"id":1}`
+    tests := []struct{
+        user, password  string
+        status          int
+    }{
+        {"", "", http.StatusUnauthorized},
+        {"user", "wrong", http.StatusUnauthorized},
+        {cookieUser, "wrong", http.StatusUnauthorized},
+        {"user", "pass", http.StatusOK},
+        {cookieUser, s.cookie, http.StatusOK},
+    }
+    for _, test := range tests {
+        w := post(s, test.user, test.password, req)
+        if w.Code != test.status {
+            t.Errorf("%s:%s got status %d", test.user, test.password, w.Code)
+        }
+        if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+            t.Errorf("No WWW-Authenticate with 401")
+        }
+    }
+    // Without a user in config only the cookie works
+    s.user, s.password = "", ""
+    if w := post(s, "", "", req); w.Code != http.StatusUnauthorized {
+        t.Errorf("Empty user authorized")
+    }
+}
+
+func TestDispatch(t *testing.T) {
+    s, _ := newServer("user", "pass")
+    tests := []struct{
+        body        string
+        status      int
+        code        int
+        result      string
+    }{
+        {`{"method":"echo","params":["x", true],"id":1}`, http.StatusOK, 0, `["x",true]`},
+        {`{"method":"echo","params":["x", 1],"id":1}`, http.StatusOK, 0, `["x",true]`},
+        {`{"method":"echo","params":{"b":true,"a":"y"},"id":1}`, http.StatusOK, 0, `["y",true]`},
+        {`{"method":"echo","params":{"a":"y"},"id":1}`, http.StatusOK, 0, `["y",false]`},
+        {`{"method":"echo","params":{"c":1},"id":1}`, http.StatusInternalServerError, codeInvalidParameter, ""},
+        {`{"method":"echo","params":[],"id":1}`, http.StatusInternalServerError, codeInvalidParams, ""},
+        {`{"method":"echo","params":[1],"id":1}`, http.StatusInternalServerError, codeType, ""},
+        {`{"method":"nope","params":[],"id":1}`, http.StatusNotFound, codeMethodNotFound, ""},
+        {`{"method":`, http.StatusInternalServerError, codeParse, ""},
+        {`{"method":"echo","params":"x","id":1}`, http.StatusBadRequest, codeInvalidRequest, ""},
+    }
+    for _, test := range tests {
+        status, resp := call(t, s, test.body)
+        if status != test.status {
+            t.Errorf("%s got status %d", test.body, status)
+        }
+        if test.code != 0 {
+            if resp.Error == nil || resp.Error.Code != test.code {
+                t.Errorf("%s got error %v", test.body, resp.Error)
+            }
+            continue
+        }
+        result, _ := json.Marshal(resp.Result)
+        if resp.Error != nil || string(result) != test.result || string(resp.ID) != "1" {
+            t.Errorf("%s got %s %v", test.body, result, resp.Error)
+        }
+    }
+}
+
+func TestBatch(t *testing.T) {
+    s, _ := newServer("user", "pass")
+    w := post(s, "user", "pass", `[{"method":"echo","params":["x"],"id":1},{"method":"nope","id":"2"}]`)
+    if w.Code != http.StatusOK {
+        t.Errorf("Batch got status %d", w.Code)
+    }
+    var resps []*response
+    if err := json.Unmarshal(w.Body.Bytes(), &resps); err != nil || len(resps) != 2 {
+        t.Fatalf("Bad batch response: %s", w.Body.String())
+    }
+    if resps[0].Error != nil || string(resps[0].ID) != "1" {
+        t.Errorf("First call got %+v", resps[0])
+    }
+    if resps[1].Error == nil || resps[1].Error.Code != codeMethodNotFound || string(resps[1].ID) != `"2"` {
+        t.Errorf("Second call got %+v", resps[1])
+    }
+}
+
+func TestAmount(t *testing.T) {
+    tests := []struct{
+        a       amount
+        s       string
+    }{
+        {0, "0.00000000"},
+        {1, "0.00000001"},
+        {100000000, "1.00000000"},
+        {2100000000000000, "21000000.00000000"},
+        {-150000000, "-1.50000000"},
+    }
+    for _, test := range tests {
+        if b, _ := json.Marshal(test.a); string(b) != test.s {
+            t.Errorf("Amount %d shown as %s", test.a, b)
+        }
+    }
+}
+
+func TestDifficulty(t *testing.T) {
+    if d := difficulty(0x1d00ffff); d != 1 {
+        t.Errorf("Difficulty of genesis is %f", d)
+    }
+    // Block 100000
+    if d := difficulty(0x1b04864c); d < 14484.16 || d > 14484.17 {
+        t.Errorf("Difficulty of block 100000 is %f", d)
+    }
+}
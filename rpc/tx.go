@@ -0,0 +1,266 @@
+package rpc
+
+import (
+    "math"
+    "encoding/hex"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/klib/address"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/catma/script"
+    "github.com/oxfeeefeee/kaiju/catma/numbers"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/node"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+    "github.com/oxfeeefeee/kaiju/blockchain/storage"
+)
+
+type scriptSig struct {
+    Asm         string      `json:"asm"`
+    Hex         string      `json:"hex"`
+}
+
+type scriptPubKey struct {
+    Asm         string      `json:"asm"`
+    Hex         string      `json:"hex"`
+    Address     string      `json:"address,omitempty"`
+    Type        string      `json:"type"`
+}
+
+type txIn struct {
+    Coinbase    string      `json:"coinbase,omitempty"`
+    TxID        string      `json:"txid,omitempty"`
+    Vout        *uint32     `json:"vout,omitempty"`
+    ScriptSig   *scriptSig  `json:"scriptSig,omitempty"`
+    Witness     []string    `json:"txinwitness,omitempty"`
+    Sequence    uint32      `json:"sequence"`
+}
+
+type txOut struct {
+    Value       amount          `json:"value"`
+    N           int             `json:"n"`
+    ScriptPubKey *scriptPubKey  `json:"scriptPubKey"`
+}
+
+type rawTx struct {
+    Hex         string      `json:"hex"`
+    TxID        string      `json:"txid"`
+    Hash        string      `json:"hash"`
+    Size        int         `json:"size"`
+    VSize       int         `json:"vsize"`
+    Weight      int         `json:"weight"`
+    Version     uint32      `json:"version"`
+    LockTime    uint32      `json:"locktime"`
+    Vin         []*txIn     `json:"vin"`
+    Vout        []*txOut    `json:"vout"`
+    BlockHash   string      `json:"blockhash,omitempty"`
+    Confirmations int       `json:"confirmations,omitempty"`
+    Time        uint32      `json:"time,omitempty"`
+    BlockTime   uint32      `json:"blocktime,omitempty"`
+}
+
+type utxo struct {
+    BestBlock   string          `json:"bestblock"`
+    Confirmations int           `json:"confirmations"`
+    Value       amount          `json:"value"`
+    ScriptPubKey *scriptPubKey  `json:"scriptPubKey"`
+    Coinbase    bool            `json:"coinbase"`
+}
+
+// Names of script types in bitcoind
+var scriptTypeNames = map[script.PKScriptType]string{
+    script.PKS_NonStandard: "nonstandard",
+    script.PKS_PubKey: "pubkey",
+    script.PKS_PubKeyHash: "pubkeyhash",
+    script.PKS_ScriptHash: "scripthash",
+    script.PKS_MultiSig: "multisig",
+    script.PKS_NullData: "nulldata",
+    script.PKS_WitnessPubKeyHash: "witness_v0_keyhash",
+    script.PKS_WitnessScriptHash: "witness_v0_scripthash",
+    script.PKS_WitnessTaproot: "witness_v1_taproot",
+    script.PKS_WitnessUnknown: "witness_unknown",
+}
+
+func newScriptPubKey(pkScript []byte) *scriptPubKey {
+    s := script.Script(pkScript)
+    r := &scriptPubKey{
+        Asm: script.Disassemble(s),
+        Hex: hex.EncodeToString(pkScript),
+        Type: scriptTypeNames[s.PKScriptType()],
+    }
+    if addr, err := s.Address(address.MainNet); err == nil {
+        r.Address = addr
+    }
+    return r
+}
+
+func newRawTx(tx *catma.Tx) *rawTx {
+    data := tx.WitnessBytes()
+    r := &rawTx{
+        Hex: hex.EncodeToString(data),
+        TxID: tx.Hash().String(),
+        Hash: tx.WitnessHash().String(),
+        Size: len(data),
+        VSize: tx.VirtualSize(),
+        Weight: tx.Weight(),
+        Version: tx.Version,
+        LockTime: tx.LockTime,
+        Vin: make([]*txIn, len(tx.TxIns)),
+        Vout: make([]*txOut, len(tx.TxOuts)),
+    }
+    coinBase := tx.IsCoinBase()
+    for i, in := range tx.TxIns {
+        vin := &txIn{Sequence: in.Sequence}
+        if coinBase {
+            vin.Coinbase = hex.EncodeToString(in.SigScript)
+        } else {
+            index := in.PreviousOutput.Index
+            vin.TxID = in.PreviousOutput.Hash.String()
+            vin.Vout = &index
+            vin.ScriptSig = &scriptSig{
+                Asm: script.Disassemble(script.Script(in.SigScript)),
+                Hex: hex.EncodeToString(in.SigScript),
+            }
+        }
+        for _, item := range in.Witness {
+            vin.Witness = append(vin.Witness, hex.EncodeToString(item))
+        }
+        r.Vin[i] = vin
+    }
+    for i, out := range tx.TxOuts {
+        r.Vout[i] = &txOut{Value: amount(out.Value), N: i, ScriptPubKey: newScriptPubKey(out.PKScript)}
+    }
+    return r
+}
+
+// Only txs in mempool or in the few recent blocks kept in memory are found
+func getRawTransaction(p params) (interface{}, error) {
+    hash, err := p.hash(0, "txid")
+    if err != nil {
+        return nil, err
+    }
+    verbose, err := p.flag(1, false)
+    if err != nil {
+        return nil, err
+    }
+    var blockHash *klib.Hash256
+    if p.has(2) {
+        if blockHash, err = p.hash(2, "blockhash"); err != nil {
+            return nil, err
+        }
+    }
+    tx, h := node.FindTx(hash)
+    if tx == nil || (blockHash != nil && (h == nil || *h.Hash() != *blockHash)) {
+        if blockHash != nil {
+            return nil, newError(codeNotFound, "No such transaction found in the provided block")
+        }
+        return nil, newError(codeNotFound, "No such mempool or blockchain transaction")
+    }
+    if !verbose {
+        return hex.EncodeToString(tx.WitnessBytes()), nil
+    }
+    r := newRawTx(tx)
+    if h != nil {
+        headers := storage.Get().Headers()
+        r.BlockHash = h.Hash().String()
+        if height, ok := headers.Height(h.Hash()); ok {
+            _, top := node.BestBlock()
+            r.Confirmations = top - height + 1
+        }
+        r.Time = h.Timestamp
+        r.BlockTime = h.Timestamp
+    }
+    return r, nil
+}
+
+// Default "maxfeerate" of sendrawtransaction, 0.10 BTC/kvB
+const defaultMaxFeeRate = satoshiPerBTC / 10
+
+// "maxfeerate" is in BTC/kvB, 0 means no limit
+func sendRawTransaction(p params) (interface{}, error) {
+    var data string
+    if err := p.get(0, &data); err != nil {
+        return nil, err
+    }
+    maxFeeRate := float64(defaultMaxFeeRate) / satoshiPerBTC
+    if err := p.opt(1, &maxFeeRate); err != nil {
+        return nil, err
+    }
+    if maxFeeRate < 0 || maxFeeRate * satoshiPerBTC > numbers.SatoshiInTotal {
+        return nil, newError(codeType, "Amount out of range")
+    }
+    raw, err := hex.DecodeString(data)
+    if err != nil {
+        return nil, newError(codeDeserialization, "TX decode failed")
+    }
+    m := btcmsg.NewTxMsg().(*btcmsg.Message_tx)
+    if err := m.Decode(raw); err != nil {
+        return nil, newError(codeDeserialization, "TX decode failed")
+    }
+    tx := (*catma.Tx)(&m.Content)
+    if len(tx.WitnessBytes()) != len(raw) {
+        // Trailing data
+        return nil, newError(codeDeserialization, "TX decode failed")
+    }
+    hash := tx.Hash()
+    if node.Mempool().Has(hash) {
+        return hash.String(), nil
+    }
+    if _, err := node.SendTx(tx, int64(math.Round(maxFeeRate * satoshiPerBTC))); err != nil {
+        if err == mempool.ErrMaxFeeExceeded {
+            return nil, newError(codeVerifyRejected, "max-fee-exceeded")
+        } else if err == mempool.ErrMissingInputs {
+            if _, err := storage.Get().OutputDB().Get(hash, 0); err == nil {
+                return nil, newError(codeAlreadyInChain, "Transaction already in block chain")
+            }
+            return nil, newError(codeVerify, "bad-txns-inputs-missingorspent")
+        }
+        return nil, newError(codeVerifyRejected, err.Error())
+    }
+    return hash.String(), nil
+}
+
+func getTxOut(p params) (interface{}, error) {
+    hash, err := p.hash(0, "txid")
+    if err != nil {
+        return nil, err
+    }
+    var n uint32
+    if err := p.get(1, &n); err != nil {
+        return nil, err
+    }
+    includeMempool, err := p.flag(2, true)
+    if err != nil {
+        return nil, err
+    }
+    best, top := node.BestBlock()
+    pool := node.Mempool()
+    if includeMempool {
+        if pool.Spender(&catma.OutPoint{Hash: *hash, Index: n}) != nil {
+            return nil, nil
+        }
+        if d := pool.Get(hash); d != nil {
+            if int(n) >= len(d.Tx.TxOuts) {
+                return nil, nil
+            }
+            out := d.Tx.TxOuts[n]
+            return &utxo{
+                BestBlock: best.String(),
+                Value: amount(out.Value),
+                ScriptPubKey: newScriptPubKey(out.PKScript),
+            }, nil
+        }
+    }
+    e, err := storage.Get().OutputDB().Get(hash, n)
+    if err == catma.ErrUtxoNotFound {
+        return nil, nil
+    } else if err != nil {
+        return nil, err
+    }
+    return &utxo{
+        BestBlock: best.String(),
+        Confirmations: top - int(e.Height) + 1,
+        Value: amount(e.Value),
+        ScriptPubKey: newScriptPubKey(e.PKScript),
+        Coinbase: e.CoinBase,
+    }, nil
+}
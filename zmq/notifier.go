@@ -0,0 +1,205 @@
+// Package zmq publishes notifications of blocks and txs the way bitcoind's
+// zmq interface does, speaking ZMTP 3 on its own so libzmq isn't needed.
+// SUB sockets of any zmq binding connect to it and subscribe to topics.
+//
+// Messages have three frames: the topic, the body, and a sequence number of
+// the topic as 4 bytes little endian, starting at 0. Bodies by topic:
+//  - "hashblock": hash of a block connected, 32 bytes in the order it's shown
+//  - "hashtx": hash of a tx entering mempool or in a block connected, the same
+//  - "rawblock": the serialized block
+//  - "rawtx": the serialized tx, with witness
+//  - "sequence": a block or tx hash, then one byte of what happened: 'C' block
+//    connected, 'D' block disconnected, 'A' tx added to mempool, 'R' tx removed
+//    from mempool other than by a block. 'A' and 'R' are followed by 8 bytes
+//    little endian of a counter of mempool changes.
+package zmq
+
+import (
+    "os"
+    "errors"
+    "strings"
+    "encoding/binary"
+    "github.com/oxfeeefeee/kaiju"
+    "github.com/oxfeeefeee/kaiju/log"
+    "github.com/oxfeeefeee/kaiju/klib"
+    "github.com/oxfeeefeee/kaiju/catma"
+    "github.com/oxfeeefeee/kaiju/mempool"
+    "github.com/oxfeeefeee/kaiju/node"
+    "github.com/oxfeeefeee/kaiju/node/event"
+    "github.com/oxfeeefeee/kaiju/knet/btcmsg"
+)
+
+const (
+    TopicHashBlock  = "hashblock"
+    TopicHashTx     = "hashtx"
+    TopicRawBlock   = "rawblock"
+    TopicRawTx      = "rawtx"
+    TopicSequence   = "sequence"
+)
+
+// Events waiting to be published, blocks connected by catching up come
+// faster than anyone could take them
+const eventQueueSize = 1000
+
+var errBadAddr = errors.New("zmq.Start: address must be tcp://host:port or ipc://path")
+
+// Publishes events of the node
+type Notifier struct {
+    pub         *publisher
+    sub         *event.Subscription
+    // Sequence numbers of messages, by topic
+    seqs        map[string]uint32
+    // Counter of txs added to and removed from mempool
+    mempoolSeq  uint64
+}
+
+// Starts publishing on the address in config, returns nil if it's disabled
+func Start() (*Notifier, error) {
+    addr := kaiju.GetConfig().ZMQListen
+    if addr == "" {
+        return nil, nil
+    }
+    network, address, err := parseAddr(addr)
+    if err != nil {
+        return nil, err
+    }
+    if network == "unix" {
+        // Left by a run that didn't clean up
+        if fi, err := os.Lstat(address); err == nil && fi.Mode() & os.ModeSocket != 0 {
+            os.Remove(address)
+        }
+    }
+    pub, err := listen(network, address)
+    if err != nil {
+        return nil, err
+    }
+    types := event.TypeBlockConnected | event.TypeBlockDisconnected |
+        event.TypeTxAcceptedToMempool | event.TypeTxRemovedFromMempool
+    n := &Notifier{
+        pub: pub,
+        sub: node.Subscribe(types, eventQueueSize, event.DropNewest),
+        seqs: make(map[string]uint32),
+    }
+    go n.run()
+    log.Infof("ZMQ notifications published on %s", addr)
+    return n, nil
+}
+
+// Addresses as zmq takes them, "*" being any interface
+func parseAddr(addr string) (string, string, error) {
+    switch {
+    case strings.HasPrefix(addr, "tcp://"):
+        a := strings.TrimPrefix(addr, "tcp://")
+        if strings.HasPrefix(a, "*:") {
+            a = a[1:]
+        }
+        return "tcp", a, nil
+    case strings.HasPrefix(addr, "ipc://") && len(addr) > len("ipc://"):
+        return "unix", strings.TrimPrefix(addr, "ipc://"), nil
+    }
+    return "", "", errBadAddr
+}
+
+func (n *Notifier) Stop() error {
+    n.sub.Cancel()
+    return n.pub.close()
+}
+
+func (n *Notifier) run() {
+    for e := range n.sub.Events() {
+        switch e := e.(type) {
+        case *event.BlockConnected:
+            n.blockConnected(e)
+        case *event.BlockDisconnected:
+            n.send(TopicSequence, func() []byte {
+                return sequenceBody(e.Header.Hash(), 'D', nil)
+            })
+        case *event.TxAcceptedToMempool:
+            n.txAdded(e.Tx, &e.Hash)
+            n.mempoolSeq++
+            n.send(TopicSequence, func() []byte {
+                return sequenceBody(&e.Hash, 'A', &n.mempoolSeq)
+            })
+        case *event.TxRemovedFromMempool:
+            if e.Reason == mempool.RemovedConfirmed {
+                // Told by the block
+                continue
+            }
+            n.mempoolSeq++
+            n.send(TopicSequence, func() []byte {
+                return sequenceBody(&e.Hash, 'R', &n.mempoolSeq)
+            })
+        }
+    }
+}
+
+func (n *Notifier) blockConnected(e *event.BlockConnected) {
+    for _, tx := range e.Txs {
+        n.txAdded(tx, nil)
+    }
+    hash := e.Header.Hash()
+    n.send(TopicHashBlock, func() []byte {
+        return reversed(hash)
+    })
+    n.send(TopicRawBlock, func() []byte {
+        m := &btcmsg.Message_block{Header: e.Header, Txs: make([]*btcmsg.Tx, len(e.Txs))}
+        for i, tx := range e.Txs {
+            m.Txs[i] = (*btcmsg.Tx)(tx)
+        }
+        data, err := m.Encode()
+        if err != nil {
+            log.Errorf("Failed to encode block %s: %s", hash, err)
+        }
+        return data
+    })
+    n.send(TopicSequence, func() []byte {
+        return sequenceBody(hash, 'C', nil)
+    })
+}
+
+// "hashtx" and "rawtx" of a tx, "hash" is computed if it's nil
+func (n *Notifier) txAdded(tx *catma.Tx, hash *klib.Hash256) {
+    n.send(TopicHashTx, func() []byte {
+        if hash == nil {
+            hash = tx.Hash()
+        }
+        return reversed(hash)
+    })
+    n.send(TopicRawTx, func() []byte {
+        return tx.WitnessBytes()
+    })
+}
+
+// Publishes the body built by "f" if anyone subscribes to "topic"
+func (n *Notifier) send(topic string, f func() []byte) {
+    if !n.pub.wants(topic) {
+        return
+    }
+    body := f()
+    if body == nil {
+        return
+    }
+    seq := make([]byte, 4)
+    binary.LittleEndian.PutUint32(seq, n.seqs[topic])
+    n.seqs[topic]++
+    n.pub.publish([][]byte{[]byte(topic), body, seq})
+}
+
+// Hash in the order it's shown, as bitcoind sends it
+func reversed(hash *klib.Hash256) []byte {
+    b := make([]byte, 32)
+    for i := 0; i < 32; i++ {
+        b[i] = hash[31 - i]
+    }
+    return b
+}
+
+func sequenceBody(hash *klib.Hash256, label byte, mempoolSeq *uint64) []byte {
+    b := append(reversed(hash), label)
+    if mempoolSeq != nil {
+        seq := make([]byte, 8)
+        binary.LittleEndian.PutUint64(seq, *mempoolSeq)
+        b = append(b, seq...)
+    }
+    return b
+}
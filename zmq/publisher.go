@@ -0,0 +1,234 @@
+package zmq
+
+import (
+    "net"
+    "time"
+    "sync"
+    "bufio"
+    "bytes"
+    "errors"
+    "strings"
+    "github.com/oxfeeefeee/kaiju/log"
+)
+
+// Messages queued for a subscriber, more are dropped as zmq does at its
+// high water mark
+const sendQueueSize = 1000
+
+// Time for a subscriber to finish the greeting and READY
+const handshakeTimeout = time.Second * 10
+
+var errNotSub = errors.New("publisher.handshake: peer is not a SUB socket")
+
+// A connected SUB socket
+type subscriber struct {
+    conn        net.Conn
+    r           *bufio.Reader
+    w           *bufio.Writer
+    // Serializes writing of messages and PONGs
+    wmutex      sync.Mutex
+    // Prefixes of topics subscribed, counted as zmq does
+    topics      map[string]int
+    tmutex      sync.RWMutex
+    queue       chan [][]byte
+}
+
+func (s *subscriber) wants(topic []byte) bool {
+    s.tmutex.RLock()
+    defer s.tmutex.RUnlock()
+    for prefix, _ := range s.topics {
+        if bytes.HasPrefix(topic, []byte(prefix)) {
+            return true
+        }
+    }
+    return false
+}
+
+func (s *subscriber) subscribe(topic []byte, on bool) {
+    s.tmutex.Lock()
+    defer s.tmutex.Unlock()
+    t := string(topic)
+    if on {
+        s.topics[t]++
+    } else if s.topics[t] > 1 {
+        s.topics[t]--
+    } else {
+        delete(s.topics, t)
+    }
+}
+
+func (s *subscriber) write(frames [][]byte, flags byte) error {
+    s.wmutex.Lock()
+    defer s.wmutex.Unlock()
+    if flags & flagCommand != 0 {
+        if err := writeFrame(s.w, flags, frames[0]); err != nil {
+            return err
+        }
+        return s.w.Flush()
+    }
+    return writeMsg(s.w, frames)
+}
+
+// Sends queued messages until the queue is closed
+func (s *subscriber) send() {
+    for frames := range s.queue {
+        if err := s.write(frames, 0); err != nil {
+            // The reading side finds out and cleans up
+            s.conn.Close()
+        }
+    }
+}
+
+// Greets the peer and exchanges READY, which says it's a SUB socket
+func (s *subscriber) handshake() error {
+    s.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+    defer s.conn.SetDeadline(time.Time{})
+    s.w.Write(greeting())
+    if err := s.write([][]byte{readyCommand("PUB")}, flagCommand); err != nil {
+        return err
+    }
+    if err := readGreeting(s.r); err != nil {
+        return err
+    }
+    flags, body, err := readFrame(s.r)
+    if err != nil {
+        return err
+    }
+    name, data, err := parseCommand(body)
+    if err != nil || flags & flagCommand == 0 || name != "READY" {
+        return errBadCommand
+    }
+    props, err := parseProps(data)
+    if err != nil {
+        return err
+    }
+    if t := strings.ToUpper(props["socket-type"]); t != "SUB" && t != "XSUB" {
+        return errNotSub
+    }
+    return nil
+}
+
+// Reads subscriptions, as messages of ZMTP 3.0 or commands of 3.1, and
+// answers pings until the connection is gone
+func (s *subscriber) read() error {
+    for {
+        flags, body, err := readFrame(s.r)
+        if err != nil {
+            return err
+        }
+        if flags & flagCommand == 0 {
+            if len(body) > 0 && (body[0] == 0 || body[0] == 1) {
+                s.subscribe(body[1:], body[0] == 1)
+            }
+            continue
+        }
+        name, data, err := parseCommand(body)
+        if err != nil {
+            return err
+        }
+        switch name {
+        case "SUBSCRIBE":
+            s.subscribe(data, true)
+        case "CANCEL":
+            s.subscribe(data, false)
+        case "PING":
+            // TTL then the context to send back
+            if len(data) >= 2 {
+                s.write([][]byte{command("PONG", data[2:])}, flagCommand)
+            }
+        }
+    }
+}
+
+// The PUB socket, messages go to the subscribers of their topics, i.e. the
+// first frames
+type publisher struct {
+    listener    net.Listener
+    subs        map[*subscriber]bool
+    mutex       sync.RWMutex
+}
+
+// Listens on "network" of "tcp" or "unix"
+func listen(network, addr string) (*publisher, error) {
+    l, err := net.Listen(network, addr)
+    if err != nil {
+        return nil, err
+    }
+    p := &publisher{listener: l, subs: make(map[*subscriber]bool)}
+    go p.accept()
+    return p, nil
+}
+
+func (p *publisher) accept() {
+    for {
+        conn, err := p.listener.Accept()
+        if err != nil {
+            log.Infof("ZMQ publisher stopped: %s", err)
+            return
+        }
+        go p.serve(conn)
+    }
+}
+
+func (p *publisher) serve(conn net.Conn) {
+    defer conn.Close()
+    s := &subscriber{
+        conn: conn,
+        r: bufio.NewReader(conn),
+        w: bufio.NewWriter(conn),
+        topics: make(map[string]int),
+        queue: make(chan [][]byte, sendQueueSize),
+    }
+    if err := s.handshake(); err != nil {
+        log.Debugf("ZMQ handshake with %s failed: %s", conn.RemoteAddr(), err)
+        return
+    }
+    p.mutex.Lock()
+    p.subs[s] = true
+    p.mutex.Unlock()
+    go s.send()
+    err := s.read()
+    log.Debugf("ZMQ subscriber %s gone: %s", conn.RemoteAddr(), err)
+    p.mutex.Lock()
+    delete(p.subs, s)
+    close(s.queue)
+    p.mutex.Unlock()
+}
+
+// If anyone subscribes to "topic", so that messages nobody wants are not built
+func (p *publisher) wants(topic string) bool {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    for s, _ := range p.subs {
+        if s.wants([]byte(topic)) {
+            return true
+        }
+    }
+    return false
+}
+
+// Queues the message for the subscribers of its topic, never blocks
+func (p *publisher) publish(frames [][]byte) {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    for s, _ := range p.subs {
+        if !s.wants(frames[0]) {
+            continue
+        }
+        select {
+        case s.queue <- frames:
+        default:
+        }
+    }
+}
+
+// Stops listening and drops the subscribers
+func (p *publisher) close() error {
+    err := p.listener.Close()
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    for s, _ := range p.subs {
+        s.conn.Close()
+    }
+    return err
+}
@@ -0,0 +1,184 @@
+package zmq
+
+import (
+    "io"
+    "net"
+    "time"
+    "bufio"
+    "bytes"
+    "testing"
+    "path/filepath"
+    "io/ioutil"
+    "github.com/oxfeeefeee/kaiju/klib"
+)
+
+// A SUB socket, as a zmq binding would connect
+type testSub struct {
+    conn    net.Conn
+    r       *bufio.Reader
+    w       *bufio.Writer
+}
+
+func dialSub(t *testing.T, network, addr, socketType string) *testSub {
+    conn, err := net.Dial(network, addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    conn.SetDeadline(time.Now().Add(time.Second * 5))
+    s := &testSub{conn, bufio.NewReader(conn), bufio.NewWriter(conn)}
+    s.w.Write(greeting())
+    writeFrame(s.w, flagCommand, readyCommand(socketType))
+    s.w.Flush()
+    if err := readGreeting(s.r); err != nil {
+        t.Fatal(err)
+    }
+    flags, body, err := readFrame(s.r)
+    if err != nil || flags & flagCommand == 0 {
+        t.Fatalf("No READY from publisher: %v", err)
+    }
+    name, data, _ := parseCommand(body)
+    props, _ := parseProps(data)
+    if name != "READY" || props["socket-type"] != "PUB" {
+        t.Fatalf("Bad READY from publisher: %s %v", name, props)
+    }
+    return s
+}
+
+func (s *testSub) send(flags byte, body []byte) {
+    writeFrame(s.w, flags, body)
+    s.w.Flush()
+}
+
+func (s *testSub) readMsg(t *testing.T) [][]byte {
+    frames := make([][]byte, 0)
+    for {
+        flags, body, err := readFrame(s.r)
+        if err != nil {
+            t.Fatalf("Failed to read message: %s", err)
+        }
+        frames = append(frames, body)
+        if flags & flagMore == 0 {
+            return frames
+        }
+    }
+}
+
+// Waits for subscriptions to reach the publisher
+func waitFor(t *testing.T, f func() bool) {
+    for i := 0; i < 200; i++ {
+        if f() {
+            return
+        }
+        time.Sleep(time.Millisecond * 10)
+    }
+    t.Fatalf("Timed out")
+}
+
+func TestPublish(t *testing.T) {
+    p, err := listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer p.close()
+    s := dialSub(t, "tcp", p.listener.Addr().String(), "SUB")
+    // ZMTP 3.0 subscription, and 3.1 command
+    s.send(0, append([]byte{1}, "hash"...))
+    s.send(flagCommand, command("SUBSCRIBE", []byte("rawtx")))
+    waitFor(t, func() bool { return p.wants("hashtx") && p.wants("rawtx") })
+    if p.wants("rawblock") || p.wants("sequence") {
+        t.Errorf("Wants topics not subscribed")
+    }
+
+    s.send(flagCommand, command("PING", []byte{0, 10, 'c', 't', 'x'}))
+    flags, body, err := readFrame(s.r)
+    if name, data, _ := parseCommand(body); err != nil || flags & flagCommand == 0 ||
+        name != "PONG" || string(data) != "ctx" {
+        t.Errorf("Bad PONG %s %v", body, err)
+    }
+
+    long := bytes.Repeat([]byte{7}, 1000)
+    p.publish([][]byte{[]byte("rawblock"), []byte("x")})
+    p.publish([][]byte{[]byte("hashblock"), []byte("block"), {0, 0, 0, 0}})
+    p.publish([][]byte{[]byte("rawtx"), long, {1, 0, 0, 0}})
+    m := s.readMsg(t)
+    if len(m) != 3 || string(m[0]) != "hashblock" || string(m[1]) != "block" {
+        t.Errorf("Bad first message %q", m)
+    }
+    m = s.readMsg(t)
+    if len(m) != 3 || string(m[0]) != "rawtx" || !bytes.Equal(m[1], long) {
+        t.Errorf("Bad second message %q", m)
+    }
+
+    s.send(flagCommand, command("CANCEL", []byte("rawtx")))
+    waitFor(t, func() bool { return !p.wants("rawtx") })
+}
+
+func TestUnixSocket(t *testing.T) {
+    dir, err := ioutil.TempDir("", "zmq")
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(dir, "sock")
+    p, err := listen("unix", path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer p.close()
+    s := dialSub(t, "unix", path, "XSUB")
+    s.send(0, []byte{1})
+    waitFor(t, func() bool { return p.wants("sequence") })
+    // Subscribed twice, cancelled once
+    s.send(0, []byte{1})
+    s.send(0, []byte{0})
+    p.publish([][]byte{[]byte("sequence"), []byte("seq")})
+    if m := s.readMsg(t); len(m) != 2 || string(m[1]) != "seq" {
+        t.Errorf("Bad message %q", m)
+    }
+    s.send(0, []byte{0})
+    waitFor(t, func() bool { return !p.wants("sequence") })
+}
+
+func TestNotSub(t *testing.T) {
+    p, err := listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer p.close()
+    s := dialSub(t, "tcp", p.listener.Addr().String(), "PUB")
+    if _, _, err := readFrame(s.r); err != io.EOF {
+        t.Errorf("PUB peer not dropped: %v", err)
+    }
+}
+
+func TestMessageBodies(t *testing.T) {
+    hash, _ := new(klib.Hash256).SetString("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f")
+    if b := reversed(hash); b[0] != 0 || b[31] != 0x6f {
+        t.Errorf("Hash not in shown order: %x", b)
+    }
+    seq := uint64(0x0102)
+    b := sequenceBody(hash, 'A', &seq)
+    if len(b) != 41 || b[32] != 'A' || b[33] != 2 || b[34] != 1 {
+        t.Errorf("Bad sequence body %x", b)
+    }
+    if b := sequenceBody(hash, 'C', nil); len(b) != 33 || b[32] != 'C' {
+        t.Errorf("Bad sequence body %x", b)
+    }
+}
+
+func TestParseAddr(t *testing.T) {
+    tests := []struct{
+        addr, network, address  string
+    }{
+        {"tcp://127.0.0.1:28332", "tcp", "127.0.0.1:28332"},
+        {"tcp://*:28332", "tcp", ":28332"},
+        {"ipc:///tmp/kaiju.sock", "unix", "/tmp/kaiju.sock"},
+        {"ipc://", "", ""},
+        {"127.0.0.1:28332", "", ""},
+    }
+    for _, test := range tests {
+        network, address, err := parseAddr(test.addr)
+        if network != test.network || address != test.address || (err != nil) != (network == "") {
+            t.Errorf("%s parsed as %s %s %v", test.addr, network, address, err)
+        }
+    }
+}
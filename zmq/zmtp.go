@@ -0,0 +1,153 @@
+package zmq
+
+import (
+    "io"
+    "bufio"
+    "bytes"
+    "errors"
+    "encoding/binary"
+)
+
+// Flags of a frame
+const (
+    flagMore    = 0x01
+    flagLong    = 0x02
+    flagCommand = 0x04
+)
+
+// Largest frame taken from subscribers, which send nothing but subscriptions
+const maxInFrameSize = 1 << 16
+
+var (
+    errBadGreeting = errors.New("readGreeting: not a ZMTP 3 peer")
+
+    errBadMechanism = errors.New("readGreeting: security mechanism other than NULL")
+
+    errFrameTooLarge = errors.New("readFrame: frame too large")
+
+    errBadCommand = errors.New("parseCommand: malformed command")
+)
+
+// ZMTP 3.1 greeting with the NULL mechanism, as server or not doesn't
+// matter for NULL
+func greeting() []byte {
+    g := make([]byte, 64)
+    g[0] = 0xff
+    g[9] = 0x7f
+    g[10], g[11] = 3, 1
+    copy(g[12:32], "NULL")
+    return g
+}
+
+func readGreeting(r io.Reader) error {
+    g := make([]byte, 64)
+    if _, err := io.ReadFull(r, g); err != nil {
+        return err
+    }
+    if g[0] != 0xff || g[9] & 0x01 == 0 || g[10] < 3 {
+        return errBadGreeting
+    }
+    if string(bytes.TrimRight(g[12:32], "\x00")) != "NULL" {
+        return errBadMechanism
+    }
+    return nil
+}
+
+// Frames are a flags byte, the size in one byte or eight for long ones,
+// then the body
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+    var head []byte
+    if len(body) > 255 {
+        head = make([]byte, 9)
+        head[0] = flags | flagLong
+        binary.BigEndian.PutUint64(head[1:], uint64(len(body)))
+    } else {
+        head = []byte{flags, byte(len(body))}
+    }
+    if _, err := w.Write(head); err != nil {
+        return err
+    }
+    _, err := w.Write(body)
+    return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+    head := make([]byte, 2)
+    if _, err := io.ReadFull(r, head); err != nil {
+        return 0, nil, err
+    }
+    flags, size := head[0], uint64(head[1])
+    if flags & flagLong != 0 {
+        long := make([]byte, 8)
+        long[0] = head[1]
+        if _, err := io.ReadFull(r, long[1:]); err != nil {
+            return 0, nil, err
+        }
+        size = binary.BigEndian.Uint64(long)
+    }
+    if size > maxInFrameSize {
+        return 0, nil, errFrameTooLarge
+    }
+    body := make([]byte, size)
+    if _, err := io.ReadFull(r, body); err != nil {
+        return 0, nil, err
+    }
+    return flags, body, nil
+}
+
+// Writes frames of a message and flushes them
+func writeMsg(w *bufio.Writer, frames [][]byte) error {
+    for i, f := range frames {
+        var flags byte
+        if i < len(frames) - 1 {
+            flags = flagMore
+        }
+        if err := writeFrame(w, flags, f); err != nil {
+            return err
+        }
+    }
+    return w.Flush()
+}
+
+// Body of a command frame: size of the name, the name, then data
+func command(name string, data []byte) []byte {
+    return append(append([]byte{byte(len(name))}, name...), data...)
+}
+
+func parseCommand(body []byte) (string, []byte, error) {
+    if len(body) == 0 || len(body) < 1 + int(body[0]) {
+        return "", nil, errBadCommand
+    }
+    n := 1 + int(body[0])
+    return string(body[1:n]), body[n:], nil
+}
+
+// READY command with the socket type as its only property
+func readyCommand(socketType string) []byte {
+    prop := []byte{byte(len("Socket-Type"))}
+    prop = append(prop, "Socket-Type"...)
+    size := make([]byte, 4)
+    binary.BigEndian.PutUint32(size, uint32(len(socketType)))
+    prop = append(append(prop, size...), socketType...)
+    return command("READY", prop)
+}
+
+// Properties of READY, names are case insensitive so they are lower cased
+func parseProps(data []byte) (map[string]string, error) {
+    props := make(map[string]string)
+    for len(data) > 0 {
+        n := 1 + int(data[0])
+        if len(data) < n + 4 {
+            return nil, errBadCommand
+        }
+        name := string(bytes.ToLower(data[1:n]))
+        size := int(binary.BigEndian.Uint32(data[n:n + 4]))
+        data = data[n + 4:]
+        if size < 0 || len(data) < size {
+            return nil, errBadCommand
+        }
+        props[name] = string(data[:size])
+        data = data[size:]
+    }
+    return props, nil
+}